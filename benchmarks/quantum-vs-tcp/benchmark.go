@@ -22,6 +22,7 @@ type BenchmarkConfig struct {
 	PacketLoss   float64       // 丢包率（0-1）
 	RTT          time.Duration // 往返延迟
 	OutputFormat string        // 输出格式：text, json, csv
+	Congestion   string        // 拥塞控制算法：bbr, bbr2, cubic
 }
 
 // 测试结果
@@ -74,6 +75,7 @@ func parseFlags() *BenchmarkConfig {
 	flag.Float64Var(&config.PacketLoss, "loss", 0.0, "Packet loss rate (0-1)")
 	flag.DurationVar(&config.RTT, "rtt", 10*time.Millisecond, "Round-trip time")
 	flag.StringVar(&config.OutputFormat, "output", "text", "Output format: text, json, csv")
+	flag.StringVar(&config.Congestion, "cc", "bbr", "Quantum congestion control: bbr, bbr2, cubic")
 
 	flag.Parse()
 
@@ -85,6 +87,7 @@ func printConfig(config *BenchmarkConfig) {
 	fmt.Printf("测试时长:         %s\n", config.Duration)
 	fmt.Printf("并发连接:         %d\n", config.Concurrency)
 	fmt.Printf("负载大小:         %d bytes\n", config.PayloadSize)
+	fmt.Printf("拥塞控制:         %s\n", config.Congestion)
 	if config.PacketLoss > 0 {
 		fmt.Printf("丢包率:           %.1f%%\n", config.PacketLoss*100)
 	}
@@ -164,7 +167,7 @@ func runQuantumClient(ctx context.Context, config *BenchmarkConfig, latencyChan
 	// 连接 Quantum 服务器
 	quantumConfig := quantum.DefaultConfig()
 	quantumConfig.FECEnabled = true
-	quantumConfig.BBREnabled = true
+	quantumConfig.CongestionControl = quantum.CongestionAlgorithm(config.Congestion)
 
 	conn, err := quantum.Dial("udp", "localhost:9090", quantumConfig)
 	if err != nil {
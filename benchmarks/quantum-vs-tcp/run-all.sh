@@ -100,6 +100,19 @@ go run benchmark.go \
   -concurrency 5 \
   | tee results/weak-network.txt
 
+# 弱网下拥塞控制算法 A/B 对比
+for cc in bbr bbr2 cubic; do
+  echo "  测试场景: 弱网 (拥塞控制: $cc)"
+  go run benchmark.go \
+    -test latency \
+    -duration 30s \
+    -rtt 100ms \
+    -loss 0.05 \
+    -concurrency 5 \
+    -cc $cc \
+    | tee results/weak-network-$cc.txt
+done
+
 echo ""
 echo -e "${GREEN}✅ 测试 4 完成${NC}"
 echo ""
@@ -13,8 +13,9 @@ type Config struct {
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Host string `yaml:"Host"`
-	Port int    `yaml:"Port"`
+	Host        string `yaml:"Host"`
+	Port        int    `yaml:"Port"`        // gRPC TCP 端口
+	QuantumPort int    `yaml:"QuantumPort"` // gRPC Quantum (UDP) 端口，0 表示不启用
 }
 
 // StoreConfig 存储配置
@@ -66,8 +67,9 @@ type TracingConfig struct {
 func DefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host: "0.0.0.0",
-			Port: 9001,
+			Host:        "0.0.0.0",
+			Port:        9001,
+			QuantumPort: 9001,
 		},
 		Store: StoreConfig{
 			Type: "memory",
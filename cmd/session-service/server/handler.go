@@ -122,6 +122,14 @@ func (s *Server) UpdateSession(ctx context.Context, req *pb.UpdateSessionRequest
 		}
 	}
 
+	// 连接迁移后更新客户端地址
+	if req.ClientIp != "" {
+		if _, err := s.manager.UpdateClientAddr(ctx, sessionID, req.ClientIp, req.ClientPort); err != nil {
+			s.logger.Error("Failed to update client address", zap.Error(err))
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
 	// 更新会话
 	sess, err := s.manager.UpdateSession(ctx, sessionID, state, req.Metadata, stats)
 	if err != nil {
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/aetherflow/aetherflow/api/proto/session"
+	"github.com/aetherflow/aetherflow/cmd/session-service/config"
+	"github.com/aetherflow/aetherflow/internal/gateway/grpcclient"
+	"github.com/aetherflow/aetherflow/internal/quantum"
+	"go.uber.org/zap"
+)
+
+// freePort 返回一个当前空闲的回环端口
+func freePort(t *testing.T, network string) int {
+	t.Helper()
+
+	var addr net.Addr
+	switch network {
+	case "tcp":
+		l, err := net.Listen(network, "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to find free port: %v", err)
+		}
+		addr = l.Addr()
+		l.Close()
+	case "udp":
+		pc, err := net.ListenPacket(network, "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to find free port: %v", err)
+		}
+		addr = pc.LocalAddr()
+		pc.Close()
+	}
+
+	_, port, _ := net.SplitHostPort(addr.String())
+	var n int
+	fmt.Sscanf(port, "%d", &n)
+	return n
+}
+
+// TestGatewayToSessionServiceOverQuantum 网关通过 Quantum 调用 Session Service，
+// 同时 TCP 端口照常服务
+func TestGatewayToSessionServiceOverQuantum(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Server.Host = "127.0.0.1"
+	cfg.Server.Port = freePort(t, "tcp")
+	cfg.Server.QuantumPort = freePort(t, "udp")
+	cfg.Metrics.Enable = false
+
+	logger := zap.NewNop()
+	srv, err := New(cfg, logger)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+
+	// 与网关 ServiceContext 相同的方式注册两个传输的连接池
+	quantumTarget := fmt.Sprintf("127.0.0.1:%d", cfg.Server.QuantumPort)
+	tcpTarget := fmt.Sprintf("127.0.0.1:%d", cfg.Server.Port)
+	quantumDialer := grpcclient.NewQuantumDialer(logger)
+
+	manager := grpcclient.NewManager(logger)
+	defer manager.Close()
+	manager.RegisterPool("quantum", quantumTarget, 1, 1, time.Minute,
+		grpcclient.GetDialOptions("quantum", quantumDialer)...)
+	manager.RegisterPool("tcp", tcpTarget, 1, 1, time.Minute,
+		grpcclient.GetDialOptions("tcp", quantumDialer)...)
+
+	quantumClient := grpcclient.NewSessionClient(manager, "quantum", 5*time.Second, 3, logger)
+	tcpClient := grpcclient.NewSessionClient(manager, "tcp", 5*time.Second, 3, logger)
+
+	ctx := context.Background()
+	created, err := quantumClient.CreateSession(ctx, &pb.CreateSessionRequest{
+		UserId:     "user-1",
+		ClientIp:   "127.0.0.1",
+		ClientPort: 12345,
+	})
+	if err != nil {
+		t.Fatalf("CreateSession over Quantum failed: %v", err)
+	}
+	if created.Session.GetUserId() != "user-1" {
+		t.Errorf("Expected user_id user-1, got %q", created.Session.GetUserId())
+	}
+
+	// 两个传输访问的是同一个服务实例
+	got, err := tcpClient.GetSession(ctx, &pb.GetSessionRequest{SessionId: created.Session.GetSessionId()})
+	if err != nil {
+		t.Fatalf("GetSession over TCP failed: %v", err)
+	}
+	if got.Session.GetSessionId() != created.Session.GetSessionId() {
+		t.Errorf("Expected session %s, got %s", created.Session.GetSessionId(), got.Session.GetSessionId())
+	}
+
+	got, err = quantumClient.GetSession(ctx, &pb.GetSessionRequest{SessionId: created.Session.GetSessionId()})
+	if err != nil {
+		t.Fatalf("GetSession over Quantum failed: %v", err)
+	}
+	if got.Session.GetUserId() != "user-1" {
+		t.Errorf("Expected user_id user-1, got %q", got.Session.GetUserId())
+	}
+}
+
+// TestMigrationReportedToSessionService Quantum 连接迁移后，会话的客户端地址随之更新
+func TestMigrationReportedToSessionService(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Server.Host = "127.0.0.1"
+	cfg.Server.Port = freePort(t, "tcp")
+	cfg.Server.QuantumPort = 0
+	cfg.Metrics.Enable = false
+
+	logger := zap.NewNop()
+	srv, err := New(cfg, logger)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+
+	manager := grpcclient.NewManager(logger)
+	defer manager.Close()
+	manager.RegisterPool("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.Server.Port), 1, 1, time.Minute)
+	sessionClient := grpcclient.NewSessionClient(manager, "tcp", 5*time.Second, 3, logger)
+
+	ctx := context.Background()
+	created, err := sessionClient.CreateSession(ctx, &pb.CreateSessionRequest{
+		UserId:     "user-1",
+		ClientIp:   "192.168.1.10",
+		ClientPort: 40000,
+	})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	// 客户端的 Quantum 连接
+	listener, err := quantum.Listen("udp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	conn, err := quantum.Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	reporter := grpcclient.NewMigrationReporter(sessionClient, logger)
+	reporter.Track(conn.GUID(), created.Session.GetSessionId())
+
+	// 客户端从 Wi-Fi 切换到蜂窝网络
+	reporter.OnMigrate(conn,
+		&net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 40000},
+		&net.UDPAddr{IP: net.ParseIP("10.20.30.40"), Port: 50000})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := sessionClient.GetSession(ctx, &pb.GetSessionRequest{SessionId: created.Session.GetSessionId()})
+		if err != nil {
+			t.Fatalf("GetSession failed: %v", err)
+		}
+		if got.Session.GetClientIp() == "10.20.30.40" && got.Session.GetClientPort() == 50000 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected client address 10.20.30.40:50000, got %s:%d",
+				got.Session.GetClientIp(), got.Session.GetClientPort())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -14,8 +14,9 @@ type Config struct {
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Host string `yaml:"Host"`
-	Port int    `yaml:"Port"`
+	Host        string `yaml:"Host"`
+	Port        int    `yaml:"Port"`        // gRPC TCP 端口
+	QuantumPort int    `yaml:"QuantumPort"` // gRPC Quantum (UDP) 端口，0 表示不启用
 }
 
 // StoreConfig 存储配置
@@ -73,8 +74,9 @@ type ManagerConfig struct {
 func DefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host: "0.0.0.0",
-			Port: 9002,
+			Host:        "0.0.0.0",
+			Port:        9002,
+			QuantumPort: 9002,
 		},
 		Store: StoreConfig{
 			Type: "memory",
@@ -11,8 +11,10 @@ import (
 	pb "github.com/aetherflow/aetherflow/api/proto/statesync"
 	"github.com/aetherflow/aetherflow/cmd/statesync-service/config"
 	"github.com/aetherflow/aetherflow/internal/gateway/tracing"
+	"github.com/aetherflow/aetherflow/internal/quantum"
 	"github.com/aetherflow/aetherflow/internal/statesync"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
@@ -173,8 +175,36 @@ func (s *Server) Start() error {
 		return fmt.Errorf("failed to listen: %w", err)
 	}
 
+	// 监听 Quantum 端口，与 TCP 共用同一个 gRPC Server
+	var quantumAddr string
+	if s.config.Server.QuantumPort > 0 {
+		quantumAddr = fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.QuantumPort)
+		quantumConfig := quantum.DefaultConfig()
+		if s.config.Metrics.Enable {
+			// 传输层指标（RTT、拥塞窗口、重传、FEC恢复等）随 /metrics 一起导出
+			quantumMetrics, err := quantum.RegisterCollector(prometheus.DefaultRegisterer)
+			if err != nil {
+				listener.Close()
+				return fmt.Errorf("failed to register quantum metrics: %w", err)
+			}
+			quantumConfig.Metrics = quantumMetrics
+		}
+		quantumListener, err := quantum.ListenStreams("udp", quantumAddr, quantumConfig)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to listen on quantum: %w", err)
+		}
+
+		go func() {
+			if err := s.grpcServer.Serve(quantumListener); err != nil {
+				s.logger.Error("Quantum gRPC server error", zap.Error(err))
+			}
+		}()
+	}
+
 	s.logger.Info("StateSync Service started",
 		zap.String("address", addr),
+		zap.String("quantum_address", quantumAddr),
 		zap.Bool("metrics_enabled", s.config.Metrics.Enable),
 		zap.Bool("tracing_enabled", s.config.Tracing.Enable))
 
@@ -0,0 +1,8 @@
+-- Rollback migration: 002_conflict_fields
+
+BEGIN;
+
+ALTER TABLE conflicts DROP COLUMN IF EXISTS resolved_op;
+ALTER TABLE conflicts DROP COLUMN IF EXISTS fields;
+
+COMMIT;
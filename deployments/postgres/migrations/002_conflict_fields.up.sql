@@ -0,0 +1,10 @@
+-- Migration: 002_conflict_fields
+-- Description: Store per-field detail and the merged operation of conflicts
+
+BEGIN;
+
+-- 无法自动合并的字段 (部分冲突) 和合并后的操作
+ALTER TABLE conflicts ADD COLUMN IF NOT EXISTS fields JSONB;
+ALTER TABLE conflicts ADD COLUMN IF NOT EXISTS resolved_op JSONB;
+
+COMMIT;
@@ -89,6 +89,8 @@ CREATE TABLE IF NOT EXISTS conflicts (
     resolved_by VARCHAR(255),
     resolved_at TIMESTAMP,
     description TEXT,
+    fields JSONB,                      -- 无法自动合并的字段 (部分冲突)
+    resolved_op JSONB,                 -- 合并后的操作
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     
     -- 约束
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 
@@ -15,14 +16,32 @@ func main() {
 
 	// Listen for connections
 	fmt.Println("Starting Quantum server on :9090...")
-	conn, err := quantum.Listen("udp", ":9090", config)
+	listener, err := quantum.Listen("udp", ":9090", config)
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
-	defer conn.Close()
+	defer listener.Close()
+
+	fmt.Printf("Listening on: %s\n", listener.Addr())
+
+	// Accept connections
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			log.Printf("Failed to accept: %v", err)
+			break
+		}
+
+		fmt.Printf("Accepted connection! GUID: %s, Remote: %s\n", conn.GUID().String(), conn.RemoteAddr())
+		go handleConnection(conn)
+	}
+
+	fmt.Println("\nServer shutting down...")
+}
 
-	fmt.Printf("Server started! GUID: %s\n", conn.GUID().String())
-	fmt.Printf("Listening on: %s\n", conn.LocalAddr())
+// handleConnection echoes messages back to a single client
+func handleConnection(conn *quantum.Connection) {
+	defer conn.Close()
 
 	// Handle incoming messages
 	messageCount := 0
@@ -31,7 +50,7 @@ func main() {
 		data, err := conn.Receive()
 		if err != nil {
 			log.Printf("Failed to receive: %v", err)
-			break
+			return
 		}
 
 		messageCount++
@@ -56,6 +75,4 @@ func main() {
 			fmt.Println()
 		}
 	}
-
-	fmt.Println("\nServer shutting down...")
 }
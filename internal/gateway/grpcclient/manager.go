@@ -114,8 +114,8 @@ func (p *ConnectionPool) createConnection(ctx context.Context) (*grpc.ClientConn
 		}
 	}
 
-	// 使用GetTarget获取目标地址（支持动态地址轮询）
-	target := p.GetTarget()
+	// 获取目标地址（支持动态地址轮询），createConnection 在持有锁时调用
+	target := p.nextTarget()
 	
 	conn, err := grpc.DialContext(ctx, target, opts...)
 	if err != nil {
@@ -152,6 +152,11 @@ func (p *ConnectionPool) GetTarget() string {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	return p.nextTarget()
+}
+
+// nextTarget 轮询下一个目标地址（内部调用，需持有锁）
+func (p *ConnectionPool) nextTarget() string {
 	// 如果有动态地址，使用轮询
 	if len(p.dynamicAddresses) > 0 {
 		target := p.dynamicAddresses[p.addressIndex]
@@ -1,6 +1,7 @@
 package grpcclient
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -116,3 +117,32 @@ func TestConnectionPool_Stats(t *testing.T) {
 		t.Errorf("Expected max_active 10, got %v", stats["max_active"])
 	}
 }
+
+func TestConnectionPool_GetDialsUnderLock(t *testing.T) {
+	pool := NewConnectionPool("127.0.0.1:9000", 5, 10, 30*time.Second, nil, zap.NewNop())
+	pool.UpdateAddresses([]string{"127.0.0.1:9001", "127.0.0.1:9002"})
+
+	// 池中没有空闲连接, Get 在持有锁时拨号新连接
+	done := make(chan error, 1)
+	go func() {
+		conn, err := pool.Get(context.Background())
+		if err == nil {
+			conn.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get deadlocked while dialing a new connection")
+	}
+
+	// 拨号使用了第一个动态地址, 轮询继续
+	if target := pool.GetTarget(); target != "127.0.0.1:9002" {
+		t.Errorf("Expected next target 127.0.0.1:9002, got %s", target)
+	}
+}
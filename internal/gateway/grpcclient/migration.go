@@ -0,0 +1,76 @@
+package grpcclient
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	guuid "github.com/Lzww0608/GUUID"
+	pb "github.com/aetherflow/aetherflow/api/proto/session"
+	"github.com/aetherflow/aetherflow/internal/quantum"
+	"go.uber.org/zap"
+)
+
+// MigrationReporter 将 Quantum 连接迁移上报给 Session Service，
+// 使会话的 ClientIP/ClientPort 跟随客户端的新地址
+type MigrationReporter struct {
+	client *SessionClient
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	sessions map[guuid.UUID]string // 连接 GUUID -> 会话 ID
+}
+
+// NewMigrationReporter 创建连接迁移上报器
+func NewMigrationReporter(client *SessionClient, logger *zap.Logger) *MigrationReporter {
+	return &MigrationReporter{
+		client:   client,
+		logger:   logger,
+		sessions: make(map[guuid.UUID]string),
+	}
+}
+
+// Track 关联 Quantum 连接与其会话
+func (r *MigrationReporter) Track(connID guuid.UUID, sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[connID] = sessionID
+}
+
+// Untrack 连接关闭后取消关联
+func (r *MigrationReporter) Untrack(connID guuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, connID)
+}
+
+// OnMigrate 可直接设置为 quantum.Config.OnMigrate。
+// 上报在独立的 goroutine 中进行，不阻塞连接的接收循环
+func (r *MigrationReporter) OnMigrate(c *quantum.Connection, from, to *net.UDPAddr) {
+	r.mu.Lock()
+	sessionID, ok := r.sessions[c.GUID()]
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	r.logger.Info("Quantum connection migrated",
+		zap.String("session_id", sessionID),
+		zap.String("from", from.String()),
+		zap.String("to", to.String()),
+	)
+
+	go func() {
+		_, err := r.client.UpdateSession(context.Background(), &pb.UpdateSessionRequest{
+			SessionId:  sessionID,
+			ClientIp:   to.IP.String(),
+			ClientPort: uint32(to.Port),
+		})
+		if err != nil {
+			r.logger.Warn("Failed to report connection migration",
+				zap.String("session_id", sessionID),
+				zap.Error(err),
+			)
+		}
+	}()
+}
@@ -4,16 +4,19 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/aetherflow/aetherflow/internal/quantum"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 // QuantumDialer 使用Quantum协议的gRPC拨号器
 type QuantumDialer struct {
-	logger *zap.Logger
+	logger  *zap.Logger
+	metrics *quantum.Collector
 }
 
 // NewQuantumDialer 创建Quantum拨号器
@@ -23,6 +26,11 @@ func NewQuantumDialer(logger *zap.Logger) *QuantumDialer {
 	}
 }
 
+// SetMetrics 设置导出传输层指标的收集器，之后拨出的连接都计入其中
+func (d *QuantumDialer) SetMetrics(collector *quantum.Collector) {
+	d.metrics = collector
+}
+
 // Dial 使用Quantum协议拨号
 func (d *QuantumDialer) Dial(ctx context.Context, target string) (net.Conn, error) {
 	d.logger.Info("Dialing with Quantum protocol", zap.String("target", target))
@@ -35,16 +43,25 @@ func (d *QuantumDialer) Dial(ctx context.Context, target string) (net.Conn, erro
 
 	// 使用Quantum协议建立连接
 	config := quantum.DefaultConfig()
-	config.FECEnabled = true  // 启用FEC前向纠错
+	config.FECEnabled = true // 启用FEC前向纠错
 	// BBR拥塞控制默认已启用
+	config.Metrics = d.metrics
 
 	conn, err := quantum.Dial("udp", net.JoinHostPort(host, port), config)
 	if err != nil {
 		return nil, fmt.Errorf("quantum dial failed: %w", err)
 	}
 
+	// gRPC 的字节流走一条独立的流，连接上的其他流不会阻塞它
+	stream, err := conn.OpenStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("quantum open stream failed: %w", err)
+	}
+
 	// 包装成quantumConn实现net.Conn接口
 	return &quantumConn{
+		Stream: stream,
 		conn:   conn,
 		logger: d.logger,
 	}, nil
@@ -57,92 +74,48 @@ func (d *QuantumDialer) DialOption() grpc.DialOption {
 	})
 }
 
-// quantumConn 包装Quantum连接以实现net.Conn接口
-type quantumConn struct {
-	conn         *quantum.Connection
-	logger       *zap.Logger
-	readDeadline  time.Time
-	writeDeadline time.Time
-}
+// quantumCloseTimeout 关闭时等待已写数据被确认的最长时间
+const quantumCloseTimeout = 5 * time.Second
 
-// Read 实现net.Conn的Read方法
-func (c *quantumConn) Read(b []byte) (int, error) {
-	// 如果设置了读超时
-	if !c.readDeadline.IsZero() {
-		timeout := time.Until(c.readDeadline)
-		if timeout <= 0 {
-			return 0, fmt.Errorf("read deadline exceeded")
-		}
-		
-		data, err := c.conn.ReceiveWithTimeout(timeout)
-		if err != nil {
-			return 0, err
-		}
-		
-		n := copy(b, data)
-		return n, nil
-	}
-	
-	// 没有超时，使用阻塞接收
-	data, err := c.conn.Receive()
-	if err != nil {
-		return 0, err
-	}
-	
-	n := copy(b, data)
-	return n, nil
-}
+// quantumConn 将Quantum流适配为net.Conn。
+// 读写、分段、部分读缓冲、截止时间（超时返回os.ErrDeadlineExceeded）
+// 和半关闭（CloseWrite）均由quantum.Stream提供；quantumConn独占底层连接，
+// 关闭时先发送流FIN并等待数据被确认，再关闭连接。
+type quantumConn struct {
+	*quantum.Stream
 
-// Write 实现net.Conn的Write方法
-func (c *quantumConn) Write(b []byte) (int, error) {
-	// Quantum的Send方法发送整个数据包
-	if err := c.conn.Send(b); err != nil {
-		return 0, err
-	}
-	return len(b), nil
+	conn      *quantum.Connection
+	logger    *zap.Logger
+	closeOnce sync.Once
+	closeErr  error
 }
 
 // Close 实现net.Conn的Close方法
 func (c *quantumConn) Close() error {
-	return c.conn.Close()
-}
-
-// LocalAddr 实现net.Conn的LocalAddr方法
-func (c *quantumConn) LocalAddr() net.Addr {
-	addr, _ := net.ResolveUDPAddr("udp", c.conn.LocalAddr())
-	return addr
-}
-
-// RemoteAddr 实现net.Conn的RemoteAddr方法
-func (c *quantumConn) RemoteAddr() net.Addr {
-	addr, _ := net.ResolveUDPAddr("udp", c.conn.RemoteAddr())
-	return addr
-}
-
-// SetDeadline 实现net.Conn的SetDeadline方法
-func (c *quantumConn) SetDeadline(t time.Time) error {
-	c.readDeadline = t
-	c.writeDeadline = t
-	return nil
-}
+	c.closeOnce.Do(func() {
+		if err := c.Stream.Close(); err != nil {
+			c.logger.Debug("Failed to close quantum stream", zap.Error(err))
+		}
 
-// SetReadDeadline 实现net.Conn的SetReadDeadline方法
-func (c *quantumConn) SetReadDeadline(t time.Time) error {
-	c.readDeadline = t
-	return nil
-}
+		// 等待已写入的数据和FIN被对端确认，避免关闭连接时丢失
+		ctx, cancel := context.WithTimeout(context.Background(), quantumCloseTimeout)
+		if err := c.conn.Flush(ctx); err != nil {
+			c.logger.Debug("Quantum connection closed before flush completed", zap.Error(err))
+		}
+		cancel()
 
-// SetWriteDeadline 实现net.Conn的SetWriteDeadline方法
-func (c *quantumConn) SetWriteDeadline(t time.Time) error {
-	c.writeDeadline = t
-	return nil
+		c.closeErr = c.conn.Close()
+	})
+	return c.closeErr
 }
 
 // GetDialOptions 根据传输协议获取DialOption
 func GetDialOptions(transport string, quantumDialer *QuantumDialer) []grpc.DialOption {
 	if transport == "quantum" {
+		// 传输安全由 Quantum 连接自身的加密配置负责，gRPC 层不叠加 TLS
 		return []grpc.DialOption{
 			quantumDialer.DialOption(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
 		}
 	}
 	// TCP使用默认配置（insecure + keepalive）
@@ -1,9 +1,18 @@
 package grpcclient
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/aetherflow/aetherflow/internal/quantum"
 	"go.uber.org/zap"
+	"golang.org/x/net/nettest"
 )
 
 func TestNewQuantumDialer(t *testing.T) {
@@ -48,8 +57,9 @@ func TestGetDialOptions_Quantum(t *testing.T) {
 		t.Fatal("Expected dial options for Quantum transport")
 	}
 
-	if len(opts) != 1 {
-		t.Errorf("Expected 1 dial option, got %d", len(opts))
+	// 拨号器 + 传输凭证
+	if len(opts) != 2 {
+		t.Errorf("Expected 2 dial options, got %d", len(opts))
 	}
 }
 
@@ -63,3 +73,112 @@ func TestGetDialOptions_Default(t *testing.T) {
 		t.Error("Expected nil options for unknown transport")
 	}
 }
+
+// newQuantumPipe 通过回环上的Quantum连接创建一对net.Conn：
+// c1为QuantumDialer拨出的quantumConn，c2为服务端接受的流
+func newQuantumPipe() (c1, c2 net.Conn, stop func(), err error) {
+	listener, err := quantum.Listen("udp", "127.0.0.1:0", nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dialer := NewQuantumDialer(zap.NewNop())
+	c1, err = dialer.Dial(ctx, listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		return nil, nil, nil, err
+	}
+
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		c1.Close()
+		listener.Close()
+		return nil, nil, nil, err
+	}
+
+	stream, err := server.AcceptStream(ctx)
+	if err != nil {
+		c1.Close()
+		listener.Close()
+		return nil, nil, nil, err
+	}
+
+	stop = func() {
+		c1.Close()
+		stream.Close()
+		listener.Close()
+	}
+	return c1, stream, stop, nil
+}
+
+func TestQuantumConn_NetConnConformance(t *testing.T) {
+	nettest.TestConn(t, newQuantumPipe)
+}
+
+func TestQuantumConn_LargeWrite(t *testing.T) {
+	c1, c2, stop, err := newQuantumPipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer stop()
+
+	// 远大于单个数据包的写入会被分段
+	want := bytes.Repeat([]byte("quantum"), 64*1024)
+	go func() {
+		c1.Write(want)
+		c1.(interface{ CloseWrite() error }).CloseWrite()
+	}()
+
+	c2.SetReadDeadline(time.Now().Add(30 * time.Second))
+
+	// 小缓冲区逐段读取，剩余数据保留到下次Read
+	var got bytes.Buffer
+	buf := make([]byte, 100)
+	for {
+		n, err := c2.Read(buf)
+		got.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+	}
+
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("Expected %d bytes, got %d", len(want), got.Len())
+	}
+
+	// 半关闭后仍可反向写入
+	if _, err := c2.Write([]byte("reply")); err != nil {
+		t.Fatalf("Failed to write after peer CloseWrite: %v", err)
+	}
+	c1.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply := make([]byte, 5)
+	if _, err := io.ReadFull(c1, reply); err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	if string(reply) != "reply" {
+		t.Errorf("Expected %q, got %q", "reply", reply)
+	}
+}
+
+func TestQuantumConn_ReadDeadline(t *testing.T) {
+	c1, _, stop, err := newQuantumPipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer stop()
+
+	c1.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = c1.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected os.ErrDeadlineExceeded, got %v", err)
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("Expected a timeout net.Error, got %v", err)
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"github.com/aetherflow/aetherflow/internal/gateway/metrics"
 	"github.com/aetherflow/aetherflow/internal/gateway/tracing"
 	"github.com/aetherflow/aetherflow/internal/gateway/websocket"
+	"github.com/aetherflow/aetherflow/internal/quantum"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
@@ -132,6 +134,16 @@ func NewServiceContext(c config.Config) *ServiceContext {
 	
 	// 创建Quantum Dialer（如果需要）
 	quantumDialer := grpcclient.NewQuantumDialer(logger)
+	usesQuantum := c.GRPC.Session.Transport == "quantum" || c.GRPC.StateSync.Transport == "quantum"
+	if usesQuantum && c.Prometheus.Host != "" {
+		// 传输层指标由网关的 /metrics 一并导出；重复创建时复用已注册的收集器
+		quantumMetrics, err := quantum.RegisterCollector(prometheus.DefaultRegisterer)
+		if err != nil {
+			logger.Error("Failed to register quantum metrics", zap.Error(err))
+		} else {
+			quantumDialer.SetMetrics(quantumMetrics)
+		}
+	}
 	
 	// 注册Session服务连接池（添加追踪拦截器）
 	sessionDialOpts := grpcclient.GetDialOptions(c.GRPC.Session.Transport, quantumDialer)
@@ -0,0 +1,154 @@
+package quantum
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// Acknowledgments are delayed and coalesced. A receiver acknowledges every
+// few data packets arriving in order, as many as the peer asked for in its
+// SYN or SYN-ACK, and otherwise within MaxAckDelay. Anything the peer's loss
+// recovery may be waiting on is acknowledged at once. Data packets going
+// out while an ACK is pending carry it instead of a separate packet. Every
+// ACK says how long it was held, which the peer takes out of its RTT
+// samples, and echoes the ECN codepoints received. Peers that ask for no
+// frequency predate delayed ACKs and have every packet acknowledged at once.
+
+// ackState tracks received data not yet acknowledged
+type ackState struct {
+	mu        sync.Mutex
+	frequency int         // Data packets per ACK the peer asked for; 0 acknowledges each at once
+	pending   int         // Data packets received since the last ACK
+	since     time.Time   // When the latest of them arrived
+	timer     *time.Timer // Sends the ACK MaxAckDelay after the first of them
+}
+
+// setAckFrequency applies the acknowledgment frequency the peer asked for,
+// zero meaning DefaultAckFrequency
+func (c *Connection) setAckFrequency(n uint16) {
+	if n == 0 {
+		n = DefaultAckFrequency
+	}
+	c.acks.mu.Lock()
+	c.acks.frequency = int(n)
+	c.acks.mu.Unlock()
+}
+
+// scheduleAck acknowledges a received data packet, at once if immediate or
+// enough packets are pending, and otherwise within MaxAckDelay
+func (c *Connection) scheduleAck(immediate bool) {
+	a := &c.acks
+	delay := c.config.MaxAckDelay
+
+	a.mu.Lock()
+	a.pending++
+	a.since = time.Now()
+	if immediate || a.frequency == 0 || delay <= 0 || a.pending >= a.frequency {
+		a.mu.Unlock()
+		c.sendAck()
+		return
+	}
+	if a.pending == 1 {
+		if a.timer == nil {
+			a.timer = time.AfterFunc(delay, c.flushAck)
+		} else {
+			a.timer.Reset(delay)
+		}
+	}
+	a.mu.Unlock()
+}
+
+// ackPending reports whether a delayed ACK is waiting to go out
+func (c *Connection) ackPending() bool {
+	c.acks.mu.Lock()
+	defer c.acks.mu.Unlock()
+	return c.acks.pending > 0
+}
+
+// flushAck sends an ACK held back for MaxAckDelay
+func (c *Connection) flushAck() {
+	select {
+	case <-c.closeSignal:
+		return
+	default:
+	}
+
+	if c.ackPending() {
+		c.sendAck()
+	}
+}
+
+// ackSent records that the peer has been sent our current acknowledgment,
+// returning how long it was held after the latest data packet arrived
+func (c *Connection) ackSent() time.Duration {
+	a := &c.acks
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var delay time.Duration
+	if a.pending > 0 {
+		delay = time.Since(a.since)
+	}
+	a.pending = 0
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	return delay
+}
+
+// stopAcks cancels a pending delayed ACK as the connection closes
+func (c *Connection) stopAcks() {
+	c.acks.mu.Lock()
+	defer c.acks.mu.Unlock()
+	if c.acks.timer != nil {
+		c.acks.timer.Stop()
+	}
+}
+
+// sendAck acknowledges received data, advertising the current receive window
+func (c *Connection) sendAck() {
+	ackNum, sackBlocks := c.recvBuf.GenerateSACK()
+	ackPacket := transport.NewPacket(c.guid, 0, ackNum, protocol.FlagACK, nil)
+	for _, block := range sackBlocks {
+		ackPacket.Header.AddSACKBlock(block.Start, block.End)
+	}
+	if delay := c.ackSent(); delay > 0 {
+		ackPacket.Header.SetAckDelay(delay)
+	}
+	c.echoECN(ackPacket.Header)
+	c.transmit(ackPacket)
+}
+
+// piggybackAck adds a pending acknowledgment to the header of an outgoing
+// data packet. ACKs with SACK blocks are sent on their own, as soon as the
+// gap appears, so data packets keep their size.
+func (c *Connection) piggybackAck(header *protocol.Header, packet *transport.Packet) {
+	if header.SequenceNumber == 0 || header.HasFlag(protocol.FlagACK) || len(packet.Payload) == 0 {
+		return
+	}
+
+	c.acks.mu.Lock()
+	due := c.acks.frequency > 0 && c.acks.pending > 0
+	c.acks.mu.Unlock()
+	if !due {
+		return
+	}
+
+	ackNum, sackBlocks := c.recvBuf.GenerateSACK()
+	if len(sackBlocks) > 0 {
+		return
+	}
+
+	// The header is a copy, but shares its extensions with the queued packet
+	header.Extensions = slices.Clone(header.Extensions)
+	header.SetFlag(protocol.FlagACK)
+	header.AckNumber = ackNum
+	if delay := c.ackSent(); delay > 0 {
+		header.SetAckDelay(delay)
+	}
+	c.echoECN(header)
+}
@@ -0,0 +1,129 @@
+package quantum
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/netsim"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+// ackCounter counts the acknowledgments crossing a simulated link, sent on
+// their own or piggybacked on data
+type ackCounter struct {
+	mu          sync.Mutex
+	acks        int
+	piggybacked int
+}
+
+// observe is a netsim drop function that counts and drops nothing
+func (ac *ackCounter) observe(datagram []byte) bool {
+	header, _, err := protocol.SplitPacket(datagram)
+	if err != nil || !header.HasFlag(protocol.FlagACK) {
+		return false
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	switch {
+	case header.SequenceNumber != 0:
+		ac.piggybacked++
+	case header.Flags == protocol.FlagACK:
+		ac.acks++
+	}
+	return false
+}
+
+func (ac *ackCounter) counts() (acks, piggybacked int) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	return ac.acks, ac.piggybacked
+}
+
+func TestDelayedAcks(t *testing.T) {
+	const count = 200
+
+	tests := []struct {
+		name         string
+		maxAckDelay  time.Duration
+		ackFrequency uint16
+		minAcks      int
+		maxAcks      int
+	}{
+		{"Immediate", 0, 0, count, 2 * count},
+		{"Default", DefaultMaxAckDelay, 0, 1, count * 2 / 3},
+		{"Frequency8", DefaultMaxAckDelay, 8, 1, count / 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var counter ackCounter
+			link := netsim.LinkConfig{Delay: 5 * time.Millisecond}
+			path := netsim.Config{AToB: link, BToA: link}
+			path.BToA.Drop = counter.observe
+
+			config := DefaultConfig()
+			config.FECEnabled = false
+			config.MaxAckDelay = tt.maxAckDelay
+			config.AckFrequency = tt.ackFrequency
+			client, server := newSimulatedPair(t, path, config)
+
+			transferMessages(t, client, server, count, 200)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := client.Flush(ctx); err != nil {
+				t.Fatalf("Failed to flush: %v", err)
+			}
+
+			acks, _ := counter.counts()
+			t.Logf("acks=%d srtt=%v", acks, client.sendBuf.SRTT())
+			if acks < tt.minAcks || acks > tt.maxAcks {
+				t.Errorf("Expected %d to %d ACKs for %d packets, got %d", tt.minAcks, tt.maxAcks, count, acks)
+			}
+
+			// Held ACKs do not inflate the 10ms round trip
+			if srtt := client.sendBuf.SRTT(); srtt > 10*time.Millisecond+DefaultMaxAckDelay/2 {
+				t.Errorf("Expected the ack delay to be taken out of the RTT, got SRTT %v", srtt)
+			}
+		})
+	}
+}
+
+func TestPiggybackedAcks(t *testing.T) {
+	var counter ackCounter
+	link := netsim.LinkConfig{Delay: 5 * time.Millisecond}
+	path := netsim.Config{AToB: link, BToA: link}
+	path.BToA.Drop = counter.observe
+
+	config := DefaultConfig()
+	config.FECEnabled = false
+	client, server := newSimulatedPair(t, path, config)
+
+	// Each request is acknowledged by its response
+	const count = 20
+	for i := 0; i < count; i++ {
+		if err := client.Send([]byte("request")); err != nil {
+			t.Fatalf("Failed to send request %d: %v", i, err)
+		}
+		if _, err := server.ReceiveWithTimeout(5 * time.Second); err != nil {
+			t.Fatalf("Failed to receive request %d: %v", i, err)
+		}
+		if err := server.Send([]byte("response")); err != nil {
+			t.Fatalf("Failed to send response %d: %v", i, err)
+		}
+		if _, err := client.ReceiveWithTimeout(5 * time.Second); err != nil {
+			t.Fatalf("Failed to receive response %d: %v", i, err)
+		}
+	}
+
+	acks, piggybacked := counter.counts()
+	t.Logf("acks=%d piggybacked=%d", acks, piggybacked)
+	if piggybacked < count/2 {
+		t.Errorf("Expected most responses to carry an ACK, got %d of %d", piggybacked, count)
+	}
+	if acks > count/2 {
+		t.Errorf("Expected few separate ACKs, got %d for %d requests", acks, count)
+	}
+}
@@ -107,6 +107,7 @@ type BBR struct {
 	// Statistics
 	deliveredBytes uint64
 	deliveredTime  time.Time
+	ceMarked       uint64 // Packets the path marked CE
 	
 	// Configuration
 	minRTT      time.Duration
@@ -334,6 +335,16 @@ func (bbr *BBR) updatePacingAndWindow() {
 		bbr.pacingRate = uint64(float64(bbr.btlBw) * bbr.pacingGain)
 	}
 
+	// Never pace slower than the minimum window per round trip: samples
+	// taken while the application or the peer's receive window limited
+	// sending understate the bandwidth and must not stall the connection
+	if bbr.rtProp > 0 {
+		floor := uint64(float64(MinPipeCwnd*1400) / bbr.rtProp.Seconds())
+		if bbr.pacingRate < floor {
+			bbr.pacingRate = floor
+		}
+	}
+
 	// Calculate congestion window (in bytes)
 	bdp := bbr.calculateBDP()
 	cwnd := uint32(float64(bdp) * bbr.cwndGain)
@@ -441,12 +452,110 @@ func (bbr *BBR) Reset() {
 	bbr.bandwidthSamples = bbr.bandwidthSamples[:0]
 }
 
+// Seed starts the controller from bandwidth and RTT estimates remembered from
+// an earlier connection over the same path. STARTUP is skipped; the usual
+// PROBE_BW cycle corrects the estimates if the path has changed.
+func (bbr *BBR) Seed(bandwidth uint64, rtt time.Duration) {
+	if bandwidth == 0 || rtt <= 0 {
+		return
+	}
+
+	bbr.mu.Lock()
+	defer bbr.mu.Unlock()
+
+	now := time.Now()
+	bbr.btlBw = min(bandwidth, bbr.maxBandwidth)
+	bbr.rtProp = rtt
+	bbr.rtPropStamp = now
+	bbr.bandwidthSamples = append(bbr.bandwidthSamples[:0], bandwidthSample{
+		bandwidth: bbr.btlBw,
+		rtt:       rtt,
+		timestamp: now,
+	})
+	bbr.fullBandwidthReached = true
+	bbr.lastBandwidthReached = bbr.btlBw
+	bbr.enterProbeBW(now)
+	bbr.updatePacingAndWindow()
+}
+
+// OnPacketCE should be called when the path has marked packets Congestion
+// Experienced. BBR ignores loss, but CE marks show a queue building at the
+// bottleneck before it overflows: STARTUP ends, as the pipe is full, and a
+// PROBE_BW cycle probing above the estimated bandwidth moves on at once to
+// draining what the probe queued.
+func (bbr *BBR) OnPacketCE(packets uint32, now time.Time) {
+	bbr.mu.Lock()
+	defer bbr.mu.Unlock()
+
+	bbr.ceMarked += uint64(packets)
+
+	switch bbr.state {
+	case StateStartup:
+		bbr.fullBandwidthReached = true
+		bbr.enterDrain(now)
+
+	case StateProbeBW:
+		if bbr.pacingGain > 1 {
+			bbr.cycleIndex = 1
+			bbr.cycleStamp = now
+			bbr.pacingGain = probeBWGainCycle[bbr.cycleIndex]
+		}
+	}
+	bbr.updatePacingAndWindow()
+}
+
+// OnSent records a sent packet (congestion controller interface)
+func (bbr *BBR) OnSent(size uint32, now time.Time) {
+	bbr.OnPacketSent(size, now)
+}
+
+// OnAcked records newly acknowledged bytes and an RTT sample (congestion
+// controller interface)
+func (bbr *BBR) OnAcked(size uint32, rtt time.Duration, now time.Time) {
+	bbr.OnPacketAcked(size, rtt, now)
+}
+
+// OnLost records a lost packet (congestion controller interface)
+func (bbr *BBR) OnLost(size uint32, now time.Time) {
+	bbr.OnPacketLost(size, now)
+}
+
+// OnCongestionExperienced records packets the path marked CE (congestion
+// controller interface)
+func (bbr *BBR) OnCongestionExperienced(packets uint32, now time.Time) {
+	bbr.OnPacketCE(packets, now)
+}
+
+// PacingDelay returns the delay before the next packet (congestion
+// controller interface)
+func (bbr *BBR) PacingDelay(size uint32) time.Duration {
+	return bbr.CalculatePacingDelay(size)
+}
+
+// Cwnd returns the congestion window in bytes (congestion controller interface)
+func (bbr *BBR) Cwnd() uint32 {
+	return bbr.GetSendWindow()
+}
+
+// Bandwidth returns the estimated bottleneck bandwidth in bytes/sec
+// (congestion controller interface)
+func (bbr *BBR) Bandwidth() uint64 {
+	return bbr.GetBandwidth()
+}
+
+// MinRTT returns the round-trip propagation delay estimate (congestion
+// controller interface)
+func (bbr *BBR) MinRTT() time.Duration {
+	return bbr.GetRTT()
+}
+
 // Statistics returns BBR statistics
 func (bbr *BBR) Statistics() map[string]interface{} {
 	bbr.mu.RLock()
 	defer bbr.mu.RUnlock()
 
 	return map[string]interface{}{
+		"algorithm":     "bbr",
 		"state":         bbr.state.String(),
 		"btl_bw_mbps":   float64(bbr.btlBw) / 1024 / 1024,
 		"rtt_ms":        float64(bbr.rtProp.Microseconds()) / 1000,
@@ -455,6 +564,7 @@ func (bbr *BBR) Statistics() map[string]interface{} {
 		"cwnd_packets":  bbr.sendWindow / 1400,
 		"pacing_gain":   bbr.pacingGain,
 		"cwnd_gain":     bbr.cwndGain,
+		"ce_packets":    bbr.ceMarked,
 	}
 }
 
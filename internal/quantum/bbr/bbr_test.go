@@ -164,3 +164,51 @@ func TestBBRReset(t *testing.T) {
 		t.Error("Bandwidth should be reset to 0")
 	}
 }
+
+func TestBBRSeed(t *testing.T) {
+	bbr := NewBBR(nil)
+
+	// Remembered estimates: 1 MB/s over a 50ms path
+	bbr.Seed(1024*1024, 50*time.Millisecond)
+
+	if bbr.GetState() != StateProbeBW {
+		t.Errorf("Seeded BBR should skip STARTUP, got %s", bbr.GetState().String())
+	}
+	if bbr.GetBandwidth() != 1024*1024 {
+		t.Errorf("Expected bandwidth 1048576, got %d", bbr.GetBandwidth())
+	}
+	if bbr.GetRTT() != 50*time.Millisecond {
+		t.Errorf("Expected RTT 50ms, got %v", bbr.GetRTT())
+	}
+
+	// The window covers the remembered bandwidth-delay product
+	bdp := uint32(1024 * 1024 * 50 / 1000)
+	if bbr.GetSendWindow() < bdp {
+		t.Errorf("Expected send window of at least %d bytes, got %d", bdp, bbr.GetSendWindow())
+	}
+
+	// Missing estimates leave a fresh controller alone
+	fresh := NewBBR(nil)
+	fresh.Seed(0, 0)
+	if fresh.GetState() != StateStartup {
+		t.Errorf("Expected STARTUP without estimates, got %s", fresh.GetState().String())
+	}
+}
+
+func TestBBRCongestionExperienced(t *testing.T) {
+	// CE marks end STARTUP, as the queue is building
+	bbr := NewBBR(nil)
+	bbr.OnCongestionExperienced(1, time.Now())
+	if bbr.GetState() != StateDrain {
+		t.Errorf("Expected CE marks to end STARTUP, got %s", bbr.GetState().String())
+	}
+
+	// In PROBE_BW they cut a bandwidth probe short
+	bbr = NewBBR(nil)
+	bbr.Seed(1024*1024, 50*time.Millisecond)
+	probing := bbr.GetPacingRate()
+	bbr.OnCongestionExperienced(1, time.Now())
+	if rate := bbr.GetPacingRate(); rate >= probing || rate > 1024*1024 {
+		t.Errorf("Expected pacing below the estimated bandwidth, got %d (was %d)", rate, probing)
+	}
+}
@@ -0,0 +1,223 @@
+package bbr
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// LossThreshold is the per-round loss rate above which BBRv2 treats
+	// loss as a sign of congestion
+	LossThreshold = 0.02
+
+	// LossBeta is the factor BBRv2 cuts its inflight bound by on high loss
+	LossBeta = 0.7
+
+	// ECNThreshold is the per-round fraction of delivered data marked CE
+	// above which BBRv2 cuts its bounds as for loss
+	ECNThreshold = 0.5
+)
+
+// BBRv2 is a loss-aware variant of BBR in the style of BBRv2. BBR alone
+// ignores loss, which lets it overrun shallow buffers and starve competing
+// flows. BBRv2 measures the loss rate and the share of data marked CE each
+// round trip: when either exceeds its threshold (LossThreshold,
+// ECNThreshold), STARTUP ends and upper bounds are set below the current
+// inflight data (inflight_hi) and sending rate (bw_lo). Rounds below both
+// raise the bounds again, slowly at first and then faster, until they no
+// longer limit the model's own window and bandwidth.
+type BBRv2 struct {
+	*BBR
+
+	mu sync.Mutex
+
+	// Upper bounds on bytes in flight and on the pacing rate (bytes/sec),
+	// zero when unbounded
+	inflightHi uint32
+	bwLo       uint64
+
+	// Current loss-measurement round
+	roundStart     time.Time
+	roundDelivered uint64
+	roundLost      uint64
+	roundCE        uint64
+	lastLossRate   float64
+	lastCERate     float64
+
+	// Loss-free rounds since inflightHi was last cut
+	probeUpRounds int
+}
+
+// NewBBRv2 creates a new BBRv2 congestion controller
+func NewBBRv2(config *Config) *BBRv2 {
+	return &BBRv2{
+		BBR:        NewBBR(config),
+		roundStart: time.Now(),
+	}
+}
+
+// OnAcked records newly acknowledged bytes and an RTT sample
+func (b *BBRv2) OnAcked(size uint32, rtt time.Duration, now time.Time) {
+	b.BBR.OnAcked(size, rtt, now)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roundDelivered += uint64(size)
+	b.endRound(now)
+}
+
+// OnLost records a lost packet
+func (b *BBRv2) OnLost(size uint32, now time.Time) {
+	b.BBR.OnLost(size, now)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roundLost += uint64(size)
+	b.endRound(now)
+}
+
+// OnCongestionExperienced records packets the path marked CE
+func (b *BBRv2) OnCongestionExperienced(packets uint32, now time.Time) {
+	b.BBR.OnCongestionExperienced(packets, now)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roundCE += uint64(packets) * 1400 // Assume 1400 bytes per packet
+	b.endRound(now)
+}
+
+// endRound adapts inflightHi to the loss and CE rates once a round trip has
+// passed
+func (b *BBRv2) endRound(now time.Time) {
+	if now.Sub(b.roundStart) < b.BBR.MinRTT() {
+		return
+	}
+
+	total := b.roundDelivered + b.roundLost
+	if total == 0 {
+		b.roundStart = now
+		return
+	}
+	b.lastLossRate = float64(b.roundLost) / float64(total)
+	b.lastCERate = min(float64(b.roundCE)/float64(total), 1)
+
+	minCwnd := uint32(MinPipeCwnd * 1400)
+	cwnd := b.BBR.Cwnd()
+
+	if b.lastLossRate > LossThreshold || b.lastCERate > ECNThreshold {
+		// Too much loss or queueing: the path cannot hold what we are
+		// sending
+		bound := cwnd
+		if b.inflightHi > 0 && b.inflightHi < bound {
+			bound = b.inflightHi
+		}
+		b.inflightHi = max(uint32(float64(bound)*LossBeta), minCwnd)
+
+		bw := b.BBR.Bandwidth()
+		if b.bwLo > 0 && b.bwLo < bw {
+			bw = b.bwLo
+		}
+		b.bwLo = uint64(float64(bw) * LossBeta)
+
+		b.probeUpRounds = 0
+		b.exitStartup()
+	} else if b.inflightHi > 0 {
+		// Probe upward: 1, 2, 4, ... packets per loss-free round, with the
+		// rate bound following in proportion
+		grown := b.inflightHi + uint32(1400)<<min(b.probeUpRounds, 10)
+		b.bwLo = uint64(float64(b.bwLo) * float64(grown) / float64(b.inflightHi))
+		b.inflightHi = grown
+		b.probeUpRounds++
+		if b.inflightHi >= cwnd {
+			b.inflightHi = 0
+			b.bwLo = 0
+		}
+	}
+
+	b.roundStart = now
+	b.roundDelivered = 0
+	b.roundLost = 0
+	b.roundCE = 0
+}
+
+// exitStartup ends STARTUP, as sustained loss shows the pipe is full
+func (b *BBRv2) exitStartup() {
+	b.BBR.mu.Lock()
+	defer b.BBR.mu.Unlock()
+	b.BBR.fullBandwidthReached = true
+}
+
+// Cwnd returns the congestion window in bytes, capped by the inflight bound
+func (b *BBRv2) Cwnd() uint32 {
+	cwnd := b.BBR.Cwnd()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inflightHi > 0 && b.inflightHi < cwnd {
+		return b.inflightHi
+	}
+	return cwnd
+}
+
+// PacingDelay returns the delay before the next packet, paced no faster than
+// the loss-derived rate bound
+func (b *BBRv2) PacingDelay(size uint32) time.Duration {
+	rate := b.BBR.GetPacingRate()
+
+	b.mu.Lock()
+	if b.bwLo > 0 {
+		rate = min(rate, b.bwLo)
+	}
+	b.mu.Unlock()
+
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(size) / float64(rate) * float64(time.Second))
+}
+
+// Reset resets the controller to its initial state
+func (b *BBRv2) Reset() {
+	b.BBR.Reset()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clearLossState()
+}
+
+// Seed starts the controller from remembered estimates
+func (b *BBRv2) Seed(bandwidth uint64, rtt time.Duration) {
+	b.BBR.Seed(bandwidth, rtt)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clearLossState()
+}
+
+// clearLossState forgets the inflight bound and the current round
+func (b *BBRv2) clearLossState() {
+	b.inflightHi = 0
+	b.bwLo = 0
+	b.roundStart = time.Now()
+	b.roundDelivered = 0
+	b.roundLost = 0
+	b.roundCE = 0
+	b.lastLossRate = 0
+	b.lastCERate = 0
+	b.probeUpRounds = 0
+}
+
+// Statistics returns BBRv2 statistics
+func (b *BBRv2) Statistics() map[string]interface{} {
+	stats := b.BBR.Statistics()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats["algorithm"] = "bbr2"
+	stats["inflight_hi"] = b.inflightHi
+	stats["bw_lo"] = b.bwLo
+	stats["loss_rate"] = b.lastLossRate
+	stats["ce_rate"] = b.lastCERate
+	return stats
+}
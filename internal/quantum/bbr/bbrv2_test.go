@@ -0,0 +1,78 @@
+package bbr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBBRv2BoundsInflightOnLoss(t *testing.T) {
+	b := NewBBRv2(nil)
+	b.Seed(1024*1024, 50*time.Millisecond)
+
+	// A round trip losing 10% of what was sent
+	now := time.Now()
+	for i := 0; i < 9; i++ {
+		now = now.Add(5 * time.Millisecond)
+		b.OnAcked(1400, 50*time.Millisecond, now)
+	}
+	cwnd := b.Cwnd()
+	now = now.Add(10 * time.Millisecond)
+	b.OnLost(1400, now)
+
+	bounded := b.Cwnd()
+	if bounded >= cwnd {
+		t.Fatalf("Expected loss to bound the window below %d, got %d", cwnd, bounded)
+	}
+	if stats := b.Statistics(); stats["algorithm"] != "bbr2" || stats["inflight_hi"] == uint32(0) {
+		t.Errorf("Expected bbr2 statistics with an inflight bound, got %v", stats)
+	}
+	if b.PacingDelay(1400) <= b.BBR.PacingDelay(1400) {
+		t.Error("Expected pacing to slow while inflight is bounded")
+	}
+
+	// Loss-free rounds raise the bound until it stops limiting the window
+	for i := 0; i < 20 && b.Cwnd() < b.BBR.Cwnd(); i++ {
+		now = now.Add(60 * time.Millisecond)
+		b.OnAcked(1400, 50*time.Millisecond, now)
+	}
+	if b.Cwnd() != b.BBR.Cwnd() {
+		t.Errorf("Expected the bound to be lifted, got %d of %d", b.Cwnd(), b.BBR.Cwnd())
+	}
+}
+
+func TestBBRv2LossEndsStartup(t *testing.T) {
+	b := NewBBRv2(nil)
+
+	now := time.Now()
+	b.OnAcked(1400, 10*time.Millisecond, now)
+	now = now.Add(20 * time.Millisecond)
+	b.OnLost(1400, now)
+	now = now.Add(20 * time.Millisecond)
+	b.OnAcked(1400, 10*time.Millisecond, now)
+
+	if b.GetState() == StateStartup {
+		t.Error("Expected heavy loss to end STARTUP")
+	}
+}
+
+func TestBBRv2BoundsInflightOnCE(t *testing.T) {
+	b := NewBBRv2(nil)
+	b.Seed(1024*1024, 50*time.Millisecond)
+
+	// A round trip in which most packets arrive marked CE, without loss
+	now := time.Now()
+	for i := 0; i < 9; i++ {
+		now = now.Add(5 * time.Millisecond)
+		b.OnAcked(1400, 50*time.Millisecond, now)
+	}
+	cwnd := b.Cwnd()
+	now = now.Add(10 * time.Millisecond)
+	b.OnCongestionExperienced(8, now)
+
+	if b.Cwnd() >= cwnd {
+		t.Fatalf("Expected CE marks to bound the window below %d, got %d", cwnd, b.Cwnd())
+	}
+	if stats := b.Statistics(); stats["ce_rate"] == 0.0 || stats["ce_packets"] != uint64(8) {
+		t.Errorf("Expected statistics with the CE rate, got %v", stats)
+	}
+}
@@ -0,0 +1,211 @@
+package quantum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// A connection is closed gracefully by Close: it stops accepting new data
+// (StateClosing), waits until everything queued has been sent and
+// acknowledged, then sends FIN, repeated every RTO, until the peer answers
+// with FIN-ACK. Both phases together are bounded by Config.Linger; data still
+// unacknowledged when it runs out is abandoned and the peer is sent RST
+// instead of FIN.
+//
+// A peer receiving FIN has already acknowledged all of the closing side's
+// data. It answers FIN-ACK and closes too, discarding data it has not sent
+// yet. RST aborts a connection at once, as does hearing nothing from the
+// peer for Config.IdleTimeout. Data already delivered stays readable after
+// the connection has closed.
+
+var (
+	// ErrConnectionReset reports that the peer aborted the connection
+	ErrConnectionReset = errors.New("connection reset by peer")
+
+	// ErrIdleTimeout reports that nothing was heard from the peer for
+	// Config.IdleTimeout
+	ErrIdleTimeout = errors.New("connection idle timeout")
+)
+
+// Close closes the connection gracefully, waiting up to Config.Linger for
+// queued data to be acknowledged and the peer to confirm the close
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	from := c.state
+	if from == StateClosing || from == StateClosed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.state = StateClosing
+	c.mu.Unlock()
+	c.notifyState(from, StateClosing)
+
+	switch {
+	case from == StateEstablished:
+		c.shutdown()
+	case from == StateConnecting && c.listener != nil:
+		// Refuse a handshake the client may already consider complete
+		c.transmit(transport.NewPacket(c.guid, 0, 0, protocol.FlagRST, nil))
+	}
+
+	return c.teardown(nil)
+}
+
+// shutdown drains queued data and exchanges FIN and FIN-ACK with the peer,
+// or sends RST if the data cannot be delivered within the linger time
+func (c *Connection) shutdown() {
+	linger := c.config.Linger
+	if linger <= 0 {
+		linger = DefaultLinger
+	}
+	deadline := time.Now().Add(linger)
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	err := c.Flush(ctx)
+	cancel()
+	if err != nil {
+		if ctx.Err() != nil {
+			c.transmit(transport.NewPacket(c.guid, 0, 0, protocol.FlagRST, nil))
+		}
+		return
+	}
+
+	for {
+		c.transmit(transport.NewPacket(c.guid, 0, 0, protocol.FlagFIN, nil))
+
+		wait := min(c.sendBuf.RTO(), time.Until(deadline))
+		if wait <= 0 {
+			return
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-c.finAcked:
+			timer.Stop()
+			return
+		case <-c.closeSignal:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// teardown stops the connection's goroutines and releases its socket, once.
+// err records why the connection closed, nil for a graceful close.
+func (c *Connection) teardown(err error) error {
+	var closeErr error
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		from := c.state
+		c.state = StateClosing
+		c.closeErr = err
+		c.mu.Unlock()
+		c.notifyState(from, StateClosing)
+
+		// Signal goroutines to stop
+		close(c.closeSignal)
+		c.stopAcks()
+
+		// Wait for goroutines
+		c.wg.Wait()
+
+		// Keep our final estimates for the next resumption
+		if c.listener == nil && c.config.Tickets != nil {
+			c.config.Tickets.remember(c.dialAddr, c.cc.Bandwidth(), c.cc.MinRTT())
+		}
+
+		// Listener-owned connections share the socket; only detach from it
+		if c.listener != nil {
+			c.listener.remove(c.guid)
+		} else {
+			closeErr = c.conn.Close()
+		}
+
+		c.setState(StateClosed)
+		c.stopTrace()
+	})
+	return closeErr
+}
+
+// handleClose processes a FIN, FIN-ACK or RST from the peer. It runs on
+// recvLoop, so closing is left to another goroutine.
+func (c *Connection) handleClose(packet *transport.Packet) {
+	switch {
+	case packet.Header.HasFlag(protocol.FlagRST):
+		go c.teardown(ErrConnectionReset)
+
+	case packet.Header.HasFlag(protocol.FlagACK):
+		// FIN-ACK: the peer confirms our FIN
+		notify(c.finAcked)
+
+	default:
+		// FIN: the peer has all of our data it is waiting for. Answer every
+		// FIN, since our FIN-ACK may have been lost.
+		c.transmit(transport.NewPacket(c.guid, 0, 0, protocol.FlagFIN|protocol.FlagACK, nil))
+
+		// During a simultaneous close our own Close finishes the job
+		if c.State() == StateEstablished {
+			go c.teardown(nil)
+		}
+	}
+}
+
+// isClose reports whether a packet is a FIN, FIN-ACK or RST
+func isClose(packet *transport.Packet) bool {
+	return packet.Header.HasFlag(protocol.FlagFIN) || packet.Header.HasFlag(protocol.FlagRST)
+}
+
+// checkIdle closes a connection the peer has been silent on for
+// Config.IdleTimeout, returning true if it did. It must only be called from
+// reliabilityLoop.
+func (c *Connection) checkIdle() bool {
+	timeout := c.config.IdleTimeout
+	if timeout <= 0 || time.Since(time.Unix(0, c.lastRecv.Load())) < timeout {
+		return false
+	}
+	go c.teardown(ErrIdleTimeout)
+	return true
+}
+
+// setState moves the connection to a new state
+func (c *Connection) setState(to State) {
+	c.mu.Lock()
+	from := c.state
+	c.state = to
+	c.mu.Unlock()
+	c.notifyState(from, to)
+}
+
+// notifyState reports a state transition to Config.OnStateChange
+func (c *Connection) notifyState(from, to State) {
+	if from == to {
+		return
+	}
+	c.traceState(from, to)
+	c.trackMetrics(to)
+	if c.config.OnStateChange != nil {
+		c.config.OnStateChange(c, from, to)
+	}
+}
+
+// closedError returns the error reported by operations on a closed connection
+func (c *Connection) closedError() error {
+	if err := c.Err(); err != nil {
+		return fmt.Errorf("connection closed: %w", err)
+	}
+	return fmt.Errorf("connection closed")
+}
+
+// Err returns why the connection was aborted: ErrConnectionReset or
+// ErrIdleTimeout. It returns nil while the connection is open and after a
+// graceful close.
+func (c *Connection) Err() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closeErr
+}
@@ -0,0 +1,169 @@
+package quantum
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stateRecorder collects the state transitions of a connection
+type stateRecorder struct {
+	mu          sync.Mutex
+	transitions []State
+}
+
+func (r *stateRecorder) record(c *Connection, from, to State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.transitions) == 0 {
+		r.transitions = append(r.transitions, from)
+	}
+	r.transitions = append(r.transitions, to)
+}
+
+func (r *stateRecorder) states() []State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.transitions)
+}
+
+// waitClosed waits until a connection has closed
+func waitClosed(t *testing.T, c *Connection) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.State() != StateClosed {
+		if time.Now().After(deadline) {
+			t.Fatalf("Connection still %v", c.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGracefulClose(t *testing.T) {
+	var clientStates, serverStates stateRecorder
+
+	serverConfig := DefaultConfig()
+	serverConfig.OnStateChange = serverStates.record
+	listener := newTestListener(t, serverConfig)
+
+	clientConfig := DefaultConfig()
+	clientConfig.OnStateChange = clientStates.record
+	client, server := newTestPair(t, listener, listener.Addr().String(), clientConfig)
+
+	// Close right after queueing: everything is delivered before FIN
+	const count = 200
+	for i := 0; i < count; i++ {
+		if err := client.Send([]byte(fmt.Sprintf("message %d", i))); err != nil {
+			t.Fatalf("Failed to send message %d: %v", i, err)
+		}
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if n := client.sendBuf.InFlight(); n != 0 {
+		t.Errorf("Expected no data in flight after Close, got %d packets", n)
+	}
+
+	// The peer closes on FIN and keeps delivered messages readable
+	waitClosed(t, server)
+	for i := 0; i < count; i++ {
+		data, err := server.ReceiveWithTimeout(time.Second)
+		if err != nil {
+			t.Fatalf("Failed to receive message %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("message %d", i); string(data) != want {
+			t.Fatalf("Expected %q, got %q", want, data)
+		}
+	}
+	if _, err := server.Receive(); err == nil {
+		t.Error("Expected Receive to fail once the queue is drained")
+	}
+
+	if client.Err() != nil || server.Err() != nil {
+		t.Errorf("Expected a graceful close, got %v and %v", client.Err(), server.Err())
+	}
+
+	want := []State{StateInit, StateConnecting, StateEstablished, StateClosing, StateClosed}
+	if got := clientStates.states(); !slices.Equal(got, want) {
+		t.Errorf("Expected client transitions %v, got %v", want, got)
+	}
+	if got := serverStates.states(); !slices.Equal(got, want) {
+		t.Errorf("Expected server transitions %v, got %v", want, got)
+	}
+}
+
+func TestCloseLingerReset(t *testing.T) {
+	serverConfig := DefaultConfig()
+	serverConfig.RecvWindow = 8
+	listener := newTestListener(t, serverConfig)
+
+	clientConfig := DefaultConfig()
+	clientConfig.Linger = 200 * time.Millisecond
+	client, server := newTestPair(t, listener, listener.Addr().String(), clientConfig)
+
+	// The server does not read, so its window closes and data stays queued
+	for i := 0; i < 50; i++ {
+		if err := client.Send([]byte("data")); err != nil {
+			t.Fatalf("Failed to send message %d: %v", i, err)
+		}
+	}
+
+	start := time.Now()
+	client.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %v, longer than its linger time", elapsed)
+	}
+
+	// The abandoned data is reported to the peer with RST
+	waitClosed(t, server)
+	if !errors.Is(server.Err(), ErrConnectionReset) {
+		t.Fatalf("Expected the server to be reset, got %v", server.Err())
+	}
+	if _, err := server.Receive(); err != nil {
+		t.Errorf("Expected delivered data to stay readable: %v", err)
+	}
+
+	if err := server.Send([]byte("late")); err == nil {
+		t.Error("Expected Send to fail on a reset connection")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.IdleTimeout = 300 * time.Millisecond
+
+	t.Run("Silent", func(t *testing.T) {
+		config := *config
+		config.KeepaliveInterval = time.Minute
+
+		listener := newTestListener(t, &config)
+		client, server := newTestPair(t, listener, listener.Addr().String(), &config)
+
+		for _, c := range []*Connection{client, server} {
+			waitClosed(t, c)
+			if !errors.Is(c.Err(), ErrIdleTimeout) {
+				t.Errorf("Expected an idle timeout, got %v", c.Err())
+			}
+		}
+		if _, err := client.Receive(); !errors.Is(err, ErrIdleTimeout) {
+			t.Errorf("Expected Receive to report the idle timeout, got %v", err)
+		}
+	})
+
+	t.Run("Keepalive", func(t *testing.T) {
+		config := *config
+		config.KeepaliveInterval = 50 * time.Millisecond
+
+		listener := newTestListener(t, &config)
+		client, server := newTestPair(t, listener, listener.Addr().String(), &config)
+
+		time.Sleep(3 * config.IdleTimeout)
+		if client.State() != StateEstablished || server.State() != StateEstablished {
+			t.Errorf("Expected keepalives to hold the connection open, got %v and %v", client.State(), server.State())
+		}
+	})
+}
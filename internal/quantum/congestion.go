@@ -0,0 +1,109 @@
+package quantum
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/bbr"
+	"github.com/aetherflow/aetherflow/internal/quantum/cubic"
+	"github.com/aetherflow/aetherflow/internal/quantum/reliability"
+)
+
+// CongestionAlgorithm names a congestion control algorithm
+type CongestionAlgorithm string
+
+const (
+	// CongestionBBR is model-based BBR, the default
+	CongestionBBR CongestionAlgorithm = "bbr"
+
+	// CongestionBBRv2 is BBR bounded by the observed loss rate
+	CongestionBBRv2 CongestionAlgorithm = "bbr2"
+
+	// CongestionCUBIC is loss-based CUBIC (RFC 9438)
+	CongestionCUBIC CongestionAlgorithm = "cubic"
+)
+
+// CongestionController decides how much a connection may have in flight and
+// how fast to send it. A connection reports every data packet it sends, the
+// bytes each ACK newly acknowledges and every packet it retransmits; sendLoop
+// holds data back while bytes in flight reach Cwnd and waits PacingDelay
+// between packets.
+type CongestionController interface {
+	// OnSent records a sent packet
+	OnSent(size uint32, now time.Time)
+
+	// OnAcked records bytes newly acknowledged by one ACK and the RTT
+	// sample it produced
+	OnAcked(size uint32, rtt time.Duration, now time.Time)
+
+	// OnLost records a packet detected as lost
+	OnLost(size uint32, now time.Time)
+
+	// OnCongestionExperienced records data packets the path marked CE
+	// (ECN), a sign of congestion without loss
+	OnCongestionExperienced(packets uint32, now time.Time)
+
+	// PacingDelay returns the delay before sending the next packet
+	PacingDelay(size uint32) time.Duration
+
+	// Cwnd returns the congestion window in bytes
+	Cwnd() uint32
+
+	// Bandwidth returns the estimated bandwidth in bytes/sec
+	Bandwidth() uint64
+
+	// MinRTT returns the minimum RTT observed
+	MinRTT() time.Duration
+
+	// Seed starts the controller from estimates remembered from an earlier
+	// connection over the same path
+	Seed(bandwidth uint64, rtt time.Duration)
+
+	// Reset forgets all path estimates, e.g. after migrating to a new path
+	Reset()
+
+	// Statistics returns algorithm-specific statistics
+	Statistics() map[string]interface{}
+}
+
+// newCongestionController creates the controller selected by config
+func newCongestionController(config *Config) (CongestionController, error) {
+	switch config.CongestionControl {
+	case "", CongestionBBR:
+		return bbr.NewBBR(config.BBRConfig), nil
+	case CongestionBBRv2:
+		return bbr.NewBBRv2(config.BBRConfig), nil
+	case CongestionCUBIC:
+		return cubic.NewCUBIC(config.CUBICConfig), nil
+	default:
+		return nil, fmt.Errorf("unknown congestion control algorithm %q", config.CongestionControl)
+	}
+}
+
+// onAcked reports the packets an ACK newly acknowledged to congestion
+// control as one delivery. The RTT sample is the freshest among packets sent
+// only once, as a retransmitted packet's ACK may answer an earlier copy.
+func (c *Connection) onAcked(acked []*reliability.SentPacket, ackDelay time.Duration) {
+	now := time.Now()
+
+	var bytes uint32
+	var rtt time.Duration
+	for _, pkt := range acked {
+		bytes += uint32(len(pkt.Packet.Payload))
+		if pkt.RetransCount == 0 {
+			if sample := now.Sub(pkt.SendTime); rtt == 0 || sample < rtt {
+				rtt = sample
+			}
+		}
+	}
+	if rtt == 0 {
+		rtt = c.sendBuf.SRTT()
+	} else if rtt-ackDelay >= c.sendBuf.MinRTT() {
+		// Take out the time the peer held the ACK, as the RTT estimate does
+		rtt -= ackDelay
+	}
+
+	c.traceAcked(acked)
+	c.cc.OnAcked(bytes, rtt, now)
+	c.traceCongestion()
+}
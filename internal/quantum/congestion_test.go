@@ -0,0 +1,57 @@
+package quantum
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCongestionControlAlgorithms(t *testing.T) {
+	for _, algorithm := range []CongestionAlgorithm{CongestionBBR, CongestionBBRv2, CongestionCUBIC} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			config := DefaultConfig()
+			config.CongestionControl = algorithm
+
+			listener := newTestListener(t, config)
+			client, server := newTestPair(t, listener, listener.Addr().String(), config)
+
+			// Enough data to fill several initial windows
+			payload := bytes.Repeat([]byte("x"), 1000)
+			const messages = 200
+			for i := 0; i < messages; i++ {
+				if err := client.Send(payload); err != nil {
+					t.Fatalf("Failed to send message %d: %v", i, err)
+				}
+			}
+			for i := 0; i < messages; i++ {
+				data, err := server.ReceiveWithTimeout(5 * time.Second)
+				if err != nil {
+					t.Fatalf("Failed to receive message %d: %v", i, err)
+				}
+				if !bytes.Equal(data, payload) {
+					t.Fatalf("Message %d corrupted", i)
+				}
+			}
+
+			stats := client.CongestionStats()
+			if stats["algorithm"] != string(algorithm) {
+				t.Errorf("Expected %s statistics, got %v", algorithm, stats)
+			}
+			if client.cc.MinRTT() <= 0 {
+				t.Error("Expected an RTT estimate from acknowledged data")
+			}
+		})
+	}
+}
+
+func TestCongestionControlUnknown(t *testing.T) {
+	config := DefaultConfig()
+	config.CongestionControl = "reno"
+
+	if _, err := Listen("udp", "127.0.0.1:0", config); err == nil {
+		t.Error("Expected Listen to reject an unknown algorithm")
+	}
+	if _, err := Dial("udp", "127.0.0.1:9", config); err == nil {
+		t.Error("Expected Dial to reject an unknown algorithm")
+	}
+}
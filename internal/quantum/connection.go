@@ -4,13 +4,20 @@ package quantum
 import (
 	"context"
 	"fmt"
+	"net"
+	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	guuid "github.com/Lzww0608/GUUID"
 	"github.com/aetherflow/aetherflow/internal/quantum/bbr"
+	"github.com/aetherflow/aetherflow/internal/quantum/crypto"
+	"github.com/aetherflow/aetherflow/internal/quantum/cubic"
 	"github.com/aetherflow/aetherflow/internal/quantum/fec"
 	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/qlog"
 	"github.com/aetherflow/aetherflow/internal/quantum/reliability"
 	"github.com/aetherflow/aetherflow/internal/quantum/transport"
 )
@@ -28,8 +35,29 @@ const (
 	// DefaultIdleTimeout is the default idle timeout
 	DefaultIdleTimeout = 60 * time.Second
 
+	// DefaultLinger is how long Close waits by default for queued data to be
+	// acknowledged and the peer to confirm the close
+	DefaultLinger = 5 * time.Second
+
 	// MaxRetries is the maximum number of connection retries
 	MaxRetries = 5
+
+	// DefaultHandshakeTimeout bounds how long a SYN/SYN-ACK/ACK exchange may take
+	DefaultHandshakeTimeout = 5 * time.Second
+
+	// DefaultAcceptBacklog is the default number of connections a Listener
+	// holds between SYN and Accept
+	DefaultAcceptBacklog = 128
+
+	// DefaultMaxAckDelay is how long a receiver holds an ACK back by default
+	DefaultMaxAckDelay = 25 * time.Millisecond
+
+	// DefaultAckFrequency is how many data packets a receiver acknowledges
+	// with one ACK when the peer asks for no particular frequency
+	DefaultAckFrequency = 2
+
+	// synRetryInterval is how often an unanswered SYN is retransmitted
+	synRetryInterval = 1 * time.Second
 )
 
 // State represents connection state
@@ -78,29 +106,127 @@ type Connection struct {
 	localAddr  string
 	remoteAddr string
 
-	// State
-	state State
-
-	// Transport layer
-	conn *transport.Conn
+	// State. closeErr records why an aborted connection closed.
+	state     State
+	closeErr  error
+	closeOnce sync.Once
+	finAcked  chan struct{}
+
+	// When a packet was last received from the peer, in Unix nanoseconds
+	lastRecv atomic.Int64
+
+	// Transport layer. A listener-owned connection shares conn with its
+	// Listener and receives packets demultiplexed by GUUID through inbound.
+	conn     *transport.Conn
+	remote   *net.UDPAddr
+	listener *Listener
+	inbound  chan *transport.Packet
+
+	// Path validation, owned by recvLoop. A listener-side connection that
+	// hears its peer from a new address challenges that address and only
+	// moves remote there once the challenge is answered.
+	pathCandidate *net.UDPAddr
+	pathChallenge [protocol.PathChallengeSize]byte
+	pathSentAt    time.Time
 
 	// Reliability layer
 	sendBuf *reliability.SendBuffer
 	recvBuf *reliability.ReceiveBuffer
 
+	// Initial sequence numbers, ours and the peer's, random unless the peer
+	// predates random ISNs. randomISN records whether the peer chose one.
+	isn       atomic.Uint32
+	peerISN   atomic.Uint32
+	randomISN atomic.Bool
+
+	// Delayed acknowledgment of received data
+	acks ackState
+
+	// ECN codepoints sent and received, and validation of the path
+	ecn ecnState
+
 	// Congestion control
-	bbr *bbr.BBR
+	cc CongestionController
+
+	// Path MTU discovery, nil when disabled
+	pmtu *pmtuDiscovery
+
+	// qlog trace, nil when disabled
+	tracer *tracer
+
+	// Our key share for the handshake, nil when not encrypting
+	kex *crypto.KeyExchange
+
+	// Keys that seal and open packets, set once the handshake has derived
+	// them; a resuming dialer holds its 0-RTT keys here until the SYN-ACK
+	session atomic.Pointer[crypto.Session]
+
+	// 0-RTT keys a resumed listener side still accepts until the client
+	// has switched to the handshake keys
+	early atomic.Pointer[crypto.Session]
+
+	// Session resumption. A resuming dialer keeps its ticket until readLoop
+	// has seen the SYN-ACK; synSentAt and handshakeStart are owned by
+	// reliabilityLoop once started. resumedFrom is guarded by mu.
+	// ticketEstimates records that a listener-side connection has issued a
+	// ticket carrying congestion estimates, after which it issues no more.
+	dialAddr        string
+	resumption      *Ticket
+	resumed         atomic.Bool
+	synSentAt       time.Time
+	handshakeStart  time.Time
+	resumedFrom     guuid.UUID
+	resumedOK       bool
+	ticketEstimates atomic.Bool
 
 	// Forward error correction
 	fecEnabled bool
 	fecEncoder *fec.Encoder
 	fecDecoder *fec.Decoder
 
-	// Channels for data flow
-	sendQueue   chan *transport.Packet
+	// Current outgoing FEC group, owned by sendLoop
+	fecGroupStart uint32
+	fecGroupCount int
+
+	// Adaptive parity control, owned by reliabilityLoop
+	fecCtl       *fecController
+	fecLastAdapt time.Time
+
+	// Stream multiplexing. Send/Receive use the default stream, whose
+	// reassembler is owned by recvLoop and whose sequence number is owned
+	// by sendLoop.
+	streamMu       sync.Mutex
+	streams        map[uint32]*Stream
+	nextStreamID   uint32
+	maxPeerStream  uint32
+	acceptStreams  []*Stream
+	streamAccepted chan struct{}
+	defaultReasm   *frameReassembler
+	defaultSeq     uint32
+
+	// Receive flow control. pendingRecv counts data packets delivered but
+	// not yet consumed by the application; advertisedEdge is the cumulative
+	// ACK plus window last sent to the peer.
+	pendingRecv     atomic.Int64
+	advertisedEdge  atomic.Uint32
+	lastWindowProbe time.Time // owned by reliabilityLoop
+
+	// Wire protocol version spoken with the peer. Listener-side connections
+	// answer older peers in their own version; a dialer offers
+	// Config.Version and moves to an older one if the listener asks to.
+	version uint8
+
+	// Data flow. unsent counts data packets handed to the send queues that
+	// sendLoop has not yet assigned a sequence number.
+	unsent      atomic.Int64
+	sched       *sendScheduler
 	recvQueue   chan []byte
 	closeSignal chan struct{}
 
+	// Unreliable datagrams waiting for sendLoop and ReceiveDatagram
+	datagramSend chan *datagram
+	datagramRecv chan *datagram
+
 	// Goroutine management
 	wg sync.WaitGroup
 
@@ -117,18 +243,111 @@ type Config struct {
 	SendWindow uint32
 	RecvWindow uint32
 
-	// Keepalive and timeout
+	// Keepalive and timeout. A connection that receives nothing from the
+	// peer for IdleTimeout is closed; zero disables the timeout.
 	KeepaliveInterval time.Duration
 	IdleTimeout       time.Duration
 
-	// FEC configuration
-	FECEnabled      bool
-	FECDataShards   int
-	FECParityShards int
-
-	// BBR configuration
+	// Linger bounds how long Close waits for queued data to be
+	// acknowledged and the peer to confirm the close (default
+	// DefaultLinger). Data still unacknowledged then is abandoned.
+	Linger time.Duration
+
+	// AcceptBacklog limits the connections a Listener keeps between
+	// receiving SYN and Accept returning them
+	AcceptBacklog int
+
+	// Delayed acknowledgments. A receiver holds an ACK back for up to
+	// MaxAckDelay, zero acknowledging every packet at once, and in the
+	// handshake asks its peer to acknowledge every AckFrequency data
+	// packets (default DefaultAckFrequency).
+	MaxAckDelay  time.Duration
+	AckFrequency uint16
+
+	// ECN marks data packets ECN-capable, where the transport supports it,
+	// once the path has shown that it carries the marks, and slows down for
+	// packets a congested router marked. Received marks are echoed either
+	// way.
+	ECN bool
+
+	// FEC configuration. With FECAdaptive the parity count starts at
+	// FECParityShards and follows the observed loss rate, up to
+	// FECMaxParityShards, dropping to zero on clean links.
+	FECEnabled         bool
+	FECDataShards      int
+	FECParityShards    int
+	FECAdaptive        bool
+	FECMaxParityShards int
+
+	// Path MTU discovery (DPLPMTUD) sizes data packets to the largest
+	// datagram the path carries, probing up to MaxDatagramSize (default
+	// protocol.MaxDatagramSize). It is off by default: packets then carry
+	// protocol.DefaultPayloadSize bytes and may be fragmented. With it on,
+	// packets start at protocol.MinDatagramSize, so messages larger than
+	// that fit only once probing has raised the path MTU.
+	PMTUDiscovery   bool
+	MaxDatagramSize int
+
+	// Encryption seals every payload with AES-256-GCM under keys derived
+	// from an X25519 exchange carried in SYN/SYN-ACK, authenticating the
+	// header as associated data. A dialer offers its key in the SYN and a
+	// listener accepts by answering with its own. A side with Encryption set
+	// refuses peers that do not encrypt, since an on-path attacker can strip
+	// the key from a SYN or SYN-ACK; AllowPlaintext opts into falling back
+	// to plaintext instead. PreSharedKey overrides AllowPlaintext: only
+	// peers holding the same key complete the handshake.
+	Encryption     bool
+	AllowPlaintext bool
+	PreSharedKey   []byte
+
+	// Session resumption (requires Encryption). A dialer with Tickets set
+	// caches the tickets servers issue and uses them to resume with 0-RTT
+	// data on the next dial to the same address. A listener seals tickets
+	// with TicketKey, random per process when unset, valid for
+	// TicketLifetime.
+	Tickets        *TicketCache
+	TicketKey      []byte
+	TicketLifetime time.Duration
+
+	// Version is the wire protocol version a dialer offers (default
+	// CurrentVersion). A listener that does not speak it answers with the
+	// versions it does and the dialer retries with the newest common one;
+	// listeners predating version negotiation stay silent, so dialers that
+	// must reach them set the version those listeners speak.
+	Version uint8
+
+	// OnMigrate, if set, is called when a peer has moved to a new address
+	// and the new path has been validated, e.g. a mobile client switching
+	// from Wi-Fi to cellular or a NAT rebinding. It runs on the connection's
+	// receive goroutine and must not block.
+	OnMigrate func(c *Connection, from, to *net.UDPAddr)
+
+	// Qlog, if set, opens a qlog trace of each connection on the sink it
+	// returns, e.g. qlog.DirSinks(dir); returning nil leaves the connection
+	// untraced. It is called as a dial starts and as a listener receives a
+	// SYN.
+	Qlog func(info qlog.TraceInfo) qlog.Sink
+
+	// Metrics, if set, exports the connection's transport health to
+	// Prometheus through a collector usually shared by all of a process's
+	// connections. A connection is counted from the handshake's completion.
+	Metrics *Collector
+
+	// OnStateChange, if set, is called on every connection state
+	// transition. It runs on the goroutine causing the transition, possibly
+	// one of the connection's own, and must not block.
+	OnStateChange func(c *Connection, from, to State)
+
+	// CongestionControl selects the congestion control algorithm; empty
+	// means CongestionBBR
+	CongestionControl CongestionAlgorithm
+
+	// BBR configuration, used by both BBR variants
 	BBRConfig *bbr.Config
 
+	// CUBIC configuration
+	CUBICConfig *cubic.Config
+
 	// Transport configuration
 	TransportConfig *transport.Config
 }
@@ -142,20 +361,37 @@ type Statistics struct {
 	PacketsLost      uint64
 	PacketsRecovered uint64
 	Retransmissions  uint64
+	Migrations       uint64
+
+	// Unreliable datagrams. Dropped counts datagrams that expired or were
+	// displaced by newer ones in a full queue, on either side.
+	DatagramsSent     uint64
+	DatagramsReceived uint64
+	DatagramsDropped  uint64
 }
 
 // DefaultConfig returns default connection configuration
 func DefaultConfig() *Config {
 	return &Config{
-		SendWindow:        DefaultSendWindow,
-		RecvWindow:        DefaultRecvWindow,
-		KeepaliveInterval: DefaultKeepaliveInterval,
-		IdleTimeout:       DefaultIdleTimeout,
-		FECEnabled:        true,
-		FECDataShards:     fec.DefaultDataShards,
-		FECParityShards:   fec.DefaultParityShards,
-		BBRConfig:         bbr.DefaultConfig(),
-		TransportConfig:   transport.DefaultConfig(),
+		SendWindow:         DefaultSendWindow,
+		RecvWindow:         DefaultRecvWindow,
+		KeepaliveInterval:  DefaultKeepaliveInterval,
+		IdleTimeout:        DefaultIdleTimeout,
+		Linger:             DefaultLinger,
+		AcceptBacklog:      DefaultAcceptBacklog,
+		MaxAckDelay:        DefaultMaxAckDelay,
+		ECN:                true,
+		FECEnabled:         true,
+		FECDataShards:      fec.DefaultDataShards,
+		FECParityShards:    fec.DefaultParityShards,
+		FECAdaptive:        true,
+		FECMaxParityShards: fec.DefaultMaxParityShards,
+		MaxDatagramSize:    protocol.MaxDatagramSize,
+		TicketLifetime:     DefaultTicketLifetime,
+		CongestionControl:  CongestionBBR,
+		BBRConfig:          bbr.DefaultConfig(),
+		CUBICConfig:        cubic.DefaultConfig(),
+		TransportConfig:    transport.DefaultConfig(),
 	}
 }
 
@@ -165,55 +401,66 @@ func Dial(network, address string, config *Config) (*Connection, error) {
 		config = DefaultConfig()
 	}
 
-	// Generate GUUID for this connection using UUIDv7 (time-ordered)
-	guid, err := guuid.NewV7()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate GUUID: %w", err)
-	}
-
 	// Create transport connection
 	conn, err := transport.Dial(network, address, config.TransportConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial: %w", err)
 	}
 
-	// Create connection
-	qconn := &Connection{
-		guid:        guid,
-		localAddr:   conn.LocalAddr().String(),
-		remoteAddr:  conn.RemoteAddr().String(),
-		state:       StateInit,
-		conn:        conn,
-		sendBuf:     reliability.NewSendBuffer(config.SendWindow),
-		recvBuf:     reliability.NewReceiveBuffer(config.RecvWindow),
-		bbr:         bbr.NewBBR(config.BBRConfig),
-		fecEnabled:  config.FECEnabled,
-		sendQueue:   make(chan *transport.Packet, 1024),
-		recvQueue:   make(chan []byte, 1024),
-		closeSignal: make(chan struct{}),
-		config:      config,
+	return dial(conn, address, config)
+}
+
+// DialPacketConn creates a new connection to a remote address over an
+// existing packet connection, such as a simulated path from package netsim.
+// The connection takes ownership of pc.
+func DialPacketConn(pc net.PacketConn, addr *net.UDPAddr, config *Config) (*Connection, error) {
+	if config == nil {
+		config = DefaultConfig()
 	}
+	return dial(transport.NewConn(pc, addr, config.TransportConfig), addr.String(), config)
+}
 
-	// Initialize FEC if enabled
-	if config.FECEnabled {
-		fecConfig := &fec.Config{
-			DataShards:   config.FECDataShards,
-			ParityShards: config.FECParityShards,
-		}
-		qconn.fecEncoder, err = fec.NewEncoder(fecConfig)
-		if err != nil {
-			conn.Close()
-			return nil, fmt.Errorf("failed to create FEC encoder: %w", err)
-		}
-		qconn.fecDecoder, err = fec.NewDecoder(fecConfig)
-		if err != nil {
+// dial connects over a transport connection to its remote address, which
+// was dialed as address
+func dial(conn *transport.Conn, address string, config *Config) (*Connection, error) {
+	// Generate GUUID for this connection using UUIDv7 (time-ordered)
+	guid, err := guuid.NewV7()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to generate GUUID: %w", err)
+	}
+
+	// Probes must be lost, not fragmented, when they exceed the path MTU
+	if config.PMTUDiscovery {
+		if err := conn.SetDontFragment(); err != nil {
 			conn.Close()
-			return nil, fmt.Errorf("failed to create FEC decoder: %w", err)
+			return nil, fmt.Errorf("failed to disable fragmentation: %w", err)
 		}
 	}
 
-	// Start connection handshake
-	if err := qconn.connect(); err != nil {
+	// Create connection
+	qconn, err := newConnection(guid, conn, conn.RemoteAddr(), config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	qconn.dialAddr = address
+	qconn.startTrace()
+
+	// Resume with 0-RTT data when holding a ticket for the server, otherwise
+	// run the full handshake
+	var ticket *Ticket
+	if config.Encryption && config.Tickets != nil {
+		ticket = config.Tickets.take(address)
+	}
+	if ticket != nil {
+		err = qconn.connectEarly(ticket)
+	} else {
+		err = qconn.connect()
+	}
+	if err != nil {
+		qconn.stopTrace()
 		conn.Close()
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
@@ -224,38 +471,61 @@ func Dial(network, address string, config *Config) (*Connection, error) {
 	return qconn, nil
 }
 
-// Listen creates a server connection listening on an address
-func Listen(network, address string, config *Config) (*Connection, error) {
-	if config == nil {
-		config = DefaultConfig()
+// newConnection creates a connection in StateInit with its own reliability,
+// congestion control and FEC state
+func newConnection(guid guuid.UUID, conn *transport.Conn, remote *net.UDPAddr, config *Config) (*Connection, error) {
+	qconn := &Connection{
+		guid:           guid,
+		localAddr:      conn.LocalAddr().String(),
+		state:          StateInit,
+		conn:           conn,
+		remote:         remote,
+		inbound:        make(chan *transport.Packet, 1024),
+		sendBuf:        reliability.NewSendBuffer(config.SendWindow),
+		recvBuf:        reliability.NewReceiveBuffer(config.RecvWindow),
+		fecEnabled:     config.FECEnabled,
+		streams:        make(map[uint32]*Stream),
+		streamAccepted: make(chan struct{}, 1),
+		defaultReasm:   newFrameReassembler(),
+		version:        config.Version,
+		sched:          newSendScheduler(),
+		recvQueue:      make(chan []byte, max(1024, int(config.RecvWindow))),
+		closeSignal:    make(chan struct{}),
+		finAcked:       make(chan struct{}, 1),
+		datagramSend:   make(chan *datagram, datagramQueueSize),
+		datagramRecv:   make(chan *datagram, datagramQueueSize),
+		config:         config,
+	}
+	if remote != nil {
+		qconn.remoteAddr = remote.String()
 	}
+	if qconn.version == 0 {
+		qconn.version = protocol.CurrentVersion
+	}
+	qconn.setInitialSeqNum(newInitialSeqNum())
+	qconn.peerISN.Store(1)
 
-	// Generate GUUID for this connection using UUIDv7 (time-ordered)
-	guid, err := guuid.NewV7()
+	cc, err := newCongestionController(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate GUUID: %w", err)
+		return nil, err
 	}
+	qconn.cc = cc
 
-	// Create transport connection
-	conn, err := transport.Listen(network, address, config.TransportConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to listen: %w", err)
+	if config.PMTUDiscovery {
+		qconn.pmtu = newPMTUDiscovery(config.MaxDatagramSize)
 	}
 
-	// Create connection
-	qconn := &Connection{
-		guid:        guid,
-		localAddr:   conn.LocalAddr().String(),
-		state:       StateInit,
-		conn:        conn,
-		sendBuf:     reliability.NewSendBuffer(config.SendWindow),
-		recvBuf:     reliability.NewReceiveBuffer(config.RecvWindow),
-		bbr:         bbr.NewBBR(config.BBRConfig),
-		fecEnabled:  config.FECEnabled,
-		sendQueue:   make(chan *transport.Packet, 1024),
-		recvQueue:   make(chan []byte, 1024),
-		closeSignal: make(chan struct{}),
-		config:      config,
+	if config.Metrics != nil {
+		qconn.sendBuf.SetRTTObserver(qconn.observeRTT)
+	}
+
+	// Generate the ephemeral key pair offered in the handshake
+	if config.Encryption {
+		var err error
+		qconn.kex, err = crypto.NewKeyExchange()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create key exchange: %w", err)
+		}
 	}
 
 	// Initialize FEC if enabled
@@ -264,62 +534,137 @@ func Listen(network, address string, config *Config) (*Connection, error) {
 			DataShards:   config.FECDataShards,
 			ParityShards: config.FECParityShards,
 		}
+		var err error
 		qconn.fecEncoder, err = fec.NewEncoder(fecConfig)
 		if err != nil {
-			conn.Close()
 			return nil, fmt.Errorf("failed to create FEC encoder: %w", err)
 		}
 		qconn.fecDecoder, err = fec.NewDecoder(fecConfig)
 		if err != nil {
-			conn.Close()
 			return nil, fmt.Errorf("failed to create FEC decoder: %w", err)
 		}
+
+		if config.FECAdaptive {
+			maxParity := config.FECMaxParityShards
+			if maxParity <= 0 {
+				maxParity = fec.DefaultMaxParityShards
+			}
+			qconn.fecCtl = newFECController(config.FECDataShards, config.FECParityShards, maxParity)
+			qconn.fecLastAdapt = time.Now()
+		}
 	}
 
 	return qconn, nil
 }
 
-// connect performs the connection handshake
+// connect performs the client side of the connection handshake
 func (c *Connection) connect() error {
-	c.mu.Lock()
-	c.state = StateConnecting
-	c.mu.Unlock()
+	c.setState(StateConnecting)
+
+	deadline := time.Now().Add(DefaultHandshakeTimeout)
+	for time.Now().Before(deadline) {
+		// Send (or retransmit) SYN packet, offering our public key if encrypting
+		var offer []byte
+		if c.kex != nil {
+			offer = c.kex.PublicKey()
+		}
+		synPacket := c.synPacket(offer)
+		if err := c.conn.Send(synPacket); err != nil {
+			return fmt.Errorf("failed to send SYN: %w", err)
+		}
 
-	// Send SYN packet
-	synPacket := transport.NewPacket(c.guid, 0, 0, protocol.FlagSYN, nil)
-	if err := c.conn.Send(synPacket); err != nil {
-		return fmt.Errorf("failed to send SYN: %w", err)
+		// Wait for SYN-ACK until the next retransmission is due
+		attemptDeadline := time.Now().Add(synRetryInterval)
+		if attemptDeadline.After(deadline) {
+			attemptDeadline = deadline
+		}
+		ctx, cancel := context.WithDeadline(context.Background(), attemptDeadline)
+		established, err := c.awaitSynAck(ctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if established {
+			return nil
+		}
 	}
 
-	// Wait for SYN-ACK with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	return fmt.Errorf("failed to receive SYN-ACK: handshake timed out after %v", DefaultHandshakeTimeout)
+}
 
+// awaitSynAck waits for the server's SYN-ACK and completes the handshake.
+// It returns false without error when ctx expires so the SYN can be retried.
+func (c *Connection) awaitSynAck(ctx context.Context) (bool, error) {
 	for {
 		packet, err := c.conn.ReceivePacket(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to receive SYN-ACK: %w", err)
+			if ctx.Err() != nil {
+				return false, nil
+			}
+			continue
+		}
+
+		if packet.Header.GUUID != c.guid {
+			continue
+		}
+		c.tracePacket(qlog.EventPacketReceived, packet, packet)
+
+		if packet.Header.HasFlag(protocol.FlagRST) {
+			return false, fmt.Errorf("connection refused by %s", packet.Addr)
+		}
+
+		// The listener does not speak our version; retry in the newest
+		// one we have in common
+		if packet.Header.Version == protocol.VersionNegotiation {
+			version, ok := protocol.NegotiateVersion(c.version, packet.Payload)
+			if !ok {
+				return false, fmt.Errorf("no protocol version in common with %s: it supports %v", packet.Addr, packet.Payload)
+			}
+			c.version = version
+			return false, nil
 		}
 
 		if packet.Header.HasFlag(protocol.FlagSYN) && packet.Header.HasFlag(protocol.FlagACK) {
-			// Send ACK
-			ackPacket := transport.NewPacket(c.guid, 1, 1, protocol.FlagACK, nil)
-			if err := c.conn.Send(ackPacket); err != nil {
-				return fmt.Errorf("failed to send ACK: %w", err)
+			// Derive session keys and check the server's key confirmation
+			if c.kex != nil {
+				if len(packet.Payload) == 0 && !c.config.requiresEncryption() {
+					// The server declined encryption and we allow plaintext
+					c.kex = nil
+				} else if err := c.acceptSynAck(packet, nil); err != nil {
+					return false, err
+				}
+			}
+			c.applyHandshake(packet.Header)
+
+			// Send ACK; when encrypting, it proves our keys to the server
+			ackPacket := transport.NewPacket(c.guid, 0, c.recvBuf.NextExpected(), protocol.FlagACK, nil)
+			if err := c.transmit(ackPacket); err != nil {
+				return false, fmt.Errorf("failed to send ACK: %w", err)
 			}
 
 			c.mu.Lock()
-			c.state = StateEstablished
 			c.remoteAddr = packet.Addr.String()
 			c.mu.Unlock()
+			c.setState(StateEstablished)
 
-			return nil
+			return true, nil
 		}
 	}
 }
 
 // start starts the connection goroutines
 func (c *Connection) start() {
+	// The peer starts out with a full receive window
+	c.advertisedEdge.Store(protocol.SeqAdd(c.recvBuf.NextExpected(), c.config.RecvWindow))
+	c.lastRecv.Store(time.Now().UnixNano())
+
+	// Dialed connections own their socket and feed inbound themselves;
+	// listener-owned connections are fed by the Listener
+	if c.listener == nil {
+		c.wg.Add(1)
+		go c.readLoop()
+	}
+
 	// Send loop
 	c.wg.Add(1)
 	go c.sendLoop()
@@ -350,46 +695,131 @@ func (c *Connection) sendLoop() {
 			return
 
 		case <-ticker.C:
+			// Datagrams are not retransmitted, so neither window holds
+			// them back
+			c.sendQueuedDatagram()
+
 			// Check if we can send
 			if !c.sendBuf.CanSend() {
 				continue
 			}
 
-			select {
-			case packet := <-c.sendQueue:
-				// Send packet
-				if err := c.conn.Send(packet); err != nil {
-					// Handle send error
-					continue
-				}
-
-				// Update statistics
-				c.mu.Lock()
-				c.stats.PacketsSent++
-				c.stats.BytesSent += uint64(len(packet.Payload))
-				c.mu.Unlock()
+			// Hold data back while the congestion window is full
+			if c.sendBuf.BytesInFlight() >= uint64(c.cc.Cwnd()) {
+				continue
+			}
 
-				// Add to send buffer
+			if packet := c.nextPacket(); packet != nil {
+				// Assign sequence number and track for retransmission
 				c.sendBuf.AddPacket(packet)
 
-				// Notify BBR
-				c.bbr.OnPacketSent(uint32(len(packet.Payload)), time.Now())
+				// Add to the current FEC group; completing the group yields parity
+				var parity []*transport.Packet
+				if c.fecEncoder != nil {
+					parity = c.protectPacket(packet)
+				}
 
-				// Calculate pacing delay
-				delay := c.bbr.CalculatePacingDelay(uint32(len(packet.Payload)))
+				// Send packet followed by any parity packets in one batch. A
+				// failed data send will be retransmitted; parity is best
+				// effort.
+				batch := append([]*transport.Packet{packet}, parity...)
+				n, _ := c.transmitBatch(batch)
+
+				// Notify congestion control and pace the whole batch
+				var delay time.Duration
+				for _, p := range batch[:n] {
+					c.cc.OnSent(uint32(len(p.Payload)), time.Now())
+					delay += c.cc.PacingDelay(uint32(len(p.Payload)))
+				}
 				if delay > 0 {
 					time.Sleep(delay)
 				}
-
-			default:
-				// No packet to send
 			}
 		}
 	}
 }
 
-// recvLoop handles receiving packets
-func (c *Connection) recvLoop() {
+// transmit writes a packet to the peer and updates statistics. Control
+// packets and retransmissions are sent through here directly so they neither
+// consume sequence numbers nor wait behind queued data.
+func (c *Connection) transmit(packet *transport.Packet) error {
+	return c.transmitTo(packet, c.peerAddr())
+}
+
+// transmitTo writes a packet to a specific peer address
+func (c *Connection) transmitTo(packet *transport.Packet, addr *net.UDPAddr) error {
+	wire, err := c.prepare(packet)
+	if err != nil {
+		return err
+	}
+
+	if err := c.conn.SendPacket(wire, addr); err != nil {
+		return err
+	}
+	c.tracePacket(qlog.EventPacketSent, packet, wire)
+
+	c.mu.Lock()
+	c.stats.PacketsSent++
+	c.stats.BytesSent += uint64(len(packet.Payload))
+	c.mu.Unlock()
+
+	return nil
+}
+
+// transmitBatch writes packets to the peer in order with as few system calls
+// as the platform allows. It stops at the first packet that cannot be sent
+// and returns how many were sent before it.
+func (c *Connection) transmitBatch(packets []*transport.Packet) (int, error) {
+	wires := make([]*transport.Packet, 0, len(packets))
+	var prepareErr error
+	for _, packet := range packets {
+		wire, err := c.prepare(packet)
+		if err != nil {
+			prepareErr = err
+			break
+		}
+		wires = append(wires, wire)
+	}
+
+	n, err := c.conn.SendBatch(wires, c.peerAddr())
+
+	var bytes uint64
+	for i, packet := range packets[:n] {
+		bytes += uint64(len(packet.Payload))
+		c.tracePacket(qlog.EventPacketSent, packet, wires[i])
+	}
+	c.mu.Lock()
+	c.stats.PacketsSent += uint64(n)
+	c.stats.BytesSent += bytes
+	c.mu.Unlock()
+
+	if err != nil {
+		return n, err
+	}
+	return n, prepareErr
+}
+
+// prepare returns the packet as it goes on the wire
+func (c *Connection) prepare(packet *transport.Packet) (*transport.Packet, error) {
+	// Stamp a copy of the header with the peer's version and our current
+	// receive window, leaving queued packets untouched for retransmission
+	header := *packet.Header
+	header.Version = c.version
+	header.Window = c.receiveWindow()
+	c.piggybackAck(&header, packet)
+	if header.HasFlag(protocol.FlagACK) {
+		c.advertisedEdge.Store(protocol.SeqAdd(header.AckNumber, header.Window))
+	}
+
+	wire := &transport.Packet{Header: &header, Payload: packet.Payload, Addr: packet.Addr, ECN: c.ecnMark(&header)}
+	if c.session.Load() != nil {
+		return c.seal(wire)
+	}
+	return wire, nil
+}
+
+// readLoop reads packets from a dialed connection's own socket
+func (c *Connection) readLoop() {
 	defer c.wg.Done()
 
 	for {
@@ -398,7 +828,6 @@ func (c *Connection) recvLoop() {
 			return
 
 		default:
-			// Receive packet
 			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 			packet, err := c.conn.ReceivePacket(ctx)
 			cancel()
@@ -407,6 +836,48 @@ func (c *Connection) recvLoop() {
 				continue
 			}
 
+			if packet.Header.GUUID != c.guid || packet.Header.Version == protocol.VersionNegotiation {
+				continue
+			}
+
+			// A SYN-ACK completes a resumed handshake; any other is a
+			// duplicate of one already handled
+			if packet.Header.HasFlag(protocol.FlagSYN) && packet.Header.HasFlag(protocol.FlagACK) {
+				if c.resumption != nil {
+					c.completeResumption(packet)
+				}
+				continue
+			}
+
+			// Drop packets that fail authentication
+			if err := c.open(packet); err != nil {
+				continue
+			}
+
+			c.deliver(packet)
+		}
+	}
+}
+
+// deliver queues a received packet for processing, dropping it if the
+// connection is too far behind (the peer will retransmit)
+func (c *Connection) deliver(packet *transport.Packet) {
+	select {
+	case c.inbound <- packet:
+	default:
+	}
+}
+
+// recvLoop handles received packets
+func (c *Connection) recvLoop() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-c.closeSignal:
+			return
+
+		case packet := <-c.inbound:
 			// Process received packet
 			c.handleReceivedPacket(packet)
 		}
@@ -420,42 +891,115 @@ func (c *Connection) handleReceivedPacket(packet *transport.Packet) {
 	c.stats.PacketsReceived++
 	c.stats.BytesReceived += uint64(len(packet.Payload))
 	c.mu.Unlock()
+	c.lastRecv.Store(time.Now().UnixNano())
+	c.tracePacket(qlog.EventPacketReceived, packet, packet)
+	congested := c.ecnReceived(packet)
+
+	// Control frames are handled outside the packet sequence
+	if isControl(packet) {
+		c.handleControl(packet)
+		return
+	}
+
+	// A peer heard from a new address may have migrated
+	if c.listener != nil {
+		c.checkPath(packet)
+	}
+
+	// Datagrams bypass acknowledgment and flow control
+	if isDatagram(packet) {
+		c.handleDatagram(packet)
+		return
+	}
+
+	// FIN, FIN-ACK and RST carry no sequence number or acknowledgment
+	if isClose(packet) {
+		c.handleClose(packet)
+		return
+	}
 
 	// Handle ACK
 	if packet.Header.HasFlag(protocol.FlagACK) {
-		ackedSeqs := c.sendBuf.HandleACK(packet.Header.AckNumber, packet.Header.SACKBlocks)
+		ackDelay, _ := packet.Header.AckDelay()
+		acked := c.sendBuf.HandleACKWithDelay(packet.Header.AckNumber, packet.Header.SACKBlocks, ackDelay)
+		c.onECNCounts(packet.Header)
+		if len(acked) > 0 {
+			c.onAcked(acked, ackDelay)
+		}
+		if c.pmtu != nil && slices.ContainsFunc(acked, func(pkt *reliability.SentPacket) bool {
+			return c.isLargePacket(pkt.Packet)
+		}) {
+			c.pmtu.onLargeAcked()
+		}
 
-		// Notify BBR of ACKs
-		for range ackedSeqs {
-			c.bbr.OnPacketAcked(uint32(len(packet.Payload)), c.sendBuf.SRTT(), time.Now())
+		// Respect the receive window the peer advertised with this ACK
+		if packet.Header.HasWindow() {
+			c.sendBuf.UpdatePeerWindow(packet.Header.AckNumber, packet.Header.Window)
 		}
 	}
 
-	// Handle data
-	if len(packet.Payload) > 0 {
-		// Add to receive buffer
-		ordered, isDuplicate, err := c.recvBuf.AddPacket(packet)
-		if err != nil || isDuplicate {
-			return
-		}
+	// Answer keepalives and window probes with our current ACK and window
+	if isKeepalive(packet) {
+		c.sendAck()
+		return
+	}
 
-		// Deliver ordered packets
-		for _, pkt := range ordered {
-			select {
-			case c.recvQueue <- pkt.Payload:
-			default:
-				// Queue full, drop packet
-			}
+	// Collect data packets: the packet itself, plus any rebuilt by FEC
+	var data, recovered []*transport.Packet
+	if packet.Header.HasFlag(protocol.FlagFEC) {
+		data, recovered = c.handleFECShard(packet)
+	} else if len(packet.Payload) > 0 {
+		data = []*transport.Packet{packet}
+	}
+
+	if len(data) == 0 && len(recovered) == 0 {
+		return
+	}
+
+	// Acknowledge at once whatever the peer's loss recovery may be waiting
+	// on: gaps opened or filled, duplicates, refused and repaired packets,
+	// packets the peer flagged urgent, and congestion marks
+	immediate := c.recvBuf.BufferedCount() > 0 || len(recovered) > 0 ||
+		packet.Header.HasFlag(protocol.FlagURG) || congested
+
+	for _, pkt := range data {
+		if !c.acceptData(pkt) {
+			immediate = true
 		}
+	}
 
-		// Send ACK
-		ackNum, sackBlocks := c.recvBuf.GenerateSACK()
-		ackPacket := transport.NewPacket(c.guid, 0, ackNum, protocol.FlagACK, nil)
-		for _, block := range sackBlocks {
-			ackPacket.Header.AddSACKBlock(block.Start, block.End)
+	for _, pkt := range recovered {
+		if c.acceptData(pkt) {
+			c.mu.Lock()
+			c.stats.PacketsRecovered++
+			c.mu.Unlock()
+			c.traceRecovered(pkt)
 		}
-		c.sendQueue <- ackPacket
 	}
+
+	if c.recvBuf.BufferedCount() > 0 {
+		immediate = true
+	}
+	c.scheduleAck(immediate)
+}
+
+// acceptData records a data packet for acknowledgment and hands its stream
+// frame on immediately; ordering is restored per stream, so a gap in the
+// packet sequence does not hold back other streams. It returns false for
+// duplicates and packets refused for lack of receive buffer space.
+func (c *Connection) acceptData(packet *transport.Packet) bool {
+	if !c.admitData(packet) {
+		return false
+	}
+
+	_, isDuplicate, err := c.recvBuf.AddPacket(packet)
+	if err != nil || isDuplicate {
+		return false
+	}
+
+	c.dispatchFrame(packet.Payload)
+
+	return true
 }
 
 // reliabilityLoop handles retransmission detection
@@ -471,27 +1015,68 @@ func (c *Connection) reliabilityLoop() {
 			return
 
 		case <-ticker.C:
+			// Close the connection if the peer has gone silent
+			if c.checkIdle() {
+				return
+			}
+
 			// Detect lost packets
 			fastRetrans, timeoutRetrans := c.sendBuf.DetectLostPackets()
 
-			// Retransmit lost packets
-			for _, packet := range fastRetrans {
-				c.sendQueue <- packet
-				c.mu.Lock()
-				c.stats.Retransmissions++
-				c.mu.Unlock()
+			// Send window updates and probe a closed peer window
+			c.updateFlowControl()
+
+			// Repeat an unanswered resuming SYN
+			c.retryResumeSyn()
+
+			// Probe the path MTU
+			if c.pmtu != nil {
+				c.probePathMTU()
 			}
 
-			for _, packet := range timeoutRetrans {
-				c.sendQueue <- packet
-				c.mu.Lock()
-				c.stats.Retransmissions++
-				c.mu.Unlock()
+			// Forget FEC groups too old to receive more shards
+			if c.fecDecoder != nil {
+				c.fecDecoder.CleanupOldGroups(fecKeepGroups)
 			}
+
+			// Re-evaluate the FEC parity count
+			if c.fecCtl != nil && time.Since(c.fecLastAdapt) >= fecAdaptInterval {
+				c.adaptFEC()
+				c.fecLastAdapt = time.Now()
+			}
+
+			// Retransmit lost packets
+			c.retransmit(fastRetrans, qlog.TriggerReorderingThreshold)
+
+			// Timeouts of large packets may mean the path MTU has shrunk
+			if c.pmtu != nil && slices.ContainsFunc(timeoutRetrans, c.isLargePacket) {
+				c.pmtu.onLargeTimeout()
+			}
+
+			c.retransmit(timeoutRetrans, qlog.TriggerTimeThreshold)
 		}
 	}
 }
 
+// retransmit resends lost packets in one batch. trigger is how the loss
+// was detected, for the trace.
+func (c *Connection) retransmit(packets []*transport.Packet, trigger string) {
+	if len(packets) == 0 {
+		return
+	}
+	for _, packet := range packets {
+		c.cc.OnLost(uint32(len(packet.Payload)), time.Now())
+	}
+	c.traceLost(packets, trigger)
+	c.traceCongestion()
+	c.transmitBatch(packets)
+
+	c.mu.Lock()
+	c.stats.PacketsLost += uint64(len(packets))
+	c.stats.Retransmissions += uint64(len(packets))
+	c.mu.Unlock()
+}
+
 // keepaliveLoop sends periodic keepalive packets
 func (c *Connection) keepaliveLoop() {
 	defer c.wg.Done()
@@ -507,16 +1092,26 @@ func (c *Connection) keepaliveLoop() {
 		case <-ticker.C:
 			// Send keepalive packet
 			packet := transport.NewPacket(c.guid, 0, 0, 0, nil)
-			select {
-			case c.sendQueue <- packet:
-			default:
+			c.transmit(packet)
+
+			// Replace the ticket issued at establishment once we have
+			// estimates worth resuming from
+			if !c.ticketEstimates.Load() && c.cc.Bandwidth() > 0 {
+				c.issueTicket()
 			}
 		}
 	}
 }
 
-// Send sends data over the connection
+// Send sends a message on the connection's default stream
 func (c *Connection) Send(data []byte) error {
+	return c.SendWithOptions(data, SendOptions{})
+}
+
+// SendWithOptions sends a message on the connection's default stream in a
+// priority class, dropping it if it cannot be sent before a deadline.
+// Messages of different classes may arrive out of order.
+func (c *Connection) SendWithOptions(data []byte, opts SendOptions) error {
 	c.mu.RLock()
 	if c.state != StateEstablished {
 		c.mu.RUnlock()
@@ -524,26 +1119,78 @@ func (c *Connection) Send(data []byte) error {
 	}
 	c.mu.RUnlock()
 
-	// Create packet
-	seqNum := c.sendBuf.NextSeqNum()
-	packet := transport.NewPacket(c.guid, seqNum, 0, 0, data)
+	if len(data) > c.maxFrameData() {
+		return fmt.Errorf("message too large: %d > %d bytes", len(data), c.maxFrameData())
+	}
+
+	if !opts.Deadline.IsZero() && !time.Now().Before(opts.Deadline) {
+		return os.ErrDeadlineExceeded
+	}
+
+	frame := &protocol.StreamFrame{
+		StreamID: protocol.DefaultStreamID,
+		Data:     data,
+	}
+
+	// Create packet; the packet and stream sequence numbers are assigned
+	// when it leaves the queue
+	o := &outgoing{
+		packet:   transport.NewPacket(c.guid, 0, 0, 0, frame.Marshal()),
+		deadline: opts.Deadline,
+		queuedAt: time.Now(),
+		message:  true,
+	}
+
+	// Queue for sending, waiting for room until the deadline if sooner
+	timeout := 5 * time.Second
+	if !opts.Deadline.IsZero() {
+		timeout = min(timeout, time.Until(opts.Deadline))
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
-	// Queue for sending
+	c.unsent.Add(1)
 	select {
-	case c.sendQueue <- packet:
+	case c.sched.queue(opts.Priority) <- o:
 		return nil
-	case <-time.After(5 * time.Second):
+	case <-timer.C:
+		c.unsent.Add(-1)
+		if !opts.Deadline.IsZero() && !time.Now().Before(opts.Deadline) {
+			return os.ErrDeadlineExceeded
+		}
 		return fmt.Errorf("send queue full")
 	}
 }
 
-// Receive receives data from the connection
+// Flush waits until all queued data has been sent and acknowledged by the peer
+func (c *Connection) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if c.unsent.Load() == 0 && c.sendBuf.InFlight() == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.closeSignal:
+			return fmt.Errorf("connection closed")
+		}
+	}
+}
+
+// Receive receives a message from the connection's default stream. Messages
+// delivered before the connection closed can still be received.
 func (c *Connection) Receive() ([]byte, error) {
 	select {
 	case data := <-c.recvQueue:
+		c.consumed(1)
 		return data, nil
 	case <-c.closeSignal:
-		return nil, fmt.Errorf("connection closed")
+		return c.receiveClosed()
 	}
 }
 
@@ -551,44 +1198,23 @@ func (c *Connection) Receive() ([]byte, error) {
 func (c *Connection) ReceiveWithTimeout(timeout time.Duration) ([]byte, error) {
 	select {
 	case data := <-c.recvQueue:
+		c.consumed(1)
 		return data, nil
 	case <-time.After(timeout):
 		return nil, fmt.Errorf("receive timeout")
 	case <-c.closeSignal:
-		return nil, fmt.Errorf("connection closed")
+		return c.receiveClosed()
 	}
 }
 
-// Close closes the connection
-func (c *Connection) Close() error {
-	c.mu.Lock()
-	if c.state == StateClosed || c.state == StateClosing {
-		c.mu.Unlock()
-		return nil
-	}
-	c.state = StateClosing
-	c.mu.Unlock()
-
-	// Send FIN packet
-	finPacket := transport.NewPacket(c.guid, 0, 0, protocol.FlagFIN, nil)
-	c.conn.Send(finPacket)
-
-	// Signal goroutines to stop
-	close(c.closeSignal)
-
-	// Wait for goroutines
-	c.wg.Wait()
-
-	// Close transport connection
-	if err := c.conn.Close(); err != nil {
-		return err
+// receiveClosed returns a message still queued on a closed connection
+func (c *Connection) receiveClosed() ([]byte, error) {
+	select {
+	case data := <-c.recvQueue:
+		return data, nil
+	default:
+		return nil, c.closedError()
 	}
-
-	c.mu.Lock()
-	c.state = StateClosed
-	c.mu.Unlock()
-
-	return nil
 }
 
 // State returns the current connection state
@@ -615,6 +1241,13 @@ func (c *Connection) RemoteAddr() string {
 	return c.remoteAddr
 }
 
+// peerAddr returns the peer's current UDP address
+func (c *Connection) peerAddr() *net.UDPAddr {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.remote
+}
+
 // Statistics returns connection statistics
 func (c *Connection) Statistics() Statistics {
 	c.mu.RLock()
@@ -622,7 +1255,24 @@ func (c *Connection) Statistics() Statistics {
 	return c.stats
 }
 
-// BBRStats returns BBR statistics
+// FECConfig returns the data and parity shard counts used for the current
+// or next outgoing FEC group
+func (c *Connection) FECConfig() (dataShards, parityShards int) {
+	if c.fecEncoder == nil {
+		return 0, 0
+	}
+	return c.fecEncoder.GetConfig()
+}
+
+// CongestionStats returns congestion control statistics; the "algorithm"
+// key names the algorithm in use
+func (c *Connection) CongestionStats() map[string]interface{} {
+	return c.cc.Statistics()
+}
+
+// BBRStats returns congestion control statistics.
+//
+// Deprecated: use CongestionStats, which is the same for any algorithm.
 func (c *Connection) BBRStats() map[string]interface{} {
-	return c.bbr.Statistics()
+	return c.CongestionStats()
 }
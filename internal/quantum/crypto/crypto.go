@@ -0,0 +1,275 @@
+// Package crypto implements the Quantum protocol key exchange and packet sealing
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// PublicKeySize is the size of an X25519 public key carried in SYN/SYN-ACK
+	PublicKeySize = 32
+
+	// NonceSize is the size of the explicit packet counter prefixed to sealed payloads
+	NonceSize = 8
+
+	// TagSize is the size of the AES-GCM authentication tag
+	TagSize = 16
+
+	// Overhead is the number of bytes sealing adds to a payload
+	Overhead = NonceSize + TagSize
+
+	// ReplayWindowSize is the number of recent packet counters tracked to
+	// reject replayed packets
+	ReplayWindowSize = 1024
+
+	keySize = 32
+	ivSize  = 12
+
+	// kdfLabel separates Quantum session keys from other uses of the secret
+	kdfLabel = "quantum v1 session keys"
+)
+
+// KeyExchange holds an ephemeral X25519 key pair for one handshake
+type KeyExchange struct {
+	private *ecdh.PrivateKey
+}
+
+// NewKeyExchange generates an ephemeral key pair
+func NewKeyExchange() (*KeyExchange, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+	return &KeyExchange{private: private}, nil
+}
+
+// PublicKey returns the public key to send to the peer
+func (k *KeyExchange) PublicKey() []byte {
+	return k.private.PublicKey().Bytes()
+}
+
+// DeriveSession combines the peer's public key with ours into a Session.
+// The pre-shared key, if any, is mixed into the derivation so only peers
+// holding it arrive at the same keys. context binds the keys to the
+// connection (e.g. its GUUID) and is hashed together with both public keys.
+func (k *KeyExchange) DeriveSession(peerPublic, psk, context []byte, isClient bool) (*Session, error) {
+	peer, err := ecdh.X25519().NewPublicKey(peerPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer public key: %w", err)
+	}
+
+	secret, err := k.private.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("key agreement failed: %w", err)
+	}
+
+	// Order the public keys client first so both ends derive the same info
+	clientPublic, serverPublic := k.PublicKey(), peerPublic
+	if !isClient {
+		clientPublic, serverPublic = serverPublic, clientPublic
+	}
+	info := make([]byte, 0, len(kdfLabel)+len(context)+2*PublicKeySize)
+	info = append(info, kdfLabel...)
+	info = append(info, context...)
+	info = append(info, clientPublic...)
+	info = append(info, serverPublic...)
+
+	material, err := hkdf.Key(sha256.New, secret, psk, string(info), 2*(keySize+ivSize))
+	if err != nil {
+		return nil, fmt.Errorf("key derivation failed: %w", err)
+	}
+
+	clientKey, clientIV := material[:keySize], material[keySize:keySize+ivSize]
+	serverKey, serverIV := material[keySize+ivSize:2*keySize+ivSize], material[2*keySize+ivSize:]
+
+	sealKey, sealIV, openKey, openIV := clientKey, clientIV, serverKey, serverIV
+	if !isClient {
+		sealKey, sealIV, openKey, openIV = serverKey, serverIV, clientKey, clientIV
+	}
+
+	s := &Session{}
+	if s.sealAEAD, err = newAEAD(sealKey); err != nil {
+		return nil, err
+	}
+	if s.openAEAD, err = newAEAD(openKey); err != nil {
+		return nil, err
+	}
+	copy(s.sealIV[:], sealIV)
+	copy(s.openIV[:], openIV)
+
+	return s, nil
+}
+
+// newAEAD creates an AES-256-GCM AEAD
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AEAD: %w", err)
+	}
+	return aead, nil
+}
+
+// Session seals outgoing and opens incoming payloads with per-direction keys.
+// Each sealed payload carries an explicit packet counter that forms the
+// nonce, so retransmissions are sealed afresh and never reuse a nonce.
+type Session struct {
+	sealAEAD cipher.AEAD
+	sealIV   [ivSize]byte
+	counter  atomic.Uint64
+
+	openAEAD cipher.AEAD
+	openIV   [ivSize]byte
+
+	mu     sync.Mutex
+	replay replayWindow
+
+	// Statistics
+	sealed   atomic.Uint64
+	opened   atomic.Uint64
+	rejected atomic.Uint64
+	replayed atomic.Uint64
+}
+
+// Seal encrypts plaintext, authenticating header as associated data. The
+// header must already carry the sealed payload length (len(plaintext)+Overhead).
+func (s *Session) Seal(header, plaintext []byte) []byte {
+	n := s.counter.Add(1)
+
+	out := make([]byte, NonceSize, NonceSize+len(plaintext)+TagSize)
+	binary.BigEndian.PutUint64(out, n)
+
+	nonce := makeNonce(s.sealIV, n)
+	out = s.sealAEAD.Seal(out, nonce[:], plaintext, header)
+
+	s.sealed.Add(1)
+	return out
+}
+
+// Open authenticates and decrypts a sealed payload. It rejects payloads that
+// fail authentication and packet counters that were already seen.
+func (s *Session) Open(header, sealed []byte) ([]byte, error) {
+	if len(sealed) < Overhead {
+		s.rejected.Add(1)
+		return nil, fmt.Errorf("sealed payload too small: need at least %d bytes, got %d", Overhead, len(sealed))
+	}
+
+	n := binary.BigEndian.Uint64(sealed[:NonceSize])
+
+	s.mu.Lock()
+	fresh := s.replay.check(n)
+	s.mu.Unlock()
+	if !fresh {
+		s.replayed.Add(1)
+		return nil, fmt.Errorf("replayed packet counter %d", n)
+	}
+
+	nonce := makeNonce(s.openIV, n)
+	plaintext, err := s.openAEAD.Open(nil, nonce[:], sealed[NonceSize:], header)
+	if err != nil {
+		s.rejected.Add(1)
+		return nil, fmt.Errorf("authentication failed: %w", err)
+	}
+
+	// Only authenticated counters advance the window
+	s.mu.Lock()
+	fresh = s.replay.record(n)
+	s.mu.Unlock()
+	if !fresh {
+		s.replayed.Add(1)
+		return nil, fmt.Errorf("replayed packet counter %d", n)
+	}
+
+	s.opened.Add(1)
+	return plaintext, nil
+}
+
+// Statistics returns session statistics
+func (s *Session) Statistics() map[string]uint64 {
+	return map[string]uint64{
+		"sealed":   s.sealed.Load(),
+		"opened":   s.opened.Load(),
+		"rejected": s.rejected.Load(),
+		"replayed": s.replayed.Load(),
+	}
+}
+
+// makeNonce XORs the packet counter into the low bytes of the IV
+func makeNonce(iv [ivSize]byte, n uint64) [ivSize]byte {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], n)
+	for i := range counter {
+		iv[ivSize-8+i] ^= counter[i]
+	}
+	return iv
+}
+
+// replayWindow tracks which of the most recent packet counters were seen
+type replayWindow struct {
+	highest uint64
+	bits    [ReplayWindowSize / 64]uint64
+}
+
+// check reports whether counter n is new and within the window
+func (w *replayWindow) check(n uint64) bool {
+	if n == 0 {
+		return false // Counters start at 1
+	}
+	if n > w.highest {
+		return true
+	}
+	if w.highest-n >= ReplayWindowSize {
+		return false
+	}
+	return !w.has(n)
+}
+
+// record marks counter n as seen, sliding the window forward if needed.
+// It returns false if n was not new.
+func (w *replayWindow) record(n uint64) bool {
+	if !w.check(n) {
+		return false
+	}
+
+	if n > w.highest {
+		// Clear the slots of counters skipped over
+		if n-w.highest >= ReplayWindowSize {
+			w.bits = [ReplayWindowSize / 64]uint64{}
+		} else {
+			for i := w.highest + 1; i < n; i++ {
+				w.clear(i)
+			}
+		}
+		w.highest = n
+	}
+
+	w.set(n)
+	return true
+}
+
+func (w *replayWindow) has(n uint64) bool {
+	i := n % ReplayWindowSize
+	return w.bits[i/64]&(1<<(i%64)) != 0
+}
+
+func (w *replayWindow) set(n uint64) {
+	i := n % ReplayWindowSize
+	w.bits[i/64] |= 1 << (i % 64)
+}
+
+func (w *replayWindow) clear(n uint64) {
+	i := n % ReplayWindowSize
+	w.bits[i/64] &^= 1 << (i % 64)
+}
@@ -0,0 +1,156 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+// newSessionPair runs a key exchange and returns client and server sessions
+func newSessionPair(t *testing.T, clientPSK, serverPSK []byte) (client, server *Session) {
+	t.Helper()
+
+	clientKex, err := NewKeyExchange()
+	if err != nil {
+		t.Fatalf("Failed to create client key exchange: %v", err)
+	}
+	serverKex, err := NewKeyExchange()
+	if err != nil {
+		t.Fatalf("Failed to create server key exchange: %v", err)
+	}
+
+	context := []byte("connection-id")
+	client, err = clientKex.DeriveSession(serverKex.PublicKey(), clientPSK, context, true)
+	if err != nil {
+		t.Fatalf("Failed to derive client session: %v", err)
+	}
+	server, err = serverKex.DeriveSession(clientKex.PublicKey(), serverPSK, context, false)
+	if err != nil {
+		t.Fatalf("Failed to derive server session: %v", err)
+	}
+
+	return client, server
+}
+
+func TestSealOpen(t *testing.T) {
+	client, server := newSessionPair(t, nil, nil)
+
+	header := []byte("header")
+	plaintext := []byte("hello quantum")
+
+	sealed := client.Seal(header, plaintext)
+	if len(sealed) != len(plaintext)+Overhead {
+		t.Fatalf("Expected %d sealed bytes, got %d", len(plaintext)+Overhead, len(sealed))
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Error("Sealed payload contains the plaintext")
+	}
+
+	opened, err := server.Open(header, sealed)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Expected %q, got %q", plaintext, opened)
+	}
+
+	// Each direction has its own keys
+	if _, err := client.Open(header, client.Seal(header, plaintext)); err == nil {
+		t.Error("Expected a session to reject its own sealed payloads")
+	}
+
+	// Retransmitting the same plaintext produces a different payload
+	if bytes.Equal(client.Seal(header, plaintext), client.Seal(header, plaintext)) {
+		t.Error("Expected each seal to use a fresh nonce")
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	client, server := newSessionPair(t, nil, nil)
+
+	sealed := client.Seal([]byte("header"), []byte("payload"))
+
+	if _, err := server.Open([]byte("HEADER"), sealed); err == nil {
+		t.Error("Expected modified header to be rejected")
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 0x01
+	if _, err := server.Open([]byte("header"), tampered); err == nil {
+		t.Error("Expected modified payload to be rejected")
+	}
+
+	if _, err := server.Open([]byte("header"), sealed[:Overhead-1]); err == nil {
+		t.Error("Expected truncated payload to be rejected")
+	}
+
+	// Failed attempts do not burn the counter of the genuine packet
+	if _, err := server.Open([]byte("header"), sealed); err != nil {
+		t.Errorf("Failed to open genuine payload: %v", err)
+	}
+
+	stats := server.Statistics()
+	if stats["rejected"] != 3 || stats["opened"] != 1 {
+		t.Errorf("Unexpected statistics: %v", stats)
+	}
+}
+
+func TestOpenRejectsReplay(t *testing.T) {
+	client, server := newSessionPair(t, nil, nil)
+	header := []byte("header")
+
+	first := client.Seal(header, []byte("first"))
+	second := client.Seal(header, []byte("second"))
+
+	// Reordering within the window is fine
+	if _, err := server.Open(header, second); err != nil {
+		t.Fatalf("Failed to open second packet: %v", err)
+	}
+	if _, err := server.Open(header, first); err != nil {
+		t.Fatalf("Failed to open reordered packet: %v", err)
+	}
+
+	if _, err := server.Open(header, first); err == nil {
+		t.Error("Expected replayed packet to be rejected")
+	}
+
+	// Packets older than the window are rejected
+	old := client.Seal(header, []byte("old"))
+	for i := 0; i < ReplayWindowSize; i++ {
+		if _, err := server.Open(header, client.Seal(header, nil)); err != nil {
+			t.Fatalf("Failed to open packet %d: %v", i, err)
+		}
+	}
+	if _, err := server.Open(header, old); err == nil {
+		t.Error("Expected packet older than the replay window to be rejected")
+	}
+}
+
+func TestPreSharedKey(t *testing.T) {
+	psk := []byte("shared secret")
+
+	client, server := newSessionPair(t, psk, psk)
+	if _, err := server.Open(nil, client.Seal(nil, []byte("ok"))); err != nil {
+		t.Errorf("Expected matching pre-shared keys to agree: %v", err)
+	}
+
+	client, server = newSessionPair(t, psk, []byte("other secret"))
+	if _, err := server.Open(nil, client.Seal(nil, []byte("ok"))); err == nil {
+		t.Error("Expected mismatched pre-shared keys to disagree")
+	}
+}
+
+func TestDeriveSessionRejectsInvalidKey(t *testing.T) {
+	kex, err := NewKeyExchange()
+	if err != nil {
+		t.Fatalf("Failed to create key exchange: %v", err)
+	}
+
+	if _, err := kex.DeriveSession(make([]byte, PublicKeySize-1), nil, nil, true); err == nil {
+		t.Error("Expected short public key to be rejected")
+	}
+
+	// The all-zero point yields an all-zero shared secret
+	if _, err := kex.DeriveSession(make([]byte, PublicKeySize), nil, nil, true); err == nil {
+		t.Error("Expected low-order public key to be rejected")
+	}
+}
@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+const (
+	// TicketKeySize is the size of the key servers seal resumption tickets with
+	TicketKeySize = 32
+
+	// SecretSize is the size of a resumption secret
+	SecretSize = 32
+
+	// TicketIDSize is the size of the nonce that identifies a ticket
+	TicketIDSize = ivSize
+
+	// TicketOverhead is the number of bytes sealing adds to ticket contents
+	TicketOverhead = TicketIDSize + TagSize
+
+	// earlyLabel separates 0-RTT keys from handshake session keys
+	earlyLabel = "quantum v1 early data"
+)
+
+// DeriveEarlySession derives the 0-RTT keys a resuming client seals its first
+// packets with, before the server has answered. Both ends derive them from
+// the resumption secret shared in a ticket; context binds them to the new
+// connection. The keys protect client-to-server packets only, so the same
+// key serves the client's Seal and the server's Open.
+func DeriveEarlySession(secret, context []byte) (*Session, error) {
+	info := make([]byte, 0, len(earlyLabel)+len(context))
+	info = append(info, earlyLabel...)
+	info = append(info, context...)
+
+	material, err := hkdf.Key(sha256.New, secret, nil, string(info), keySize+ivSize)
+	if err != nil {
+		return nil, fmt.Errorf("key derivation failed: %w", err)
+	}
+
+	aead, err := newAEAD(material[:keySize])
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{sealAEAD: aead, openAEAD: aead}
+	copy(s.sealIV[:], material[keySize:])
+	copy(s.openIV[:], material[keySize:])
+
+	return s, nil
+}
+
+// NewSecret returns a random resumption secret
+func NewSecret() ([]byte, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return secret, nil
+}
+
+// TicketKey seals the server state carried in resumption tickets. Tickets are
+// opaque to clients; only a server holding the key can read them back.
+type TicketKey struct {
+	aead cipher.AEAD
+}
+
+// NewTicketKey creates a ticket key. A nil key generates a random one, so
+// tickets are only valid for the lifetime of the process.
+func NewTicketKey(key []byte) (*TicketKey, error) {
+	if key == nil {
+		key = make([]byte, TicketKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate ticket key: %w", err)
+		}
+	}
+	if len(key) != TicketKeySize {
+		return nil, fmt.Errorf("invalid ticket key size: %d", len(key))
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &TicketKey{aead: aead}, nil
+}
+
+// Seal encrypts ticket contents under a random nonce, which prefixes the
+// ticket and serves as its unique identifier
+func (k *TicketKey) Seal(plaintext []byte) ([]byte, error) {
+	out := make([]byte, ivSize, TicketOverhead+len(plaintext))
+	if _, err := rand.Read(out); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return k.aead.Seal(out, out[:ivSize], plaintext, nil), nil
+}
+
+// Open authenticates and decrypts a ticket
+func (k *TicketKey) Open(ticket []byte) ([]byte, error) {
+	if len(ticket) < TicketOverhead {
+		return nil, fmt.Errorf("ticket too small: need at least %d bytes, got %d", TicketOverhead, len(ticket))
+	}
+
+	plaintext, err := k.aead.Open(nil, ticket[:ivSize], ticket[ivSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("ticket authentication failed: %w", err)
+	}
+	return plaintext, nil
+}
+
+// TicketID returns the unique identifier of a sealed ticket
+func TicketID(ticket []byte) [TicketIDSize]byte {
+	var id [TicketIDSize]byte
+	copy(id[:], ticket)
+	return id
+}
@@ -0,0 +1,80 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEarlySession(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("Failed to generate secret: %v", err)
+	}
+
+	client, err := DeriveEarlySession(secret, []byte("connection-id"))
+	if err != nil {
+		t.Fatalf("Failed to derive client early session: %v", err)
+	}
+	server, err := DeriveEarlySession(secret, []byte("connection-id"))
+	if err != nil {
+		t.Fatalf("Failed to derive server early session: %v", err)
+	}
+
+	plaintext, err := server.Open(nil, client.Seal(nil, []byte("0-rtt")))
+	if err != nil {
+		t.Fatalf("Failed to open early data: %v", err)
+	}
+	if string(plaintext) != "0-rtt" {
+		t.Errorf("Expected %q, got %q", "0-rtt", plaintext)
+	}
+
+	// Keys are bound to the connection
+	other, _ := DeriveEarlySession(secret, []byte("another-connection"))
+	if _, err := other.Open(nil, client.Seal(nil, []byte("0-rtt"))); err == nil {
+		t.Error("Expected early data to be bound to its connection")
+	}
+}
+
+func TestTicketKey(t *testing.T) {
+	key, err := NewTicketKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to create ticket key: %v", err)
+	}
+
+	state := []byte("server state")
+	ticket, err := key.Seal(state)
+	if err != nil {
+		t.Fatalf("Failed to seal ticket: %v", err)
+	}
+	if bytes.Contains(ticket, state) {
+		t.Error("Expected ticket contents to be encrypted")
+	}
+
+	opened, err := key.Open(ticket)
+	if err != nil {
+		t.Fatalf("Failed to open ticket: %v", err)
+	}
+	if !bytes.Equal(opened, state) {
+		t.Errorf("Expected %q, got %q", state, opened)
+	}
+
+	// Every ticket gets its own identifier
+	again, _ := key.Seal(state)
+	if TicketID(again) == TicketID(ticket) {
+		t.Error("Expected distinct ticket identifiers")
+	}
+
+	// Other servers' and tampered tickets are rejected
+	otherKey, _ := NewTicketKey(nil)
+	if _, err := otherKey.Open(ticket); err == nil {
+		t.Error("Expected ticket from another key to be rejected")
+	}
+	ticket[len(ticket)-1] ^= 1
+	if _, err := key.Open(ticket); err == nil {
+		t.Error("Expected tampered ticket to be rejected")
+	}
+
+	if _, err := NewTicketKey(make([]byte, 16)); err == nil {
+		t.Error("Expected short ticket key to be rejected")
+	}
+}
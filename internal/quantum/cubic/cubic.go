@@ -0,0 +1,305 @@
+// Package cubic implements the CUBIC congestion control algorithm for Quantum protocol
+// Based on RFC 9438: https://www.rfc-editor.org/rfc/rfc9438
+package cubic
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// C scales the cubic window growth function (packets/sec^3)
+	C = 0.4
+
+	// Beta is the multiplicative window decrease factor on loss or ECN
+	// congestion marks
+	Beta = 0.7
+
+	// MinCwnd is the minimum congestion window (packets)
+	MinCwnd = 2
+
+	// PacketSize is the packet size windows are counted in (bytes)
+	PacketSize = 1400
+
+	// SlowStartPacingGain and CongestionAvoidancePacingGain scale the
+	// pacing rate above cwnd/RTT so pacing never limits window growth
+	SlowStartPacingGain           = 2.0
+	CongestionAvoidancePacingGain = 1.2
+)
+
+// Config contains configuration for CUBIC
+type Config struct {
+	InitialCwnd uint32 // Initial congestion window (packets)
+}
+
+// DefaultConfig returns default CUBIC configuration
+func DefaultConfig() *Config {
+	return &Config{
+		InitialCwnd: 10,
+	}
+}
+
+// CUBIC implements the CUBIC congestion control algorithm. Windows are kept
+// in packets. After a loss the window grows along a cubic curve that is
+// concave up to the window where the loss happened (wMax) and convex beyond
+// it, so it returns quickly to the last known capacity and then probes
+// carefully; a Reno-equivalent estimate keeps it TCP-friendly on short-RTT
+// paths.
+type CUBIC struct {
+	mu sync.RWMutex
+
+	initialCwnd float64
+
+	// Window state (packets)
+	cwnd     float64
+	ssthresh float64
+	wMax     float64 // Window before the last reduction
+	wEst     float64 // Reno-friendly window estimate
+
+	// Current congestion avoidance epoch
+	epochStart time.Time
+	k          float64 // Seconds from epoch start until the window reaches wMax
+
+	// Losses within an RTT of a reduction belong to the same congestion event
+	lastReduction time.Time
+
+	// RTT estimates
+	srtt   time.Duration
+	minRTT time.Duration
+}
+
+// NewCUBIC creates a new CUBIC congestion controller
+func NewCUBIC(config *Config) *CUBIC {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	c := &CUBIC{initialCwnd: float64(config.InitialCwnd)}
+	c.reset()
+	return c
+}
+
+// reset returns to slow start with the initial window
+func (c *CUBIC) reset() {
+	c.cwnd = c.initialCwnd
+	c.ssthresh = math.Inf(1)
+	c.wMax = 0
+	c.wEst = 0
+	c.epochStart = time.Time{}
+	c.k = 0
+	c.lastReduction = time.Time{}
+	c.srtt = 0
+	c.minRTT = 0
+}
+
+// OnSent records a sent packet
+func (c *CUBIC) OnSent(size uint32, now time.Time) {}
+
+// OnAcked records newly acknowledged bytes and an RTT sample, growing the
+// window
+func (c *CUBIC) OnAcked(size uint32, rtt time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.updateRTT(rtt)
+	acked := float64(size) / PacketSize
+
+	// Slow start: one packet per packet acknowledged
+	if c.cwnd < c.ssthresh {
+		c.cwnd = math.Min(c.cwnd+acked, c.ssthresh)
+		return
+	}
+
+	if c.epochStart.IsZero() {
+		c.startEpoch(now)
+	}
+
+	// Where the cubic curve puts the window one RTT from now
+	t := now.Add(c.minRTT).Sub(c.epochStart).Seconds()
+	target := C*math.Pow(t-c.k, 3) + c.wMax
+
+	// Reno-friendly region: grow at least as fast as Reno would
+	c.wEst += 3 * (1 - Beta) / (1 + Beta) * acked / c.cwnd
+	if c.wEst > target {
+		target = c.wEst
+	}
+
+	if target > c.cwnd {
+		c.cwnd += (target - c.cwnd) / c.cwnd * acked
+	} else {
+		c.cwnd += 0.01 * acked / c.cwnd
+	}
+}
+
+// startEpoch begins a congestion avoidance epoch at the current window
+func (c *CUBIC) startEpoch(now time.Time) {
+	c.epochStart = now
+	c.wEst = c.cwnd
+	if c.cwnd < c.wMax {
+		c.k = math.Cbrt((c.wMax - c.cwnd) / C)
+	} else {
+		c.k = 0
+		c.wMax = c.cwnd
+	}
+}
+
+// updateRTT folds an RTT sample into the estimates
+func (c *CUBIC) updateRTT(rtt time.Duration) {
+	if rtt <= 0 {
+		return
+	}
+	if c.minRTT == 0 || rtt < c.minRTT {
+		c.minRTT = rtt
+	}
+	if c.srtt == 0 {
+		c.srtt = rtt
+	} else {
+		c.srtt = (7*c.srtt + rtt) / 8
+	}
+}
+
+// OnLost reduces the window, once per congestion event
+func (c *CUBIC) OnLost(size uint32, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reduce(now)
+}
+
+// OnCongestionExperienced reduces the window as for loss when the path
+// marks packets CE (RFC 3168), once per congestion event
+func (c *CUBIC) OnCongestionExperienced(packets uint32, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reduce(now)
+}
+
+// reduce makes the multiplicative decrease for a congestion event, unless
+// one was made within the last RTT
+func (c *CUBIC) reduce(now time.Time) {
+	if !c.lastReduction.IsZero() && now.Sub(c.lastReduction) < c.srtt {
+		return
+	}
+	c.lastReduction = now
+
+	// Fast convergence: release capacity to newer flows when the window
+	// stopped short of the previous maximum
+	if c.cwnd < c.wMax {
+		c.wMax = c.cwnd * (1 + Beta) / 2
+	} else {
+		c.wMax = c.cwnd
+	}
+
+	c.cwnd = math.Max(c.cwnd*Beta, MinCwnd)
+	c.ssthresh = c.cwnd
+	c.epochStart = time.Time{}
+}
+
+// PacingDelay returns the delay before the next packet, spreading a window
+// over a little less than one RTT
+func (c *CUBIC) PacingDelay(size uint32) time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rate := c.pacingRate()
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(size) / rate * float64(time.Second))
+}
+
+// pacingRate returns the pacing rate in bytes/sec, zero before any RTT sample
+func (c *CUBIC) pacingRate() float64 {
+	if c.srtt == 0 {
+		return 0
+	}
+	gain := CongestionAvoidancePacingGain
+	if c.cwnd < c.ssthresh {
+		gain = SlowStartPacingGain
+	}
+	return c.cwnd * PacketSize / c.srtt.Seconds() * gain
+}
+
+// Cwnd returns the congestion window in bytes
+func (c *CUBIC) Cwnd() uint32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return uint32(c.cwnd * PacketSize)
+}
+
+// Bandwidth returns the bandwidth the window achieves, cwnd/RTT (bytes/sec)
+func (c *CUBIC) Bandwidth() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.srtt == 0 {
+		return 0
+	}
+	return uint64(c.cwnd * PacketSize / c.srtt.Seconds())
+}
+
+// MinRTT returns the minimum RTT observed
+func (c *CUBIC) MinRTT() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.minRTT
+}
+
+// Seed starts the controller from bandwidth and RTT estimates remembered from
+// an earlier connection over the same path. The window starts at the
+// bandwidth-delay product in congestion avoidance, skipping slow start.
+func (c *CUBIC) Seed(bandwidth uint64, rtt time.Duration) {
+	if bandwidth == 0 || rtt <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cwnd = math.Max(float64(bandwidth)*rtt.Seconds()/PacketSize, MinCwnd)
+	c.ssthresh = c.cwnd
+	c.wMax = c.cwnd
+	c.epochStart = time.Time{}
+	c.srtt = rtt
+	c.minRTT = rtt
+}
+
+// Reset resets the controller to its initial state
+func (c *CUBIC) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset()
+}
+
+// InSlowStart reports whether the controller is in slow start
+func (c *CUBIC) InSlowStart() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cwnd < c.ssthresh
+}
+
+// Statistics returns CUBIC statistics
+func (c *CUBIC) Statistics() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	state := "CONGESTION_AVOIDANCE"
+	if c.cwnd < c.ssthresh {
+		state = "SLOW_START"
+	}
+	ssthresh := c.ssthresh
+	if math.IsInf(ssthresh, 1) {
+		ssthresh = 0
+	}
+
+	return map[string]interface{}{
+		"algorithm":        "cubic",
+		"state":            state,
+		"cwnd_packets":     c.cwnd,
+		"ssthresh_packets": ssthresh,
+		"w_max_packets":    c.wMax,
+		"srtt_ms":          float64(c.srtt.Microseconds()) / 1000,
+		"rtt_ms":           float64(c.minRTT.Microseconds()) / 1000,
+		"pacing_rate":      uint64(c.pacingRate()),
+	}
+}
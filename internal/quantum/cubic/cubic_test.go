@@ -0,0 +1,111 @@
+package cubic
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCUBICSlowStart(t *testing.T) {
+	c := NewCUBIC(nil)
+
+	if !c.InSlowStart() {
+		t.Fatal("Should start in slow start")
+	}
+	if c.Cwnd() != 10*PacketSize {
+		t.Errorf("Expected initial window of 10 packets, got %d bytes", c.Cwnd())
+	}
+
+	// Each acknowledged packet grows the window by one packet
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		c.OnAcked(PacketSize, 20*time.Millisecond, now)
+	}
+	if c.Cwnd() != 20*PacketSize {
+		t.Errorf("Expected window of 20 packets, got %d bytes", c.Cwnd())
+	}
+}
+
+func TestCUBICLossAndRecovery(t *testing.T) {
+	c := NewCUBIC(nil)
+	rtt := 20 * time.Millisecond
+
+	now := time.Now()
+	for i := 0; i < 90; i++ {
+		c.OnAcked(PacketSize, rtt, now)
+	}
+	before := c.Cwnd()
+
+	// Loss cuts the window by Beta and ends slow start
+	c.OnLost(PacketSize, now)
+	after := c.Cwnd()
+	if want := uint32(float64(before) * Beta); math.Abs(float64(after)-float64(want)) > 1 {
+		t.Fatalf("Expected window %d after loss, got %d", want, after)
+	}
+	if c.InSlowStart() {
+		t.Error("Expected congestion avoidance after loss")
+	}
+
+	// Further losses in the same round trip are the same congestion event
+	c.OnLost(PacketSize, now.Add(rtt/2))
+	if c.Cwnd() != after {
+		t.Errorf("Expected one reduction per congestion event, got %d", c.Cwnd())
+	}
+
+	// The window climbs back towards the old maximum, then past it
+	for i := 0; i < 200; i++ {
+		now = now.Add(rtt)
+		for j := 0; j < int(c.Cwnd()/PacketSize); j++ {
+			c.OnAcked(PacketSize, rtt, now)
+		}
+	}
+	if c.Cwnd() <= before {
+		t.Errorf("Expected window to grow past %d, got %d", before, c.Cwnd())
+	}
+}
+
+func TestCUBICSeed(t *testing.T) {
+	c := NewCUBIC(nil)
+
+	// 1.4 MB/s over a 50ms path is a 50 packet window
+	c.Seed(50*PacketSize*20, 50*time.Millisecond)
+	if c.InSlowStart() {
+		t.Error("Seeded CUBIC should skip slow start")
+	}
+	if got := c.Cwnd() / PacketSize; got != 50 {
+		t.Errorf("Expected 50 packet window, got %d", got)
+	}
+	if c.MinRTT() != 50*time.Millisecond {
+		t.Errorf("Expected RTT 50ms, got %v", c.MinRTT())
+	}
+	if c.PacingDelay(PacketSize) == 0 {
+		t.Error("Expected a pacing delay once the RTT is known")
+	}
+
+	c.Reset()
+	if !c.InSlowStart() || c.Cwnd() != 10*PacketSize {
+		t.Errorf("Expected reset to return to slow start, got %v", c.Statistics())
+	}
+}
+
+func TestCUBICCongestionExperienced(t *testing.T) {
+	c := NewCUBIC(nil)
+	rtt := 20 * time.Millisecond
+
+	now := time.Now()
+	for i := 0; i < 40; i++ {
+		c.OnAcked(PacketSize, rtt, now)
+	}
+	before := c.Cwnd()
+
+	// CE marks cut the window as loss would, once per round trip
+	c.OnCongestionExperienced(3, now)
+	after := c.Cwnd()
+	if want := uint32(float64(before) * Beta); math.Abs(float64(after)-float64(want)) > 1 {
+		t.Fatalf("Expected window %d after CE marks, got %d", want, after)
+	}
+	c.OnLost(PacketSize, now.Add(rtt/2))
+	if c.Cwnd() != after {
+		t.Errorf("Expected one reduction per congestion event, got %d", c.Cwnd())
+	}
+}
@@ -0,0 +1,200 @@
+package quantum
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// Datagrams are unreliable messages sharing the connection with stream data,
+// for state where a stale copy is worse than none, such as cursor positions
+// and presence. They are sent outside the packet sequence like control
+// frames: never acknowledged, retransmitted or FEC protected, and they take
+// no send or receive window. They are paced with stream data and reported to
+// congestion control as sent, but are not held back by the congestion window.
+//
+// A datagram may carry a deadline. The sender drops it if the deadline passes
+// before it leaves the queue, otherwise it sends the remaining time along and
+// the receiver drops it if the application reads it too late. Both queues
+// drop their oldest datagram when full, so newer state wins.
+
+// datagramQueueSize bounds the datagrams waiting to be sent or read
+const datagramQueueSize = 256
+
+// datagram is a queued datagram, expires zero if it does not expire
+type datagram struct {
+	data    []byte
+	expires time.Time
+}
+
+// expired reports whether a datagram's deadline has passed
+func (d *datagram) expired(now time.Time) bool {
+	return !d.expires.IsZero() && !now.Before(d.expires)
+}
+
+// SendDatagram sends data unreliably. It may be lost or dropped in favour of
+// newer datagrams, and is never retransmitted.
+func (c *Connection) SendDatagram(data []byte) error {
+	return c.SendDatagramWithDeadline(data, time.Time{})
+}
+
+// SendDatagramWithDeadline sends data unreliably, dropping it if it has not
+// been sent or read by the peer before deadline. A zero deadline never
+// expires.
+func (c *Connection) SendDatagramWithDeadline(data []byte, deadline time.Time) error {
+	if c.State() != StateEstablished {
+		return fmt.Errorf("connection not established")
+	}
+
+	if len(data) > c.MaxDatagramPayload() {
+		return fmt.Errorf("datagram too large: %d > %d bytes", len(data), c.MaxDatagramPayload())
+	}
+
+	d := &datagram{data: append([]byte(nil), data...), expires: deadline}
+	if c.pushDatagram(c.datagramSend, d) {
+		c.mu.Lock()
+		c.stats.DatagramsDropped++
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// ReceiveDatagram receives the next datagram that has not expired
+func (c *Connection) ReceiveDatagram() ([]byte, error) {
+	return c.receiveDatagram(nil)
+}
+
+// ReceiveDatagramWithTimeout receives the next datagram that has not expired,
+// waiting at most timeout
+func (c *Connection) ReceiveDatagramWithTimeout(timeout time.Duration) ([]byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	return c.receiveDatagram(timer.C)
+}
+
+// receiveDatagram reads datagrams until one has not expired
+func (c *Connection) receiveDatagram(timeout <-chan time.Time) ([]byte, error) {
+	for {
+		select {
+		case d := <-c.datagramRecv:
+			if d.expired(time.Now()) {
+				c.mu.Lock()
+				c.stats.DatagramsDropped++
+				c.mu.Unlock()
+				continue
+			}
+			return d.data, nil
+		case <-timeout:
+			return nil, fmt.Errorf("receive timeout")
+		case <-c.closeSignal:
+			return nil, fmt.Errorf("connection closed")
+		}
+	}
+}
+
+// MaxDatagramPayload returns the largest datagram SendDatagram currently
+// accepts. It follows the discovered path MTU.
+func (c *Connection) MaxDatagramPayload() int {
+	size := c.maxPayloadSize() - protocol.DatagramFrameHeaderSize
+	// Datagrams are sent whole rather than as FEC shards
+	if c.fecEnabled {
+		size += fecShardOverhead
+	}
+	return size
+}
+
+// pushDatagram queues a datagram, dropping the oldest one if the queue is
+// full. It reports whether a datagram was dropped.
+func (c *Connection) pushDatagram(queue chan *datagram, d *datagram) bool {
+	dropped := false
+	for {
+		select {
+		case queue <- d:
+			return dropped
+		default:
+		}
+
+		select {
+		case <-queue:
+			dropped = true
+		default:
+		}
+	}
+}
+
+// sendQueuedDatagram sends the oldest queued datagram that has not expired,
+// if any, and waits for pacing. It must only be called from sendLoop.
+func (c *Connection) sendQueuedDatagram() {
+	for {
+		var d *datagram
+		select {
+		case d = <-c.datagramSend:
+		default:
+			return
+		}
+
+		now := time.Now()
+		frame := &protocol.DatagramFrame{Data: d.data}
+		if !d.expires.IsZero() {
+			if d.expired(now) {
+				c.mu.Lock()
+				c.stats.DatagramsDropped++
+				c.mu.Unlock()
+				continue
+			}
+			// Round up so the peer never drops a datagram early
+			remaining := d.expires.Sub(now)
+			frame.TTL = uint32((remaining + time.Millisecond - 1) / time.Millisecond)
+		}
+
+		packet := transport.NewPacket(c.guid, 0, 0, 0, frame.Marshal())
+		if err := c.transmit(packet); err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		c.stats.DatagramsSent++
+		c.mu.Unlock()
+
+		// Datagrams use the path like any other data
+		c.cc.OnSent(uint32(len(packet.Payload)), now)
+		if delay := c.cc.PacingDelay(uint32(len(packet.Payload))); delay > 0 {
+			time.Sleep(delay)
+		}
+		return
+	}
+}
+
+// handleDatagram queues a datagram from the peer for ReceiveDatagram
+func (c *Connection) handleDatagram(packet *transport.Packet) {
+	frame := &protocol.DatagramFrame{}
+	if err := frame.Unmarshal(packet.Payload); err != nil {
+		return
+	}
+
+	d := &datagram{data: frame.Data}
+	if frame.TTL > 0 {
+		d.expires = time.Now().Add(time.Duration(frame.TTL) * time.Millisecond)
+	}
+
+	c.mu.Lock()
+	c.stats.DatagramsReceived++
+	c.mu.Unlock()
+
+	if c.pushDatagram(c.datagramRecv, d) {
+		c.mu.Lock()
+		c.stats.DatagramsDropped++
+		c.mu.Unlock()
+	}
+}
+
+// isDatagram reports whether a packet carries a datagram frame. Like control
+// packets, datagram packets take no sequence number and are never FEC
+// protected.
+func isDatagram(packet *transport.Packet) bool {
+	return packet.Header.SequenceNumber == 0 &&
+		!packet.Header.HasFlag(protocol.FlagFEC) &&
+		protocol.IsDatagramFrame(packet.Payload)
+}
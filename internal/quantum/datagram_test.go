@@ -0,0 +1,193 @@
+package quantum
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDatagramRoundTrip(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, server := newTestPair(t, listener, listener.Addr().String(), nil)
+
+	// Reliable messages and datagrams share the connection
+	const count = 20
+	for i := 0; i < count; i++ {
+		if err := client.Send([]byte(fmt.Sprintf("message %d", i))); err != nil {
+			t.Fatalf("Failed to send message %d: %v", i, err)
+		}
+		if err := client.SendDatagram([]byte(fmt.Sprintf("cursor %d", i))); err != nil {
+			t.Fatalf("Failed to send datagram %d: %v", i, err)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		data, err := server.ReceiveWithTimeout(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Failed to receive message %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("message %d", i); string(data) != want {
+			t.Fatalf("Expected %q, got %q", want, data)
+		}
+	}
+
+	// Loopback loses nothing, so every datagram arrives in order
+	for i := 0; i < count; i++ {
+		data, err := server.ReceiveDatagramWithTimeout(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Failed to receive datagram %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("cursor %d", i); string(data) != want {
+			t.Fatalf("Expected %q, got %q", want, data)
+		}
+	}
+
+	if sent := client.Statistics().DatagramsSent; sent != count {
+		t.Errorf("Expected %d datagrams sent, got %d", count, sent)
+	}
+	if received := server.Statistics().DatagramsReceived; received != count {
+		t.Errorf("Expected %d datagrams received, got %d", count, received)
+	}
+
+	// The peer answers on the same connection
+	if err := server.SendDatagram([]byte("presence")); err != nil {
+		t.Fatalf("Failed to send datagram: %v", err)
+	}
+	data, err := client.ReceiveDatagramWithTimeout(5 * time.Second)
+	if err != nil || string(data) != "presence" {
+		t.Fatalf("Failed to receive datagram: %v", err)
+	}
+}
+
+func TestDatagramExpiry(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, server := newTestPair(t, listener, listener.Addr().String(), nil)
+
+	// A datagram whose deadline passed before it was sent is dropped
+	if err := client.SendDatagramWithDeadline([]byte("stale"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Failed to send datagram: %v", err)
+	}
+
+	// One the application reads too late is dropped at the receiver
+	if err := client.SendDatagramWithDeadline([]byte("late"), time.Now().Add(100*time.Millisecond)); err != nil {
+		t.Fatalf("Failed to send datagram: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Statistics().DatagramsReceived == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	if err := client.SendDatagramWithDeadline([]byte("fresh"), time.Now().Add(5*time.Second)); err != nil {
+		t.Fatalf("Failed to send datagram: %v", err)
+	}
+
+	data, err := server.ReceiveDatagramWithTimeout(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Failed to receive datagram: %v", err)
+	}
+	if string(data) != "fresh" {
+		t.Errorf("Expected only the fresh datagram, got %q", data)
+	}
+
+	if dropped := client.Statistics().DatagramsDropped; dropped != 1 {
+		t.Errorf("Expected the sender to drop 1 datagram, got %d", dropped)
+	}
+	if dropped := server.Statistics().DatagramsDropped; dropped != 1 {
+		t.Errorf("Expected the receiver to drop 1 datagram, got %d", dropped)
+	}
+}
+
+func TestDatagramNotRetransmitted(t *testing.T) {
+	const limit = 1200
+
+	config := DefaultConfig()
+	config.PMTUDiscovery = false
+
+	listener := newTestListener(t, config)
+	proxy := newMTUProxy(t, listener.Addr(), limit)
+
+	client, err := Dial("udp", proxy.Addr(), config)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	// The path loses a datagram too large for it; nothing resends it
+	if err := client.SendDatagram(bytes.Repeat([]byte{0xA5}, limit)); err != nil {
+		t.Fatalf("Failed to send datagram: %v", err)
+	}
+	if err := client.SendDatagram([]byte("small")); err != nil {
+		t.Fatalf("Failed to send datagram: %v", err)
+	}
+	if err := client.Send([]byte("reliable")); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := client.Flush(flushCtx); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if _, err := server.ReceiveWithTimeout(5 * time.Second); err != nil {
+		t.Fatalf("Failed to receive message: %v", err)
+	}
+
+	data, err := server.ReceiveDatagramWithTimeout(5 * time.Second)
+	if err != nil || string(data) != "small" {
+		t.Fatalf("Expected the small datagram, got %q: %v", data, err)
+	}
+	if _, err := server.ReceiveDatagramWithTimeout(200 * time.Millisecond); err == nil {
+		t.Error("Expected the large datagram to be lost")
+	}
+
+	if stats := client.Statistics(); stats.Retransmissions != 0 || stats.DatagramsSent != 2 {
+		t.Errorf("Expected 2 datagrams sent and no retransmissions, got %+v", stats)
+	}
+}
+
+func TestDatagramLimits(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, _ := newTestPair(t, listener, listener.Addr().String(), nil)
+
+	limit := client.MaxDatagramPayload()
+	if err := client.SendDatagram(make([]byte, limit+1)); err == nil {
+		t.Errorf("Expected a datagram over %d bytes to be rejected", limit)
+	}
+	if err := client.SendDatagram(make([]byte, limit)); err != nil {
+		t.Errorf("Expected a %d byte datagram to be accepted: %v", limit, err)
+	}
+
+	client.Close()
+	if err := client.SendDatagram([]byte("closed")); err == nil {
+		t.Error("Expected send on a closed connection to fail")
+	}
+}
+
+func TestDatagramQueueDropsOldest(t *testing.T) {
+	c := &Connection{}
+	queue := make(chan *datagram, 2)
+
+	for i := 0; i < 3; i++ {
+		dropped := c.pushDatagram(queue, &datagram{data: []byte{byte(i)}})
+		if dropped != (i == 2) {
+			t.Errorf("Push %d: expected dropped=%v, got %v", i, i == 2, dropped)
+		}
+	}
+
+	// Newer datagrams displace older ones
+	for _, want := range []byte{1, 2} {
+		if d := <-queue; d.data[0] != want {
+			t.Errorf("Expected datagram %d, got %d", want, d.data[0])
+		}
+	}
+}
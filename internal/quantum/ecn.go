@@ -0,0 +1,195 @@
+package quantum
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// With ECN, routers signal congestion by marking packets CE before their
+// queues overflow, so the sender can slow down without losing anything.
+// Every ACK echoes the counts of ECN codepoints received so far, and the
+// congestion controller hears about every newly reported CE mark.
+//
+// Some paths clear the codepoints or drop marked packets, and peers predating
+// ECN never echo them, so the sender validates the path first, as in RFC 9000
+// section 13.4.2: it marks its first ecnTestPackets data packets ECT(0) and
+// waits for their ACKs. If the echoed counts grow, every data packet is
+// marked from then on; if the test packets are acknowledged without the
+// counts growing, or the peer reports ECT(1), which we never send, ECN is
+// disabled for the path. A connection migrating to a new path validates it
+// again.
+
+// ecnTestPackets is the number of data packets marked to test a path
+const ecnTestPackets = 10
+
+// ecnValidation is the sender's view of whether a path carries ECN marks
+type ecnValidation int
+
+const (
+	ecnTesting ecnValidation = iota // Marking test packets
+	ecnUnknown                      // Waiting for the test packets' ACKs
+	ecnCapable                      // Marks arrive; every data packet is marked
+	ecnFailed                       // Marks are lost; nothing is marked
+)
+
+// String returns the state's qlog name
+func (v ecnValidation) String() string {
+	switch v {
+	case ecnTesting:
+		return "testing"
+	case ecnUnknown:
+		return "unknown"
+	case ecnCapable:
+		return "capable"
+	default:
+		return "failed"
+	}
+}
+
+// ecnState tracks the ECN codepoints sent and received
+type ecnState struct {
+	mu sync.Mutex
+
+	// Sending side
+	validation ecnValidation
+	testSent   int                // Test packets marked on this path
+	lastTest   uint32             // Sequence number of the latest of them
+	base       uint32             // ECT(0) and CE echoed when testing began
+	echoed     protocol.ECNCounts // Largest counts the peer has echoed
+
+	// Receiving side
+	received protocol.ECNCounts // Codepoints of the packets received
+	ceSent   uint32             // CE count on the last ACK sent
+}
+
+// ecnMark returns the codepoint to send a packet with: ECT(0) for data
+// packets while the path is being tested or has passed, and for FEC parity
+// once it has passed, so that packets rebuilt from parity are acknowledged
+// along with a counted mark
+func (c *Connection) ecnMark(header *protocol.Header) protocol.ECN {
+	if !c.config.ECN || !c.conn.ECN() {
+		return protocol.ECNNotECT
+	}
+	data := header.SequenceNumber != 0 && !header.HasFlag(protocol.FlagSYN)
+	if !data && !header.HasFlag(protocol.FlagFEC) {
+		return protocol.ECNNotECT
+	}
+
+	e := &c.ecn
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch e.validation {
+	case ecnCapable:
+		return protocol.ECNECT0
+	case ecnTesting:
+		if !data {
+			return protocol.ECNNotECT
+		}
+		if e.testSent == 0 || protocol.SeqLess(e.lastTest, header.SequenceNumber) {
+			e.lastTest = header.SequenceNumber
+		}
+		e.testSent++
+		if e.testSent >= ecnTestPackets {
+			c.setECNValidation(ecnUnknown)
+		}
+		return protocol.ECNECT0
+	default:
+		return protocol.ECNNotECT
+	}
+}
+
+// ecnReceived counts the codepoint a packet arrived with, reporting whether
+// it was marked CE
+func (c *Connection) ecnReceived(packet *transport.Packet) bool {
+	if packet.ECN == protocol.ECNNotECT {
+		return false
+	}
+	c.ecn.mu.Lock()
+	c.ecn.received.Add(packet.ECN)
+	c.ecn.mu.Unlock()
+	return packet.ECN == protocol.ECNCE
+}
+
+// echoECN adds the codepoints received so far to an outgoing ACK, setting
+// FlagECE if it reports CE marks the last one did not
+func (c *Connection) echoECN(header *protocol.Header) {
+	e := &c.ecn
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.received.IsZero() {
+		return
+	}
+	header.SetECNCounts(e.received)
+	if e.received.CE != e.ceSent {
+		header.SetFlag(protocol.FlagECE)
+		e.ceSent = e.received.CE
+	}
+}
+
+// onECNCounts validates the path against the codepoints an ACK echoes and
+// reports CE marks not reported before to congestion control
+func (c *Connection) onECNCounts(header *protocol.Header) {
+	counts, _ := header.ECNCounts()
+
+	e := &c.ecn
+	e.mu.Lock()
+	if e.validation == ecnFailed {
+		e.mu.Unlock()
+		return
+	}
+
+	// ACKs may be reordered, so the counts only count once they grow
+	var newCE uint32
+	if counts.CE > e.echoed.CE {
+		newCE = counts.CE - e.echoed.CE
+		e.echoed.CE = counts.CE
+	}
+	e.echoed.ECT0 = max(e.echoed.ECT0, counts.ECT0)
+	e.echoed.ECT1 = max(e.echoed.ECT1, counts.ECT1)
+	arrived := e.echoed.ECT0 + e.echoed.CE
+
+	switch {
+	case e.echoed.ECT1 > 0:
+		// Something on the path rewrites the codepoint
+		c.setECNValidation(ecnFailed)
+	case e.validation == ecnCapable:
+	case arrived > e.base:
+		c.setECNValidation(ecnCapable)
+	case e.testSent > 0 && protocol.SeqLess(e.lastTest, header.AckNumber):
+		// Every test packet has been acknowledged, without a mark
+		c.setECNValidation(ecnFailed)
+	}
+	failed := e.validation == ecnFailed
+	e.mu.Unlock()
+
+	if newCE > 0 && !failed {
+		c.cc.OnCongestionExperienced(newCE, time.Now())
+	}
+}
+
+// restartECN validates ECN again on a new path
+func (c *Connection) restartECN() {
+	e := &c.ecn
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.testSent = 0
+	e.base = e.echoed.ECT0 + e.echoed.CE
+	c.setECNValidation(ecnTesting)
+}
+
+// setECNValidation moves ECN validation to a new state. c.ecn.mu must be
+// held.
+func (c *Connection) setECNValidation(to ecnValidation) {
+	from := c.ecn.validation
+	if from == to {
+		return
+	}
+	c.ecn.validation = to
+	c.traceECN(from, to)
+}
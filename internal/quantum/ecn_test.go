@@ -0,0 +1,84 @@
+package quantum
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/netsim"
+)
+
+func TestECNValidation(t *testing.T) {
+	link := netsim.LinkConfig{Delay: 5 * time.Millisecond}
+
+	tests := []struct {
+		name    string
+		bleach  bool
+		version uint8
+		want    ecnValidation
+	}{
+		{"Capable", false, 0, ecnCapable},
+		{"Bleached", true, 0, ecnFailed},
+		{"PeerWithoutECN", false, 2, ecnFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := netsim.Symmetric(1, link)
+			path.AToB.BleachECN = tt.bleach
+
+			config := DefaultConfig()
+			config.Version = tt.version
+			client, server := newSimulatedPair(t, path, config)
+
+			transferMessages(t, client, server, 100, 200)
+
+			client.ecn.mu.Lock()
+			validation, echoed := client.ecn.validation, client.ecn.echoed
+			client.ecn.mu.Unlock()
+			if validation != tt.want {
+				t.Errorf("Expected ECN validation %v, got %v (echoed %+v)", tt.want, validation, echoed)
+			}
+
+			// Once validated, every data packet is marked
+			if tt.want == ecnCapable && echoed.ECT0 < 100 {
+				t.Errorf("Expected every data packet marked, got %+v", echoed)
+			}
+		})
+	}
+}
+
+func TestECNCongestionMarks(t *testing.T) {
+	// A 4 Mbit/s bottleneck marking CE once 10 KB are queued, well before
+	// its 30 KB queue overflows
+	const bandwidth = 500000
+	link := netsim.LinkConfig{Delay: 10 * time.Millisecond}
+	path := netsim.Config{AToB: link, BToA: link}
+	path.AToB.Bandwidth = bandwidth
+	path.AToB.QueueLimit = 30000
+	path.AToB.ECNThreshold = 10000
+
+	transfer := func(ecn bool) (retransmissions uint64, marked uint32) {
+		config := DefaultConfig()
+		config.FECEnabled = false
+		config.CongestionControl = CongestionCUBIC
+		config.ECN = ecn
+		client, server := newSimulatedPair(t, path, config)
+
+		transferMessages(t, client, server, 600, 1000)
+
+		server.ecn.mu.Lock()
+		defer server.ecn.mu.Unlock()
+		return client.Statistics().Retransmissions, server.ecn.received.CE
+	}
+
+	// CUBIC backs off on the marks instead of filling the queue until it
+	// overflows
+	lost, _ := transfer(false)
+	retransmitted, marked := transfer(true)
+	t.Logf("retransmissions: %d without ECN, %d with %d packets marked", lost, retransmitted, marked)
+	if marked == 0 {
+		t.Fatal("Expected packets marked CE")
+	}
+	if retransmitted*4 > lost {
+		t.Errorf("Expected far fewer losses with ECN: %d against %d", retransmitted, lost)
+	}
+}
@@ -2,7 +2,9 @@
 package fec
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
 	"sync"
 
 	"github.com/klauspost/reedsolomon"
@@ -17,6 +19,9 @@ const (
 
 	// MaxShardSize is the maximum size of a single shard
 	MaxShardSize = 1400
+
+	// DefaultMaxParityShards is the default upper bound for adaptive parity
+	DefaultMaxParityShards = 5
 )
 
 // Encoder handles FEC encoding for outgoing packets
@@ -27,6 +32,11 @@ type Encoder struct {
 	parityShards int
 	encoder      reedsolomon.Encoder
 
+	// Parameters requested while a group was in progress, applied when it completes
+	pendingData   int
+	pendingParity int
+	hasPending    bool
+
 	// Current encoding group
 	currentGroup *EncodingGroup
 	groupID      uint64
@@ -38,11 +48,16 @@ type Decoder struct {
 
 	dataShards   int
 	parityShards int
-	encoder      reedsolomon.Encoder // Used for reconstruction
+
+	// Reed-Solomon codecs by group parameters, since the sender may change them
+	codecs map[[2]int]reedsolomon.Encoder
 
 	// Active decoding groups
 	groups map[uint64]*DecodingGroup
 
+	// Groups created so far, which orders them for cleanup
+	created uint64
+
 	// Statistics
 	totalRecovered uint64
 	failedRecovery uint64
@@ -60,11 +75,16 @@ type EncodingGroup struct {
 // DecodingGroup represents a group of packets being decoded
 type DecodingGroup struct {
 	GroupID       uint64
+	NumData       int
+	NumParity     int
 	DataShards    [][]byte
 	ParityShards  [][]byte
 	ReceivedMask  []bool // Track which shards have been received
 	ReceivedCount int
 	Complete      bool
+
+	// Creation order. Group IDs may wrap, so they do not give the age.
+	order uint64
 }
 
 // Config contains configuration for FEC
@@ -87,17 +107,9 @@ func NewEncoder(config *Config) (*Encoder, error) {
 		config = DefaultConfig()
 	}
 
-	if config.DataShards < 1 || config.DataShards > 256 {
-		return nil, fmt.Errorf("invalid data shards: %d (must be 1-256)", config.DataShards)
-	}
-
-	if config.ParityShards < 0 || config.ParityShards > 256 {
-		return nil, fmt.Errorf("invalid parity shards: %d (must be 0-256)", config.ParityShards)
-	}
-
-	enc, err := reedsolomon.New(config.DataShards, config.ParityShards)
+	enc, err := newCodec(config.DataShards, config.ParityShards)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Reed-Solomon encoder: %w", err)
+		return nil, err
 	}
 
 	return &Encoder{
@@ -108,9 +120,17 @@ func NewEncoder(config *Config) (*Encoder, error) {
 	}, nil
 }
 
+// GroupParams are the parameters an encoding group was started with
+type GroupParams struct {
+	DataShards   int
+	ParityShards int
+}
+
 // AddData adds a data packet to the current encoding group
-// Returns parity shards when the group is complete, or nil if more data is needed
-func (e *Encoder) AddData(data []byte) (groupID uint64, parityShards [][]byte, err error) {
+// Returns the parameters of the group the packet joined, which may differ from
+// GetConfig if a reconfiguration is pending, and the parity shards when the
+// group is complete, or nil if more data is needed
+func (e *Encoder) AddData(data []byte) (groupID uint64, params GroupParams, parityShards [][]byte, err error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
@@ -125,6 +145,8 @@ func (e *Encoder) AddData(data []byte) (groupID uint64, parityShards [][]byte, e
 		e.groupID++
 	}
 
+	params = GroupParams{DataShards: e.dataShards, ParityShards: e.parityShards}
+
 	// Add data to current group
 	dataCopy := make([]byte, len(data))
 	copy(dataCopy, data)
@@ -134,14 +156,56 @@ func (e *Encoder) AddData(data []byte) (groupID uint64, parityShards [][]byte, e
 	// If group is complete, generate parity shards
 	if e.currentGroup.Count == e.dataShards {
 		if err := e.encodeGroup(); err != nil {
-			return 0, nil, fmt.Errorf("failed to encode group: %w", err)
+			return 0, params, nil, fmt.Errorf("failed to encode group: %w", err)
 		}
 
 		e.currentGroup.Complete = true
-		return e.currentGroup.GroupID, e.currentGroup.ParityShards, nil
+		groupID, parity := e.currentGroup.GroupID, e.currentGroup.ParityShards
+		if e.hasPending {
+			if err := e.apply(e.pendingData, e.pendingParity); err != nil {
+				return 0, params, nil, err
+			}
+		}
+		return groupID, params, parity, nil
 	}
 
-	return 0, nil, nil
+	return 0, params, nil, nil
+}
+
+// Reconfigure changes the group parameters. A group in progress is finished
+// with its original parameters; the new ones apply from the next group.
+func (e *Encoder) Reconfigure(dataShards, parityShards int) error {
+	if err := validateShards(dataShards, parityShards); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.currentGroup != nil && !e.currentGroup.Complete && e.currentGroup.Count > 0 {
+		e.pendingData, e.pendingParity, e.hasPending = dataShards, parityShards, true
+		return nil
+	}
+	return e.apply(dataShards, parityShards)
+}
+
+// apply switches the encoder to new group parameters; caller holds e.mu
+func (e *Encoder) apply(dataShards, parityShards int) error {
+	e.hasPending = false
+	if dataShards == e.dataShards && parityShards == e.parityShards {
+		return nil
+	}
+
+	enc, err := newCodec(dataShards, parityShards)
+	if err != nil {
+		return err
+	}
+
+	e.dataShards = dataShards
+	e.parityShards = parityShards
+	e.encoder = enc
+	e.currentGroup = nil
+	return nil
 }
 
 // encodeGroup generates parity shards for the current group
@@ -190,8 +254,11 @@ func (e *Encoder) Reset() {
 	e.currentGroup = nil
 }
 
-// GetConfig returns the encoder configuration
+// GetConfig returns the parameters of the group in progress, or of the
+// next group if none is in progress
 func (e *Encoder) GetConfig() (dataShards, parityShards int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	return e.dataShards, e.parityShards
 }
 
@@ -201,23 +268,15 @@ func NewDecoder(config *Config) (*Decoder, error) {
 		config = DefaultConfig()
 	}
 
-	if config.DataShards < 1 || config.DataShards > 256 {
-		return nil, fmt.Errorf("invalid data shards: %d (must be 1-256)", config.DataShards)
-	}
-
-	if config.ParityShards < 0 || config.ParityShards > 256 {
-		return nil, fmt.Errorf("invalid parity shards: %d (must be 0-256)", config.ParityShards)
-	}
-
-	enc, err := reedsolomon.New(config.DataShards, config.ParityShards)
+	enc, err := newCodec(config.DataShards, config.ParityShards)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Reed-Solomon encoder: %w", err)
+		return nil, err
 	}
 
 	return &Decoder{
 		dataShards:   config.DataShards,
 		parityShards: config.ParityShards,
-		encoder:      enc,
+		codecs:       map[[2]int]reedsolomon.Encoder{{config.DataShards, config.ParityShards}: enc},
 		groups:       make(map[uint64]*DecodingGroup),
 	}, nil
 }
@@ -225,21 +284,37 @@ func NewDecoder(config *Config) (*Decoder, error) {
 // AddShard adds a data or parity shard to a decoding group
 // Returns recovered data shards if decoding is successful, or nil if more shards are needed
 func (d *Decoder) AddShard(groupID uint64, shardIndex int, data []byte, isParity bool) (recovered [][]byte, err error) {
+	return d.AddGroupShard(groupID, d.dataShards, d.parityShards, shardIndex, data, isParity)
+}
+
+// AddGroupShard adds a shard to a decoding group encoded with the given
+// parameters, which the sender signals per group and may change between groups
+func (d *Decoder) AddGroupShard(groupID uint64, dataShards, parityShards, shardIndex int, data []byte, isParity bool) (recovered [][]byte, err error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	// Get or create decoding group
 	group, exists := d.groups[groupID]
 	if !exists {
+		if err := validateShards(dataShards, parityShards); err != nil {
+			return nil, err
+		}
 		group = &DecodingGroup{
 			GroupID:       groupID,
-			DataShards:    make([][]byte, d.dataShards),
-			ParityShards:  make([][]byte, d.parityShards),
-			ReceivedMask:  make([]bool, d.dataShards+d.parityShards),
+			NumData:       dataShards,
+			NumParity:     parityShards,
+			DataShards:    make([][]byte, dataShards),
+			ParityShards:  make([][]byte, parityShards),
+			ReceivedMask:  make([]bool, dataShards+parityShards),
 			ReceivedCount: 0,
 			Complete:      false,
+			order:         d.created,
 		}
+		d.created++
 		d.groups[groupID] = group
+	} else if group.NumData != dataShards || group.NumParity != parityShards {
+		return nil, fmt.Errorf("group %d parameters changed: %d+%d, got %d+%d",
+			groupID, group.NumData, group.NumParity, dataShards, parityShards)
 	}
 
 	// Check if already complete
@@ -253,13 +328,13 @@ func (d *Decoder) AddShard(groupID uint64, shardIndex int, data []byte, isParity
 
 	var maskIndex int
 	if isParity {
-		if shardIndex < 0 || shardIndex >= d.parityShards {
+		if shardIndex < 0 || shardIndex >= group.NumParity {
 			return nil, fmt.Errorf("invalid parity shard index: %d", shardIndex)
 		}
 		group.ParityShards[shardIndex] = dataCopy
-		maskIndex = d.dataShards + shardIndex
+		maskIndex = group.NumData + shardIndex
 	} else {
-		if shardIndex < 0 || shardIndex >= d.dataShards {
+		if shardIndex < 0 || shardIndex >= group.NumData {
 			return nil, fmt.Errorf("invalid data shard index: %d", shardIndex)
 		}
 		group.DataShards[shardIndex] = dataCopy
@@ -272,15 +347,21 @@ func (d *Decoder) AddShard(groupID uint64, shardIndex int, data []byte, isParity
 		group.ReceivedCount++
 	}
 
+	// Nothing to recover once every data shard has arrived
+	if group.countReceivedData() == group.NumData {
+		group.Complete = true
+		return nil, nil
+	}
+
 	// Try to reconstruct if we have enough shards
-	if group.ReceivedCount >= d.dataShards {
+	if group.ReceivedCount >= group.NumData {
 		if err := d.reconstructGroup(group); err != nil {
 			d.failedRecovery++
 			return nil, fmt.Errorf("failed to reconstruct group: %w", err)
 		}
 
 		group.Complete = true
-		d.totalRecovered += uint64(d.dataShards - group.countReceivedData())
+		d.totalRecovered += uint64(group.NumData - group.countReceivedData())
 
 		// Return recovered data shards
 		return group.DataShards, nil
@@ -291,22 +372,38 @@ func (d *Decoder) AddShard(groupID uint64, shardIndex int, data []byte, isParity
 
 // reconstructGroup attempts to reconstruct missing shards
 func (d *Decoder) reconstructGroup(group *DecodingGroup) error {
+	codec, err := d.codec(group.NumData, group.NumParity)
+	if err != nil {
+		return err
+	}
+
 	// Combine all shards for reconstruction
-	allShards := make([][]byte, d.dataShards+d.parityShards)
-	for i := 0; i < d.dataShards; i++ {
-		allShards[i] = group.DataShards[i]
+	allShards := make([][]byte, group.NumData+group.NumParity)
+	copy(allShards, group.DataShards)
+	copy(allShards[group.NumData:], group.ParityShards)
+
+	// Data shards arrive unpadded; pad them to the encoded shard size
+	shardSize := 0
+	for _, shard := range allShards {
+		if len(shard) > shardSize {
+			shardSize = len(shard)
+		}
 	}
-	for i := 0; i < d.parityShards; i++ {
-		allShards[d.dataShards+i] = group.ParityShards[i]
+	for i, shard := range allShards {
+		if shard != nil && len(shard) < shardSize {
+			padded := make([]byte, shardSize)
+			copy(padded, shard)
+			allShards[i] = padded
+		}
 	}
 
 	// Reconstruct missing shards
-	if err := d.encoder.Reconstruct(allShards); err != nil {
+	if err := codec.Reconstruct(allShards); err != nil {
 		return fmt.Errorf("Reed-Solomon reconstruction failed: %w", err)
 	}
 
 	// Verify reconstruction
-	ok, err := d.encoder.Verify(allShards)
+	ok, err := codec.Verify(allShards)
 	if err != nil {
 		return fmt.Errorf("failed to verify reconstruction: %w", err)
 	}
@@ -315,15 +412,26 @@ func (d *Decoder) reconstructGroup(group *DecodingGroup) error {
 	}
 
 	// Update group with reconstructed shards
-	for i := 0; i < d.dataShards; i++ {
-		if group.DataShards[i] == nil {
-			group.DataShards[i] = allShards[i]
-		}
-	}
+	copy(group.DataShards, allShards[:group.NumData])
 
 	return nil
 }
 
+// codec returns the Reed-Solomon codec for the given parameters; caller holds d.mu
+func (d *Decoder) codec(dataShards, parityShards int) (reedsolomon.Encoder, error) {
+	key := [2]int{dataShards, parityShards}
+	if enc, ok := d.codecs[key]; ok {
+		return enc, nil
+	}
+
+	enc, err := newCodec(dataShards, parityShards)
+	if err != nil {
+		return nil, err
+	}
+	d.codecs[key] = enc
+	return enc, nil
+}
+
 // countReceivedData counts how many data shards were received (not reconstructed)
 func (group *DecodingGroup) countReceivedData() int {
 	count := 0
@@ -345,24 +453,20 @@ func (d *Decoder) CleanupOldGroups(keepLatest int) {
 	}
 
 	// Find oldest groups to remove
-	groupIDs := make([]uint64, 0, len(d.groups))
-	for id := range d.groups {
-		groupIDs = append(groupIDs, id)
+	groups := make([]*DecodingGroup, 0, len(d.groups))
+	for _, group := range d.groups {
+		groups = append(groups, group)
 	}
 
-	// Sort by ID (ascending)
-	for i := 0; i < len(groupIDs)-1; i++ {
-		for j := i + 1; j < len(groupIDs); j++ {
-			if groupIDs[i] > groupIDs[j] {
-				groupIDs[i], groupIDs[j] = groupIDs[j], groupIDs[i]
-			}
-		}
-	}
+	// Sort by creation order (ascending)
+	slices.SortFunc(groups, func(a, b *DecodingGroup) int {
+		return cmp.Compare(a.order, b.order)
+	})
 
 	// Remove oldest groups
-	toRemove := len(groupIDs) - keepLatest
+	toRemove := len(groups) - keepLatest
 	for i := 0; i < toRemove; i++ {
-		delete(d.groups, groupIDs[i])
+		delete(d.groups, groups[i].GroupID)
 	}
 }
 
@@ -390,6 +494,37 @@ func (d *Decoder) Reset() {
 	d.groups = make(map[uint64]*DecodingGroup)
 }
 
+// validateShards checks group parameters. Shard counts and indexes travel in
+// single header bytes, so a group holds at most 256 shards.
+func validateShards(dataShards, parityShards int) error {
+	if dataShards < 1 || dataShards > 255 {
+		return fmt.Errorf("invalid data shards: %d (must be 1-255)", dataShards)
+	}
+
+	if parityShards < 0 || parityShards > 255 {
+		return fmt.Errorf("invalid parity shards: %d (must be 0-255)", parityShards)
+	}
+
+	if dataShards+parityShards > 256 {
+		return fmt.Errorf("invalid shards: %d data + %d parity (must be at most 256)", dataShards, parityShards)
+	}
+
+	return nil
+}
+
+// newCodec creates a Reed-Solomon codec for validated group parameters
+func newCodec(dataShards, parityShards int) (reedsolomon.Encoder, error) {
+	if err := validateShards(dataShards, parityShards); err != nil {
+		return nil, err
+	}
+
+	enc, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Reed-Solomon encoder: %w", err)
+	}
+	return enc, nil
+}
+
 // CalculateOverhead calculates the FEC overhead ratio
 func CalculateOverhead(dataShards, parityShards int) float64 {
 	if dataShards == 0 {
@@ -33,7 +33,7 @@ func TestEncoderDecoder(t *testing.T) {
 	var groupID uint64
 	var parityShards [][]byte
 	for _, data := range testData {
-		gid, parity, err := encoder.AddData(data)
+		gid, _, parity, err := encoder.AddData(data)
 		if err != nil {
 			t.Fatalf("Failed to add data: %v", err)
 		}
@@ -86,6 +86,57 @@ func TestEncoderDecoder(t *testing.T) {
 	}
 }
 
+func TestDecoderUnequalShardLengths(t *testing.T) {
+	config := &Config{DataShards: 3, ParityShards: 1}
+
+	encoder, _ := NewEncoder(config)
+	decoder, _ := NewDecoder(config)
+
+	testData := [][]byte{
+		[]byte("a"),
+		[]byte("a much longer packet"),
+		[]byte("mid-size"),
+	}
+
+	var groupID uint64
+	var parity [][]byte
+	for _, data := range testData {
+		gid, _, p, err := encoder.AddData(data)
+		if err != nil {
+			t.Fatalf("Failed to add data: %v", err)
+		}
+		if p != nil {
+			groupID, parity = gid, p
+		}
+	}
+
+	// Data shards arrive at their original, unpadded lengths
+	decoder.AddShard(groupID, 0, testData[0], false)
+	decoder.AddShard(groupID, 2, testData[2], false)
+	recovered, err := decoder.AddShard(groupID, 0, parity[0], true)
+	if err != nil {
+		t.Fatalf("Failed to reconstruct: %v", err)
+	}
+
+	if !bytes.HasPrefix(recovered[1], testData[1]) {
+		t.Errorf("Recovered shard %q does not match %q", recovered[1], testData[1])
+	}
+
+	if stats := decoder.Statistics(); stats["total_recovered"] != 1 {
+		t.Errorf("Expected 1 recovered shard, got %d", stats["total_recovered"])
+	}
+}
+
+func TestDecoderNothingToRecover(t *testing.T) {
+	decoder, _ := NewDecoder(&Config{DataShards: 2, ParityShards: 1})
+
+	decoder.AddShard(1, 0, []byte("x"), false)
+	recovered, err := decoder.AddShard(1, 1, []byte("y"), false)
+	if err != nil || recovered != nil {
+		t.Errorf("Expected no recovery when all data shards arrived, got %v, %v", recovered, err)
+	}
+}
+
 func TestEncoderSingleGroup(t *testing.T) {
 	encoder, err := NewEncoder(DefaultConfig())
 	if err != nil {
@@ -94,7 +145,7 @@ func TestEncoderSingleGroup(t *testing.T) {
 
 	dataCount := DefaultDataShards
 	for i := 0; i < dataCount-1; i++ {
-		gid, parity, err := encoder.AddData([]byte("test data"))
+		gid, _, parity, err := encoder.AddData([]byte("test data"))
 		if err != nil {
 			t.Fatalf("Failed to add data %d: %v", i, err)
 		}
@@ -107,7 +158,7 @@ func TestEncoderSingleGroup(t *testing.T) {
 	}
 
 	// Add last data packet
-	gid, parity, err := encoder.AddData([]byte("test data"))
+	gid, _, parity, err := encoder.AddData([]byte("test data"))
 	if err != nil {
 		t.Fatalf("Failed to add last data: %v", err)
 	}
@@ -150,6 +201,29 @@ func TestDecoderCleanup(t *testing.T) {
 	}
 }
 
+func TestDecoderCleanupAcrossWrap(t *testing.T) {
+	decoder, err := NewDecoder(DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	// Group IDs are sequence numbers, which wrap past zero
+	ids := []uint64{0xFFFFFFF0, 0xFFFFFFFA, 5, 15}
+	for _, id := range ids {
+		decoder.AddShard(id, 0, []byte("test"), false)
+	}
+
+	// The groups created last survive, whatever their IDs
+	decoder.CleanupOldGroups(2)
+	decoder.mu.RLock()
+	defer decoder.mu.RUnlock()
+	for i, id := range ids {
+		if _, exists := decoder.groups[id]; exists != (i >= 2) {
+			t.Errorf("Group %#x: expected kept=%v", id, i >= 2)
+		}
+	}
+}
+
 func TestCalculateOverhead(t *testing.T) {
 	tests := []struct {
 		data   int
@@ -206,3 +280,92 @@ func TestInvalidConfig(t *testing.T) {
 		t.Error("Should reject negative parity shards")
 	}
 }
+
+func TestEncoderReconfigure(t *testing.T) {
+	encoder, _ := NewEncoder(&Config{DataShards: 3, ParityShards: 1})
+
+	// Start a group, then change parameters mid-group
+	encoder.AddData([]byte("one"))
+	if err := encoder.Reconfigure(3, 2); err != nil {
+		t.Fatalf("Failed to reconfigure: %v", err)
+	}
+
+	// The group in progress keeps its original parameters
+	if _, parity := encoder.GetConfig(); parity != 1 {
+		t.Errorf("Expected parity 1 for group in progress, got %d", parity)
+	}
+
+	encoder.AddData([]byte("two"))
+	_, _, parity, err := encoder.AddData([]byte("three"))
+	if err != nil {
+		t.Fatalf("Failed to add data: %v", err)
+	}
+	if len(parity) != 1 {
+		t.Errorf("Expected 1 parity shard for first group, got %d", len(parity))
+	}
+
+	// The next group uses the new parameters
+	if _, parity := encoder.GetConfig(); parity != 2 {
+		t.Errorf("Expected parity 2 for next group, got %d", parity)
+	}
+	for i := 0; i < 3; i++ {
+		_, _, parity, _ = encoder.AddData([]byte("next"))
+	}
+	if len(parity) != 2 {
+		t.Errorf("Expected 2 parity shards for second group, got %d", len(parity))
+	}
+
+	// Between groups a reconfiguration applies at once; AddData reports the
+	// parameters the packet was actually encoded with
+	if err := encoder.Reconfigure(4, 1); err != nil {
+		t.Fatalf("Failed to reconfigure: %v", err)
+	}
+	if _, params, _, _ := encoder.AddData([]byte("first")); params != (GroupParams{DataShards: 4, ParityShards: 1}) {
+		t.Errorf("Expected group parameters 4+1, got %+v", params)
+	}
+
+	if err := encoder.Reconfigure(0, 1); err == nil {
+		t.Error("Should reject 0 data shards")
+	}
+	if err := encoder.Reconfigure(256, 0); err == nil {
+		t.Error("Should reject data shards that do not fit the header")
+	}
+	if err := encoder.Reconfigure(200, 57); err == nil {
+		t.Error("Should reject groups of more than 256 shards")
+	}
+}
+
+func TestDecoderMixedGroupParameters(t *testing.T) {
+	decoder, _ := NewDecoder(&Config{DataShards: 10, ParityShards: 3})
+
+	for _, params := range []struct{ data, parity int }{{2, 1}, {3, 2}} {
+		encoder, _ := NewEncoder(&Config{DataShards: params.data, ParityShards: params.parity})
+
+		var groupID uint64
+		var parity [][]byte
+		for i := 0; i < params.data; i++ {
+			gid, _, p, _ := encoder.AddData([]byte{byte(i + 1), byte(i + 1)})
+			if p != nil {
+				groupID, parity = gid, p
+			}
+		}
+		groupID += uint64(params.data) * 100 // keep groups distinct
+
+		// Lose data shard 0, recover it from the rest
+		for i := 1; i < params.data; i++ {
+			decoder.AddGroupShard(groupID, params.data, params.parity, i, []byte{byte(i + 1), byte(i + 1)}, false)
+		}
+		recovered, err := decoder.AddGroupShard(groupID, params.data, params.parity, 0, parity[0], true)
+		if err != nil {
+			t.Fatalf("%d+%d: failed to recover: %v", params.data, params.parity, err)
+		}
+		if !bytes.Equal(recovered[0], []byte{1, 1}) {
+			t.Errorf("%d+%d: expected shard [1 1], got %v", params.data, params.parity, recovered[0])
+		}
+
+		// A shard claiming different parameters for the same group is rejected
+		if _, err := decoder.AddGroupShard(groupID, params.data+1, params.parity, 0, []byte{1}, false); err == nil {
+			t.Errorf("%d+%d: expected parameter mismatch error", params.data, params.parity)
+		}
+	}
+}
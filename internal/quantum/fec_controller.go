@@ -0,0 +1,152 @@
+package quantum
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// fecAdaptInterval is how often the FEC controller re-evaluates parity
+	fecAdaptInterval = 250 * time.Millisecond
+
+	// fecLossAlpha is the EWMA weight of a new loss sample
+	fecLossAlpha = 0.25
+
+	// fecCleanLossRate is the loss rate below which parity is turned off
+	fecCleanLossRate = 0.005
+
+	// fecHighRTT is the RTT above which retransmission is costly enough to
+	// warrant a stricter residual loss target
+	fecHighRTT = 50 * time.Millisecond
+
+	// Target probability that a group loses more shards than it has parity
+	fecResidualTarget        = 0.01
+	fecResidualTargetHighRTT = 0.001
+)
+
+// fecSample is a snapshot of the cumulative counters the controller reads
+type fecSample struct {
+	sent      uint64 // data packets sent (SendBuffer total_sent)
+	retrans   uint64 // retransmissions (SendBuffer total_retrans)
+	received  uint64 // data packets accepted (ReceiveBuffer total_received)
+	recovered uint64 // packets rebuilt by FEC (Decoder total_recovered)
+	srtt      time.Duration
+}
+
+// fecController adapts the number of parity shards per FEC group to the
+// observed loss rate and RTT
+type fecController struct {
+	dataShards int
+	maxParity  int
+	parity     int
+
+	lossRate float64 // smoothed loss estimate
+	last     fecSample
+}
+
+// newFECController creates a controller starting at the configured parity
+func newFECController(dataShards, initialParity, maxParity int) *fecController {
+	if initialParity > maxParity {
+		initialParity = maxParity
+	}
+	return &fecController{
+		dataShards: dataShards,
+		maxParity:  maxParity,
+		parity:     initialParity,
+	}
+}
+
+// update folds a new sample into the loss estimate and returns the parity
+// count to use for subsequent groups
+func (fc *fecController) update(sample fecSample) int {
+	sent := sample.sent - fc.last.sent
+	retrans := sample.retrans - fc.last.retrans
+	received := sample.received - fc.last.received
+	recovered := sample.recovered - fc.last.recovered
+	fc.last = sample
+
+	// Residual loss on our outgoing path shows up as retransmissions; loss on
+	// the incoming path shows up as FEC recoveries. Assume the path is symmetric.
+	var loss float64
+	var haveSample bool
+	if sent > 0 {
+		loss = float64(retrans) / float64(sent)
+		haveSample = true
+	}
+	if received > 0 {
+		loss = math.Max(loss, float64(recovered)/float64(received))
+		haveSample = true
+	}
+	if !haveSample {
+		return fc.parity
+	}
+
+	fc.lossRate = fecLossAlpha*math.Min(loss, 1) + (1-fecLossAlpha)*fc.lossRate
+
+	target := parityForLoss(fc.dataShards, fc.lossRate, residualTarget(sample.srtt), fc.maxParity)
+
+	// Add parity immediately, but shed it one shard at a time so a brief
+	// quiet period doesn't strip protection from a lossy link
+	if target > fc.parity {
+		fc.parity = target
+	} else if target < fc.parity {
+		fc.parity--
+	}
+
+	return fc.parity
+}
+
+// residualTarget returns the acceptable unrecoverable group rate for an RTT
+func residualTarget(srtt time.Duration) float64 {
+	if srtt >= fecHighRTT {
+		return fecResidualTargetHighRTT
+	}
+	return fecResidualTarget
+}
+
+// parityForLoss returns the smallest parity count, up to maxParity, for which
+// a group of dataShards+parity shards with independent loss probability p
+// loses more than parity shards with probability at most target
+func parityForLoss(dataShards int, p, target float64, maxParity int) int {
+	if p < fecCleanLossRate {
+		return 0
+	}
+
+	for parity := 1; parity < maxParity; parity++ {
+		if binomialTail(dataShards+parity, parity, p) <= target {
+			return parity
+		}
+	}
+	return maxParity
+}
+
+// binomialTail returns P(X > k) for X ~ Binomial(n, p)
+func binomialTail(n, k int, p float64) float64 {
+	cdf := 0.0
+	coeff := 1.0 // C(n, i)
+	for i := 0; i <= k; i++ {
+		if i > 0 {
+			coeff = coeff * float64(n-i+1) / float64(i)
+		}
+		cdf += coeff * math.Pow(p, float64(i)) * math.Pow(1-p, float64(n-i))
+	}
+	return math.Max(0, 1-cdf)
+}
+
+// adaptFEC samples loss statistics and reconfigures the FEC encoder
+func (c *Connection) adaptFEC() {
+	sendStats := c.sendBuf.Statistics()
+	recvStats := c.recvBuf.Statistics()
+	decoderStats := c.fecDecoder.Statistics()
+
+	parity := c.fecCtl.update(fecSample{
+		sent:      sendStats["total_sent"],
+		retrans:   sendStats["total_retrans"],
+		received:  recvStats["total_received"],
+		recovered: decoderStats["total_recovered"],
+		srtt:      c.sendBuf.SRTT(),
+	})
+
+	dataShards, _ := c.fecEncoder.GetConfig()
+	c.fecEncoder.Reconfigure(dataShards, parity)
+}
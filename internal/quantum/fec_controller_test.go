@@ -0,0 +1,134 @@
+package quantum
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParityForLoss(t *testing.T) {
+	if parity := parityForLoss(10, 0, fecResidualTarget, 5); parity != 0 {
+		t.Errorf("Expected no parity on a clean link, got %d", parity)
+	}
+
+	prev := 0
+	for _, loss := range []float64{0.01, 0.05, 0.10, 0.15} {
+		parity := parityForLoss(10, loss, fecResidualTarget, 8)
+		if parity < prev {
+			t.Errorf("Parity should not decrease as loss grows: %d at %.2f after %d", parity, loss, prev)
+		}
+		if parity == 0 {
+			t.Errorf("Expected parity at %.0f%% loss", loss*100)
+		}
+		prev = parity
+	}
+
+	if parity := parityForLoss(10, 0.5, fecResidualTarget, 5); parity != 5 {
+		t.Errorf("Expected parity capped at 5, got %d", parity)
+	}
+
+	// High-RTT paths get more protection for the same loss
+	low := parityForLoss(10, 0.05, residualTarget(10*time.Millisecond), 8)
+	high := parityForLoss(10, 0.05, residualTarget(100*time.Millisecond), 8)
+	if high <= low {
+		t.Errorf("Expected more parity at high RTT: %d <= %d", high, low)
+	}
+}
+
+func TestBinomialTail(t *testing.T) {
+	// P(X > 0) for Bin(1, 0.5) = 0.5
+	if got := binomialTail(1, 0, 0.5); got < 0.499 || got > 0.501 {
+		t.Errorf("Expected 0.5, got %f", got)
+	}
+
+	// P(X > n) is always zero
+	if got := binomialTail(10, 10, 0.3); got > 1e-9 {
+		t.Errorf("Expected 0, got %f", got)
+	}
+}
+
+func TestFECControllerFollowsLoss(t *testing.T) {
+	fc := newFECController(10, 3, 5)
+
+	var sample fecSample
+	step := func(sent, retrans, received, recovered uint64) int {
+		sample.sent += sent
+		sample.retrans += retrans
+		sample.received += received
+		sample.recovered += recovered
+		sample.srtt = 20 * time.Millisecond
+		return fc.update(sample)
+	}
+
+	// Heavy loss on the incoming path raises parity
+	var parity int
+	for i := 0; i < 10; i++ {
+		parity = step(100, 0, 100, 15)
+	}
+	if parity != 5 {
+		t.Errorf("Expected parity to reach max 5 at 15%% loss, got %d", parity)
+	}
+
+	// No traffic leaves parity untouched
+	if got := step(0, 0, 0, 0); got != parity {
+		t.Errorf("Expected parity unchanged without traffic, got %d", got)
+	}
+
+	// A clean link sheds parity one shard at a time, down to zero
+	prev := parity
+	for i := 0; i < 40; i++ {
+		parity = step(100, 0, 100, 0)
+		if prev-parity > 1 {
+			t.Fatalf("Parity dropped by more than one shard: %d -> %d", prev, parity)
+		}
+		prev = parity
+	}
+	if parity != 0 {
+		t.Errorf("Expected parity to drop to zero on a clean link, got %d", parity)
+	}
+
+	// Residual loss on the outgoing path raises it again
+	for i := 0; i < 5; i++ {
+		parity = step(100, 5, 0, 0)
+	}
+	if parity == 0 {
+		t.Error("Expected parity to return when retransmissions appear")
+	}
+}
+
+func TestAdaptiveFECDropsParityOnCleanLink(t *testing.T) {
+	listener := newTestListener(t, nil)
+
+	client, err := Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	if _, parity := client.FECConfig(); parity != DefaultConfig().FECParityShards {
+		t.Fatalf("Expected initial parity %d, got %d", DefaultConfig().FECParityShards, parity)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := client.Send([]byte("tick")); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		if _, err := server.ReceiveWithTimeout(time.Second); err != nil {
+			t.Fatalf("Failed to receive: %v", err)
+		}
+		if _, parity := client.FECConfig(); parity == 0 {
+			return
+		}
+	}
+
+	_, parity := client.FECConfig()
+	t.Errorf("Expected parity to drop to zero on loopback, got %d", parity)
+}
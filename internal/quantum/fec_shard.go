@@ -0,0 +1,139 @@
+package quantum
+
+import (
+	"encoding/binary"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+const (
+	// fecShardOverhead is the length prefix added to each data payload before
+	// encoding, so recovered shards can be trimmed of Reed-Solomon padding
+	fecShardOverhead = 2
+
+	// fecKeepGroups is how many decoding groups are kept for late shards
+	fecKeepGroups = 64
+)
+
+// encodeShard turns a data payload into an FEC data shard
+func encodeShard(payload []byte) []byte {
+	shard := make([]byte, fecShardOverhead+len(payload))
+	binary.BigEndian.PutUint16(shard, uint16(len(payload)))
+	copy(shard[fecShardOverhead:], payload)
+	return shard
+}
+
+// decodeShard recovers the data payload from a (possibly padded) FEC data shard
+func decodeShard(shard []byte) ([]byte, bool) {
+	if len(shard) < fecShardOverhead {
+		return nil, false
+	}
+	n := int(binary.BigEndian.Uint16(shard))
+	if n > len(shard)-fecShardOverhead {
+		return nil, false
+	}
+	payload := make([]byte, n)
+	copy(payload, shard[fecShardOverhead:])
+	return payload, true
+}
+
+// protectPacket adds an outgoing data packet to the current FEC group and
+// returns the group's parity packets once the group is complete.
+// It must only be called from sendLoop, after the sequence number is assigned.
+func (c *Connection) protectPacket(packet *transport.Packet) []*transport.Packet {
+	// Without parity there is nothing to protect the group with. The encoder
+	// may be reconfigured at any time, so this is only a hint; the header is
+	// stamped with the parameters AddData reports for the packet's group.
+	if c.fecGroupCount == 0 {
+		if _, parityShards := c.fecEncoder.GetConfig(); parityShards == 0 {
+			return nil
+		}
+	}
+
+	_, params, parity, err := c.fecEncoder.AddData(encodeShard(packet.Payload))
+	if err != nil {
+		return nil
+	}
+	if c.fecGroupCount == 0 {
+		c.fecGroupStart = packet.Header.SequenceNumber
+	}
+	dataShards, parityShards := uint8(params.DataShards), uint8(params.ParityShards)
+	if parityShards > 0 {
+		packet.Header.SetFECInfo(c.fecGroupStart, uint8(c.fecGroupCount), dataShards, parityShards)
+	}
+	c.fecGroupCount++
+	if parity == nil {
+		return nil
+	}
+	c.fecGroupCount = 0
+
+	parityPackets := make([]*transport.Packet, len(parity))
+	for i, shard := range parity {
+		p := transport.NewPacket(c.guid, 0, 0, 0, shard)
+		p.Header.SetFECInfo(c.fecGroupStart, dataShards+uint8(i), dataShards, parityShards)
+		parityPackets[i] = p
+	}
+	return parityPackets
+}
+
+// handleFECShard feeds a received FEC shard to the decoder. It returns the
+// packet itself if it carries data, plus any data packets rebuilt from the group.
+func (c *Connection) handleFECShard(packet *transport.Packet) (data, recovered []*transport.Packet) {
+	h := packet.Header
+	isParity := h.IsParity()
+	if !isParity {
+		data = append(data, packet)
+	}
+
+	if c.fecDecoder == nil {
+		return data, nil
+	}
+
+	// Group parameters are signalled per packet, so the decoder follows
+	// whatever the sender's controller chose for this group
+	dataShards, parityShards := int(h.FECDataShards), int(h.FECParityShards)
+
+	index := int(h.FECShardIndex)
+	shard := packet.Payload
+	if isParity {
+		index -= dataShards
+	} else {
+		shard = encodeShard(packet.Payload)
+	}
+
+	shards, err := c.fecDecoder.AddGroupShard(uint64(h.FECGroupID), dataShards, parityShards, index, shard, isParity)
+	if err != nil || shards == nil {
+		return data, nil
+	}
+
+	for i, s := range shards {
+		if !isParity && i == int(h.FECShardIndex) {
+			continue
+		}
+		payload, ok := decodeShard(s)
+		if !ok {
+			continue
+		}
+		p := transport.NewPacket(c.guid, protocol.SeqAdd(h.FECGroupID, uint32(i)), 0, 0, payload)
+		p.Header.SetFECInfo(h.FECGroupID, uint8(i), h.FECDataShards, h.FECParityShards)
+		recovered = append(recovered, p)
+	}
+
+	return data, recovered
+}
+
+// maxPayloadSize returns the largest payload a single data packet may carry.
+// With path MTU discovery data packets fill the discovered path MTU, which
+// also sizes FEC shards.
+func (c *Connection) maxPayloadSize() int {
+	size := protocol.DefaultPayloadSize
+	if mtu := c.PathMTU(); mtu > 0 {
+		size = min(mtu-dataHeaderReserve, protocol.MaxPayloadSize)
+	}
+	size -= c.sealOverhead()
+	if c.fecEnabled {
+		size -= fecShardOverhead
+	}
+	return size
+}
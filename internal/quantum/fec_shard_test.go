@@ -0,0 +1,192 @@
+package quantum
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+func TestShardEncodeDecode(t *testing.T) {
+	payload := []byte("hello quantum")
+
+	shard := encodeShard(payload)
+	if len(shard) != len(payload)+fecShardOverhead {
+		t.Fatalf("Expected shard length %d, got %d", len(payload)+fecShardOverhead, len(shard))
+	}
+
+	// Reed-Solomon pads shards; decoding must strip the padding
+	padded := append(shard, make([]byte, 32)...)
+	decoded, ok := decodeShard(padded)
+	if !ok {
+		t.Fatal("Failed to decode padded shard")
+	}
+	if !bytes.Equal(decoded, payload) {
+		t.Errorf("Expected %q, got %q", payload, decoded)
+	}
+
+	if _, ok := decodeShard([]byte{0xFF, 0xFF, 1}); ok {
+		t.Error("Shard with length beyond its size should not decode")
+	}
+}
+
+// lossyProxy relays UDP between one client and a server, dropping the first
+// transmission of selected client data packets
+type lossyProxy struct {
+	conn   *net.UDPConn
+	server *net.UDPAddr
+	drop   func(h *protocol.Header) bool
+
+	mu      sync.Mutex
+	client  *net.UDPAddr
+	dropped map[uint32]bool
+}
+
+func newLossyProxy(t *testing.T, server net.Addr, drop func(h *protocol.Header) bool) *lossyProxy {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	p := &lossyProxy{
+		conn:    conn,
+		server:  server.(*net.UDPAddr),
+		drop:    drop,
+		dropped: make(map[uint32]bool),
+	}
+	go p.run()
+	return p
+}
+
+func (p *lossyProxy) run() {
+	buf := make([]byte, protocol.MaxPacketSize)
+	for {
+		n, addr, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		if addr.Port == p.server.Port {
+			p.mu.Lock()
+			client := p.client
+			p.mu.Unlock()
+			if client != nil {
+				p.conn.WriteToUDP(buf[:n], client)
+			}
+			continue
+		}
+
+		p.mu.Lock()
+		p.client = addr
+		p.mu.Unlock()
+
+		if p.shouldDrop(buf[:n]) {
+			continue
+		}
+		p.conn.WriteToUDP(buf[:n], p.server)
+	}
+}
+
+func (p *lossyProxy) shouldDrop(data []byte) bool {
+	headerSize := len(data) - int(binary.BigEndian.Uint16(data[30:32]))
+	header := &protocol.Header{}
+	if err := header.Unmarshal(data[:headerSize]); err != nil {
+		return false
+	}
+	if headerSize == len(data) || header.IsParity() || !p.drop(header) {
+		return false
+	}
+
+	// Drop only the first transmission so retransmissions get through
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.dropped[header.SequenceNumber] {
+		return false
+	}
+	p.dropped[header.SequenceNumber] = true
+	return true
+}
+
+func (p *lossyProxy) Addr() string {
+	return p.conn.LocalAddr().String()
+}
+
+// transferOverLossyLink sends count messages through a proxy that drops every
+// seventh data packet and returns sender and receiver statistics
+func transferOverLossyLink(t *testing.T, config *Config, count int) (sender, receiver Statistics) {
+	t.Helper()
+
+	listener := newTestListener(t, config)
+	proxy := newLossyProxy(t, listener.Addr(), func(h *protocol.Header) bool {
+		return h.SequenceNumber%7 == 3
+	})
+
+	client, err := Dial("udp", proxy.Addr(), config)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	for i := 0; i < count; i++ {
+		if err := client.Send([]byte(fmt.Sprintf("message %03d", i))); err != nil {
+			t.Fatalf("Failed to send message %d: %v", i, err)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		data, err := server.ReceiveWithTimeout(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Failed to receive message %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("message %03d", i); string(data) != want {
+			t.Fatalf("Expected %q, got %q", want, string(data))
+		}
+	}
+
+	return client.Statistics(), server.Statistics()
+}
+
+func TestFECReducesRetransmissionsOnLossyLink(t *testing.T) {
+	const count = 100
+
+	plain := DefaultConfig()
+	plain.FECEnabled = false
+	plainSender, plainReceiver := transferOverLossyLink(t, plain, count)
+
+	withFEC := DefaultConfig()
+	withFEC.FECDataShards = 4
+	withFEC.FECParityShards = 2
+	fecSender, fecReceiver := transferOverLossyLink(t, withFEC, count)
+
+	t.Logf("Without FEC: retransmissions=%d recovered=%d", plainSender.Retransmissions, plainReceiver.PacketsRecovered)
+	t.Logf("With FEC:    retransmissions=%d recovered=%d", fecSender.Retransmissions, fecReceiver.PacketsRecovered)
+
+	if plainReceiver.PacketsRecovered != 0 {
+		t.Errorf("Expected no recoveries without FEC, got %d", plainReceiver.PacketsRecovered)
+	}
+
+	if fecReceiver.PacketsRecovered == 0 {
+		t.Error("Expected FEC to recover lost packets")
+	}
+
+	if fecSender.Retransmissions >= plainSender.Retransmissions {
+		t.Errorf("Expected fewer retransmissions with FEC: %d >= %d",
+			fecSender.Retransmissions, plainSender.Retransmissions)
+	}
+}
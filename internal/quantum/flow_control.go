@@ -0,0 +1,73 @@
+package quantum
+
+import (
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// Receive flow control is credit based and counted in packets. Every data
+// packet the application has not consumed yet, whether buffered in a stream,
+// waiting in the default stream's queue or held for reassembly, uses one
+// packet of RecvWindow. Each ACK advertises the remaining credit, and the
+// sender stops at the cumulative ACK plus that window.
+
+// receiveWindow returns the credit to advertise to the peer
+func (c *Connection) receiveWindow() uint32 {
+	pending := c.pendingRecv.Load()
+	if pending >= int64(c.config.RecvWindow) {
+		return 0
+	}
+	return c.config.RecvWindow - uint32(pending)
+}
+
+// consumed returns credit for n data packets the application has consumed
+func (c *Connection) consumed(n int) {
+	if n > 0 {
+		c.pendingRecv.Add(int64(-n))
+	}
+}
+
+// admitData reports whether the receive buffers have room for a data packet.
+// A refused packet is not acknowledged, so a peer that ignores the window is
+// slowed down by retransmission rather than losing data. The next expected
+// packet is still admitted while later ones are buffered, because it may
+// complete frames held for reassembly.
+func (c *Connection) admitData(packet *transport.Packet) bool {
+	if c.pendingRecv.Load() < int64(c.config.RecvWindow) {
+		return true
+	}
+	return packet.Header.SequenceNumber == c.recvBuf.NextExpected() && c.recvBuf.BufferedCount() > 0
+}
+
+// updateFlowControl runs from reliabilityLoop. As the receiver it tells the
+// peer about credit freed by the application; as the sender it probes a peer
+// whose window is closed, in case that window update was lost.
+func (c *Connection) updateFlowControl() {
+	// Advertise freed credit once it is worth a packet: after a quarter of
+	// the window, or as soon as the application has drained everything.
+	// Version 1 peers do not read the window, and a delayed ACK about to go
+	// out will carry it.
+	edge := protocol.SeqAdd(c.recvBuf.NextExpected(), c.receiveWindow())
+	advertised := c.advertisedEdge.Load()
+	if c.version >= 2 && protocol.SeqLess(advertised, edge) && !c.ackPending() {
+		threshold := c.config.RecvWindow / 4
+		if protocol.SeqDiff(advertised, edge) >= threshold || c.pendingRecv.Load() == 0 {
+			c.sendAck()
+		}
+	}
+
+	// A keepalive asks the peer to repeat its ACK
+	if c.unsent.Load() > 0 && !c.sendBuf.CanSend() && c.sendBuf.InFlight() == 0 {
+		if time.Since(c.lastWindowProbe) >= c.sendBuf.RTO() {
+			c.transmit(transport.NewPacket(c.guid, 0, 0, 0, nil))
+			c.lastWindowProbe = time.Now()
+		}
+	}
+}
+
+// isKeepalive reports whether a packet is a bare keepalive or window probe
+func isKeepalive(packet *transport.Packet) bool {
+	return packet.Header.Flags == 0 && len(packet.Payload) == 0
+}
@@ -0,0 +1,113 @@
+package quantum
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	guuid "github.com/Lzww0608/GUUID"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+func TestFlowControlSlowReader(t *testing.T) {
+	config := DefaultConfig()
+	config.RecvWindow = 16
+
+	listener := newTestListener(t, config)
+	client, server := newTestPair(t, listener, listener.Addr().String(), config)
+
+	const messages = 100
+	for i := 0; i < messages; i++ {
+		if err := client.Send([]byte{byte(i)}); err != nil {
+			t.Fatalf("Failed to send message %d: %v", i, err)
+		}
+	}
+
+	// The sender stops at the receiver's window instead of overrunning it
+	time.Sleep(300 * time.Millisecond)
+	if pending := server.pendingRecv.Load(); pending > int64(config.RecvWindow) {
+		t.Errorf("Expected at most %d unread packets, got %d", config.RecvWindow, pending)
+	}
+	if window, known := client.sendBuf.PeerWindow(); !known || window != 0 {
+		t.Errorf("Expected the peer window to be closed, got %d (known %v)", window, known)
+	}
+
+	// Reading reopens the window; nothing is lost or reordered
+	for i := 0; i < messages; i++ {
+		data, err := server.ReceiveWithTimeout(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Failed to receive message %d: %v", i, err)
+		}
+		if len(data) != 1 || data[0] != byte(i) {
+			t.Fatalf("Expected message %d, got %v", i, data)
+		}
+	}
+
+	if pending := server.pendingRecv.Load(); pending != 0 {
+		t.Errorf("Expected all receive credit returned, %d packets outstanding", pending)
+	}
+}
+
+func TestFlowControlVersion1Peer(t *testing.T) {
+	config := DefaultConfig()
+	config.Linger = 100 * time.Millisecond // the peer never answers FIN
+	listener := newTestListener(t, config)
+
+	peer, err := transport.Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create peer socket: %v", err)
+	}
+	defer peer.Close()
+
+	guid, _ := guuid.NewV7()
+	sendV1 := func(seq, ack uint32, flags protocol.Flags, payload []byte) {
+		t.Helper()
+		packet := transport.NewPacket(guid, seq, ack, flags, payload)
+		packet.Header.Version = 1
+		if err := peer.Send(packet); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+	receive := func() *transport.Packet {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		packet, err := peer.ReceivePacket(ctx)
+		if err != nil {
+			t.Fatalf("Failed to receive: %v", err)
+		}
+		return packet
+	}
+
+	// The server answers a version 1 handshake in version 1
+	sendV1(0, 0, protocol.FlagSYN, nil)
+	synAck := receive()
+	if synAck.Header.Version != 1 || !synAck.Header.HasFlag(protocol.FlagSYN|protocol.FlagACK) {
+		t.Fatalf("Expected a version 1 SYN-ACK, got %s (version %d)", synAck.Header, synAck.Header.Version)
+	}
+	sendV1(1, 1, protocol.FlagACK, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	frame := &protocol.StreamFrame{StreamID: protocol.DefaultStreamID, Data: []byte("from v1")}
+	sendV1(1, 0, 0, frame.Marshal())
+
+	data, err := server.ReceiveWithTimeout(2 * time.Second)
+	if err != nil {
+		t.Fatalf("Failed to receive from version 1 peer: %v", err)
+	}
+	if string(data) != "from v1" {
+		t.Errorf("Expected %q, got %q", "from v1", data)
+	}
+
+	ack := receive()
+	if ack.Header.Version != 1 || ack.Header.AckNumber != 2 {
+		t.Errorf("Expected a version 1 ACK of packet 1, got %s (version %d)", ack.Header, ack.Header.Version)
+	}
+}
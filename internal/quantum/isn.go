@@ -0,0 +1,59 @@
+package quantum
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// Each side numbers its data packets from a random initial sequence number
+// (ISN), carried in the sequence number field of its SYN or SYN-ACK, so a
+// blind attacker cannot guess the sequence space and sequence numbers wrap
+// on long-lived connections as a matter of course. Peers predating random
+// ISNs leave that field zero and number their packets from 1; we then start
+// at 1 too, since they expect it. The SYN and SYN-ACK also ask the peer for
+// an acknowledgment frequency, which tells us the peer understands delayed
+// and piggybacked ACKs.
+
+// newInitialSeqNum picks a connection's initial sequence number. Tests
+// replace it to force a wrap.
+var newInitialSeqNum = func() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return max(binary.BigEndian.Uint32(b[:]), 1)
+}
+
+// setInitialSeqNum starts our sequence at isn, if nothing has been sent yet
+func (c *Connection) setInitialSeqNum(isn uint32) {
+	if c.sendBuf.SetInitialSeqNum(isn) {
+		c.isn.Store(max(isn, 1))
+	}
+}
+
+// synPacket builds a SYN carrying our ISN and the acknowledgment frequency
+// we ask of the peer
+func (c *Connection) synPacket(payload []byte) *transport.Packet {
+	syn := transport.NewPacket(c.guid, c.isn.Load(), 0, protocol.FlagSYN, payload)
+	syn.Header.Version = c.version
+	syn.Header.SetAckFrequency(c.config.AckFrequency)
+	return syn
+}
+
+// applyHandshake takes the peer's ISN and requested acknowledgment
+// frequency from its SYN or SYN-ACK
+func (c *Connection) applyHandshake(h *protocol.Header) {
+	if h.SequenceNumber == 0 {
+		c.setInitialSeqNum(1)
+	} else {
+		c.randomISN.Store(true)
+	}
+	if c.recvBuf.SetInitialSeqNum(h.SequenceNumber) {
+		c.peerISN.Store(max(h.SequenceNumber, 1))
+	}
+
+	if n, ok := h.AckFrequency(); ok {
+		c.setAckFrequency(n)
+	}
+}
@@ -0,0 +1,94 @@
+package quantum
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	guuid "github.com/Lzww0608/GUUID"
+	"github.com/aetherflow/aetherflow/internal/quantum/netsim"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+func TestSequenceWraparound(t *testing.T) {
+	// Both ends start 100 packets short of the wrap
+	defer func(f func() uint32) { newInitialSeqNum = f }(newInitialSeqNum)
+	newInitialSeqNum = func() uint32 { return math.MaxUint32 - 100 }
+
+	link := netsim.LinkConfig{Delay: 5 * time.Millisecond, Loss: 0.03}
+	client, server := newSimulatedPair(t, netsim.Symmetric(1, link), DefaultConfig())
+
+	// Losses before, across and after the wrap are recovered both ways
+	transferMessages(t, client, server, 300, 200)
+	transferMessages(t, server, client, 300, 200)
+
+	for _, c := range []*Connection{client, server} {
+		if next := c.sendBuf.NextSeqNum(); next > 1000 {
+			t.Errorf("Expected the sequence to have wrapped, next is %d", next)
+		}
+	}
+}
+
+func TestHandshakeSequenceNumbers(t *testing.T) {
+	a, b := netsim.Pipe(netsim.Config{})
+	defer b.Close()
+	guid, _ := guuid.NewV7()
+
+	c, err := newConnection(guid, transport.NewConn(a, a.PeerAddr(), nil), a.PeerAddr(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err)
+	}
+	defer c.conn.Close()
+
+	isn := c.isn.Load()
+	if isn == 0 || c.sendBuf.NextSeqNum() != isn {
+		t.Fatalf("Expected the sequence to start at the ISN %d, got %d", isn, c.sendBuf.NextSeqNum())
+	}
+	if syn := c.synPacket(nil); syn.Header.SequenceNumber != isn {
+		t.Errorf("Expected the SYN to carry ISN %d, got %d", isn, syn.Header.SequenceNumber)
+	}
+
+	// A peer with its own ISN that asks for the default ack frequency
+	syn := protocol.NewHeader(guid, 12345, 0, protocol.FlagSYN)
+	syn.SetAckFrequency(0)
+	c.applyHandshake(syn)
+	if c.recvBuf.NextExpected() != 12345 || c.sendBuf.NextSeqNum() != isn || !c.randomISN.Load() {
+		t.Errorf("Expected to receive from 12345 and send from %d, got %d and %d",
+			isn, c.recvBuf.NextExpected(), c.sendBuf.NextSeqNum())
+	}
+	if c.acks.frequency != DefaultAckFrequency {
+		t.Errorf("Expected ack frequency %d, got %d", DefaultAckFrequency, c.acks.frequency)
+	}
+}
+
+func TestHandshakeLegacyPeer(t *testing.T) {
+	a, b := netsim.Pipe(netsim.Config{})
+	defer b.Close()
+	guid, _ := guuid.NewV7()
+
+	c, err := newConnection(guid, transport.NewConn(a, a.PeerAddr(), nil), a.PeerAddr(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err)
+	}
+	defer c.conn.Close()
+
+	// A SYN without an ISN or ack frequency comes from a peer that numbers
+	// both sequences from 1 and acknowledges every packet
+	c.applyHandshake(protocol.NewHeader(guid, 0, 0, protocol.FlagSYN))
+	if c.sendBuf.NextSeqNum() != 1 || c.recvBuf.NextExpected() != 1 || c.randomISN.Load() {
+		t.Errorf("Expected both sequences to start at 1, got %d and %d",
+			c.sendBuf.NextSeqNum(), c.recvBuf.NextExpected())
+	}
+	if c.acks.frequency != 0 {
+		t.Errorf("Expected no delayed ACKs, got frequency %d", c.acks.frequency)
+	}
+
+	synAck, err := c.synAckPacket()
+	if err != nil {
+		t.Fatalf("Failed to build SYN-ACK: %v", err)
+	}
+	if synAck.Header.SequenceNumber != 1 || synAck.Header.AckNumber != 1 {
+		t.Errorf("Expected SYN-ACK 1/1, got %d/%d", synAck.Header.SequenceNumber, synAck.Header.AckNumber)
+	}
+}
@@ -0,0 +1,403 @@
+package quantum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	guuid "github.com/Lzww0608/GUUID"
+	"github.com/aetherflow/aetherflow/internal/quantum/crypto"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/qlog"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// Listener accepts Quantum connections from multiple peers on one UDP socket.
+// Incoming packets are demultiplexed by header GUUID into per-peer connections,
+// each with its own send/receive buffers and congestion controller.
+type Listener struct {
+	mu sync.Mutex
+
+	conn   *transport.Conn
+	config *Config
+
+	// Connections by GUUID, including half-open ones
+	conns map[guuid.UUID]*Connection
+
+	// Handshake bookkeeping for connections not yet returned by Accept
+	halfOpen    map[guuid.UUID]time.Time
+	pending     int
+	acceptQueue chan *Connection
+
+	// Resumption tickets, when encrypting
+	tickets *ticketIssuer
+
+	closed      bool
+	closeSignal chan struct{}
+	wg          sync.WaitGroup
+}
+
+// Listen creates a listener accepting Quantum connections on an address
+func Listen(network, address string, config *Config) (*Listener, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	// Reject an unknown congestion control algorithm now rather than on
+	// every accepted connection
+	if _, err := newCongestionController(config); err != nil {
+		return nil, err
+	}
+
+	// Create transport connection
+	conn, err := transport.Listen(network, address, config.TransportConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	return listen(conn, config)
+}
+
+// ListenPacketConn creates a listener accepting Quantum connections over an
+// existing packet connection, such as a simulated path from package netsim.
+// The listener takes ownership of pc.
+func ListenPacketConn(pc net.PacketConn, config *Config) (*Listener, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	if _, err := newCongestionController(config); err != nil {
+		pc.Close()
+		return nil, err
+	}
+
+	return listen(transport.NewConn(pc, nil, config.TransportConfig), config)
+}
+
+// listen accepts connections on a transport connection
+func listen(conn *transport.Conn, config *Config) (*Listener, error) {
+	backlog := config.AcceptBacklog
+	if backlog <= 0 {
+		backlog = DefaultAcceptBacklog
+	}
+
+	// Probes must be lost, not fragmented, when they exceed the path MTU
+	if config.PMTUDiscovery {
+		if err := conn.SetDontFragment(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to disable fragmentation: %w", err)
+		}
+	}
+
+	l := &Listener{
+		conn:        conn,
+		config:      config,
+		conns:       make(map[guuid.UUID]*Connection),
+		halfOpen:    make(map[guuid.UUID]time.Time),
+		acceptQueue: make(chan *Connection, backlog),
+		closeSignal: make(chan struct{}),
+	}
+
+	if config.Encryption {
+		var err error
+		if l.tickets, err = newTicketIssuer(config); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create ticket key: %w", err)
+		}
+	}
+
+	l.wg.Add(1)
+	go l.readLoop()
+
+	return l, nil
+}
+
+// Accept waits for and returns the next established connection
+func (l *Listener) Accept(ctx context.Context) (*Connection, error) {
+	// A closed listener never hands out queued connections
+	select {
+	case <-l.closeSignal:
+		return nil, fmt.Errorf("listener closed")
+	default:
+	}
+
+	select {
+	case c := <-l.acceptQueue:
+		l.mu.Lock()
+		l.pending--
+		l.mu.Unlock()
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.closeSignal:
+		return nil, fmt.Errorf("listener closed")
+	}
+}
+
+// readLoop reads packets from the shared socket and dispatches them by GUUID
+func (l *Listener) readLoop() {
+	defer l.wg.Done()
+
+	for {
+		select {
+		case <-l.closeSignal:
+			return
+
+		default:
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			packet, err := l.conn.ReceivePacket(ctx)
+			cancel()
+
+			l.reapHalfOpen()
+
+			if err != nil {
+				// Tell peers opening a connection in a version we do not
+				// speak which versions we do
+				var verr *protocol.VersionError
+				if errors.As(err, &verr) && packet != nil {
+					l.sendVersionNegotiation(packet)
+				}
+				continue
+			}
+
+			l.dispatch(packet)
+		}
+	}
+}
+
+// dispatch routes a packet to its connection, running the server side of the
+// handshake for unknown GUUIDs
+func (l *Listener) dispatch(packet *transport.Packet) {
+	guid := packet.Header.GUUID
+
+	// Only listeners send version negotiation packets
+	if packet.Header.Version == protocol.VersionNegotiation {
+		return
+	}
+
+	l.mu.Lock()
+	c, exists := l.conns[guid]
+	if !exists {
+		// Packets for unknown connections other than SYN are stale; drop them
+		if !packet.Header.HasFlag(protocol.FlagSYN) || packet.Header.HasFlag(protocol.FlagACK) {
+			l.mu.Unlock()
+			return
+		}
+
+		// Refuse the connection if the backlog is full or the listener is
+		// closing
+		if l.pending >= cap(l.acceptQueue) || l.closed {
+			l.mu.Unlock()
+			rst := transport.NewPacket(guid, 0, 0, protocol.FlagRST, nil)
+			l.conn.SendPacket(rst, packet.Addr)
+			return
+		}
+
+		var err error
+		c, err = newConnection(guid, l.conn, packet.Addr, l.config)
+		if err != nil {
+			l.mu.Unlock()
+			return
+		}
+
+		// A key offer followed by a ticket asks to resume. Tickets we
+		// cannot redeem fall back to a full handshake.
+		offer := packet.Payload
+		var resumed *ticketState
+		if c.kex != nil && len(offer) > crypto.PublicKeySize {
+			resumed = l.tickets.redeem(offer[crypto.PublicKeySize:])
+			offer = offer[:crypto.PublicKeySize]
+		}
+
+		// A peer that offers no key is served in plaintext only if we
+		// allow it; a malformed offer is always refused
+		if c.kex != nil && len(offer) == 0 && !l.config.requiresEncryption() {
+			c.kex = nil
+		}
+		if c.kex != nil {
+			var secret []byte
+			if resumed != nil {
+				secret = resumed.secret
+			}
+			session, err := c.deriveSession(offer, secret, false)
+			if err == nil && resumed != nil {
+				err = c.resume(resumed, offer)
+			}
+			if err != nil {
+				l.mu.Unlock()
+				rst := transport.NewPacket(guid, 0, 0, protocol.FlagRST, nil)
+				l.conn.SendPacket(rst, packet.Addr)
+				return
+			}
+			c.session.Store(session)
+		}
+		c.listener = l
+		c.version = packet.Header.Version
+		c.applyHandshake(packet.Header)
+		c.startTrace()
+		c.tracePacket(qlog.EventPacketReceived, packet, packet)
+		l.conns[guid] = c
+		l.pending++
+
+		if resumed == nil {
+			l.halfOpen[guid] = time.Now()
+			l.mu.Unlock()
+
+			c.setState(StateConnecting)
+			l.sendSynAck(c)
+			return
+		}
+
+		// A resumed connection is established at once so the client's
+		// 0-RTT data is delivered without waiting for its ACK
+		l.mu.Unlock()
+		c.setState(StateEstablished)
+		c.start()
+
+		// Capacity was reserved above
+		l.acceptQueue <- c
+
+		l.sendSynAck(c)
+		c.issueTicket()
+		return
+	}
+
+	_, isHalfOpen := l.halfOpen[guid]
+	if packet.Header.HasFlag(protocol.FlagSYN) && !packet.Header.HasFlag(protocol.FlagACK) {
+		// Our SYN-ACK was lost; answer the retransmitted SYN while the
+		// client may still be waiting for it
+		l.mu.Unlock()
+		if isHalfOpen || c.early.Load() != nil {
+			l.sendSynAck(c)
+		}
+		return
+	}
+
+	// Drop packets that fail authentication
+	if err := c.open(packet); err != nil {
+		l.mu.Unlock()
+		return
+	}
+
+	if isHalfOpen {
+		// Any other authentic packet from the peer completes the handshake
+		delete(l.halfOpen, guid)
+		l.mu.Unlock()
+
+		c.setState(StateEstablished)
+		c.start()
+
+		// Capacity was reserved when the SYN was admitted
+		l.acceptQueue <- c
+		c.issueTicket()
+	} else {
+		l.mu.Unlock()
+	}
+
+	c.deliver(packet)
+}
+
+// sendVersionNegotiation answers a SYN in an unsupported version with the
+// versions we support
+func (l *Listener) sendVersionNegotiation(packet *transport.Packet) {
+	if !packet.Header.HasFlag(protocol.FlagSYN) || packet.Header.HasFlag(protocol.FlagACK) {
+		return
+	}
+
+	vn := transport.NewPacket(packet.Header.GUUID, 0, 0, 0, protocol.SupportedVersions())
+	vn.Header.Version = protocol.VersionNegotiation
+	l.conn.SendPacket(vn, packet.Addr)
+}
+
+// sendSynAck answers a SYN on behalf of a half-open connection
+func (l *Listener) sendSynAck(c *Connection) {
+	synAck, err := c.synAckPacket()
+	if err != nil {
+		return
+	}
+	l.conn.SendPacket(synAck, c.peerAddr())
+}
+
+// reapHalfOpen discards half-open connections whose handshake timed out
+func (l *Listener) reapHalfOpen() {
+	now := time.Now()
+
+	if l.tickets != nil {
+		l.tickets.purge(now)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for guid, since := range l.halfOpen {
+		if now.Sub(since) > DefaultHandshakeTimeout {
+			if c := l.conns[guid]; c != nil {
+				c.stopTrace()
+			}
+			delete(l.halfOpen, guid)
+			delete(l.conns, guid)
+			l.pending--
+		}
+	}
+}
+
+// remove detaches a closed connection from the listener
+func (l *Listener) remove(guid guuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, isHalfOpen := l.halfOpen[guid]; isHalfOpen {
+		delete(l.halfOpen, guid)
+		l.pending--
+	}
+	delete(l.conns, guid)
+}
+
+// Close stops accepting connections and closes all connections on the listener
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+
+	conns := make([]*Connection, 0, len(l.conns))
+	for _, c := range l.conns {
+		conns = append(conns, c)
+	}
+	l.mu.Unlock()
+
+	// Close connections while still dispatching, so their peers' FIN-ACKs
+	// arrive
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
+	}
+	wg.Wait()
+
+	close(l.closeSignal)
+	l.wg.Wait()
+
+	return l.conn.Close()
+}
+
+// Addr returns the listener's local address
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// ConnectionCount returns the number of connections on the listener,
+// including half-open ones
+func (l *Listener) ConnectionCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.conns)
+}
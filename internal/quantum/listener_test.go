@@ -0,0 +1,289 @@
+package quantum
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	guuid "github.com/Lzww0608/GUUID"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+func newTestListener(t *testing.T, config *Config) *Listener {
+	t.Helper()
+
+	listener, err := Listen("udp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	return listener
+}
+
+func TestListenerAcceptMultiplePeers(t *testing.T) {
+	listener := newTestListener(t, nil)
+
+	const numPeers = 3
+
+	// Echo server
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func(conn *Connection) {
+				for {
+					data, err := conn.Receive()
+					if err != nil {
+						return
+					}
+					conn.Send(data)
+				}
+			}(conn)
+		}
+	}()
+
+	clients := make([]*Connection, numPeers)
+	for i := range clients {
+		conn, err := Dial("udp", listener.Addr().String(), nil)
+		if err != nil {
+			t.Fatalf("Failed to dial peer %d: %v", i, err)
+		}
+		defer conn.Close()
+		clients[i] = conn
+	}
+
+	for i, conn := range clients {
+		msg := fmt.Sprintf("hello from peer %d", i)
+		if err := conn.Send([]byte(msg)); err != nil {
+			t.Fatalf("Peer %d failed to send: %v", i, err)
+		}
+
+		data, err := conn.ReceiveWithTimeout(2 * time.Second)
+		if err != nil {
+			t.Fatalf("Peer %d failed to receive echo: %v", i, err)
+		}
+		if string(data) != msg {
+			t.Errorf("Peer %d: expected %q, got %q", i, msg, string(data))
+		}
+	}
+
+	if count := listener.ConnectionCount(); count != numPeers {
+		t.Errorf("Expected %d connections, got %d", numPeers, count)
+	}
+}
+
+func TestListenerAcceptedConnectionSharesGUID(t *testing.T) {
+	listener := newTestListener(t, nil)
+
+	client, err := Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	if server.GUID() != client.GUID() {
+		t.Errorf("Expected GUID %s, got %s", client.GUID(), server.GUID())
+	}
+
+	if server.State() != StateEstablished {
+		t.Errorf("Expected state ESTABLISHED, got %s", server.State())
+	}
+
+	if server.RemoteAddr() != client.LocalAddr() {
+		t.Errorf("Expected remote %s, got %s", client.LocalAddr(), server.RemoteAddr())
+	}
+}
+
+func TestListenerBacklogFull(t *testing.T) {
+	config := DefaultConfig()
+	config.AcceptBacklog = 1
+	listener := newTestListener(t, config)
+
+	// The first connection occupies the only backlog slot until accepted
+	first, err := Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial first connection: %v", err)
+	}
+	defer first.Close()
+
+	if _, err := Dial("udp", listener.Addr().String(), nil); err == nil {
+		t.Fatal("Expected dial to be refused when backlog is full")
+	}
+
+	// Accepting frees the slot
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := listener.Accept(ctx); err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	second, err := Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial after accept: %v", err)
+	}
+	second.Close()
+}
+
+func TestListenerAcceptContextCancel(t *testing.T) {
+	listener := newTestListener(t, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := listener.Accept(ctx); err == nil {
+		t.Fatal("Expected Accept to fail when context expires")
+	}
+}
+
+func TestListenerClose(t *testing.T) {
+	listener, err := Listen("udp", "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	client, err := Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	if err := listener.Close(); err != nil {
+		t.Fatalf("Failed to close listener: %v", err)
+	}
+
+	if _, err := listener.Accept(context.Background()); err == nil {
+		t.Error("Expected Accept to fail after Close")
+	}
+
+	if count := listener.ConnectionCount(); count != 0 {
+		t.Errorf("Expected 0 connections after Close, got %d", count)
+	}
+}
+
+func TestListenerVersionNegotiation(t *testing.T) {
+	listener := newTestListener(t, nil)
+
+	peer, err := net.DialUDP("udp", nil, listener.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("Failed to create peer socket: %v", err)
+	}
+	defer peer.Close()
+
+	// A SYN in a version from the future
+	guid, _ := guuid.NewV7()
+	syn := protocol.NewHeader(guid, 0, 0, protocol.FlagSYN)
+	syn.Version = 2
+	data, _ := syn.Marshal()
+	data[4] = protocol.CurrentVersion + 1
+	if _, err := peer.Write(data); err != nil {
+		t.Fatalf("Failed to send SYN: %v", err)
+	}
+
+	buf := make([]byte, protocol.MaxPacketSize)
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := peer.Read(buf)
+	if err != nil {
+		t.Fatalf("Expected a version negotiation packet: %v", err)
+	}
+	header, versions, err := protocol.SplitPacket(buf[:n])
+	if err != nil {
+		t.Fatalf("Failed to parse reply: %v", err)
+	}
+	if header.Version != protocol.VersionNegotiation || header.GUUID != guid {
+		t.Fatalf("Expected version negotiation for %v, got %s (version %d)", guid, header, header.Version)
+	}
+	if string(versions) != string(protocol.SupportedVersions()) {
+		t.Errorf("Expected versions %v, got %v", protocol.SupportedVersions(), versions)
+	}
+	if count := listener.ConnectionCount(); count != 0 {
+		t.Errorf("Expected no connection state for an unsupported version, got %d", count)
+	}
+}
+
+// olderListener fronts a listener, answering SYNs newer than version 2 with
+// a version negotiation packet as a listener that predates version 3 would
+func olderListener(t *testing.T, listener *Listener) *net.UDPAddr {
+	t.Helper()
+
+	front, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	back, err := net.DialUDP("udp", nil, listener.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	t.Cleanup(func() {
+		front.Close()
+		back.Close()
+	})
+
+	client := make(chan *net.UDPAddr, 1)
+	go func() {
+		buf := make([]byte, protocol.MaxPacketSize)
+		for {
+			n, from, err := front.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case client <- from:
+			default:
+			}
+
+			header, _, err := protocol.SplitPacket(buf[:n])
+			if err == nil && header.HasFlag(protocol.FlagSYN) && header.Version > 2 {
+				vn := protocol.NewHeader(header.GUUID, 0, 0, 0)
+				vn.Version = protocol.VersionNegotiation
+				vn.PayloadLength = 2
+				data, _ := vn.Marshal()
+				front.WriteToUDP(append(data, 2, 1), from)
+				continue
+			}
+			back.Write(buf[:n])
+		}
+	}()
+	go func() {
+		buf := make([]byte, protocol.MaxPacketSize)
+		to := <-client
+		for {
+			n, err := back.Read(buf)
+			if err != nil {
+				return
+			}
+			front.WriteToUDP(buf[:n], to)
+		}
+	}()
+
+	return front.LocalAddr().(*net.UDPAddr)
+}
+
+func TestDialNegotiatesOlderVersion(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, server := newTestPair(t, listener, olderListener(t, listener).String(), nil)
+
+	if client.version != 2 || server.version != 2 {
+		t.Fatalf("Expected both ends to speak version 2, got client %d server %d", client.version, server.version)
+	}
+
+	if err := client.Send([]byte("negotiated")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	data, err := server.ReceiveWithTimeout(2 * time.Second)
+	if err != nil || string(data) != "negotiated" {
+		t.Fatalf("Expected %q, got %q (%v)", "negotiated", data, err)
+	}
+}
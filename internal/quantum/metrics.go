@@ -0,0 +1,240 @@
+package quantum
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/reliability"
+)
+
+// A Collector set as Config.Metrics exports the transport health of every
+// connection using it to Prometheus, aggregated over the process: RTT
+// samples, congestion windows, pacing rates and states, bytes in flight and
+// queue depths of the connections currently open, and packet, loss,
+// retransmission and FEC counters. A connection joins once established and
+// leaves when closed; its counts stay in the totals, so counters never go
+// down as connections come and go.
+
+// Collector is a prometheus.Collector aggregating Quantum connections
+type Collector struct {
+	mu    sync.Mutex
+	conns map[*Connection]struct{}
+
+	// Counts of the connections that have closed
+	closed            Statistics
+	closedFECFailures uint64
+
+	rtt prometheus.Histogram
+
+	connections   *prometheus.Desc
+	cwnd          *prometheus.Desc
+	pacingRate    *prometheus.Desc
+	inflight      *prometheus.Desc
+	sendQueue     *prometheus.Desc
+	reorderBuffer *prometheus.Desc
+	receiveQueue  *prometheus.Desc
+
+	packetsSent     *prometheus.Desc
+	packetsReceived *prometheus.Desc
+	bytesSent       *prometheus.Desc
+	bytesReceived   *prometheus.Desc
+	packetsLost     *prometheus.Desc
+	retransmissions *prometheus.Desc
+	fecRecoveries   *prometheus.Desc
+	fecFailures     *prometheus.Desc
+}
+
+// NewCollector creates a collector exporting metrics named quantum_*. It
+// must be registered, e.g. with RegisterCollector, to be scraped.
+func NewCollector() *Collector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("quantum", "", name), help, labels, nil)
+	}
+
+	return &Collector{
+		conns: make(map[*Connection]struct{}),
+		rtt: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "quantum",
+			Name:      "rtt_seconds",
+			Help:      "Round-trip time samples",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12), // 1ms to ~2s
+		}),
+
+		connections:   desc("connections", "Open connections by congestion control algorithm and state", "algorithm", "state"),
+		cwnd:          desc("cwnd_bytes", "Sum of the congestion windows of open connections", "algorithm"),
+		pacingRate:    desc("pacing_rate_bytes", "Sum of the pacing rates of open connections, in bytes per second", "algorithm"),
+		inflight:      desc("inflight_bytes", "Payload bytes sent and not yet acknowledged"),
+		sendQueue:     desc("send_queue_packets", "Data packets queued by the application and not yet sent"),
+		reorderBuffer: desc("reorder_buffer_packets", "Packets received out of order and waiting for a gap to fill"),
+		receiveQueue:  desc("receive_queue_packets", "Data packets delivered and not yet read by the application"),
+
+		packetsSent:     desc("packets_sent_total", "Packets sent"),
+		packetsReceived: desc("packets_received_total", "Packets received"),
+		bytesSent:       desc("bytes_sent_total", "Bytes sent"),
+		bytesReceived:   desc("bytes_received_total", "Bytes received"),
+		packetsLost:     desc("packets_lost_total", "Packets detected as lost"),
+		retransmissions: desc("retransmissions_total", "Packets retransmitted"),
+		fecRecoveries:   desc("fec_recoveries_total", "Lost packets rebuilt from FEC parity"),
+		fecFailures:     desc("fec_recovery_failures_total", "FEC groups that could not be rebuilt"),
+	}
+}
+
+// RegisterCollector registers a new collector with reg and returns it. If
+// reg already holds one, that collector is returned instead, so listeners
+// and dialers set up more than once in a process share a single set of
+// quantum_* metrics.
+func RegisterCollector(reg prometheus.Registerer) (*Collector, error) {
+	m := NewCollector()
+	if err := reg.Register(m); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(*Collector); ok {
+				return existing, nil
+			}
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+// Describe sends the descriptors of the collector's metrics
+func (m *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		m.connections, m.cwnd, m.pacingRate, m.inflight, m.sendQueue, m.reorderBuffer, m.receiveQueue,
+		m.packetsSent, m.packetsReceived, m.bytesSent, m.bytesReceived,
+		m.packetsLost, m.retransmissions, m.fecRecoveries, m.fecFailures,
+	} {
+		ch <- d
+	}
+	m.rtt.Describe(ch)
+}
+
+// Collect sends the current values of the collector's metrics
+func (m *Collector) Collect(ch chan<- prometheus.Metric) {
+	m.mu.Lock()
+	conns := make([]*Connection, 0, len(m.conns))
+	for c := range m.conns {
+		conns = append(conns, c)
+	}
+	totals, fecFailures := m.closed, m.closedFECFailures
+	m.mu.Unlock()
+
+	type ccKey struct{ algorithm, state string }
+	states := make(map[ccKey]int)
+	cwnd := make(map[string]uint64)
+	pacing := make(map[string]float64)
+	var inflight, sendQueue, reorderBuffer, receiveQueue uint64
+
+	for _, c := range conns {
+		algorithm, _ := c.cc.Statistics()["algorithm"].(string)
+		states[ccKey{algorithm, congestionState(c.cc)}]++
+		cwnd[algorithm] += uint64(c.cc.Cwnd())
+		if delay := c.cc.PacingDelay(protocol.DefaultPayloadSize); delay > 0 {
+			pacing[algorithm] += protocol.DefaultPayloadSize / delay.Seconds()
+		}
+
+		inflight += c.sendBuf.BytesInFlight()
+		sendQueue += uint64(max(c.unsent.Load(), 0))
+		reorderBuffer += c.recvBuf.Statistics()["buffered"]
+		receiveQueue += uint64(max(c.pendingRecv.Load(), 0))
+
+		addStatistics(&totals, c.Statistics())
+		fecFailures += c.fecFailures()
+	}
+
+	for key, n := range states {
+		ch <- prometheus.MustNewConstMetric(m.connections, prometheus.GaugeValue, float64(n), key.algorithm, key.state)
+	}
+	for algorithm, bytes := range cwnd {
+		ch <- prometheus.MustNewConstMetric(m.cwnd, prometheus.GaugeValue, float64(bytes), algorithm)
+		ch <- prometheus.MustNewConstMetric(m.pacingRate, prometheus.GaugeValue, pacing[algorithm], algorithm)
+	}
+
+	gauge := func(d *prometheus.Desc, v uint64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, float64(v))
+	}
+	gauge(m.inflight, inflight)
+	gauge(m.sendQueue, sendQueue)
+	gauge(m.reorderBuffer, reorderBuffer)
+	gauge(m.receiveQueue, receiveQueue)
+
+	counter := func(d *prometheus.Desc, v uint64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v))
+	}
+	counter(m.packetsSent, totals.PacketsSent)
+	counter(m.packetsReceived, totals.PacketsReceived)
+	counter(m.bytesSent, totals.BytesSent)
+	counter(m.bytesReceived, totals.BytesReceived)
+	counter(m.packetsLost, totals.PacketsLost)
+	counter(m.retransmissions, totals.Retransmissions)
+	counter(m.fecRecoveries, totals.PacketsRecovered)
+	counter(m.fecFailures, fecFailures)
+
+	m.rtt.Collect(ch)
+}
+
+// add starts collecting a connection
+func (m *Collector) add(c *Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conns[c] = struct{}{}
+}
+
+// remove stops collecting a closed connection, keeping its counts
+func (m *Collector) remove(c *Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.conns[c]; !ok {
+		return
+	}
+	delete(m.conns, c)
+	addStatistics(&m.closed, c.Statistics())
+	m.closedFECFailures += c.fecFailures()
+}
+
+// addStatistics adds a connection's counts to totals
+func addStatistics(totals *Statistics, s Statistics) {
+	totals.PacketsSent += s.PacketsSent
+	totals.PacketsReceived += s.PacketsReceived
+	totals.BytesSent += s.BytesSent
+	totals.BytesReceived += s.BytesReceived
+	totals.PacketsLost += s.PacketsLost
+	totals.PacketsRecovered += s.PacketsRecovered
+	totals.Retransmissions += s.Retransmissions
+}
+
+// fecFailures returns the FEC groups the connection could not rebuild
+func (c *Connection) fecFailures() uint64 {
+	if c.fecDecoder == nil {
+		return 0
+	}
+	return c.fecDecoder.Statistics()["failed_recovery"]
+}
+
+// trackMetrics adds the connection to Config.Metrics once established and
+// removes it once closed
+func (c *Connection) trackMetrics(to State) {
+	m := c.config.Metrics
+	if m == nil {
+		return
+	}
+	switch to {
+	case StateEstablished:
+		m.add(c)
+	case StateClosed:
+		m.remove(c)
+	}
+}
+
+// observeRTT passes an RTT update to the connection's trace and metrics
+func (c *Connection) observeRTT(u reliability.RTTUpdate) {
+	if c.tracer != nil {
+		c.tracer.rttUpdated(u)
+	}
+	if c.config.Metrics != nil {
+		c.config.Metrics.rtt.Observe(u.Latest.Seconds())
+	}
+}
@@ -0,0 +1,101 @@
+package quantum
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/netsim"
+)
+
+// gather scrapes a registry into metric families by name
+func gather(t *testing.T, reg *prometheus.Registry) map[string]*dto.MetricFamily {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		byName[f.GetName()] = f
+	}
+	return byName
+}
+
+// sum adds the values of all of a family's gauges or counters
+func sum(f *dto.MetricFamily) float64 {
+	var total float64
+	for _, m := range f.GetMetric() {
+		total += m.GetGauge().GetValue() + m.GetCounter().GetValue()
+	}
+	return total
+}
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(collector)
+
+	config := DefaultConfig()
+	config.Metrics = collector
+	path := netsim.Symmetric(1, netsim.LinkConfig{Delay: 5 * time.Millisecond, Loss: 0.05})
+	client, server := newSimulatedPair(t, path, config)
+
+	transferMessages(t, client, server, 200, 1000)
+
+	families := gather(t, reg)
+	if n := sum(families["quantum_connections"]); n != 2 {
+		t.Errorf("Expected 2 open connections, got %v", n)
+	}
+	for _, m := range families["quantum_connections"].GetMetric() {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == "algorithm" && l.GetValue() != "bbr" {
+				t.Errorf("Expected algorithm bbr, got %q", l.GetValue())
+			}
+		}
+	}
+	if sum(families["quantum_cwnd_bytes"]) == 0 || sum(families["quantum_pacing_rate_bytes"]) == 0 {
+		t.Error("Expected congestion windows and pacing rates")
+	}
+	if n := families["quantum_rtt_seconds"].GetMetric()[0].GetHistogram().GetSampleCount(); n == 0 {
+		t.Error("Expected RTT samples")
+	}
+	if sum(families["quantum_retransmissions_total"]) == 0 || sum(families["quantum_packets_lost_total"]) == 0 {
+		t.Error("Expected losses on a lossy link to be counted")
+	}
+	sent := sum(families["quantum_packets_sent_total"])
+
+	// Closed connections leave the gauges but stay in the counters
+	client.Close()
+	server.Close()
+
+	families = gather(t, reg)
+	if f := families["quantum_connections"]; f != nil {
+		t.Errorf("Expected no open connections, got %v", sum(f))
+	}
+	if n := sum(families["quantum_packets_sent_total"]); n < sent {
+		t.Errorf("Expected packets sent to stay at least %v, got %v", sent, n)
+	}
+}
+
+func TestRegisterCollector(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+
+	first, err := RegisterCollector(reg)
+	if err != nil {
+		t.Fatalf("Failed to register collector: %v", err)
+	}
+
+	// Registering again, as a rebuilt service context would, shares the
+	// collector instead of failing
+	second, err := RegisterCollector(reg)
+	if err != nil {
+		t.Fatalf("Failed to register collector again: %v", err)
+	}
+	if second != first {
+		t.Error("Expected the registered collector to be returned")
+	}
+}
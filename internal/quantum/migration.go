@@ -0,0 +1,132 @@
+package quantum
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// Connections are identified by GUUID rather than by address, so a peer whose
+// address changes (a phone moving from Wi-Fi to cellular, a NAT rebinding its
+// port) keeps its connection. Before sending to a new address the listener
+// side validates it: it sends a random challenge there and migrates only when
+// the peer echoes it back from that address, so a spoofed source address
+// cannot redirect traffic. With encryption on, only authentic packets start
+// a validation at all.
+
+// checkPath starts validating the address a packet came from if it is not the
+// peer's current address. The challenge is repeated, at most once per RTO,
+// while packets keep arriving from the new address.
+func (c *Connection) checkPath(packet *transport.Packet) {
+	addr := packet.Addr
+	if addr == nil || sameAddr(addr, c.peerAddr()) {
+		return
+	}
+
+	// A late packet from a path the peer has already left is no sign of
+	// migration; only data we have not seen yet, or unsequenced packets, are
+	if seq := packet.Header.SequenceNumber; seq != 0 && protocol.SeqLess(seq, c.recvBuf.NextExpected()) {
+		return
+	}
+
+	// One path is validated at a time
+	if c.pathCandidate != nil && time.Since(c.pathSentAt) < c.sendBuf.RTO() {
+		return
+	}
+
+	if c.pathCandidate == nil || !sameAddr(addr, c.pathCandidate) {
+		if _, err := rand.Read(c.pathChallenge[:]); err != nil {
+			return
+		}
+		c.pathCandidate = addr
+	}
+
+	c.pathSentAt = time.Now()
+	c.sendControl(protocol.ControlPathChallenge, c.pathChallenge[:], addr)
+}
+
+// handleControl processes a control frame received from the peer
+func (c *Connection) handleControl(packet *transport.Packet) {
+	frame := &protocol.ControlFrame{}
+	if err := frame.Unmarshal(packet.Payload); err != nil {
+		return
+	}
+
+	switch frame.Type {
+	case protocol.ControlPathChallenge:
+		// Echo from the path the challenge arrived on
+		c.sendControl(protocol.ControlPathResponse, frame.Data, packet.Addr)
+
+	case protocol.ControlPathResponse:
+		if c.pathCandidate == nil || packet.Addr == nil || !sameAddr(packet.Addr, c.pathCandidate) {
+			return
+		}
+		if !bytes.Equal(frame.Data, c.pathChallenge[:]) {
+			return
+		}
+		c.migrate(c.pathCandidate)
+		c.pathCandidate = nil
+
+	case protocol.ControlNewTicket:
+		c.storeTicket(frame.Data)
+
+	case protocol.ControlPMTUProbe:
+		c.handlePMTUProbe(frame)
+
+	case protocol.ControlPMTUAck:
+		c.handlePMTUAck(frame)
+	}
+}
+
+// migrate moves the connection to a validated peer address
+func (c *Connection) migrate(addr *net.UDPAddr) {
+	c.mu.Lock()
+	from := c.remote
+	c.remote = addr
+	c.remoteAddr = addr.String()
+	c.stats.Migrations++
+	c.mu.Unlock()
+
+	// A new network path has unknown capacity and delay, so congestion
+	// control, RTT estimation, path MTU discovery and ECN validation start
+	// over. A port change alone is a NAT rebinding on the same path and
+	// keeps its estimates.
+	if !from.IP.Equal(addr.IP) {
+		c.cc.Reset()
+		c.sendBuf.ResetRTT()
+		c.restartECN()
+		if c.pmtu != nil {
+			c.pmtu.restart()
+		}
+	}
+
+	if c.config.OnMigrate != nil {
+		c.config.OnMigrate(c, from, addr)
+	}
+}
+
+// sendControl sends a control frame to addr outside the packet sequence
+func (c *Connection) sendControl(typ protocol.ControlType, data []byte, addr *net.UDPAddr) {
+	frame := &protocol.ControlFrame{Type: typ, Data: data}
+	c.transmitTo(transport.NewPacket(c.guid, 0, 0, 0, frame.Marshal()), addr)
+}
+
+// isControl reports whether a packet carries a control frame. Control packets
+// take no sequence number and are never FEC protected.
+func isControl(packet *transport.Packet) bool {
+	return packet.Header.SequenceNumber == 0 &&
+		!packet.Header.HasFlag(protocol.FlagFEC) &&
+		protocol.IsControlFrame(packet.Payload)
+}
+
+// sameAddr reports whether two UDP addresses are equal
+func sameAddr(a, b *net.UDPAddr) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Port == b.Port && a.IP.Equal(b.IP)
+}
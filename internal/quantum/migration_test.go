@@ -0,0 +1,214 @@
+package quantum
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// natRelay forwards datagrams between one client and a server like a NAT,
+// whose public address toward the server can change mid-connection
+type natRelay struct {
+	front  *net.UDPConn
+	server *net.UDPAddr
+
+	mu     sync.Mutex
+	back   *net.UDPConn
+	client *net.UDPAddr
+}
+
+func newNATRelay(t *testing.T, server net.Addr) *natRelay {
+	t.Helper()
+
+	front, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to create relay: %v", err)
+	}
+	r := &natRelay{front: front, server: server.(*net.UDPAddr)}
+	t.Cleanup(r.close)
+
+	if err := r.rebind("127.0.0.1"); err != nil {
+		t.Fatalf("Failed to bind relay: %v", err)
+	}
+	go r.forward()
+
+	return r
+}
+
+// rebind moves the relay's server-facing side to a new socket on ip,
+// abandoning the old mapping
+func (r *natRelay) rebind(ip string) error {
+	back, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(ip)})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	old := r.back
+	r.back = back
+	r.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	go r.backward(back)
+
+	return nil
+}
+
+func (r *natRelay) forward() {
+	buf := make([]byte, protocol.MaxPacketSize)
+	for {
+		n, from, err := r.front.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.client = from
+		back := r.back
+		r.mu.Unlock()
+		back.WriteToUDP(buf[:n], r.server)
+	}
+}
+
+func (r *natRelay) backward(back *net.UDPConn) {
+	buf := make([]byte, protocol.MaxPacketSize)
+	for {
+		n, _, err := back.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		client := r.client
+		r.mu.Unlock()
+		if client != nil {
+			r.front.WriteToUDP(buf[:n], client)
+		}
+	}
+}
+
+func (r *natRelay) addr() *net.UDPAddr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.back.LocalAddr().(*net.UDPAddr)
+}
+
+func (r *natRelay) close() {
+	r.front.Close()
+	r.mu.Lock()
+	r.back.Close()
+	r.mu.Unlock()
+}
+
+type migration struct {
+	from, to *net.UDPAddr
+}
+
+func TestConnectionMigration(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+	}{
+		{"NATRebinding", "127.0.0.1"},
+		{"NewNetwork", "127.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations := make(chan migration, 4)
+			config := DefaultConfig()
+			config.OnMigrate = func(c *Connection, from, to *net.UDPAddr) {
+				migrations <- migration{from, to}
+			}
+
+			listener := newTestListener(t, config)
+			relay := newNATRelay(t, listener.Addr())
+			client, server := newTestPair(t, listener, relay.front.LocalAddr().String(), config)
+
+			if err := client.Send([]byte("before")); err != nil {
+				t.Fatalf("Failed to send: %v", err)
+			}
+			if _, err := server.ReceiveWithTimeout(2 * time.Second); err != nil {
+				t.Fatalf("Failed to receive before migration: %v", err)
+			}
+			before := relay.addr()
+
+			if err := relay.rebind(tt.ip); err != nil {
+				t.Skipf("Cannot bind %s: %v", tt.ip, err)
+			}
+			after := relay.addr()
+
+			// The server follows the client once the new path answers its challenge
+			if err := client.Send([]byte("after")); err != nil {
+				t.Fatalf("Failed to send: %v", err)
+			}
+			data, err := server.ReceiveWithTimeout(2 * time.Second)
+			if err != nil || string(data) != "after" {
+				t.Fatalf("Expected %q after migration, got %q (%v)", "after", data, err)
+			}
+
+			select {
+			case m := <-migrations:
+				if !sameAddr(m.from, before) || !sameAddr(m.to, after) {
+					t.Errorf("Expected migration %s -> %s, got %s -> %s", before, after, m.from, m.to)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Expected OnMigrate to be called")
+			}
+			if server.RemoteAddr() != after.String() {
+				t.Errorf("Expected remote address %s, got %s", after, server.RemoteAddr())
+			}
+			if got := server.Statistics().Migrations; got != 1 {
+				t.Errorf("Expected 1 migration, got %d", got)
+			}
+
+			// Server to client traffic takes the new path
+			if err := server.Send([]byte("reply")); err != nil {
+				t.Fatalf("Failed to send reply: %v", err)
+			}
+			data, err = client.ReceiveWithTimeout(2 * time.Second)
+			if err != nil || string(data) != "reply" {
+				t.Fatalf("Expected %q over the new path, got %q (%v)", "reply", data, err)
+			}
+		})
+	}
+}
+
+func TestConnectionMigrationRequiresValidation(t *testing.T) {
+	config := DefaultConfig()
+	listener := newTestListener(t, config)
+	client, server := newTestPair(t, listener, listener.Addr().String(), config)
+
+	// An off-path attacker spoofs a packet for the connection from its own
+	// address but cannot answer the challenge sent there
+	attacker, err := transport.Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create attacker socket: %v", err)
+	}
+	defer attacker.Close()
+
+	if err := attacker.Send(transport.NewPacket(server.GUID(), 0, 0, 0, nil)); err != nil {
+		t.Fatalf("Failed to send spoofed packet: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if server.RemoteAddr() != client.LocalAddr() {
+		t.Errorf("Expected remote address to stay %s, got %s", client.LocalAddr(), server.RemoteAddr())
+	}
+	if got := server.Statistics().Migrations; got != 0 {
+		t.Errorf("Expected no migration, got %d", got)
+	}
+
+	// Traffic keeps flowing to the real client
+	if err := server.Send([]byte("still here")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	data, err := client.ReceiveWithTimeout(2 * time.Second)
+	if err != nil || string(data) != "still here" {
+		t.Fatalf("Expected %q, got %q (%v)", "still here", data, err)
+	}
+}
@@ -0,0 +1,208 @@
+package netsim
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Conn is one endpoint of a simulated path. It implements net.PacketConn
+// with UDP addresses, so it can stand in for a UDP socket.
+type Conn struct {
+	addr *net.UDPAddr
+	peer *net.UDPAddr
+	out  *link
+
+	inbox chan *datagram
+
+	readDeadline deadline
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newConn(addr *net.UDPAddr) *Conn {
+	return &Conn{
+		addr:         addr,
+		inbox:        make(chan *datagram, inboxSize),
+		readDeadline: makeDeadline(),
+		done:         make(chan struct{}),
+	}
+}
+
+// deliver queues an arriving datagram to be read. It reports false if the
+// inbox is full or the endpoint closed.
+func (c *Conn) deliver(d *datagram) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.inbox <- d:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadFrom reads the next datagram to arrive
+func (c *Conn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, _, err := c.ReadFromECN(p)
+	return n, addr, err
+}
+
+// ReadFromECN reads the next datagram to arrive along with its ECN
+// codepoint, the two low bits of the IP traffic class
+func (c *Conn) ReadFromECN(p []byte) (int, net.Addr, uint8, error) {
+	select {
+	case <-c.done:
+		return 0, nil, 0, c.opError("read", net.ErrClosed)
+	case <-c.readDeadline.wait():
+		return 0, nil, 0, c.opError("read", os.ErrDeadlineExceeded)
+	default:
+	}
+
+	select {
+	case d := <-c.inbox:
+		return copy(p, d.data), d.from, d.ecn, nil
+	case <-c.done:
+		return 0, nil, 0, c.opError("read", net.ErrClosed)
+	case <-c.readDeadline.wait():
+		return 0, nil, 0, c.opError("read", os.ErrDeadlineExceeded)
+	}
+}
+
+// WriteTo sends a datagram to the peer. Writes never block; datagrams the
+// path cannot carry, or addressed to anyone but the peer, are lost.
+func (c *Conn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.WriteToECN(p, addr, 0)
+}
+
+// WriteToECN sends a datagram to the peer with an ECN codepoint, which the
+// path may mark CE or clear
+func (c *Conn) WriteToECN(p []byte, addr net.Addr, ecn uint8) (int, error) {
+	select {
+	case <-c.done:
+		return 0, c.opError("write", net.ErrClosed)
+	default:
+	}
+
+	if a, ok := addr.(*net.UDPAddr); ok && a.IP.Equal(c.peer.IP) && a.Port == c.peer.Port {
+		c.out.send(p, c.addr, ecn)
+	}
+	return len(p), nil
+}
+
+// opError wraps an error the way net does for sockets
+func (c *Conn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "udp", Source: c.addr, Err: err}
+}
+
+// Close closes the endpoint. Datagrams still in flight towards the peer
+// are lost.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+// LocalAddr returns the endpoint's address
+func (c *Conn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// PeerAddr returns the address of the other endpoint
+func (c *Conn) PeerAddr() *net.UDPAddr {
+	return c.peer
+}
+
+// SetDeadline sets the read deadline; writes never block
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for ReadFrom. A zero time means no
+// deadline.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline does nothing, as writes never block
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// SetLink changes the impairments of the link this endpoint sends on, for
+// datagrams sent from now on
+func (c *Conn) SetLink(config LinkConfig) {
+	c.out.setConfig(config)
+}
+
+// Statistics returns the statistics of the link this endpoint sends on
+func (c *Conn) Statistics() LinkStatistics {
+	return c.out.statistics()
+}
+
+// deadline is a read deadline that wakes readers blocked when it passes
+// or is moved
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // closed when the deadline passes
+}
+
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+// set moves the deadline, zero for none
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // the timer already closed it
+	}
+	d.timer = nil
+
+	// A deadline that passed and is moved reopens the channel
+	closed := isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if wait := time.Until(t); wait > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(wait, func() { close(cancel) })
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel closed once the deadline passes
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
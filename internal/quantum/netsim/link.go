@@ -0,0 +1,221 @@
+package netsim
+
+import (
+	"bytes"
+	"container/heap"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// datagram is a packet in flight on a link
+type datagram struct {
+	data []byte
+	from *net.UDPAddr
+	ecn  uint8     // ECN codepoint
+	at   time.Time // when it arrives
+	seq  uint64    // keeps packets arriving at the same time in send order
+}
+
+// arrivals orders datagrams in flight by arrival time
+type arrivals []*datagram
+
+func (a arrivals) Len() int { return len(a) }
+func (a arrivals) Less(i, j int) bool {
+	if a[i].at.Equal(a[j].at) {
+		return a[i].seq < a[j].seq
+	}
+	return a[i].at.Before(a[j].at)
+}
+func (a arrivals) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a *arrivals) Push(x any)   { *a = append(*a, x.(*datagram)) }
+func (a *arrivals) Pop() any {
+	old := *a
+	d := old[len(old)-1]
+	*a = old[:len(old)-1]
+	return d
+}
+
+// link carries datagrams in one direction, applying its impairments
+type link struct {
+	dst *Conn
+
+	mu     sync.Mutex
+	config LinkConfig
+	rng    *rand.Rand
+	bad    bool      // Gilbert-Elliott state
+	idleAt time.Time // when the bottleneck has sent everything queued
+	queue  arrivals
+	seq    uint64
+	stats  LinkStatistics
+
+	// wake tells run that a datagram was queued
+	wake chan struct{}
+}
+
+func newLink(config LinkConfig, rng *rand.Rand, dst *Conn) *link {
+	return &link{
+		dst:    dst,
+		config: config,
+		rng:    rng,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// ECN codepoints, the two low bits of the IP traffic class
+const (
+	ecnMask = 0x03
+	ecnCE   = 0x03
+)
+
+// send puts a datagram with an ECN codepoint on the link, or drops it as
+// the impairments decide
+func (l *link) send(data []byte, from *net.UDPAddr, ecn uint8) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.Sent++
+	cfg := l.config
+	ecn &= ecnMask
+	if cfg.BleachECN {
+		ecn = 0
+	}
+
+	if cfg.MTU > 0 && len(data) > cfg.MTU {
+		l.stats.TooLarge++
+		return
+	}
+	if l.lost(data) {
+		l.stats.Lost++
+		return
+	}
+
+	// Queue behind the bottleneck, dropping at the tail when it is full
+	now := time.Now()
+	var delay time.Duration
+	if cfg.Bandwidth > 0 {
+		start := now
+		if l.idleAt.After(now) {
+			start = l.idleAt
+		}
+		limit := cfg.QueueLimit
+		if limit <= 0 {
+			limit = DefaultQueueLimit
+		}
+		queued := int(start.Sub(now).Seconds() * float64(cfg.Bandwidth))
+		if queued+len(data) > limit {
+			l.stats.Overflowed++
+			return
+		}
+		if cfg.ECNThreshold > 0 && queued >= cfg.ECNThreshold && ecn != 0 && ecn != ecnCE {
+			ecn = ecnCE
+			l.stats.Marked++
+		}
+		l.idleAt = start.Add(time.Duration(len(data)) * time.Second / time.Duration(cfg.Bandwidth))
+		delay = l.idleAt.Sub(now)
+	}
+
+	if cfg.Reorder > 0 && l.rng.Float64() < cfg.Reorder {
+		l.stats.Reordered++
+	} else {
+		delay += cfg.Delay
+		if cfg.Jitter > 0 {
+			delay += time.Duration((l.rng.Float64()*2 - 1) * float64(cfg.Jitter))
+		}
+	}
+	at := now.Add(max(delay, 0))
+
+	copies := 1
+	if cfg.Duplicate > 0 && l.rng.Float64() < cfg.Duplicate {
+		l.stats.Duplicated++
+		copies = 2
+	}
+	for range copies {
+		l.seq++
+		heap.Push(&l.queue, &datagram{data: bytes.Clone(data), from: from, ecn: ecn, at: at, seq: l.seq})
+	}
+
+	// The new datagram may arrive before the one run is waiting for
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// lost decides whether the loss models lose a datagram
+func (l *link) lost(data []byte) bool {
+	cfg := l.config
+	if cfg.Drop != nil && cfg.Drop(data) {
+		return true
+	}
+
+	if ge := cfg.GilbertElliott; ge != nil {
+		loss := ge.LossGood
+		if l.bad {
+			loss = ge.LossBad
+		}
+		lost := l.rng.Float64() < loss
+		if l.bad {
+			l.bad = l.rng.Float64() >= ge.R
+		} else {
+			l.bad = l.rng.Float64() < ge.P
+		}
+		return lost
+	}
+
+	return cfg.Loss > 0 && l.rng.Float64() < cfg.Loss
+}
+
+// run delivers datagrams as they arrive until done is closed
+func (l *link) run(done <-chan struct{}) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		var due []*datagram
+		for len(l.queue) > 0 && !l.queue[0].at.After(now) {
+			due = append(due, heap.Pop(&l.queue).(*datagram))
+		}
+		wait := time.Hour
+		if len(l.queue) > 0 {
+			wait = l.queue[0].at.Sub(now)
+		}
+		l.mu.Unlock()
+
+		for _, d := range due {
+			delivered := l.dst.deliver(d)
+			l.mu.Lock()
+			if delivered {
+				l.stats.Delivered++
+			} else {
+				l.stats.Overflowed++
+			}
+			l.mu.Unlock()
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-l.wake:
+		case <-timer.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// setConfig changes the link's impairments for datagrams sent from now on
+func (l *link) setConfig(config LinkConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = config
+}
+
+// statistics returns a copy of the link's statistics
+func (l *link) statistics() LinkStatistics {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
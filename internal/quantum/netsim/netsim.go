@@ -0,0 +1,130 @@
+// Package netsim simulates an impaired network path in memory, so the
+// Quantum protocol can be tested against loss, delay, jitter, reordering,
+// duplication, bandwidth limits, small MTUs and ECN marking without tc netem
+// or root.
+//
+// Pipe returns the two ends of a path as net.PacketConns. Each direction is
+// a link with its own impairments, drawn from a random source seeded by
+// Config.Seed, so the same traffic on the same seed sees the same packets
+// lost, duplicated and reordered.
+package netsim
+
+import (
+	"math/rand"
+	"net"
+	"time"
+)
+
+// DefaultQueueLimit is the default number of bytes a bandwidth-limited link
+// queues before dropping packets
+const DefaultQueueLimit = 256 * 1024
+
+// inboxSize is how many delivered datagrams an endpoint holds before
+// dropping new ones, like a socket receive buffer
+const inboxSize = 4096
+
+// GilbertElliott is a two-state loss model producing loss in bursts. The
+// link moves between a good and a bad state after every packet and loses
+// packets with the probability of the state it is in.
+type GilbertElliott struct {
+	// P is the probability of moving from the good to the bad state
+	P float64
+
+	// R is the probability of moving from the bad back to the good state
+	R float64
+
+	// LossGood and LossBad are the loss probabilities in each state
+	LossGood float64
+	LossBad  float64
+}
+
+// LinkConfig describes the impairments of one direction of a path
+type LinkConfig struct {
+	// Loss is the probability that a packet is lost, independently of
+	// every other packet
+	Loss float64
+
+	// GilbertElliott, if set, replaces Loss with bursty loss
+	GilbertElliott *GilbertElliott
+
+	// Drop, if set, loses every datagram it reports true for, so a test
+	// can pick exactly which packets are lost
+	Drop func(datagram []byte) bool
+
+	// Delay is the one-way propagation delay
+	Delay time.Duration
+
+	// Jitter varies each packet's delay uniformly by up to this much either
+	// way. Packets whose delays differ by more than their spacing arrive
+	// out of order.
+	Jitter time.Duration
+
+	// Reorder is the probability that a packet skips the delay and
+	// overtakes the packets ahead of it
+	Reorder float64
+
+	// Duplicate is the probability that a packet is delivered twice
+	Duplicate float64
+
+	// Bandwidth limits the link to this many bytes per second, 0 for no
+	// limit. Packets queue behind the bottleneck up to QueueLimit bytes and
+	// are dropped beyond it.
+	Bandwidth  int
+	QueueLimit int
+
+	// MTU is the largest datagram the link carries, 0 for no limit. Larger
+	// datagrams are lost, as on a path that does not fragment.
+	MTU int
+
+	// ECNThreshold makes the bottleneck mark ECN-capable packets CE once
+	// this many bytes are queued ahead of them, like a router running AQM,
+	// 0 never marking. Packets that are not ECN-capable just queue.
+	ECNThreshold int
+
+	// BleachECN clears the ECN codepoint of every packet, as some
+	// middleboxes do
+	BleachECN bool
+}
+
+// Config describes a simulated path between two endpoints
+type Config struct {
+	// Seed seeds the random impairments
+	Seed int64
+
+	// AToB and BToA are the impairments of each direction
+	AToB LinkConfig
+	BToA LinkConfig
+}
+
+// Symmetric returns a path with the same impairments in both directions
+func Symmetric(seed int64, link LinkConfig) Config {
+	return Config{Seed: seed, AToB: link, BToA: link}
+}
+
+// LinkStatistics counts what happened to the packets sent on a link
+type LinkStatistics struct {
+	Sent       uint64
+	Delivered  uint64
+	Lost       uint64 // lost to Loss, GilbertElliott or Drop
+	Duplicated uint64
+	Reordered  uint64
+	TooLarge   uint64 // larger than the MTU
+	Overflowed uint64 // dropped by a full bottleneck queue or inbox
+	Marked     uint64 // marked CE by the bottleneck
+}
+
+// Pipe creates a simulated path and returns its two endpoints. Each can
+// only send to the other; datagrams to any other address are lost.
+func Pipe(config Config) (a, b *Conn) {
+	a = newConn(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4000})
+	b = newConn(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 4000})
+
+	a.peer, b.peer = b.addr, a.addr
+	a.out = newLink(config.AToB, rand.New(rand.NewSource(config.Seed)), b)
+	b.out = newLink(config.BToA, rand.New(rand.NewSource(config.Seed+1)), a)
+
+	go a.out.run(a.done)
+	go b.out.run(b.done)
+
+	return a, b
+}
@@ -0,0 +1,325 @@
+package netsim
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// sendNumbered sends count datagrams of the given size numbered from 0
+func sendNumbered(t *testing.T, c *Conn, count, size int) {
+	t.Helper()
+	buf := make([]byte, max(size, 4))
+	for i := 0; i < count; i++ {
+		binary.BigEndian.PutUint32(buf, uint32(i))
+		if _, err := c.WriteTo(buf, c.PeerAddr()); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+}
+
+// receiveNumbered reads numbered datagrams until none arrives for idle
+func receiveNumbered(t *testing.T, c *Conn, idle time.Duration) []uint32 {
+	t.Helper()
+	var got []uint32
+	buf := make([]byte, 2048)
+	for {
+		c.SetReadDeadline(time.Now().Add(idle))
+		n, _, err := c.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return got
+		}
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		if n >= 4 {
+			got = append(got, binary.BigEndian.Uint32(buf))
+		}
+	}
+}
+
+func newPipe(t *testing.T, config Config) (a, b *Conn) {
+	a, b = Pipe(config)
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func TestPipe(t *testing.T) {
+	a, b := newPipe(t, Config{})
+
+	if _, err := a.WriteTo([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	buf := make([]byte, 16)
+	b.SetReadDeadline(time.Now().Add(time.Second))
+	n, from, err := b.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(buf[:n]) != "hello" || from.String() != a.LocalAddr().String() {
+		t.Errorf("Expected hello from %v, got %q from %v", a.LocalAddr(), buf[:n], from)
+	}
+
+	// An unimpaired path delivers everything in order
+	sendNumbered(t, a, 1000, 100)
+	got := receiveNumbered(t, b, 50*time.Millisecond)
+	if len(got) != 1000 {
+		t.Fatalf("Expected 1000 datagrams, got %d", len(got))
+	}
+	for i, seq := range got {
+		if seq != uint32(i) {
+			t.Fatalf("Expected datagram %d, got %d", i, seq)
+		}
+	}
+
+	// Only the peer is reachable
+	a.WriteTo([]byte("lost"), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 3), Port: 4000})
+	if got := receiveNumbered(t, b, 20*time.Millisecond); len(got) != 0 {
+		t.Errorf("Expected nothing from a misaddressed datagram, got %v", got)
+	}
+}
+
+func TestPipeClosed(t *testing.T) {
+	a, b := newPipe(t, Config{})
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := b.ReadFrom(make([]byte, 16))
+		done <- err
+	}()
+
+	b.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Expected net.ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not unblock ReadFrom")
+	}
+
+	if _, err := b.WriteTo([]byte("x"), a.LocalAddr()); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed writing to a closed endpoint, got %v", err)
+	}
+}
+
+func TestLossIsDeterministic(t *testing.T) {
+	run := func(seed int64) []uint32 {
+		a, b := newPipe(t, Config{Seed: seed, AToB: LinkConfig{Loss: 0.1}})
+		sendNumbered(t, a, 2000, 100)
+		return receiveNumbered(t, b, 50*time.Millisecond)
+	}
+
+	first := run(1)
+	if lost := 2000 - len(first); lost < 150 || lost > 250 {
+		t.Errorf("Expected about 10%% of 2000 datagrams lost, lost %d", lost)
+	}
+
+	if second := run(1); !slices.Equal(first, second) {
+		t.Error("Expected the same seed to lose the same datagrams")
+	}
+	if other := run(2); slices.Equal(first, other) {
+		t.Error("Expected another seed to lose other datagrams")
+	}
+}
+
+func TestGilbertElliott(t *testing.T) {
+	// Bad states last 1/R = 4 packets on average and lose everything
+	a, b := newPipe(t, Config{Seed: 3, AToB: LinkConfig{
+		GilbertElliott: &GilbertElliott{P: 0.02, R: 0.25, LossBad: 1},
+	}})
+	sendNumbered(t, a, 3000, 100)
+	got := receiveNumbered(t, b, 50*time.Millisecond)
+
+	var lost, bursts int
+	next := uint32(0)
+	for _, seq := range append(got, 3000) {
+		if seq > next {
+			lost += int(seq - next)
+			bursts++
+		}
+		next = seq + 1
+	}
+	if bursts == 0 {
+		t.Fatal("Expected losses")
+	}
+	if mean := float64(lost) / float64(bursts); mean < 2.5 {
+		t.Errorf("Expected bursts of about 4 losses, got %.1f on average", mean)
+	}
+	if stats := a.Statistics(); stats.Lost != uint64(lost) {
+		t.Errorf("Expected %d lost in statistics, got %d", lost, stats.Lost)
+	}
+}
+
+func TestDelayJitterAndReorder(t *testing.T) {
+	a, b := newPipe(t, Config{Seed: 1, AToB: LinkConfig{Delay: 30 * time.Millisecond}})
+
+	start := time.Now()
+	sendNumbered(t, a, 1, 100)
+	buf := make([]byte, 16)
+	b.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := b.ReadFrom(buf); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected a 30ms delay, arrived after %v", elapsed)
+	}
+
+	reordered := func(got []uint32) int {
+		n := 0
+		for i := 1; i < len(got); i++ {
+			if got[i] < got[i-1] {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Jitter larger than the spacing between packets reorders them
+	a.SetLink(LinkConfig{Delay: 10 * time.Millisecond, Jitter: 5 * time.Millisecond})
+	for i := 0; i < 50; i++ {
+		a.WriteTo(binary.BigEndian.AppendUint32(nil, uint32(i)), b.LocalAddr())
+		time.Sleep(100 * time.Microsecond)
+	}
+	if got := receiveNumbered(t, b, 50*time.Millisecond); len(got) != 50 || reordered(got) == 0 {
+		t.Errorf("Expected 50 datagrams with some reordered, got %d with %d reordered", len(got), reordered(got))
+	}
+
+	// Reordered packets overtake the delayed ones
+	a.SetLink(LinkConfig{Delay: 20 * time.Millisecond, Reorder: 0.2})
+	sendNumbered(t, a, 100, 100)
+	got := receiveNumbered(t, b, 50*time.Millisecond)
+	if len(got) != 100 || reordered(got) == 0 {
+		t.Errorf("Expected 100 datagrams with some reordered, got %d with %d reordered", len(got), reordered(got))
+	}
+	if a.Statistics().Reordered == 0 {
+		t.Error("Expected reordered datagrams in statistics")
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	a, b := newPipe(t, Config{Seed: 1, AToB: LinkConfig{Duplicate: 0.1}})
+	sendNumbered(t, a, 1000, 100)
+	got := receiveNumbered(t, b, 50*time.Millisecond)
+
+	dups := len(got) - 1000
+	if dups < 50 || dups > 150 {
+		t.Errorf("Expected about 100 duplicates, got %d", dups)
+	}
+	if stats := a.Statistics(); stats.Duplicated != uint64(dups) || stats.Delivered != uint64(len(got)) {
+		t.Errorf("Statistics do not match: %+v", stats)
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	// 100 KB at 1 MB/s takes 100ms to drain
+	a, b := newPipe(t, Config{AToB: LinkConfig{Bandwidth: 1000000}})
+
+	start := time.Now()
+	sendNumbered(t, a, 100, 1000)
+	got := receiveNumbered(t, b, 50*time.Millisecond)
+	elapsed := time.Since(start) - 50*time.Millisecond
+	if len(got) != 100 {
+		t.Fatalf("Expected 100 datagrams, got %d", len(got))
+	}
+	if elapsed < 90*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("Expected about 100ms to drain, took %v", elapsed)
+	}
+
+	// A burst beyond the queue limit is dropped at the tail
+	a.SetLink(LinkConfig{Bandwidth: 1000000, QueueLimit: 10000})
+	sendNumbered(t, a, 100, 1000)
+	got = receiveNumbered(t, b, 50*time.Millisecond)
+	if len(got) < 10 || len(got) > 12 || got[len(got)-1] != uint32(len(got)-1) {
+		t.Errorf("Expected the first 10 datagrams, got %v", got)
+	}
+	if stats := a.Statistics(); stats.Overflowed == 0 {
+		t.Errorf("Expected overflowed datagrams in statistics: %+v", stats)
+	}
+}
+
+func TestMTU(t *testing.T) {
+	a, b := newPipe(t, Config{AToB: LinkConfig{MTU: 1200}})
+	sendNumbered(t, a, 1, 1200)
+	sendNumbered(t, a, 1, 1201)
+
+	if got := receiveNumbered(t, b, 50*time.Millisecond); len(got) != 1 {
+		t.Errorf("Expected only the datagram within the MTU, got %d", len(got))
+	}
+	if stats := a.Statistics(); stats.TooLarge != 1 {
+		t.Errorf("Expected 1 datagram too large, got %d", stats.TooLarge)
+	}
+}
+
+func TestDrop(t *testing.T) {
+	a, b := newPipe(t, Config{AToB: LinkConfig{Drop: func(datagram []byte) bool {
+		return binary.BigEndian.Uint32(datagram)%10 == 0
+	}}})
+	sendNumbered(t, a, 100, 100)
+
+	got := receiveNumbered(t, b, 50*time.Millisecond)
+	if len(got) != 90 {
+		t.Fatalf("Expected 90 datagrams, got %d", len(got))
+	}
+	for _, seq := range got {
+		if seq%10 == 0 {
+			t.Errorf("Expected datagram %d to be dropped", seq)
+		}
+	}
+}
+
+func TestECN(t *testing.T) {
+	// 20 KB at 1 MB/s queues past the 4500 byte threshold from the sixth
+	// datagram on, which are marked CE if ECN-capable and only queued if not
+	a, b := newPipe(t, Config{AToB: LinkConfig{Bandwidth: 1000000, ECNThreshold: 4500}})
+	buf := make([]byte, 1000)
+	for i := range 20 {
+		ecn := uint8(2) // ECT(0)
+		if i%2 == 1 {
+			ecn = 0
+		}
+		if _, err := a.WriteToECN(buf, b.LocalAddr(), ecn); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	var codepoints []uint8
+	for range 20 {
+		b.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, ecn, err := b.ReadFromECN(buf)
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		codepoints = append(codepoints, ecn)
+	}
+	for i, ecn := range codepoints {
+		want := uint8(2)
+		switch {
+		case i%2 == 1:
+			want = 0
+		case i > 5:
+			want = 3
+		}
+		if ecn != want {
+			t.Errorf("Datagram %d: expected codepoint %d, got %d", i, want, ecn)
+		}
+	}
+	if stats := a.Statistics(); stats.Marked != 7 {
+		t.Errorf("Expected 7 datagrams marked, got %d", stats.Marked)
+	}
+
+	// A bleaching link clears the codepoint
+	a.SetLink(LinkConfig{BleachECN: true})
+	a.WriteToECN(buf, b.LocalAddr(), 2)
+	b.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, ecn, err := b.ReadFromECN(buf); err != nil || ecn != 0 {
+		t.Errorf("Expected a cleared codepoint, got %d: %v", ecn, err)
+	}
+}
@@ -0,0 +1,186 @@
+package quantum
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/bbr"
+	"github.com/aetherflow/aetherflow/internal/quantum/netsim"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+// newSimulatedPair connects a client and a server over a simulated path
+func newSimulatedPair(t *testing.T, path netsim.Config, config *Config) (client, server *Connection) {
+	t.Helper()
+
+	a, b := netsim.Pipe(path)
+	return connectSimulated(t, a, b, config)
+}
+
+// connectSimulated dials from a to a listener on b
+func connectSimulated(t *testing.T, a, b *netsim.Conn, config *Config) (client, server *Connection) {
+	t.Helper()
+
+	listener, err := ListenPacketConn(b, config)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	client, err = DialPacketConn(a, a.PeerAddr(), config)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server, err = listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	return client, server
+}
+
+// transferMessages sends count messages of size bytes from client to server
+// and checks they arrive complete and in order
+func transferMessages(t *testing.T, client, server *Connection, count, size int) {
+	t.Helper()
+
+	msg := make([]byte, size)
+	for i := 0; i < count; i++ {
+		binary.BigEndian.PutUint32(msg, uint32(i))
+		if err := client.Send(msg); err != nil {
+			t.Fatalf("Failed to send message %d: %v", i, err)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		data, err := server.ReceiveWithTimeout(10 * time.Second)
+		if err != nil {
+			t.Fatalf("Failed to receive message %d: %v", i, err)
+		}
+		if len(data) != size || binary.BigEndian.Uint32(data) != uint32(i) {
+			t.Fatalf("Expected message %d, got %d bytes starting %x", i, len(data), data[:min(len(data), 4)])
+		}
+	}
+}
+
+// dropFirstTransmission returns a netsim drop function losing the first
+// transmission of data packets whose sequence number drop selects
+func dropFirstTransmission(drop func(seq uint32) bool) func([]byte) bool {
+	var mu sync.Mutex
+	dropped := make(map[uint32]bool)
+
+	return func(datagram []byte) bool {
+		header, payload, err := protocol.SplitPacket(datagram)
+		if err != nil || len(payload) == 0 || header.IsParity() || !drop(header.SequenceNumber) {
+			return false
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if dropped[header.SequenceNumber] {
+			return false
+		}
+		dropped[header.SequenceNumber] = true
+		return true
+	}
+}
+
+func TestSimulatedLossRecovery(t *testing.T) {
+	tests := []struct {
+		name string
+		link netsim.LinkConfig
+	}{
+		{"Bernoulli", netsim.LinkConfig{Delay: 5 * time.Millisecond, Loss: 0.05}},
+		{"GilbertElliott", netsim.LinkConfig{Delay: 5 * time.Millisecond, GilbertElliott: &netsim.GilbertElliott{
+			P: 0.01, R: 0.3, LossBad: 0.8,
+		}}},
+		{"ReorderAndDuplicate", netsim.LinkConfig{Delay: 5 * time.Millisecond, Jitter: 2 * time.Millisecond, Duplicate: 0.05}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.FECEnabled = false
+			client, server := newSimulatedPair(t, netsim.Symmetric(1, tt.link), config)
+
+			transferMessages(t, client, server, 300, 200)
+
+			lossy := tt.link.Loss > 0 || tt.link.GilbertElliott != nil
+			if n := client.Statistics().Retransmissions; lossy && n == 0 {
+				t.Error("Expected lost packets to be retransmitted")
+			}
+		})
+	}
+}
+
+func TestSimulatedFEC(t *testing.T) {
+	// Every tenth data packet from the client is lost once
+	var path netsim.Config
+	path.AToB.Delay = 5 * time.Millisecond
+	path.BToA.Delay = 5 * time.Millisecond
+	path.AToB.Drop = dropFirstTransmission(func(seq uint32) bool { return seq%10 == 5 })
+
+	config := DefaultConfig()
+	config.FECDataShards = 4
+	config.FECParityShards = 2
+	config.FECAdaptive = false
+	client, server := newSimulatedPair(t, path, config)
+
+	transferMessages(t, client, server, 100, 200)
+
+	// Every loss is repaired without waiting for a retransmission
+	if recovered := server.Statistics().PacketsRecovered; recovered == 0 {
+		t.Error("Expected FEC to recover lost packets")
+	}
+	if n := client.Statistics().Retransmissions; n != 0 {
+		t.Errorf("Expected no retransmissions, got %d", n)
+	}
+}
+
+func TestSimulatedBBR(t *testing.T) {
+	// A 4 Mbit/s bottleneck with a 40ms round trip and a 256 KB queue
+	const bandwidth = 500000
+	link := netsim.LinkConfig{Delay: 20 * time.Millisecond}
+	path := netsim.Config{AToB: link, BToA: link}
+	path.AToB.Bandwidth = bandwidth
+
+	// BBR's window starts from its MinRTT hint, far below this path's round
+	// trip, so it is window limited and ACKs held back would slow it down
+	// regardless of how well it finds the bottleneck
+	config := DefaultConfig()
+	config.FECEnabled = false
+	config.MaxAckDelay = 0
+	a, b := netsim.Pipe(path)
+	client, server := connectSimulated(t, a, b, config)
+
+	const count, size = 500, 1000
+	start := time.Now()
+	transferMessages(t, client, server, count, size)
+	goodput := float64(count*size) / time.Since(start).Seconds()
+
+	cc := client.cc.(*bbr.BBR)
+	stats := a.Statistics()
+	t.Logf("goodput=%.0f B/s bandwidth=%d state=%v overflowed=%d retransmissions=%d",
+		goodput, cc.Bandwidth(), cc.GetState(), stats.Overflowed, client.Statistics().Retransmissions)
+
+	// BBR finds the bottleneck and leaves STARTUP without overflowing its
+	// queue. The links run on real timers, so a loaded machine can still
+	// fire spurious retransmission timeouts; only losses at the bottleneck
+	// are held to a bound.
+	if cc.GetState() == bbr.StateStartup {
+		t.Error("Expected BBR to leave STARTUP")
+	}
+	if goodput < bandwidth*0.4 {
+		t.Errorf("Expected goodput near the %d B/s bottleneck, got %.0f B/s", bandwidth, goodput)
+	}
+	if stats.Overflowed > stats.Sent/100 {
+		t.Errorf("Expected at most 1%% of %d packets lost at the bottleneck, got %d", stats.Sent, stats.Overflowed)
+	}
+}
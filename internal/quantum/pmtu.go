@@ -0,0 +1,376 @@
+package quantum
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// Path MTU discovery follows DPLPMTUD (RFC 8899). The largest datagram the
+// path is known to carry, the PLPMTU, starts at MinDatagramSize and grows as
+// padded probes are acknowledged. Probes are control frames sent outside the
+// packet sequence, so a lost probe is neither retransmitted nor taken as
+// congestion; the peer answers each with the size it was sent at. Sizes of
+// common links are probed first, then the gap between the largest
+// acknowledged and the smallest lost size is bisected. When packets larger
+// than MinDatagramSize keep timing out the path has shrunk (a black hole):
+// the connection falls back to MinDatagramSize and searches again.
+//
+// Data packets are sized to the PLPMTU, so segmentation and FEC shards follow
+// it. A peer that never answers a probe does not support discovery; the
+// connection then keeps the fixed DefaultPayloadSize.
+
+const (
+	// pmtuMaxProbes is how many times a size is probed before the path is
+	// taken not to carry it (MAX_PROBES)
+	pmtuMaxProbes = 3
+
+	// pmtuGranularity ends a search once the largest acknowledged and the
+	// smallest lost size are this close
+	pmtuGranularity = 16
+
+	// pmtuRaiseInterval is how long a finished search is trusted before the
+	// path is probed for a larger MTU again (PMTU_RAISE_TIMER)
+	pmtuRaiseInterval = 10 * time.Minute
+
+	// pmtuBlackHoleTimeouts is how many retransmission timeouts of packets
+	// larger than MinDatagramSize, with none acknowledged in between, are
+	// taken as a black hole
+	pmtuBlackHoleTimeouts = 3
+
+	// dataHeaderReserve is the header space reserved in a data packet: a
+	// version 3 header with a full extension area and no SACK blocks
+	dataHeaderReserve = protocol.HeaderMinSize + protocol.LengthFieldsSize + protocol.MaxExtensionsSize
+)
+
+// pmtuCandidates are datagram sizes of common links, probed in order before
+// the search bisects: the IPv6 minimum MTU, tunnels (VPN, WireGuard),
+// Ethernet over IPv6 and IPv4, and jumbo frames over IPv6 and IPv4
+var pmtuCandidates = []int{1232, 1372, 1392, 1452, 1472, 8952, 8972}
+
+// pmtuPhase is the state of path MTU discovery
+type pmtuPhase int
+
+const (
+	pmtuBase      pmtuPhase = iota // Confirming MinDatagramSize
+	pmtuSearching                  // Probing larger sizes
+	pmtuComplete                   // Search finished until pmtuRaiseInterval
+	pmtuDisabled                   // The peer does not answer probes
+)
+
+// pmtuDiscovery tracks the path MTU search. Probes are sent and timed out by
+// reliabilityLoop; acknowledgments arrive on recvLoop.
+type pmtuDiscovery struct {
+	mu sync.Mutex
+
+	phase   pmtuPhase
+	maxSize int
+
+	plpmtu    int  // Largest datagram size the path carries
+	failed    int  // Smallest size taken as too large, maxSize+1 if none
+	confirmed bool // The peer has answered a probe
+
+	// Outstanding probe, probeSize 0 if none
+	probeSize   int
+	probeCount  int
+	probeSentAt time.Time
+
+	completedAt time.Time
+
+	// Consecutive timeouts of packets larger than MinDatagramSize
+	largeTimeouts int
+}
+
+// newPMTUDiscovery starts a search for path MTUs up to maxSize
+func newPMTUDiscovery(maxSize int) *pmtuDiscovery {
+	if maxSize <= 0 || maxSize > protocol.MaxDatagramSize {
+		maxSize = protocol.MaxDatagramSize
+	}
+	maxSize = max(maxSize, protocol.MinDatagramSize)
+
+	return &pmtuDiscovery{
+		maxSize: maxSize,
+		plpmtu:  protocol.MinDatagramSize,
+		failed:  maxSize + 1,
+	}
+}
+
+// mtu returns the PLPMTU, or 0 once discovery is disabled
+func (p *pmtuDiscovery) mtu() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.phase == pmtuDisabled {
+		return 0
+	}
+	return p.plpmtu
+}
+
+// nextProbe returns the size to probe now, if any. An outstanding probe is
+// repeated after timeout and given up after pmtuMaxProbes attempts.
+func (p *pmtuDiscovery) nextProbe(now time.Time, timeout time.Duration) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.phase {
+	case pmtuDisabled:
+		return 0, false
+	case pmtuComplete:
+		if now.Sub(p.completedAt) < pmtuRaiseInterval {
+			return 0, false
+		}
+		// The path may carry more by now
+		p.phase = pmtuSearching
+		p.failed = p.maxSize + 1
+	}
+
+	if p.probeSize != 0 {
+		if now.Sub(p.probeSentAt) < timeout {
+			return 0, false
+		}
+		if p.probeCount >= pmtuMaxProbes {
+			p.probeLost(now)
+			return p.startProbe(now)
+		}
+		p.probeCount++
+		p.probeSentAt = now
+		return p.probeSize, true
+	}
+
+	return p.startProbe(now)
+}
+
+// startProbe starts probing the next size, or finishes the search
+func (p *pmtuDiscovery) startProbe(now time.Time) (int, bool) {
+	var size int
+	switch p.phase {
+	case pmtuBase:
+		size = protocol.MinDatagramSize
+	case pmtuSearching:
+		size = p.searchSize()
+	}
+
+	if size == 0 {
+		if p.phase == pmtuSearching {
+			p.phase = pmtuComplete
+			p.completedAt = now
+		}
+		return 0, false
+	}
+
+	p.probeSize = size
+	p.probeCount = 1
+	p.probeSentAt = now
+	return size, true
+}
+
+// searchSize returns the next size to probe: the smallest untried candidate,
+// then the middle of the remaining gap
+func (p *pmtuDiscovery) searchSize() int {
+	for _, size := range pmtuCandidates {
+		if size > p.plpmtu && size < p.failed && size <= p.maxSize {
+			return size
+		}
+	}
+	if p.failed-p.plpmtu > pmtuGranularity {
+		return (p.plpmtu + p.failed) / 2
+	}
+	return 0
+}
+
+// probeLost gives up on the outstanding probe size
+func (p *pmtuDiscovery) probeLost(now time.Time) {
+	size := p.probeSize
+	p.probeSize = 0
+	p.probeCount = 0
+
+	if p.phase != pmtuBase {
+		p.failed = size
+		return
+	}
+
+	// Even the base size is not answered. A peer that never answered is
+	// taken not to support discovery; otherwise the path is unusable for
+	// now and the base size is retried later.
+	if !p.confirmed {
+		p.phase = pmtuDisabled
+		return
+	}
+	p.phase = pmtuComplete
+	p.completedAt = now
+}
+
+// onProbeAcked records the peer's acknowledgment of a probe
+func (p *pmtuDiscovery) onProbeAcked(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if size != p.probeSize || p.phase == pmtuDisabled {
+		return
+	}
+
+	p.confirmed = true
+	p.plpmtu = max(p.plpmtu, size)
+	p.probeSize = 0
+	p.probeCount = 0
+	p.largeTimeouts = 0
+	if p.phase == pmtuBase {
+		p.phase = pmtuSearching
+	}
+}
+
+// onProbeRefused records that the local interface cannot send a probe size
+func (p *pmtuDiscovery) onProbeRefused(size int, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if size == p.probeSize {
+		p.probeLost(now)
+	}
+}
+
+// onLargeTimeout records a retransmission timeout of packets larger than
+// MinDatagramSize, returning true when it falls back to the base size
+func (p *pmtuDiscovery) onLargeTimeout() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.phase == pmtuDisabled || p.plpmtu <= protocol.MinDatagramSize {
+		return false
+	}
+
+	p.largeTimeouts++
+	if p.largeTimeouts < pmtuBlackHoleTimeouts {
+		return false
+	}
+
+	// Black hole: the current PLPMTU no longer gets through
+	p.failed = p.plpmtu
+	p.reset()
+	return true
+}
+
+// onLargeAcked records the acknowledgment of a packet larger than
+// MinDatagramSize, which shows the path still carries it
+func (p *pmtuDiscovery) onLargeAcked() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.largeTimeouts = 0
+}
+
+// restart starts over at the base size, e.g. on a new network path
+func (p *pmtuDiscovery) restart() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.phase == pmtuDisabled {
+		return
+	}
+	p.failed = p.maxSize + 1
+	p.reset()
+}
+
+// reset returns to confirming the base size
+func (p *pmtuDiscovery) reset() {
+	p.phase = pmtuBase
+	p.plpmtu = protocol.MinDatagramSize
+	p.probeSize = 0
+	p.probeCount = 0
+	p.largeTimeouts = 0
+}
+
+// statistics returns path MTU discovery statistics
+func (p *pmtuDiscovery) statistics() map[string]interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	phases := [...]string{"BASE", "SEARCHING", "SEARCH_COMPLETE", "DISABLED"}
+	return map[string]interface{}{
+		"phase":      phases[p.phase],
+		"plpmtu":     p.plpmtu,
+		"max_size":   p.maxSize,
+		"probe_size": p.probeSize,
+	}
+}
+
+// probePathMTU sends the next path MTU probe when one is due. It must only
+// be called from reliabilityLoop.
+func (c *Connection) probePathMTU() {
+	if c.State() != StateEstablished {
+		return
+	}
+
+	now := time.Now()
+	size, ok := c.pmtu.nextProbe(now, c.sendBuf.RTO())
+	if !ok {
+		return
+	}
+
+	// A probe larger than the local interface MTU is refused at once
+	if err := c.sendPMTUProbe(size); errors.Is(err, transport.ErrMessageTooLarge) {
+		c.pmtu.onProbeRefused(size, now)
+	}
+}
+
+// sendPMTUProbe sends a control frame padded to a datagram of size bytes
+func (c *Connection) sendPMTUProbe(size int) error {
+	data := make([]byte, protocol.PMTUProbeSize)
+	binary.BigEndian.PutUint32(data, uint32(size))
+
+	frame := &protocol.ControlFrame{Type: protocol.ControlPMTUProbe, Data: data}
+	packet := transport.NewPacket(c.guid, 0, 0, 0, frame.Marshal())
+	if pad := size - c.datagramSize(packet); pad > 0 {
+		frame.Data = append(data, make([]byte, pad)...)
+		packet.Payload = frame.Marshal()
+	}
+
+	return c.transmit(packet)
+}
+
+// handlePMTUProbe acknowledges a path MTU probe from the peer
+func (c *Connection) handlePMTUProbe(frame *protocol.ControlFrame) {
+	if len(frame.Data) < protocol.PMTUProbeSize {
+		return
+	}
+	c.sendControl(protocol.ControlPMTUAck, frame.Data[:protocol.PMTUProbeSize], c.peerAddr())
+}
+
+// handlePMTUAck records the peer's acknowledgment of a path MTU probe
+func (c *Connection) handlePMTUAck(frame *protocol.ControlFrame) {
+	if c.pmtu == nil || len(frame.Data) < protocol.PMTUProbeSize {
+		return
+	}
+	c.pmtu.onProbeAcked(int(binary.BigEndian.Uint32(frame.Data)))
+}
+
+// datagramSize returns the size a packet has on the wire
+func (c *Connection) datagramSize(packet *transport.Packet) int {
+	header := *packet.Header
+	header.Version = c.version
+	return header.Size() + len(packet.Payload) + c.sealOverhead()
+}
+
+// isLargePacket reports whether a data packet is larger than every path is
+// assumed to carry
+func (c *Connection) isLargePacket(packet *transport.Packet) bool {
+	return len(packet.Payload)+dataHeaderReserve+c.sealOverhead() > protocol.MinDatagramSize
+}
+
+// PathMTU returns the largest datagram the path to the peer is known to
+// carry, or 0 when path MTU discovery is disabled or unsupported by the peer
+func (c *Connection) PathMTU() int {
+	if c.pmtu == nil {
+		return 0
+	}
+	return c.pmtu.mtu()
+}
+
+// MaxMessageSize returns the largest message Send currently accepts. It
+// follows the discovered path MTU.
+func (c *Connection) MaxMessageSize() int {
+	return c.maxFrameData()
+}
@@ -0,0 +1,300 @@
+package quantum
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+// searchPath runs path MTU discovery against a simulated path that carries
+// datagrams up to limit, returning the time it took
+func searchPath(p *pmtuDiscovery, limit int, now time.Time) time.Duration {
+	const timeout = 100 * time.Millisecond
+	start := now
+
+	for i := 0; i < 1000; i++ {
+		if size, ok := p.nextProbe(now, timeout); ok && size <= limit {
+			p.onProbeAcked(size)
+			continue
+		}
+		p.mu.Lock()
+		phase := p.phase
+		p.mu.Unlock()
+		if phase == pmtuComplete || phase == pmtuDisabled {
+			break
+		}
+		now = now.Add(timeout)
+	}
+	return now.Sub(start)
+}
+
+func TestPMTUSearch(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int
+		limit   int
+		want    int
+	}{
+		{"Ethernet", protocol.MaxDatagramSize, 1472, 1472},
+		{"Jumbo", protocol.MaxDatagramSize, 8972, 8972},
+		{"Tunnel", protocol.MaxDatagramSize, 1350, 1350},
+		{"BaseOnly", protocol.MaxDatagramSize, protocol.MinDatagramSize, protocol.MinDatagramSize},
+		{"Capped", 1500, 8972, 1500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPMTUDiscovery(tt.maxSize)
+			searchPath(p, tt.limit, time.Now())
+
+			mtu := p.mtu()
+			if mtu > tt.want || tt.want-mtu > pmtuGranularity {
+				t.Errorf("Expected a path MTU within %d of %d, got %d", pmtuGranularity, tt.want, mtu)
+			}
+			if _, ok := p.nextProbe(time.Now(), 0); ok {
+				t.Error("Expected no probes after the search completed")
+			}
+		})
+	}
+}
+
+func TestPMTUPeerWithoutSupport(t *testing.T) {
+	p := newPMTUDiscovery(0)
+
+	// No probe is ever answered
+	searchPath(p, 0, time.Now())
+	if mtu := p.mtu(); mtu != 0 {
+		t.Errorf("Expected discovery to be disabled, got path MTU %d", mtu)
+	}
+}
+
+func TestPMTUBlackHole(t *testing.T) {
+	p := newPMTUDiscovery(0)
+	now := time.Now()
+	now = now.Add(searchPath(p, 1472, now))
+
+	// The path shrinks: large packets keep timing out
+	for i := 0; i < pmtuBlackHoleTimeouts-1; i++ {
+		if p.onLargeTimeout() {
+			t.Fatal("Fell back before the black hole threshold")
+		}
+	}
+	p.onLargeAcked()
+	for i := 0; i < pmtuBlackHoleTimeouts-1; i++ {
+		p.onLargeTimeout()
+	}
+	if p.mtu() != 1472 {
+		t.Fatal("An acknowledged large packet should reset black hole detection")
+	}
+	if !p.onLargeTimeout() {
+		t.Fatal("Expected a black hole after consecutive timeouts")
+	}
+	if p.mtu() != protocol.MinDatagramSize {
+		t.Errorf("Expected fallback to %d, got %d", protocol.MinDatagramSize, p.mtu())
+	}
+
+	// The search starts over on the smaller path
+	searchPath(p, 1400, now)
+	if mtu := p.mtu(); mtu > 1400 || 1400-mtu > pmtuGranularity {
+		t.Errorf("Expected a path MTU near 1400, got %d", mtu)
+	}
+}
+
+// mtuProxy relays UDP between one client and a server, dropping datagrams
+// larger than its limit in either direction. If set before the first
+// datagram, rewrite may alter each datagram relayed.
+type mtuProxy struct {
+	conn    *net.UDPConn
+	server  *net.UDPAddr
+	limit   atomic.Int64
+	rewrite func(data []byte) []byte
+
+	mu     sync.Mutex
+	client *net.UDPAddr
+}
+
+func newMTUProxy(t *testing.T, server net.Addr, limit int) *mtuProxy {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	p := &mtuProxy{conn: conn, server: server.(*net.UDPAddr)}
+	p.limit.Store(int64(limit))
+	go p.run()
+	return p
+}
+
+func (p *mtuProxy) run() {
+	buf := make([]byte, protocol.MaxPacketSize)
+	for {
+		n, addr, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		p.mu.Lock()
+		to := p.server
+		if addr.Port == p.server.Port {
+			to = p.client
+		} else {
+			p.client = addr
+		}
+		p.mu.Unlock()
+
+		data := buf[:n]
+		if p.rewrite != nil {
+			data = p.rewrite(data)
+		}
+		if to != nil && int64(len(data)) <= p.limit.Load() {
+			p.conn.WriteToUDP(data, to)
+		}
+	}
+}
+
+func (p *mtuProxy) Addr() string {
+	return p.conn.LocalAddr().String()
+}
+
+// waitPathMTU waits until a connection's path MTU discovery has finished
+func waitPathMTU(t *testing.T, c *Connection) int {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		c.pmtu.mu.Lock()
+		phase := c.pmtu.phase
+		c.pmtu.mu.Unlock()
+		if phase == pmtuComplete || phase == pmtuDisabled {
+			return c.PathMTU()
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatalf("Path MTU discovery did not finish: %v", c.pmtu.statistics())
+	return 0
+}
+
+// exchange sends a message of the largest size the client accepts and
+// checks that the server receives it
+func exchange(t *testing.T, client, server *Connection) {
+	t.Helper()
+
+	msg := bytes.Repeat([]byte{0xA5}, client.MaxMessageSize())
+	if err := client.Send(msg); err != nil {
+		t.Fatalf("Failed to send %d bytes: %v", len(msg), err)
+	}
+	data, err := server.ReceiveWithTimeout(5 * time.Second)
+	if err != nil || !bytes.Equal(data, msg) {
+		t.Fatalf("Failed to receive %d bytes: %v", len(msg), err)
+	}
+}
+
+// pmtuConfig returns a default configuration with path MTU discovery on
+func pmtuConfig() *Config {
+	config := DefaultConfig()
+	config.PMTUDiscovery = true
+	return config
+}
+
+func TestPathMTUDiscovery(t *testing.T) {
+	const limit = 1350
+
+	config := pmtuConfig()
+	listener := newTestListener(t, config)
+	proxy := newMTUProxy(t, listener.Addr(), limit)
+
+	client, err := Dial("udp", proxy.Addr(), config)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	// Traffic gives an RTT estimate, so lost probes time out quickly
+	for i := 0; i < 10; i++ {
+		exchange(t, client, server)
+		exchange(t, server, client)
+	}
+
+	// Both directions settle just below the path's limit
+	for name, c := range map[string]*Connection{"client": client, "server": server} {
+		if mtu := waitPathMTU(t, c); mtu > limit || limit-mtu > pmtuGranularity {
+			t.Errorf("Expected %s path MTU near %d, got %d", name, limit, mtu)
+		}
+	}
+
+	// Full-size messages fit the path
+	exchange(t, client, server)
+	exchange(t, server, client)
+
+	// The path shrinks: the client falls back and finds the new limit
+	proxy.limit.Store(1250)
+	for i := 0; i < pmtuBlackHoleTimeouts; i++ {
+		client.pmtu.onLargeTimeout()
+	}
+	if mtu := waitPathMTU(t, client); mtu > 1250 || 1250-mtu > pmtuGranularity {
+		t.Errorf("Expected path MTU near 1250 after the path shrank, got %d", mtu)
+	}
+	exchange(t, client, server)
+}
+
+func TestPathMTUDiscoveryJumbo(t *testing.T) {
+	config := pmtuConfig()
+	listener := newTestListener(t, config)
+	client, server := newTestPair(t, listener, listener.Addr().String(), config)
+
+	// Loopback carries jumbo datagrams
+	exchange(t, client, server)
+	if mtu := waitPathMTU(t, client); mtu != protocol.MaxDatagramSize {
+		t.Fatalf("Expected path MTU %d, got %d", protocol.MaxDatagramSize, mtu)
+	}
+	if size := client.MaxMessageSize(); size <= protocol.DefaultPayloadSize {
+		t.Errorf("Expected messages larger than %d bytes, got %d", protocol.DefaultPayloadSize, size)
+	}
+	exchange(t, client, server)
+}
+
+func TestPathMTUDiscoveryDisabled(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, server := newTestPair(t, listener, listener.Addr().String(), nil)
+
+	if mtu := client.PathMTU(); mtu != 0 {
+		t.Errorf("Expected no path MTU, got %d", mtu)
+	}
+	if want := protocol.DefaultPayloadSize - client.sealOverhead() - fecShardOverhead - protocol.StreamFrameHeaderSize; client.MaxMessageSize() != want {
+		t.Errorf("Expected fixed message size %d, got %d", want, client.MaxMessageSize())
+	}
+	exchange(t, client, server)
+}
+
+func TestSendFullSizeAfterConnect(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, server := newTestPair(t, listener, listener.Addr().String(), nil)
+
+	// The default configuration accepts messages of the fixed payload size
+	// straight away, without waiting for path MTU discovery
+	msg := bytes.Repeat([]byte{0x5A}, 1300)
+	if err := client.Send(msg); err != nil {
+		t.Fatalf("Failed to send %d bytes right after connect: %v", len(msg), err)
+	}
+	data, err := server.ReceiveWithTimeout(5 * time.Second)
+	if err != nil || !bytes.Equal(data, msg) {
+		t.Fatalf("Failed to receive %d bytes: %v", len(msg), err)
+	}
+}
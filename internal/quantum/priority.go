@@ -0,0 +1,241 @@
+package quantum
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// Outgoing data is queued by priority class. sendLoop serves the classes by
+// weighted round robin, so urgent messages overtake a bulk transfer without
+// starving it: while all classes have data queued, each round sends up to
+// priorityWeights[p] packets of class p. Packets within a class keep their
+// order.
+//
+// Messages sent with a deadline are dropped if it passes before they leave
+// the queue. Default stream messages only take their stream sequence number
+// when they are sent, so a dropped or overtaken message leaves no gap for
+// the receiver to wait on.
+//
+// Urgent packets carry FlagURG. A packet sent with nothing else queued behind
+// it carries FlagPSH, telling the receiver the sender has paused.
+
+// Priority is the scheduling class of outgoing data
+type Priority uint8
+
+const (
+	// PriorityNormal is the default class, for interactive messages
+	PriorityNormal Priority = iota
+
+	// PriorityUrgent is for small, latency critical messages such as
+	// operation acknowledgments
+	PriorityUrgent
+
+	// PriorityBulk is for large transfers such as snapshots
+	PriorityBulk
+
+	numPriorities = 3
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityNormal:
+		return "NORMAL"
+	case PriorityUrgent:
+		return "URGENT"
+	case PriorityBulk:
+		return "BULK"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// priorityOrder is the order classes are served in within a round
+var priorityOrder = [numPriorities]Priority{PriorityUrgent, PriorityNormal, PriorityBulk}
+
+// priorityWeights is how many packets of each class a round may send
+var priorityWeights = [numPriorities]int{
+	PriorityNormal: 4,
+	PriorityUrgent: 16,
+	PriorityBulk:   1,
+}
+
+// sendQueueSize bounds the packets queued in each priority class
+const sendQueueSize = 1024
+
+// SendOptions control how a message is scheduled
+type SendOptions struct {
+	// Priority selects the scheduling class
+	Priority Priority
+
+	// Deadline, if set, drops the message unless it is sent by then
+	Deadline time.Time
+}
+
+// outgoing is a packet waiting in a send queue
+type outgoing struct {
+	packet   *transport.Packet
+	deadline time.Time
+	queuedAt time.Time
+
+	// message marks a default stream message, whose stream sequence
+	// number is assigned when it is sent
+	message bool
+}
+
+// QueueStatistics describes one priority class of the send queue
+type QueueStatistics struct {
+	Queued       int           // Packets waiting now
+	Sent         uint64        // Packets sent
+	Expired      uint64        // Messages dropped at their deadline
+	AvgQueueTime time.Duration // Mean time from Send to transmission
+	MaxQueueTime time.Duration // Longest time from Send to transmission
+}
+
+// sendScheduler holds the per-class send queues. Queues are filled by
+// Send and stream writers; next must only be called from sendLoop.
+type sendScheduler struct {
+	queues [numPriorities]chan *outgoing
+
+	// Remaining sends of each class in the current round, owned by sendLoop
+	credits [numPriorities]int
+
+	mu        sync.Mutex
+	sent      [numPriorities]uint64
+	expired   [numPriorities]uint64
+	queueTime [numPriorities]time.Duration
+	maxQueue  [numPriorities]time.Duration
+}
+
+// newSendScheduler creates empty send queues
+func newSendScheduler() *sendScheduler {
+	s := &sendScheduler{}
+	for p := range s.queues {
+		s.queues[p] = make(chan *outgoing, sendQueueSize)
+	}
+	return s
+}
+
+// queue returns the send queue of a class, treating unknown classes as
+// normal
+func (s *sendScheduler) queue(p Priority) chan *outgoing {
+	if int(p) >= numPriorities {
+		p = PriorityNormal
+	}
+	return s.queues[p]
+}
+
+// next returns the next packet to send and its class, or nil if all queues
+// are empty, along with the number of expired messages dropped on the way
+func (s *sendScheduler) next(now time.Time) (*outgoing, Priority, int) {
+	dropped := 0
+	for {
+		o, p := s.pick()
+		if o == nil {
+			return nil, 0, dropped
+		}
+
+		s.mu.Lock()
+		if !o.deadline.IsZero() && !now.Before(o.deadline) {
+			s.expired[p]++
+			s.mu.Unlock()
+			dropped++
+			continue
+		}
+		wait := now.Sub(o.queuedAt)
+		s.sent[p]++
+		s.queueTime[p] += wait
+		s.maxQueue[p] = max(s.maxQueue[p], wait)
+		s.mu.Unlock()
+
+		return o, p, dropped
+	}
+}
+
+// pick dequeues from the first class in priorityOrder with credit left in
+// this round, starting a new round once no class with data has any
+func (s *sendScheduler) pick() (*outgoing, Priority) {
+	for round := 0; round < 2; round++ {
+		for _, p := range priorityOrder {
+			if s.credits[p] == 0 {
+				continue
+			}
+			select {
+			case o := <-s.queues[p]:
+				s.credits[p]--
+				return o, p
+			default:
+			}
+		}
+		s.credits = priorityWeights
+	}
+	return nil, 0
+}
+
+// pending returns the number of packets queued in all classes
+func (s *sendScheduler) pending() int {
+	n := 0
+	for _, q := range s.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// statistics returns per-class queue statistics
+func (s *sendScheduler) statistics() map[Priority]QueueStatistics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[Priority]QueueStatistics, numPriorities)
+	for _, p := range priorityOrder {
+		qs := QueueStatistics{
+			Queued:       len(s.queues[p]),
+			Sent:         s.sent[p],
+			Expired:      s.expired[p],
+			MaxQueueTime: s.maxQueue[p],
+		}
+		if s.sent[p] > 0 {
+			qs.AvgQueueTime = s.queueTime[p] / time.Duration(s.sent[p])
+		}
+		stats[p] = qs
+	}
+	return stats
+}
+
+// nextPacket takes the next packet to send from the send queues, preparing
+// it for transmission. It must only be called from sendLoop.
+func (c *Connection) nextPacket() *transport.Packet {
+	o, p, dropped := c.sched.next(time.Now())
+	if dropped > 0 {
+		c.unsent.Add(-int64(dropped))
+	}
+	if o == nil {
+		return nil
+	}
+	c.unsent.Add(-1)
+
+	packet := o.packet
+	if o.message {
+		frame := &protocol.StreamFrame{}
+		frame.Unmarshal(packet.Payload)
+		frame.Sequence = c.defaultSeq
+		packet.Payload = frame.Marshal()
+		c.defaultSeq++
+	}
+
+	if p == PriorityUrgent {
+		packet.Header.SetFlag(protocol.FlagURG)
+	}
+	if c.sched.pending() == 0 {
+		packet.Header.SetFlag(protocol.FlagPSH)
+	}
+
+	return packet
+}
+
+// QueueStats returns send queue statistics for each priority class
+func (c *Connection) QueueStats() map[Priority]QueueStatistics {
+	return c.sched.statistics()
+}
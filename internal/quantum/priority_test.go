@@ -0,0 +1,160 @@
+package quantum
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// queueTestPackets fills a scheduler class with n packets
+func queueTestPackets(s *sendScheduler, p Priority, n int, deadline time.Time) {
+	for i := 0; i < n; i++ {
+		s.queue(p) <- &outgoing{
+			packet:   transport.NewPacket([16]byte{}, 0, 0, 0, []byte{byte(p)}),
+			deadline: deadline,
+			queuedAt: time.Now(),
+		}
+	}
+}
+
+func TestSendSchedulerWeights(t *testing.T) {
+	s := newSendScheduler()
+	queueTestPackets(s, PriorityBulk, 100, time.Time{})
+	queueTestPackets(s, PriorityNormal, 100, time.Time{})
+	queueTestPackets(s, PriorityUrgent, 100, time.Time{})
+
+	// Each round serves every class by its weight, urgent first
+	round := priorityWeights[PriorityUrgent] + priorityWeights[PriorityNormal] + priorityWeights[PriorityBulk]
+	var counts [numPriorities]int
+	for i := 0; i < 2*round; i++ {
+		o, p, _ := s.next(time.Now())
+		if o == nil {
+			t.Fatalf("Expected a packet at %d", i)
+		}
+		if i < priorityWeights[PriorityUrgent] && p != PriorityUrgent {
+			t.Fatalf("Expected urgent packets first, got %v at %d", p, i)
+		}
+		counts[p]++
+	}
+
+	for _, p := range priorityOrder {
+		if want := 2 * priorityWeights[p]; counts[p] != want {
+			t.Errorf("Expected %d %v packets in two rounds, got %d", want, p, counts[p])
+		}
+	}
+
+	// An idle class leaves its share to the others
+	s = newSendScheduler()
+	queueTestPackets(s, PriorityBulk, 10, time.Time{})
+	for i := 0; i < 10; i++ {
+		if o, p, _ := s.next(time.Now()); o == nil || p != PriorityBulk {
+			t.Fatalf("Expected bulk packet %d", i)
+		}
+	}
+	if o, _, _ := s.next(time.Now()); o != nil {
+		t.Error("Expected empty queues")
+	}
+}
+
+func TestSendSchedulerDeadline(t *testing.T) {
+	s := newSendScheduler()
+	now := time.Now()
+	queueTestPackets(s, PriorityNormal, 3, now.Add(-time.Millisecond))
+	queueTestPackets(s, PriorityNormal, 1, now.Add(time.Second))
+
+	o, p, dropped := s.next(now)
+	if o == nil || p != PriorityNormal || dropped != 3 {
+		t.Fatalf("Expected 3 expired packets dropped before a live one, got %v, %d", o, dropped)
+	}
+
+	stats := s.statistics()[PriorityNormal]
+	if stats.Sent != 1 || stats.Expired != 3 || stats.Queued != 0 {
+		t.Errorf("Unexpected statistics: %+v", stats)
+	}
+}
+
+func TestSendPriority(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, server := newTestPair(t, listener, listener.Addr().String(), nil)
+
+	// A bulk transfer is queued ahead of an urgent message
+	bulk := bytes.Repeat([]byte("b"), 1000)
+	const count = 300
+	for i := 0; i < count; i++ {
+		if err := client.SendWithOptions(bulk, SendOptions{Priority: PriorityBulk}); err != nil {
+			t.Fatalf("Failed to send bulk message %d: %v", i, err)
+		}
+	}
+	if err := client.SendWithOptions([]byte("ack"), SendOptions{Priority: PriorityUrgent}); err != nil {
+		t.Fatalf("Failed to send urgent message: %v", err)
+	}
+
+	// The urgent message overtakes most of the bulk transfer
+	urgentAt := -1
+	for i := 0; i <= count; i++ {
+		data, err := server.ReceiveWithTimeout(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Failed to receive message %d: %v", i, err)
+		}
+		if string(data) == "ack" {
+			urgentAt = i
+		}
+	}
+	if urgentAt < 0 || urgentAt > count/2 {
+		t.Errorf("Urgent message arrived after %d bulk messages", urgentAt)
+	}
+
+	stats := client.QueueStats()
+	if stats[PriorityUrgent].Sent != 1 || stats[PriorityBulk].Sent != count {
+		t.Errorf("Expected 1 urgent and %d bulk packets sent, got %+v", count, stats)
+	}
+	if stats[PriorityBulk].MaxQueueTime <= stats[PriorityUrgent].MaxQueueTime {
+		t.Errorf("Expected bulk packets to wait longer than urgent ones: %+v", stats)
+	}
+}
+
+func TestSendDeadline(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, server := newTestPair(t, listener, listener.Addr().String(), nil)
+
+	// A message queued behind more data than its deadline allows is dropped
+	const count = 200
+	for i := 0; i < count; i++ {
+		if err := client.Send([]byte(fmt.Sprintf("message %d", i))); err != nil {
+			t.Fatalf("Failed to send message %d: %v", i, err)
+		}
+	}
+	if err := client.SendWithOptions([]byte("stale"), SendOptions{Deadline: time.Now().Add(10 * time.Millisecond)}); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if err := client.Send([]byte("last")); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	// The dropped message leaves no gap in the stream
+	for i := 0; i < count; i++ {
+		data, err := server.ReceiveWithTimeout(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Failed to receive message %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("message %d", i); string(data) != want {
+			t.Fatalf("Expected %q, got %q", want, data)
+		}
+	}
+	data, err := server.ReceiveWithTimeout(5 * time.Second)
+	if err != nil || string(data) != "last" {
+		t.Fatalf("Expected the message after the expired one, got %q: %v", data, err)
+	}
+
+	if expired := client.QueueStats()[PriorityNormal].Expired; expired != 1 {
+		t.Errorf("Expected 1 expired message, got %d", expired)
+	}
+
+	// A deadline already passed is refused at once
+	if err := client.SendWithOptions([]byte("late"), SendOptions{Deadline: time.Now()}); err == nil {
+		t.Error("Expected a message past its deadline to be refused")
+	}
+}
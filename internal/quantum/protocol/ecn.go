@@ -0,0 +1,84 @@
+package protocol
+
+import "encoding/binary"
+
+// Explicit Congestion Notification (RFC 3168) lets routers signal congestion
+// by marking packets instead of dropping them. A sender marks its packets
+// ECN-capable with ECT(0); a congested router rewrites that to CE. The
+// receiver counts the codepoints it sees and echoes the counts on its ACKs,
+// setting FlagECE when they report CE marks not reported before.
+
+// ECN is an ECN codepoint, the two low bits of the IP TOS or traffic class
+// byte
+type ECN uint8
+
+const (
+	ECNNotECT ECN = iota // Not ECN-capable
+	ECNECT1              // ECN-capable, ECT(1)
+	ECNECT0              // ECN-capable, ECT(0)
+	ECNCE                // Congestion Experienced
+)
+
+// ecnCountsSize is the size of the ECN counts extension
+const ecnCountsSize = 12
+
+// String returns the codepoint's name
+func (e ECN) String() string {
+	switch e & ECNCE {
+	case ECNECT1:
+		return "ECT(1)"
+	case ECNECT0:
+		return "ECT(0)"
+	case ECNCE:
+		return "CE"
+	default:
+		return "Not-ECT"
+	}
+}
+
+// ECNCounts counts the packets received with each ECN-capable codepoint
+type ECNCounts struct {
+	ECT0 uint32
+	ECT1 uint32
+	CE   uint32
+}
+
+// Add counts a packet received with codepoint e
+func (c *ECNCounts) Add(e ECN) {
+	switch e & ECNCE {
+	case ECNECT0:
+		c.ECT0++
+	case ECNECT1:
+		c.ECT1++
+	case ECNCE:
+		c.CE++
+	}
+}
+
+// IsZero reports whether no ECN-capable packets were counted
+func (c ECNCounts) IsZero() bool {
+	return c == ECNCounts{}
+}
+
+// SetECNCounts echoes the ECN codepoints received so far
+func (h *Header) SetECNCounts(counts ECNCounts) {
+	value := make([]byte, 0, ecnCountsSize)
+	value = binary.BigEndian.AppendUint32(value, counts.ECT0)
+	value = binary.BigEndian.AppendUint32(value, counts.ECT1)
+	value = binary.BigEndian.AppendUint32(value, counts.CE)
+	h.SetExtension(ExtECNCounts, value)
+}
+
+// ECNCounts returns the ECN codepoints the peer has received, and false if
+// the header does not carry them
+func (h *Header) ECNCounts() (ECNCounts, bool) {
+	value, ok := h.Extension(ExtECNCounts)
+	if !ok || len(value) != ecnCountsSize {
+		return ECNCounts{}, false
+	}
+	return ECNCounts{
+		ECT0: binary.BigEndian.Uint32(value[0:4]),
+		ECT1: binary.BigEndian.Uint32(value[4:8]),
+		CE:   binary.BigEndian.Uint32(value[8:12]),
+	}, true
+}
@@ -0,0 +1,50 @@
+package protocol
+
+import (
+	"testing"
+
+	guuid "github.com/Lzww0608/GUUID"
+)
+
+func TestECNCounts(t *testing.T) {
+	var counts ECNCounts
+	for _, e := range []ECN{ECNECT0, ECNECT0, ECNCE, ECNNotECT, ECNECT1} {
+		counts.Add(e)
+	}
+	if want := (ECNCounts{ECT0: 2, ECT1: 1, CE: 1}); counts != want {
+		t.Fatalf("Expected counts %+v, got %+v", want, counts)
+	}
+
+	guid, _ := guuid.NewV7()
+	original := NewHeader(guid, 0, 12, FlagACK|FlagECE)
+	original.SetAckDelay(1000)
+	original.SetECNCounts(counts)
+
+	data, err := original.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal header: %v", err)
+	}
+	parsed := &Header{}
+	if err := parsed.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal header: %v", err)
+	}
+	if got, ok := parsed.ECNCounts(); !ok || got != counts {
+		t.Errorf("Expected counts %+v, got %+v", counts, got)
+	}
+	if !parsed.HasFlag(FlagECE) {
+		t.Error("Expected the ECN Echo flag")
+	}
+
+	// Headers without counts say so
+	if _, ok := NewHeader(guid, 0, 12, FlagACK).ECNCounts(); ok {
+		t.Error("Expected no ECN counts")
+	}
+}
+
+func TestECNString(t *testing.T) {
+	for e, want := range map[ECN]string{ECNNotECT: "Not-ECT", ECNECT0: "ECT(0)", ECNECT1: "ECT(1)", ECNCE: "CE"} {
+		if got := e.String(); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+}
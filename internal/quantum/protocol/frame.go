@@ -0,0 +1,161 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// StreamFrameHeaderSize is the size of the stream frame header that
+	// prefixes every data payload
+	StreamFrameHeaderSize = 9
+
+	// DefaultStreamID is the stream carrying Connection.Send/Receive messages
+	DefaultStreamID uint32 = 0
+
+	// ControlStreamID marks a payload as a control frame rather than stream
+	// data. It is never assigned to a stream.
+	ControlStreamID uint32 = 0xFFFFFFFF
+
+	// DatagramStreamID marks a payload as an unreliable datagram frame. It
+	// is never assigned to a stream.
+	DatagramStreamID uint32 = 0xFFFFFFFE
+
+	// DatagramFrameHeaderSize is the size of the datagram frame header
+	DatagramFrameHeaderSize = 8
+
+	// ControlFrameHeaderSize is the size of the control frame header
+	ControlFrameHeaderSize = 5
+
+	// PathChallengeSize is the size of path validation challenge data
+	PathChallengeSize = 8
+
+	// PMTUProbeSize is the size of the probed datagram size that starts a
+	// path MTU probe's data and is echoed in the acknowledgment
+	PMTUProbeSize = 4
+)
+
+// FrameFlags represent control flags of a stream frame
+type FrameFlags uint8
+
+const (
+	FrameFIN FrameFlags = 1 << iota // Last frame of the stream
+)
+
+// StreamFrame is the unit of stream data carried in a packet payload.
+// Frames are ordered per stream by Sequence, independently of the packet
+// sequence numbers used for acknowledgment and retransmission.
+type StreamFrame struct {
+	StreamID uint32     // 4 bytes - Stream identifier
+	Sequence uint32     // 4 bytes - Frame sequence number within the stream
+	Flags    FrameFlags // 1 byte  - Frame flags
+	Data     []byte     // Variable - Stream data
+}
+
+// Marshal serializes the frame to bytes
+func (f *StreamFrame) Marshal() []byte {
+	buf := make([]byte, StreamFrameHeaderSize+len(f.Data))
+	binary.BigEndian.PutUint32(buf[0:4], f.StreamID)
+	binary.BigEndian.PutUint32(buf[4:8], f.Sequence)
+	buf[8] = uint8(f.Flags)
+	copy(buf[StreamFrameHeaderSize:], f.Data)
+	return buf
+}
+
+// Unmarshal deserializes bytes into the frame. Data aliases the input.
+func (f *StreamFrame) Unmarshal(data []byte) error {
+	if len(data) < StreamFrameHeaderSize {
+		return fmt.Errorf("frame too small: need at least %d bytes, got %d", StreamFrameHeaderSize, len(data))
+	}
+
+	f.StreamID = binary.BigEndian.Uint32(data[0:4])
+	f.Sequence = binary.BigEndian.Uint32(data[4:8])
+	f.Flags = FrameFlags(data[8])
+	f.Data = data[StreamFrameHeaderSize:]
+
+	return nil
+}
+
+// HasFlag checks if a specific frame flag is set
+func (f *StreamFrame) HasFlag(flag FrameFlags) bool {
+	return f.Flags&flag != 0
+}
+
+// ControlType identifies a control frame
+type ControlType uint8
+
+const (
+	ControlPathChallenge ControlType = iota + 1 // Asks the peer to echo Data from its address
+	ControlPathResponse                         // Echoes a path challenge's Data
+	ControlNewTicket                            // Carries a session resumption ticket
+	ControlPMTUProbe                            // Padded path MTU probe; Data starts with the probed size
+	ControlPMTUAck                              // Echoes the size of a received path MTU probe
+)
+
+// ControlFrame carries connection control messages. Packets holding a control
+// frame are sent outside the packet sequence: they are neither acknowledged
+// nor retransmitted, and the sender repeats them if needed.
+type ControlFrame struct {
+	Type ControlType // 1 byte  - Control message type
+	Data []byte      // Variable - Type specific data
+}
+
+// Marshal serializes the control frame to bytes
+func (f *ControlFrame) Marshal() []byte {
+	buf := make([]byte, ControlFrameHeaderSize+len(f.Data))
+	binary.BigEndian.PutUint32(buf[0:4], ControlStreamID)
+	buf[4] = uint8(f.Type)
+	copy(buf[ControlFrameHeaderSize:], f.Data)
+	return buf
+}
+
+// Unmarshal deserializes bytes into the control frame. Data aliases the input.
+func (f *ControlFrame) Unmarshal(data []byte) error {
+	if !IsControlFrame(data) {
+		return fmt.Errorf("not a control frame")
+	}
+
+	f.Type = ControlType(data[4])
+	f.Data = data[ControlFrameHeaderSize:]
+
+	return nil
+}
+
+// IsControlFrame reports whether a payload holds a control frame
+func IsControlFrame(data []byte) bool {
+	return len(data) >= ControlFrameHeaderSize && binary.BigEndian.Uint32(data[0:4]) == ControlStreamID
+}
+
+// DatagramFrame carries an unreliable datagram. Like control frames,
+// datagram packets are sent outside the packet sequence: they are neither
+// acknowledged, retransmitted nor FEC protected.
+type DatagramFrame struct {
+	TTL  uint32 // 4 bytes - Milliseconds the datagram stays useful, 0 if it does not expire
+	Data []byte // Variable - Datagram data
+}
+
+// Marshal serializes the datagram frame to bytes
+func (f *DatagramFrame) Marshal() []byte {
+	buf := make([]byte, DatagramFrameHeaderSize+len(f.Data))
+	binary.BigEndian.PutUint32(buf[0:4], DatagramStreamID)
+	binary.BigEndian.PutUint32(buf[4:8], f.TTL)
+	copy(buf[DatagramFrameHeaderSize:], f.Data)
+	return buf
+}
+
+// Unmarshal deserializes bytes into the datagram frame. Data aliases the input.
+func (f *DatagramFrame) Unmarshal(data []byte) error {
+	if !IsDatagramFrame(data) {
+		return fmt.Errorf("not a datagram frame")
+	}
+
+	f.TTL = binary.BigEndian.Uint32(data[4:8])
+	f.Data = data[DatagramFrameHeaderSize:]
+
+	return nil
+}
+
+// IsDatagramFrame reports whether a payload holds a datagram frame
+func IsDatagramFrame(data []byte) bool {
+	return len(data) >= DatagramFrameHeaderSize && binary.BigEndian.Uint32(data[0:4]) == DatagramStreamID
+}
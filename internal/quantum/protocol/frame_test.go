@@ -0,0 +1,113 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStreamFrameMarshalUnmarshal(t *testing.T) {
+	original := &StreamFrame{
+		StreamID: 7,
+		Sequence: 42,
+		Flags:    FrameFIN,
+		Data:     []byte("stream data"),
+	}
+
+	data := original.Marshal()
+	if len(data) != StreamFrameHeaderSize+len(original.Data) {
+		t.Fatalf("Expected %d bytes, got %d", StreamFrameHeaderSize+len(original.Data), len(data))
+	}
+
+	parsed := &StreamFrame{}
+	if err := parsed.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal frame: %v", err)
+	}
+
+	if parsed.StreamID != original.StreamID {
+		t.Errorf("StreamID mismatch: got %d, want %d", parsed.StreamID, original.StreamID)
+	}
+	if parsed.Sequence != original.Sequence {
+		t.Errorf("Sequence mismatch: got %d, want %d", parsed.Sequence, original.Sequence)
+	}
+	if !parsed.HasFlag(FrameFIN) {
+		t.Error("Expected FIN flag")
+	}
+	if !bytes.Equal(parsed.Data, original.Data) {
+		t.Errorf("Data mismatch: got %q, want %q", parsed.Data, original.Data)
+	}
+
+	if err := parsed.Unmarshal(data[:StreamFrameHeaderSize-1]); err == nil {
+		t.Error("Expected error for truncated frame")
+	}
+}
+
+func TestControlFrameMarshalUnmarshal(t *testing.T) {
+	original := &ControlFrame{
+		Type: ControlPathChallenge,
+		Data: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+	}
+
+	data := original.Marshal()
+	if !IsControlFrame(data) {
+		t.Fatal("Expected payload to be recognized as a control frame")
+	}
+
+	parsed := &ControlFrame{}
+	if err := parsed.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal control frame: %v", err)
+	}
+	if parsed.Type != original.Type {
+		t.Errorf("Type mismatch: got %d, want %d", parsed.Type, original.Type)
+	}
+	if !bytes.Equal(parsed.Data, original.Data) {
+		t.Errorf("Data mismatch: got %v, want %v", parsed.Data, original.Data)
+	}
+
+	// Stream data is never mistaken for a control frame
+	stream := (&StreamFrame{StreamID: 1, Data: []byte("data")}).Marshal()
+	if IsControlFrame(stream) {
+		t.Error("Expected stream frame not to be a control frame")
+	}
+	if err := parsed.Unmarshal(stream); err == nil {
+		t.Error("Expected error unmarshaling a stream frame")
+	}
+}
+
+func TestDatagramFrameMarshalUnmarshal(t *testing.T) {
+	original := &DatagramFrame{
+		TTL:  250,
+		Data: []byte("cursor 12,34"),
+	}
+
+	data := original.Marshal()
+	if !IsDatagramFrame(data) {
+		t.Fatal("Expected payload to be recognized as a datagram frame")
+	}
+	if IsControlFrame(data) {
+		t.Error("Expected datagram frame not to be a control frame")
+	}
+
+	parsed := &DatagramFrame{}
+	if err := parsed.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal datagram frame: %v", err)
+	}
+	if parsed.TTL != original.TTL {
+		t.Errorf("TTL mismatch: got %d, want %d", parsed.TTL, original.TTL)
+	}
+	if !bytes.Equal(parsed.Data, original.Data) {
+		t.Errorf("Data mismatch: got %v, want %v", parsed.Data, original.Data)
+	}
+
+	// Neither stream nor control frames are mistaken for datagrams
+	for _, payload := range [][]byte{
+		(&StreamFrame{StreamID: 1, Data: []byte("data")}).Marshal(),
+		(&ControlFrame{Type: ControlPathChallenge}).Marshal(),
+	} {
+		if IsDatagramFrame(payload) {
+			t.Errorf("Expected %v not to be a datagram frame", payload)
+		}
+		if err := parsed.Unmarshal(payload); err == nil {
+			t.Error("Expected error unmarshaling a non-datagram frame")
+		}
+	}
+}
@@ -4,6 +4,10 @@ package protocol
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
 
 	guuid "github.com/Lzww0608/GUUID"
 )
@@ -12,19 +16,119 @@ const (
 	// MagicNumber identifies Quantum protocol packets
 	MagicNumber uint32 = 0x51554E54 // "QUNT" in ASCII
 
-	// CurrentVersion is the current protocol version
-	CurrentVersion uint8 = 1
+	// CurrentVersion is the current protocol version. Version 2 added the
+	// receive window field; version 3 made the header self-describing, with
+	// a SACK block count and a TLV extension area.
+	CurrentVersion uint8 = 3
 
-	// HeaderMinSize is the minimum header size without SACK blocks
+	// MinVersion is the oldest protocol version still parsed
+	MinVersion uint8 = 1
+
+	// VersionNegotiation is the version field of a version negotiation
+	// packet, which lists the versions its sender supports in the payload
+	VersionNegotiation uint8 = 0
+
+	// HeaderMinSize is the minimum header size without SACK blocks (version 1)
 	HeaderMinSize = 32
 
+	// WindowFieldSize is the size of the receive window field (version 2)
+	WindowFieldSize = 4
+
+	// LengthFieldsSize is the size of the SACK block count and extension
+	// area length that follow the fixed header (version 3+)
+	LengthFieldsSize = 3
+
+	// ExtensionHeaderSize is the type and length prefix of each extension
+	ExtensionHeaderSize = 2
+
+	// MaxExtensionsSize is the maximum size of the extension area
+	MaxExtensionsSize = 64
+
 	// MaxSACKBlocks is the maximum number of SACK blocks allowed
 	MaxSACKBlocks = 8
 
+	// MinDatagramSize is the datagram size every path is assumed to carry
+	// (BASE_PLPMTU in RFC 8899), where path MTU discovery starts
+	MinDatagramSize = 1200
+
+	// MaxDatagramSize is the largest datagram path MTU discovery probes
+	// for: a 9000 byte jumbo frame less the IPv4 and UDP headers
+	MaxDatagramSize = 8972
+
 	// MaxPayloadSize is the maximum payload size per packet
-	MaxPayloadSize = 1400 // Leave room for IP/UDP headers
+	MaxPayloadSize = MaxDatagramSize - HeaderMinSize - LengthFieldsSize
+
+	// DefaultPayloadSize is the payload size per packet when the path MTU
+	// is not discovered
+	DefaultPayloadSize = 1400 // Leave room for IP/UDP headers
+
+	// FECInfoSize is the size of the FEC group block present when FlagFEC is set
+	FECInfoSize = 8
+
+	// fecExtensionSize is the size of the FEC info extension, which drops
+	// the block's padding byte
+	fecExtensionSize = FECInfoSize - 1
+
+	// MaxPacketSize is the largest packet a peer may send
+	MaxPacketSize = HeaderMinSize + LengthFieldsSize + MaxExtensionsSize + MaxSACKBlocks*8 + MaxPayloadSize
+)
+
+// ExtensionType identifies a header extension (version 3+). Each extension
+// is encoded as type (1 byte), length (1 byte) and value. Receivers skip
+// types they do not know, so new fields can be added without a new version.
+type ExtensionType uint8
+
+const (
+	ExtWindow        ExtensionType = iota + 1 // Receive window (4 bytes)
+	ExtFECInfo                                // FEC group info (7 bytes), present with FlagFEC
+	ExtTimestamp                              // Sender timestamp
+	ExtPathChallenge                          // Path validation data
+	ExtAckDelay                               // Time the ACK was held, in microseconds (4 bytes)
+	ExtAckFrequency                           // Packets the peer should receive per ACK (2 bytes), on SYN and SYN-ACK
+	ExtECNCounts                              // ECT(0), ECT(1) and CE packets received (12 bytes), on ACKs
 )
 
+// Extension is a header extension the header does not decode into a field
+type Extension struct {
+	Type  ExtensionType
+	Value []byte
+}
+
+// VersionError reports a packet whose version this implementation does not
+// speak. The version-independent fields are kept so the receiver can answer
+// with a version negotiation packet.
+type VersionError struct {
+	Version uint8
+	Flags   Flags
+	GUUID   guuid.UUID
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("unsupported version: expected %d to %d, got %d", MinVersion, CurrentVersion, e.Version)
+}
+
+// SupportedVersions returns the versions this implementation speaks, newest
+// first, as carried in a version negotiation payload
+func SupportedVersions() []byte {
+	versions := make([]byte, 0, CurrentVersion-MinVersion+1)
+	for v := CurrentVersion; v >= MinVersion; v-- {
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// NegotiateVersion picks the newest version no later than offered from the
+// versions a peer listed in a version negotiation packet
+func NegotiateVersion(offered uint8, peerVersions []byte) (uint8, bool) {
+	var best uint8
+	for _, v := range peerVersions {
+		if v >= MinVersion && v <= CurrentVersion && v < offered && v > best {
+			best = v
+		}
+	}
+	return best, best != 0
+}
+
 // Flags represent various control flags in the packet header
 type Flags uint8
 
@@ -33,12 +137,26 @@ const (
 	FlagACK                   // Acknowledgment
 	FlagFIN                   // Connection termination
 	FlagRST                   // Connection reset
-	FlagFEC                   // Forward Error Correction enabled
+	FlagFEC                   // Packet belongs to an FEC group (carries FEC info)
 	FlagPSH                   // Push data immediately
 	FlagURG                   // Urgent data
 	FlagECE                   // ECN Echo
 )
 
+// flagNames names the flags in bit order
+var flagNames = [...]string{"SYN", "ACK", "FIN", "RST", "FEC", "PSH", "URG", "ECE"}
+
+// String returns the set flags joined by "|", e.g. "SYN|ACK"
+func (f Flags) String() string {
+	var names []string
+	for i, name := range flagNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
 // SACKBlock represents a selective acknowledgment block
 type SACKBlock struct {
 	Start uint32 // Starting sequence number (inclusive)
@@ -55,6 +173,17 @@ type Header struct {
 	AckNumber      uint32      // 4 bytes - Acknowledgment number
 	SACKBlocks     []SACKBlock // Variable - Selective ACK blocks
 	PayloadLength  uint16      // 2 bytes - Payload data length
+	Window         uint32      // 4 bytes - Receive window in packets beyond AckNumber (version 2+)
+
+	// FEC group info, only on the wire when FlagFEC is set
+	FECGroupID      uint32 // 4 bytes - Sequence number of the group's first data packet
+	FECShardIndex   uint8  // 1 byte  - Shard index; >= FECDataShards for parity shards
+	FECDataShards   uint8  // 1 byte  - Data shards in the group
+	FECParityShards uint8  // 1 byte  - Parity shards in the group
+
+	// Extensions other than the window and FEC info, in wire order
+	// (version 3+). They follow the extensions decoded into fields.
+	Extensions []Extension
 }
 
 // NewHeader creates a new Quantum protocol header
@@ -100,15 +229,131 @@ func (h *Header) ClearFlag(flag Flags) {
 	h.Flags &^= flag
 }
 
+// HasWindow reports whether the header carries a receive window. Version 1
+// peers do not advertise one.
+func (h *Header) HasWindow() bool {
+	return h.Version >= 2
+}
+
+// hasExtensions reports whether the header uses the self-describing
+// version 3 layout
+func (h *Header) hasExtensions() bool {
+	return h.Version >= 3
+}
+
+// Extension returns the value of an extension not decoded into a field
+func (h *Header) Extension(typ ExtensionType) ([]byte, bool) {
+	for _, ext := range h.Extensions {
+		if ext.Type == typ {
+			return ext.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetExtension adds or replaces an extension (version 3+)
+func (h *Header) SetExtension(typ ExtensionType, value []byte) {
+	for i := range h.Extensions {
+		if h.Extensions[i].Type == typ {
+			h.Extensions[i].Value = value
+			return
+		}
+	}
+	h.Extensions = append(h.Extensions, Extension{Type: typ, Value: value})
+}
+
+// extensionsSize returns the size of the version 3 extension area
+func (h *Header) extensionsSize() int {
+	size := ExtensionHeaderSize + WindowFieldSize
+	if h.HasFlag(FlagFEC) {
+		size += ExtensionHeaderSize + fecExtensionSize
+	}
+	for _, ext := range h.Extensions {
+		size += ExtensionHeaderSize + len(ext.Value)
+	}
+	return size
+}
+
+// SetAckDelay records how long the acknowledgment was held before sending
+func (h *Header) SetAckDelay(delay time.Duration) {
+	var value [4]byte
+	binary.BigEndian.PutUint32(value[:], uint32(min(delay.Microseconds(), math.MaxUint32)))
+	h.SetExtension(ExtAckDelay, value[:])
+}
+
+// AckDelay returns how long the acknowledgment was held before sending, and
+// false if the header does not say
+func (h *Header) AckDelay() (time.Duration, bool) {
+	value, ok := h.Extension(ExtAckDelay)
+	if !ok || len(value) != 4 {
+		return 0, false
+	}
+	return time.Duration(binary.BigEndian.Uint32(value)) * time.Microsecond, true
+}
+
+// SetAckFrequency asks the peer to acknowledge every n ack-eliciting packets
+func (h *Header) SetAckFrequency(n uint16) {
+	h.SetExtension(ExtAckFrequency, binary.BigEndian.AppendUint16(nil, n))
+}
+
+// AckFrequency returns the acknowledgment frequency the sender asks for, and
+// false if it asks for none
+func (h *Header) AckFrequency() (uint16, bool) {
+	value, ok := h.Extension(ExtAckFrequency)
+	if !ok || len(value) != 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(value), true
+}
+
+// SetFECInfo marks the packet as a shard of an FEC group
+func (h *Header) SetFECInfo(groupID uint32, shardIndex, dataShards, parityShards uint8) {
+	h.SetFlag(FlagFEC)
+	h.FECGroupID = groupID
+	h.FECShardIndex = shardIndex
+	h.FECDataShards = dataShards
+	h.FECParityShards = parityShards
+}
+
+// IsParity reports whether the packet carries an FEC parity shard
+func (h *Header) IsParity() bool {
+	return h.HasFlag(FlagFEC) && h.FECShardIndex >= h.FECDataShards
+}
+
 // Size returns the total size of the header in bytes
 func (h *Header) Size() int {
-	return HeaderMinSize + len(h.SACKBlocks)*8 // Each SACK block is 8 bytes
+	if h.Version == VersionNegotiation {
+		return HeaderMinSize
+	}
+
+	size := HeaderMinSize + len(h.SACKBlocks)*8 // Each SACK block is 8 bytes
+	if h.hasExtensions() {
+		return size + LengthFieldsSize + h.extensionsSize()
+	}
+	if h.HasWindow() {
+		size += WindowFieldSize
+	}
+	if h.HasFlag(FlagFEC) {
+		size += FECInfoSize
+	}
+	return size
 }
 
 // Marshal serializes the header to bytes
 func (h *Header) Marshal() ([]byte, error) {
+	return h.AppendBinary(make([]byte, 0, h.Size()))
+}
+
+// AppendBinary appends the serialized header to b, so a packet can be built
+// in a reused buffer
+func (h *Header) AppendBinary(b []byte) ([]byte, error) {
+	if h.hasExtensions() && h.extensionsSize() > MaxExtensionsSize {
+		return nil, fmt.Errorf("header extensions too large: %d > %d bytes", h.extensionsSize(), MaxExtensionsSize)
+	}
+
 	size := h.Size()
-	buf := make([]byte, size)
+	out := slices.Grow(b, size)[:len(b)+size]
+	buf := out[len(b):]
 
 	// Magic Number (4 bytes)
 	binary.BigEndian.PutUint32(buf[0:4], h.MagicNumber)
@@ -131,41 +376,148 @@ func (h *Header) Marshal() ([]byte, error) {
 	// Payload Length (2 bytes)
 	binary.BigEndian.PutUint16(buf[30:32], h.PayloadLength)
 
-	// SACK Blocks (variable length)
 	offset := 32
+	if h.Version == VersionNegotiation {
+		return out, nil
+	}
+	if h.hasExtensions() {
+		h.marshalExtended(buf[offset:])
+		return out, nil
+	}
+
+	// Receive window (4 bytes, version 2)
+	if h.HasWindow() {
+		binary.BigEndian.PutUint32(buf[offset:offset+4], h.Window)
+		offset += WindowFieldSize
+	}
+
+	// FEC group info (8 bytes, only with FlagFEC)
+	if h.HasFlag(FlagFEC) {
+		binary.BigEndian.PutUint32(buf[offset:offset+4], h.FECGroupID)
+		buf[offset+4] = h.FECShardIndex
+		buf[offset+5] = h.FECDataShards
+		buf[offset+6] = h.FECParityShards
+		offset += FECInfoSize
+	}
+
+	// SACK Blocks (variable length)
+	for _, block := range h.SACKBlocks {
+		binary.BigEndian.PutUint32(buf[offset:offset+4], block.Start)
+		binary.BigEndian.PutUint32(buf[offset+4:offset+8], block.End)
+		offset += 8
+	}
+
+	return out, nil
+}
+
+// marshalExtended writes the version 3 tail of the header: SACK block count,
+// extension area length, SACK blocks, then extensions
+func (h *Header) marshalExtended(buf []byte) {
+	buf[0] = uint8(len(h.SACKBlocks))
+	binary.BigEndian.PutUint16(buf[1:3], uint16(h.extensionsSize()))
+	offset := LengthFieldsSize
+
 	for _, block := range h.SACKBlocks {
 		binary.BigEndian.PutUint32(buf[offset:offset+4], block.Start)
 		binary.BigEndian.PutUint32(buf[offset+4:offset+8], block.End)
 		offset += 8
 	}
 
-	return buf, nil
+	putExtension := func(typ ExtensionType, value []byte) {
+		buf[offset] = uint8(typ)
+		buf[offset+1] = uint8(len(value))
+		copy(buf[offset+ExtensionHeaderSize:], value)
+		offset += ExtensionHeaderSize + len(value)
+	}
+
+	var window [WindowFieldSize]byte
+	binary.BigEndian.PutUint32(window[:], h.Window)
+	putExtension(ExtWindow, window[:])
+
+	if h.HasFlag(FlagFEC) {
+		var info [fecExtensionSize]byte
+		binary.BigEndian.PutUint32(info[0:4], h.FECGroupID)
+		info[4] = h.FECShardIndex
+		info[5] = h.FECDataShards
+		info[6] = h.FECParityShards
+		putExtension(ExtFECInfo, info[:])
+	}
+
+	for _, ext := range h.Extensions {
+		putExtension(ext.Type, ext.Value)
+	}
 }
 
-// Unmarshal deserializes bytes into the header
+// Unmarshal deserializes bytes into the header. data must hold exactly the
+// header; use SplitPacket to parse a whole packet.
 func (h *Header) Unmarshal(data []byte) error {
+	n, err := h.unmarshal(data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return fmt.Errorf("invalid header: %d trailing bytes", len(data)-n)
+	}
+	return nil
+}
+
+// SplitPacket parses a packet into its header and payload. Version 3 headers
+// describe their own size; older ones are found from the payload length,
+// since their SACK blocks run up to the payload. On a *VersionError the
+// header holds the fields common to all versions.
+func SplitPacket(data []byte) (*Header, []byte, error) {
 	if len(data) < HeaderMinSize {
-		return fmt.Errorf("packet too small: need at least %d bytes, got %d", HeaderMinSize, len(data))
+		return nil, nil, fmt.Errorf("packet too small: need at least %d bytes, got %d", HeaderMinSize, len(data))
+	}
+
+	header := &Header{}
+	headerData := data
+	if version := data[4]; version != VersionNegotiation && version < 3 {
+		headerSize := len(data) - int(binary.BigEndian.Uint16(data[30:32]))
+		if headerSize < HeaderMinSize {
+			return nil, nil, fmt.Errorf("invalid payload length in %d byte packet", len(data))
+		}
+		headerData = data[:headerSize]
+	}
+
+	n, err := header.unmarshal(headerData)
+	if err != nil {
+		if _, ok := err.(*VersionError); ok {
+			return header, nil, err
+		}
+		return nil, nil, err
+	}
+
+	payload := data[n:]
+	if header.Version != VersionNegotiation && len(payload) != int(header.PayloadLength) {
+		return nil, nil, fmt.Errorf("payload length mismatch: header says %d, got %d", header.PayloadLength, len(payload))
+	}
+
+	return header, payload, nil
+}
+
+// unmarshal parses a header from the start of data, returning its size. For
+// versions before 3, everything after the fixed fields is header.
+func (h *Header) unmarshal(data []byte) (int, error) {
+	if len(data) < HeaderMinSize {
+		return 0, fmt.Errorf("packet too small: need at least %d bytes, got %d", HeaderMinSize, len(data))
 	}
 
 	// Magic Number
 	h.MagicNumber = binary.BigEndian.Uint32(data[0:4])
 	if h.MagicNumber != MagicNumber {
-		return fmt.Errorf("invalid magic number: expected 0x%08X, got 0x%08X", MagicNumber, h.MagicNumber)
+		return 0, fmt.Errorf("invalid magic number: expected 0x%08X, got 0x%08X", MagicNumber, h.MagicNumber)
 	}
 
-	// Version
+	// Version, flags and GUUID keep their place in every version
 	h.Version = data[4]
-	if h.Version != CurrentVersion {
-		return fmt.Errorf("unsupported version: expected %d, got %d", CurrentVersion, h.Version)
-	}
-
-	// Flags
 	h.Flags = Flags(data[5])
-
-	// GUUID
 	copy(h.GUUID[:], data[6:22])
 
+	if h.Version != VersionNegotiation && (h.Version < MinVersion || h.Version > CurrentVersion) {
+		return 0, &VersionError{Version: h.Version, Flags: h.Flags, GUUID: h.GUUID}
+	}
+
 	// Sequence Number
 	h.SequenceNumber = binary.BigEndian.Uint32(data[22:26])
 
@@ -175,27 +527,117 @@ func (h *Header) Unmarshal(data []byte) error {
 	// Payload Length
 	h.PayloadLength = binary.BigEndian.Uint16(data[30:32])
 
+	offset := 32
+	h.Window = 0
+	h.Extensions = nil
+	if h.Version == VersionNegotiation {
+		h.SACKBlocks = nil
+		return offset, nil
+	}
+	if h.hasExtensions() {
+		n, err := h.unmarshalExtended(data[offset:])
+		return offset + n, err
+	}
+
+	// Receive window
+	if h.HasWindow() {
+		if len(data) < offset+WindowFieldSize {
+			return 0, fmt.Errorf("packet too small for receive window: need %d bytes, got %d", offset+WindowFieldSize, len(data))
+		}
+		h.Window = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += WindowFieldSize
+	}
+
+	// FEC group info
+	if h.HasFlag(FlagFEC) {
+		if len(data) < offset+FECInfoSize {
+			return 0, fmt.Errorf("packet too small for FEC info: need %d bytes, got %d", offset+FECInfoSize, len(data))
+		}
+		h.FECGroupID = binary.BigEndian.Uint32(data[offset : offset+4])
+		h.FECShardIndex = data[offset+4]
+		h.FECDataShards = data[offset+5]
+		h.FECParityShards = data[offset+6]
+		offset += FECInfoSize
+	}
+
 	// Calculate number of SACK blocks
-	remainingBytes := len(data) - HeaderMinSize
+	remainingBytes := len(data) - offset
 	if remainingBytes%8 != 0 {
-		return fmt.Errorf("invalid SACK blocks: remaining bytes %d not divisible by 8", remainingBytes)
+		return 0, fmt.Errorf("invalid SACK blocks: remaining bytes %d not divisible by 8", remainingBytes)
 	}
 
 	numSACKBlocks := remainingBytes / 8
 	if numSACKBlocks > MaxSACKBlocks {
-		return fmt.Errorf("too many SACK blocks: maximum %d, got %d", MaxSACKBlocks, numSACKBlocks)
+		return 0, fmt.Errorf("too many SACK blocks: maximum %d, got %d", MaxSACKBlocks, numSACKBlocks)
 	}
 
 	// Parse SACK blocks
 	h.SACKBlocks = make([]SACKBlock, numSACKBlocks)
-	offset := 32
 	for i := 0; i < numSACKBlocks; i++ {
 		h.SACKBlocks[i].Start = binary.BigEndian.Uint32(data[offset : offset+4])
 		h.SACKBlocks[i].End = binary.BigEndian.Uint32(data[offset+4 : offset+8])
 		offset += 8
 	}
 
-	return nil
+	return offset, nil
+}
+
+// unmarshalExtended parses the version 3 tail of the header, returning its size
+func (h *Header) unmarshalExtended(data []byte) (int, error) {
+	if len(data) < LengthFieldsSize {
+		return 0, fmt.Errorf("packet too small for header lengths: need %d bytes, got %d", LengthFieldsSize, len(data))
+	}
+
+	numSACKBlocks := int(data[0])
+	extSize := int(binary.BigEndian.Uint16(data[1:3]))
+	if numSACKBlocks > MaxSACKBlocks {
+		return 0, fmt.Errorf("too many SACK blocks: maximum %d, got %d", MaxSACKBlocks, numSACKBlocks)
+	}
+	if extSize > MaxExtensionsSize {
+		return 0, fmt.Errorf("header extensions too large: %d > %d bytes", extSize, MaxExtensionsSize)
+	}
+	size := LengthFieldsSize + numSACKBlocks*8 + extSize
+	if len(data) < size {
+		return 0, fmt.Errorf("packet too small for header: need %d bytes, got %d", HeaderMinSize+size, HeaderMinSize+len(data))
+	}
+
+	offset := LengthFieldsSize
+	h.SACKBlocks = make([]SACKBlock, numSACKBlocks)
+	for i := range h.SACKBlocks {
+		h.SACKBlocks[i].Start = binary.BigEndian.Uint32(data[offset : offset+4])
+		h.SACKBlocks[i].End = binary.BigEndian.Uint32(data[offset+4 : offset+8])
+		offset += 8
+	}
+
+	// Extensions: window and FEC info are decoded into fields, unknown
+	// types are kept for whoever understands them
+	for offset < size {
+		if size-offset < ExtensionHeaderSize {
+			return 0, fmt.Errorf("truncated header extension")
+		}
+		typ := ExtensionType(data[offset])
+		length := int(data[offset+1])
+		offset += ExtensionHeaderSize
+		if size-offset < length {
+			return 0, fmt.Errorf("header extension %d overruns extension area", typ)
+		}
+		value := data[offset : offset+length]
+		offset += length
+
+		switch {
+		case typ == ExtWindow && length == WindowFieldSize:
+			h.Window = binary.BigEndian.Uint32(value)
+		case typ == ExtFECInfo && length == fecExtensionSize:
+			h.FECGroupID = binary.BigEndian.Uint32(value[0:4])
+			h.FECShardIndex = value[4]
+			h.FECDataShards = value[5]
+			h.FECParityShards = value[6]
+		default:
+			h.Extensions = append(h.Extensions, Extension{Type: typ, Value: append([]byte{}, value...)})
+		}
+	}
+
+	return size, nil
 }
 
 // Validate performs basic validation on the header
@@ -204,7 +646,7 @@ func (h *Header) Validate() error {
 		return fmt.Errorf("invalid magic number")
 	}
 
-	if h.Version != CurrentVersion {
+	if h.Version != VersionNegotiation && (h.Version < MinVersion || h.Version > CurrentVersion) {
 		return fmt.Errorf("unsupported version")
 	}
 
@@ -216,10 +658,21 @@ func (h *Header) Validate() error {
 		return fmt.Errorf("payload too large: %d > %d", h.PayloadLength, MaxPayloadSize)
 	}
 
-	// Validate SACK blocks
+	// Validate FEC group info
+	if h.HasFlag(FlagFEC) {
+		if h.FECDataShards == 0 {
+			return fmt.Errorf("FEC group must have at least one data shard")
+		}
+		if int(h.FECShardIndex) >= int(h.FECDataShards)+int(h.FECParityShards) {
+			return fmt.Errorf("invalid FEC shard index %d for %d+%d group",
+				h.FECShardIndex, h.FECDataShards, h.FECParityShards)
+		}
+	}
+
+	// Validate SACK blocks; a block may span the sequence number wrap
 	for i, block := range h.SACKBlocks {
-		if block.Start > block.End {
-			return fmt.Errorf("invalid SACK block %d: start %d > end %d", i, block.Start, block.End)
+		if SeqLess(block.End, block.Start) {
+			return fmt.Errorf("invalid SACK block %d: start %d after end %d", i, block.Start, block.End)
 		}
 	}
 
@@ -232,6 +685,6 @@ func (h *Header) String() string {
 	if len(guidStr) > 8 {
 		guidStr = guidStr[:8]
 	}
-	return fmt.Sprintf("Quantum{GUUID:%s, Seq:%d, Ack:%d, Flags:0x%02X, PayloadLen:%d, SACKBlocks:%d}",
-		guidStr, h.SequenceNumber, h.AckNumber, uint8(h.Flags), h.PayloadLength, len(h.SACKBlocks))
+	return fmt.Sprintf("Quantum{GUUID:%s, Seq:%d, Ack:%d, Flags:0x%02X, Window:%d, PayloadLen:%d, SACKBlocks:%d}",
+		guidStr, h.SequenceNumber, h.AckNumber, uint8(h.Flags), h.Window, h.PayloadLength, len(h.SACKBlocks))
 }
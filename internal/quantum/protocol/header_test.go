@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"testing"
+	"time"
 
 	guuid "github.com/Lzww0608/GUUID"
 )
@@ -11,6 +12,7 @@ func TestHeaderMarshalUnmarshal(t *testing.T) {
 
 	original := NewHeader(guid, 100, 50, FlagSYN|FlagACK)
 	original.PayloadLength = 1234
+	original.Window = 200
 	original.AddSACKBlock(10, 20)
 	original.AddSACKBlock(30, 40)
 
@@ -36,7 +38,7 @@ func TestHeaderMarshalUnmarshal(t *testing.T) {
 	}
 
 	if parsed.Flags != original.Flags {
-		t.Errorf("Flags mismatch: got %x, want %x", parsed.Flags, original.Flags)
+		t.Errorf("Flags mismatch: got %v, want %v", parsed.Flags, original.Flags)
 	}
 
 	if parsed.GUUID != original.GUUID {
@@ -55,11 +57,206 @@ func TestHeaderMarshalUnmarshal(t *testing.T) {
 		t.Errorf("PayloadLength mismatch: got %d, want %d", parsed.PayloadLength, original.PayloadLength)
 	}
 
+	if parsed.Window != original.Window {
+		t.Errorf("Window mismatch: got %d, want %d", parsed.Window, original.Window)
+	}
+
 	if len(parsed.SACKBlocks) != len(original.SACKBlocks) {
 		t.Errorf("SACKBlocks length mismatch: got %d, want %d", len(parsed.SACKBlocks), len(original.SACKBlocks))
 	}
 }
 
+func TestHeaderVersion1Compatibility(t *testing.T) {
+	guid, _ := guuid.NewV7()
+
+	// A version 1 header has no receive window field
+	v1 := NewHeader(guid, 7, 3, FlagACK)
+	v1.Version = 1
+	v1.Window = 200
+	v1.AddSACKBlock(5, 6)
+
+	data, err := v1.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal header: %v", err)
+	}
+	if len(data) != HeaderMinSize+8 {
+		t.Fatalf("Version 1 header should be %d bytes, got %d", HeaderMinSize+8, len(data))
+	}
+
+	parsed := &Header{}
+	if err := parsed.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal version 1 header: %v", err)
+	}
+	if parsed.Version != 1 || parsed.HasWindow() || parsed.Window != 0 {
+		t.Errorf("Expected version 1 header without window, got version %d window %d", parsed.Version, parsed.Window)
+	}
+	if parsed.AckNumber != 3 || len(parsed.SACKBlocks) != 1 || parsed.SACKBlocks[0].End != 6 {
+		t.Errorf("Version 1 fields not preserved: %s", parsed)
+	}
+	if err := parsed.Validate(); err != nil {
+		t.Errorf("Version 1 header should validate: %v", err)
+	}
+
+	// Versions outside the supported range are rejected
+	data[4] = CurrentVersion + 1
+	err = parsed.Unmarshal(data)
+	verr, ok := err.(*VersionError)
+	if !ok {
+		t.Fatalf("Expected a version error for an unknown version, got %v", err)
+	}
+	if verr.Version != CurrentVersion+1 || verr.GUUID != guid || verr.Flags != FlagACK {
+		t.Errorf("Version error should keep the common fields, got %+v", verr)
+	}
+}
+
+func TestHeaderVersion3(t *testing.T) {
+	guid, _ := guuid.NewV7()
+
+	original := NewHeader(guid, 9, 4, FlagACK)
+	original.Window = 77
+	original.SetFECInfo(1001, 2, 10, 3)
+	original.AddSACKBlock(6, 7)
+	original.SetExtension(ExtTimestamp, []byte{1, 2, 3, 4})
+
+	payload := []byte("payload after SACK blocks")
+	original.PayloadLength = uint16(len(payload))
+
+	data, err := original.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal header: %v", err)
+	}
+	if len(data) != original.Size() {
+		t.Fatalf("Marshaled %d bytes, Size says %d", len(data), original.Size())
+	}
+
+	// The header describes its own size, so SACK blocks and payload
+	// separate without help
+	parsed, rest, err := SplitPacket(append(data, payload...))
+	if err != nil {
+		t.Fatalf("Failed to split packet: %v", err)
+	}
+	if string(rest) != string(payload) {
+		t.Errorf("Payload mismatch: got %q", rest)
+	}
+	if parsed.Window != 77 || parsed.FECGroupID != 1001 || parsed.FECShardIndex != 2 {
+		t.Errorf("Extension fields not preserved: %s", parsed)
+	}
+	if len(parsed.SACKBlocks) != 1 || parsed.SACKBlocks[0] != (SACKBlock{6, 7}) {
+		t.Errorf("SACK blocks not preserved: %+v", parsed.SACKBlocks)
+	}
+	if ts, ok := parsed.Extension(ExtTimestamp); !ok || len(ts) != 4 || ts[3] != 4 {
+		t.Errorf("Timestamp extension not preserved: %v", ts)
+	}
+
+	// Re-marshaling yields the same bytes, as packet authentication needs
+	again, _ := parsed.Marshal()
+	if string(again) != string(data) {
+		t.Error("Re-marshaled header differs from the original")
+	}
+
+	// Appending to a reused buffer keeps what it holds and overwrites
+	// stale bytes beyond it
+	buf := append([]byte("prefix"), make([]byte, 256)...)
+	for i := range buf[6:] {
+		buf[6+i] = 0xFF
+	}
+	appended, err := parsed.AppendBinary(buf[:6])
+	if err != nil {
+		t.Fatalf("Failed to append header: %v", err)
+	}
+	if string(appended) != "prefix"+string(data) {
+		t.Error("Appended header differs from the marshaled one")
+	}
+
+	// Unmarshal takes the header alone
+	if err := (&Header{}).Unmarshal(append(data, 0)); err == nil {
+		t.Error("Expected trailing bytes to be rejected")
+	}
+
+	// Extensions this version does not know are carried along
+	data[len(data)-6] = 200
+	parsed, _, err = SplitPacket(append(data, payload...))
+	if err != nil {
+		t.Fatalf("Failed to split packet with unknown extension: %v", err)
+	}
+	if _, ok := parsed.Extension(200); !ok {
+		t.Error("Expected unknown extension to be kept")
+	}
+}
+
+func TestHeaderAckExtensions(t *testing.T) {
+	guid, _ := guuid.NewV7()
+
+	original := NewHeader(guid, 0, 12, FlagSYN|FlagACK)
+	original.SetAckDelay(12345 * time.Microsecond)
+	original.SetAckFrequency(8)
+
+	data, err := original.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal header: %v", err)
+	}
+	parsed := &Header{}
+	if err := parsed.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal header: %v", err)
+	}
+
+	if delay, ok := parsed.AckDelay(); !ok || delay != 12345*time.Microsecond {
+		t.Errorf("Expected an ack delay of 12.345ms, got %v", delay)
+	}
+	if n, ok := parsed.AckFrequency(); !ok || n != 8 {
+		t.Errorf("Expected an ack frequency of 8, got %d", n)
+	}
+
+	// Headers without them say so
+	plain := NewHeader(guid, 0, 12, FlagACK)
+	if _, ok := plain.AckDelay(); ok {
+		t.Error("Expected no ack delay")
+	}
+	if _, ok := plain.AckFrequency(); ok {
+		t.Error("Expected no ack frequency")
+	}
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	guid, _ := guuid.NewV7()
+
+	vn := NewHeader(guid, 0, 0, 0)
+	vn.Version = VersionNegotiation
+	versions := SupportedVersions()
+	vn.PayloadLength = uint16(len(versions))
+
+	data, err := vn.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal header: %v", err)
+	}
+	parsed, payload, err := SplitPacket(append(data, versions...))
+	if err != nil {
+		t.Fatalf("Failed to split version negotiation packet: %v", err)
+	}
+	if parsed.Version != VersionNegotiation || parsed.GUUID != guid || string(payload) != string(versions) {
+		t.Errorf("Version negotiation packet not preserved: %s %v", parsed, payload)
+	}
+
+	tests := []struct {
+		offered uint8
+		peer    []byte
+		want    uint8
+		ok      bool
+	}{
+		{3, []byte{2, 1}, 2, true},
+		{3, []byte{1}, 1, true},
+		{3, []byte{9, 2}, 2, true},
+		{2, []byte{3}, 0, false},
+		{3, []byte{}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := NegotiateVersion(tt.offered, tt.peer)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NegotiateVersion(%d, %v) = %d, %v; want %d, %v", tt.offered, tt.peer, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
 func TestHeaderFlags(t *testing.T) {
 	guid, _ := guuid.NewV7()
 	header := NewHeader(guid, 0, 0, 0)
@@ -84,6 +281,10 @@ func TestHeaderFlags(t *testing.T) {
 	if !header.HasFlag(FlagACK) {
 		t.Error("Flag ACK should still be set")
 	}
+
+	if s := (FlagSYN | FlagACK | FlagECE).String(); s != "SYN|ACK|ECE" {
+		t.Errorf("Expected SYN|ACK|ECE, got %q", s)
+	}
 }
 
 func TestHeaderValidate(t *testing.T) {
@@ -102,6 +303,17 @@ func TestHeaderValidate(t *testing.T) {
 		t.Error("Header with too large payload should fail validation")
 	}
 
+	// A SACK block may span the sequence number wrap, but not run backwards
+	header.PayloadLength = 1000
+	header.AddSACKBlock(0xFFFFFFF0, 5)
+	if err := header.Validate(); err != nil {
+		t.Errorf("SACK block across the wrap should pass validation: %v", err)
+	}
+	header.SACKBlocks[0] = SACKBlock{Start: 5, End: 0xFFFFFFF0}
+	if err := header.Validate(); err == nil {
+		t.Error("Backwards SACK block should fail validation")
+	}
+
 	// Invalid: zero GUUID
 	header = NewHeader(guuid.Nil, 100, 50, FlagACK)
 	header.PayloadLength = 1000
@@ -132,19 +344,63 @@ func TestSACKBlocks(t *testing.T) {
 func TestHeaderSize(t *testing.T) {
 	guid, _ := guuid.NewV7()
 	header := NewHeader(guid, 0, 0, 0)
+	header.Version = 2
 
 	// Without SACK blocks
 	size := header.Size()
-	if size != HeaderMinSize {
-		t.Errorf("Header size without SACK blocks should be %d, got %d", HeaderMinSize, size)
+	if size != HeaderMinSize+WindowFieldSize {
+		t.Errorf("Header size without SACK blocks should be %d, got %d", HeaderMinSize+WindowFieldSize, size)
 	}
 
 	// With SACK blocks
 	header.AddSACKBlock(10, 20)
 	header.AddSACKBlock(30, 40)
 	size = header.Size()
-	expected := HeaderMinSize + 2*8 // 2 SACK blocks * 8 bytes each
+	expected := HeaderMinSize + WindowFieldSize + 2*8 // 2 SACK blocks * 8 bytes each
 	if size != expected {
 		t.Errorf("Header size with 2 SACK blocks should be %d, got %d", expected, size)
 	}
 }
+
+func TestHeaderFECInfo(t *testing.T) {
+	guid, _ := guuid.NewV7()
+
+	original := NewHeader(guid, 0, 0, 0)
+	original.Version = 2
+	original.SetFECInfo(1001, 11, 10, 3)
+	original.AddSACKBlock(10, 20)
+
+	if size := original.Size(); size != HeaderMinSize+WindowFieldSize+FECInfoSize+8 {
+		t.Errorf("Header size with FEC info should be %d, got %d", HeaderMinSize+WindowFieldSize+FECInfoSize+8, size)
+	}
+
+	data, err := original.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal header: %v", err)
+	}
+
+	parsed := &Header{}
+	if err := parsed.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal header: %v", err)
+	}
+
+	if parsed.FECGroupID != 1001 || parsed.FECShardIndex != 11 ||
+		parsed.FECDataShards != 10 || parsed.FECParityShards != 3 {
+		t.Errorf("FEC info mismatch: got group=%d shard=%d data=%d parity=%d",
+			parsed.FECGroupID, parsed.FECShardIndex, parsed.FECDataShards, parsed.FECParityShards)
+	}
+
+	if !parsed.IsParity() {
+		t.Error("Shard 11 of a 10+3 group should be parity")
+	}
+
+	if len(parsed.SACKBlocks) != 1 || parsed.SACKBlocks[0].Start != 10 {
+		t.Errorf("SACK blocks not preserved after FEC info: %+v", parsed.SACKBlocks)
+	}
+
+	// Shard index outside the group is invalid
+	original.SetFECInfo(1001, 13, 10, 3)
+	if err := original.Validate(); err == nil {
+		t.Error("Header with out-of-range FEC shard index should fail validation")
+	}
+}
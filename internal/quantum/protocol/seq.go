@@ -0,0 +1,54 @@
+package protocol
+
+// Sequence numbers are compared with serial number arithmetic (RFC 1982), so
+// a connection keeps working when they wrap around, as it will after 4
+// billion packets or sooner from a random initial sequence number. Of two
+// sequence numbers less than 2^31 apart, the one behind the other is the
+// smaller, whatever their values.
+//
+// Zero marks packets outside the sequence (ACKs, control frames, datagrams)
+// and is never assigned: the number after 0xFFFFFFFF is 1.
+
+// SeqLess reports whether sequence number a comes before b
+func SeqLess(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// SeqLessEq reports whether sequence number a is b or comes before it
+func SeqLessEq(a, b uint32) bool {
+	return int32(a-b) <= 0
+}
+
+// SeqMax returns the later of two sequence numbers
+func SeqMax(a, b uint32) uint32 {
+	if SeqLess(a, b) {
+		return b
+	}
+	return a
+}
+
+// SeqNext returns the sequence number after seq
+func SeqNext(seq uint32) uint32 {
+	return SeqAdd(seq, 1)
+}
+
+// SeqAdd returns the sequence number n after seq, for n below 2^31
+func SeqAdd(seq, n uint32) uint32 {
+	next := seq + n
+	if next < seq {
+		// Wrapped past zero, which is skipped
+		next++
+	}
+	return next
+}
+
+// SeqDiff returns how many sequence numbers from lies before to: the n for
+// which SeqAdd(from, n) == to. from must not come after to.
+func SeqDiff(from, to uint32) uint32 {
+	n := to - from
+	if to < from {
+		// Wrapped past zero, which is skipped
+		n--
+	}
+	return n
+}
@@ -0,0 +1,53 @@
+package protocol
+
+import "testing"
+
+func TestSeqArithmetic(t *testing.T) {
+	const top = 0xFFFFFFFF
+
+	// Comparison holds across the wrap
+	if !SeqLess(top, 1) || SeqLess(1, top) {
+		t.Error("Expected 0xFFFFFFFF to come before 1")
+	}
+	if !SeqLess(top-10, 5) || !SeqLessEq(5, 5) || SeqLess(5, 5) {
+		t.Error("Unexpected comparison near the wrap")
+	}
+	if SeqMax(top, 3) != 3 {
+		t.Errorf("Expected 3 as the later sequence number, got %d", SeqMax(top, 3))
+	}
+
+	// Zero is skipped
+	if got := SeqNext(top); got != 1 {
+		t.Errorf("Expected 1 after 0xFFFFFFFF, got %d", got)
+	}
+	tests := []struct {
+		seq, n, want uint32
+	}{
+		{5, 3, 8},
+		{top - 1, 1, top},
+		{top - 1, 2, 1},
+		{top, 5, 5},
+		{top - 3, 10, 7},
+	}
+	for _, tt := range tests {
+		if got := SeqAdd(tt.seq, tt.n); got != tt.want {
+			t.Errorf("SeqAdd(%d, %d) = %d, want %d", tt.seq, tt.n, got, tt.want)
+		}
+		if got := SeqDiff(tt.seq, tt.want); got != tt.n {
+			t.Errorf("SeqDiff(%d, %d) = %d, want %d", tt.seq, tt.want, got, tt.n)
+		}
+	}
+
+	// Walking across the wrap visits every number but zero
+	seq, steps := uint32(top-2), 0
+	for SeqLess(seq, 3) {
+		if seq == 0 {
+			t.Fatal("Zero must not be assigned")
+		}
+		seq = SeqNext(seq)
+		steps++
+	}
+	if steps != 5 {
+		t.Errorf("Expected 5 steps from 0xFFFFFFFD to 3, took %d", steps)
+	}
+}
@@ -0,0 +1,92 @@
+package qlog
+
+// Packet types
+const (
+	PacketTypeInitial = "initial" // SYN and SYN-ACK
+	PacketType1RTT    = "1RTT"    // Everything after the handshake
+)
+
+// Frame types
+const (
+	FrameTypeAck      = "ack"
+	FrameTypeStream   = "stream"
+	FrameTypeDatagram = "datagram"
+	FrameTypeControl  = "control"
+	FrameTypeFEC      = "fec_parity"
+)
+
+// Loss triggers
+const (
+	TriggerReorderingThreshold = "reordering_threshold"
+	TriggerTimeThreshold       = "time_threshold"
+)
+
+// PacketHeader identifies a packet
+type PacketHeader struct {
+	PacketType   string `json:"packet_type"`
+	PacketNumber uint32 `json:"packet_number"`
+	Flags        string `json:"flags,omitempty"`
+}
+
+// RawInfo describes a packet's size on the wire
+type RawInfo struct {
+	Length        int `json:"length"`
+	PayloadLength int `json:"payload_length"`
+}
+
+// Frame summarizes what a packet carries. Acked ranges are inclusive; the
+// ack delay is in milliseconds. ACKs echo the ECN codepoints received.
+type Frame struct {
+	FrameType   string      `json:"frame_type"`
+	AckedRanges [][2]uint32 `json:"acked_ranges,omitempty"`
+	AckDelay    float64     `json:"ack_delay,omitempty"`
+	ECT0        uint32      `json:"ect0,omitempty"`
+	ECT1        uint32      `json:"ect1,omitempty"`
+	CE          uint32      `json:"ce,omitempty"`
+}
+
+// PacketEvent is the data of EventPacketSent and EventPacketReceived
+type PacketEvent struct {
+	Header PacketHeader `json:"header"`
+	Raw    RawInfo      `json:"raw"`
+	Frames []Frame      `json:"frames,omitempty"`
+}
+
+// PacketLost is the data of EventPacketLost
+type PacketLost struct {
+	Header  PacketHeader `json:"header"`
+	Trigger string       `json:"trigger"`
+}
+
+// PacketAcked is the data of EventPacketAcked
+type PacketAcked struct {
+	Header PacketHeader `json:"header"`
+}
+
+// MetricsUpdated is the data of EventMetricsUpdated. Only the metrics that
+// changed are set; times are in milliseconds and the pacing rate in bits per
+// second.
+type MetricsUpdated struct {
+	MinRTT           float64 `json:"min_rtt,omitempty"`
+	SmoothedRTT      float64 `json:"smoothed_rtt,omitempty"`
+	LatestRTT        float64 `json:"latest_rtt,omitempty"`
+	RTTVariance      float64 `json:"rtt_variance,omitempty"`
+	RTO              float64 `json:"rto,omitempty"`
+	CongestionWindow uint32  `json:"congestion_window,omitempty"`
+	BytesInFlight    uint64  `json:"bytes_in_flight,omitempty"`
+	PacingRate       uint64  `json:"pacing_rate,omitempty"`
+}
+
+// StateUpdated is the data of EventCongestionStateUpdated,
+// EventConnectionStateUpdated and EventECNStateUpdated
+type StateUpdated struct {
+	Old string `json:"old,omitempty"`
+	New string `json:"new"`
+}
+
+// FECRecovered is the data of EventFECRecovered: a data packet rebuilt from
+// its FEC group instead of being retransmitted
+type FECRecovered struct {
+	GroupID      uint32 `json:"group_id"`
+	PacketNumber uint32 `json:"packet_number"`
+}
@@ -0,0 +1,144 @@
+// Package qlog records Quantum connection events in the qlog schema
+// (draft-ietf-quic-qlog-main-schema), serialized as JSON-SEQ so traces can be
+// loaded into existing qlog tools such as qvis.
+//
+// Events with a QUIC equivalent use its name and fields: packets sent,
+// received and lost, recovery metrics (RTT, congestion window, pacing rate)
+// and congestion state changes. Events specific to Quantum, such as packets
+// rebuilt by FEC, use the quantum category.
+package qlog
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+const (
+	// Version is the qlog schema version written in trace headers
+	Version = "0.3"
+
+	// Format is the serialization: records separated by the ASCII record
+	// separator (RFC 7464)
+	Format = "JSON-SEQ"
+
+	// recordSeparator starts every JSON-SEQ record
+	recordSeparator = 0x1E
+)
+
+// Event names
+const (
+	EventConnectionStateUpdated = "connectivity:connection_state_updated"
+	EventPacketSent             = "transport:packet_sent"
+	EventPacketReceived         = "transport:packet_received"
+	EventPacketLost             = "recovery:packet_lost"
+	EventMetricsUpdated         = "recovery:metrics_updated"
+	EventCongestionStateUpdated = "recovery:congestion_state_updated"
+	EventECNStateUpdated        = "recovery:ecn_state_updated"
+	EventPacketAcked            = "quantum:packet_acked"
+	EventFECRecovered           = "quantum:fec_recovered"
+)
+
+// Vantage points
+const (
+	VantageClient = "client"
+	VantageServer = "server"
+)
+
+// TraceInfo describes the connection a trace belongs to
+type TraceInfo struct {
+	// ODCID identifies the connection; Quantum uses its GUUID
+	ODCID string
+
+	// VantagePoint is VantageClient or VantageServer
+	VantagePoint string
+
+	// ReferenceTime is the time event times are relative to
+	ReferenceTime time.Time
+}
+
+// Event is one traced event
+type Event struct {
+	// Time since the trace's reference time
+	Time time.Duration
+
+	// Name is one of the Event constants
+	Name string
+
+	// Data is the event's data, one of the types in events.go
+	Data any
+}
+
+// MarshalJSON encodes the event as a qlog event with relative time in
+// milliseconds
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time float64 `json:"time"`
+		Name string  `json:"name"`
+		Data any     `json:"data"`
+	}{Milliseconds(e.Time), e.Name, e.Data})
+}
+
+// Sink receives the events of one connection. Record is called from the
+// connection's goroutines concurrently and must not block for long; Close is
+// called once the connection has closed.
+type Sink interface {
+	Record(e Event)
+	Close() error
+}
+
+// Milliseconds converts a duration to qlog's fractional milliseconds
+func Milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// writeHeader writes the JSON-SEQ header record of a trace
+func writeHeader(w io.Writer, info TraceInfo) error {
+	type vantagePoint struct {
+		Type string `json:"type"`
+	}
+	type commonFields struct {
+		ODCID         string   `json:"ODCID"`
+		ReferenceTime float64  `json:"reference_time"`
+		TimeFormat    string   `json:"time_format"`
+		ProtocolType  []string `json:"protocol_type"`
+	}
+	type trace struct {
+		VantagePoint vantagePoint `json:"vantage_point"`
+		CommonFields commonFields `json:"common_fields"`
+	}
+
+	return writeRecord(w, struct {
+		QlogVersion string `json:"qlog_version"`
+		QlogFormat  string `json:"qlog_format"`
+		Title       string `json:"title"`
+		Trace       trace  `json:"trace"`
+	}{
+		QlogVersion: Version,
+		QlogFormat:  Format,
+		Title:       "quantum " + info.ODCID,
+		Trace: trace{
+			VantagePoint: vantagePoint{Type: info.VantagePoint},
+			CommonFields: commonFields{
+				ODCID:         info.ODCID,
+				ReferenceTime: float64(info.ReferenceTime.UnixNano()) / float64(time.Millisecond),
+				TimeFormat:    "relative",
+				ProtocolType:  []string{"QUANTUM"},
+			},
+		},
+	})
+}
+
+// writeRecord writes one JSON-SEQ record
+func writeRecord(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, 0, len(data)+2)
+	record = append(record, recordSeparator)
+	record = append(record, data...)
+	record = append(record, '\n')
+	_, err = w.Write(record)
+	return err
+}
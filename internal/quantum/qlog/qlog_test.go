@@ -0,0 +1,125 @@
+package qlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// parseRecords splits a JSON-SEQ trace into its decoded records
+func parseRecords(t *testing.T, data []byte) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+	for _, chunk := range bytes.Split(data, []byte{recordSeparator}) {
+		if len(chunk) == 0 {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal(chunk, &record); err != nil {
+			t.Fatalf("Invalid record %q: %v", chunk, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestFileSink(t *testing.T) {
+	var buf bytes.Buffer
+	info := TraceInfo{ODCID: "0123", VantagePoint: VantageClient, ReferenceTime: time.Now()}
+	s := NewFileSink(&buf, info)
+
+	s.Record(Event{Time: 1500 * time.Microsecond, Name: EventPacketSent, Data: PacketEvent{
+		Header: PacketHeader{PacketType: PacketType1RTT, PacketNumber: 7},
+		Raw:    RawInfo{Length: 100, PayloadLength: 60},
+		Frames: []Frame{{FrameType: FrameTypeAck, AckedRanges: [][2]uint32{{1, 6}}}},
+	}})
+	s.Record(Event{Time: 3 * time.Millisecond, Name: EventMetricsUpdated, Data: MetricsUpdated{SmoothedRTT: 12.5}})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	records := parseRecords(t, buf.Bytes())
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and 2 events, got %d records", len(records))
+	}
+
+	header := records[0]
+	if header["qlog_version"] != Version || header["qlog_format"] != Format {
+		t.Errorf("Unexpected header: %v", header)
+	}
+	trace := header["trace"].(map[string]any)
+	if trace["vantage_point"].(map[string]any)["type"] != VantageClient {
+		t.Errorf("Unexpected vantage point: %v", trace)
+	}
+
+	sent := records[1]
+	if sent["time"] != 1.5 || sent["name"] != EventPacketSent {
+		t.Errorf("Unexpected event: %v", sent)
+	}
+	pn := sent["data"].(map[string]any)["header"].(map[string]any)["packet_number"]
+	if pn != float64(7) {
+		t.Errorf("Expected packet number 7, got %v", pn)
+	}
+
+	// Unset metrics are left out
+	metrics := records[2]["data"].(map[string]any)
+	if len(metrics) != 1 || metrics["smoothed_rtt"] != 12.5 {
+		t.Errorf("Expected only smoothed_rtt, got %v", metrics)
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	r := NewRingBuffer(3)
+	for i := 0; i < 5; i++ {
+		r.Record(Event{Time: time.Duration(i) * time.Millisecond, Name: EventPacketSent})
+	}
+
+	// The oldest events are overwritten
+	events := r.Events()
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	for i, e := range events {
+		if want := time.Duration(i+2) * time.Millisecond; e.Time != want {
+			t.Errorf("Expected event %d at %v, got %v", i, want, e.Time)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteTrace(&buf, TraceInfo{ODCID: "0123", VantagePoint: VantageServer}); err != nil {
+		t.Fatalf("Failed to write trace: %v", err)
+	}
+	if n := len(parseRecords(t, buf.Bytes())); n != 4 {
+		t.Errorf("Expected a header and 3 events, got %d records", n)
+	}
+}
+
+func TestDirSinks(t *testing.T) {
+	dir := t.TempDir()
+	info := TraceInfo{ODCID: "0123", VantagePoint: VantageServer, ReferenceTime: time.Now()}
+
+	s := DirSinks(dir)(info)
+	if s == nil {
+		t.Fatal("Expected a sink")
+	}
+	s.Record(Event{Name: EventPacketReceived, Data: PacketEvent{}})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "0123_server.sqlog"))
+	if err != nil {
+		t.Fatalf("Failed to read trace: %v", err)
+	}
+	if n := len(parseRecords(t, data)); n != 2 {
+		t.Errorf("Expected a header and 1 event, got %d records", n)
+	}
+
+	if DirSinks(filepath.Join(dir, "missing"))(info) != nil {
+		t.Error("Expected no sink when the file cannot be created")
+	}
+}
@@ -0,0 +1,123 @@
+package qlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileSink streams a trace to a writer as JSON-SEQ: the header record, then
+// one record per event. Output is buffered until Flush or Close.
+type FileSink struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+	err    error
+}
+
+// NewFileSink starts a trace on w. If w is an io.Closer, Close closes it.
+func NewFileSink(w io.Writer, info TraceInfo) *FileSink {
+	s := &FileSink{w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		s.closer = c
+	}
+	s.err = writeHeader(s.w, info)
+	return s
+}
+
+// Record writes an event. Write errors are kept and returned by Close.
+func (s *FileSink) Record(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = writeRecord(s.w, e)
+	}
+}
+
+// Flush writes buffered events
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = s.w.Flush()
+	}
+	return s.err
+}
+
+// Close flushes the trace and closes the underlying writer
+func (s *FileSink) Close() error {
+	err := s.Flush()
+	if s.closer != nil {
+		if cerr := s.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// DirSinks returns a sink factory writing each connection's trace to its
+// own file in dir, named after the connection GUUID and vantage point.
+// Connections whose file cannot be created are not traced.
+func DirSinks(dir string) func(info TraceInfo) Sink {
+	return func(info TraceInfo) Sink {
+		name := fmt.Sprintf("%s_%s.sqlog", info.ODCID, info.VantagePoint)
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return nil
+		}
+		return NewFileSink(f, info)
+	}
+}
+
+// RingBuffer keeps the most recent events of a trace in memory, e.g. to
+// dump a trace only when a connection misbehaves
+type RingBuffer struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// NewRingBuffer creates a ring buffer holding up to size events
+func NewRingBuffer(size int) *RingBuffer {
+	return &RingBuffer{events: make([]Event, max(size, 1))}
+}
+
+// Record adds an event, overwriting the oldest once the buffer is full
+func (r *RingBuffer) Record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Events returns the buffered events, oldest first
+func (r *RingBuffer) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Event(nil), r.events[:r.next]...)
+	}
+	return append(append([]Event(nil), r.events[r.next:]...), r.events[:r.next]...)
+}
+
+// WriteTrace writes the buffered events to w as a JSON-SEQ trace
+func (r *RingBuffer) WriteTrace(w io.Writer, info TraceInfo) error {
+	s := NewFileSink(w, info)
+	s.closer = nil
+	for _, e := range r.Events() {
+		s.Record(e)
+	}
+	return s.Flush()
+}
+
+// Close does nothing; the events stay readable
+func (r *RingBuffer) Close() error {
+	return nil
+}
@@ -42,6 +42,23 @@ func NewReceiveBuffer(windowSize uint32) *ReceiveBuffer {
 	}
 }
 
+// SetInitialSeqNum expects the sequence to start at seq, the peer's initial
+// sequence number. It reports false, changing nothing, once a packet has
+// been received.
+func (rb *ReceiveBuffer) SetInitialSeqNum(seq uint32) bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.totalReceived > 0 {
+		return false
+	}
+	if seq == 0 {
+		seq = 1
+	}
+	rb.nextExpected = seq
+	return true
+}
+
 // AddPacket adds a received packet to the buffer
 // Returns:
 // - ordered: list of packets that can now be delivered in order
@@ -53,7 +70,7 @@ func (rb *ReceiveBuffer) AddPacket(packet *transport.Packet) (ordered []*transpo
 	seqNum := packet.Header.SequenceNumber
 
 	// Check if this is a duplicate
-	if seqNum < rb.nextExpected {
+	if protocol.SeqLess(seqNum, rb.nextExpected) {
 		rb.duplicates++
 		return nil, true, nil
 	}
@@ -65,7 +82,7 @@ func (rb *ReceiveBuffer) AddPacket(packet *transport.Packet) (ordered []*transpo
 	}
 
 	// Check receive window
-	if seqNum >= rb.nextExpected+rb.recvWindow {
+	if !protocol.SeqLess(seqNum, protocol.SeqAdd(rb.nextExpected, rb.recvWindow)) {
 		return nil, false, fmt.Errorf("packet outside receive window: seq=%d, expected=%d, window=%d",
 			seqNum, rb.nextExpected, rb.recvWindow)
 	}
@@ -75,7 +92,7 @@ func (rb *ReceiveBuffer) AddPacket(packet *transport.Packet) (ordered []*transpo
 	// If this is the next expected packet, it can be delivered immediately
 	if seqNum == rb.nextExpected {
 		ordered = append(ordered, packet)
-		rb.nextExpected++
+		rb.nextExpected = protocol.SeqNext(rb.nextExpected)
 		rb.totalOrdered++
 
 		// Check if any buffered packets can now be delivered
@@ -83,7 +100,7 @@ func (rb *ReceiveBuffer) AddPacket(packet *transport.Packet) (ordered []*transpo
 			if pkt, exists := rb.packets[rb.nextExpected]; exists {
 				ordered = append(ordered, pkt.Packet)
 				delete(rb.packets, rb.nextExpected)
-				rb.nextExpected++
+				rb.nextExpected = protocol.SeqNext(rb.nextExpected)
 				rb.totalOrdered++
 			} else {
 				break
@@ -122,10 +139,11 @@ func (rb *ReceiveBuffer) GenerateSACK() (ackNum uint32, sackBlocks []protocol.SA
 		seqNums = append(seqNums, seq)
 	}
 
-	// Simple bubble sort (sufficient for small number of SACK blocks)
+	// Simple bubble sort (sufficient for small number of SACK blocks), by
+	// distance from the cumulative ACK so the order survives wraparound
 	for i := 0; i < len(seqNums); i++ {
 		for j := i + 1; j < len(seqNums); j++ {
-			if seqNums[i] > seqNums[j] {
+			if protocol.SeqLess(seqNums[j], seqNums[i]) {
 				seqNums[i], seqNums[j] = seqNums[j], seqNums[i]
 			}
 		}
@@ -136,7 +154,7 @@ func (rb *ReceiveBuffer) GenerateSACK() (ackNum uint32, sackBlocks []protocol.SA
 	for _, seq := range seqNums {
 		if currentBlock == nil {
 			currentBlock = &protocol.SACKBlock{Start: seq, End: seq}
-		} else if seq == currentBlock.End+1 {
+		} else if seq == protocol.SeqNext(currentBlock.End) {
 			// Extend current block
 			currentBlock.End = seq
 		} else {
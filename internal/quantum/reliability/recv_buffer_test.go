@@ -179,3 +179,48 @@ func TestReceiveBufferStatistics(t *testing.T) {
 		t.Errorf("out_of_order should be 1, got %d", stats["out_of_order"])
 	}
 }
+
+func TestReceiveBufferWraparound(t *testing.T) {
+	rb := NewReceiveBuffer(256)
+	guid, _ := guuid.NewV7()
+
+	if !rb.SetInitialSeqNum(0xFFFFFFFE) {
+		t.Fatal("Expected the initial sequence number to be set")
+	}
+
+	add := func(seq uint32) []*transport.Packet {
+		t.Helper()
+		packet := &transport.Packet{
+			Header:  protocol.NewHeader(guid, seq, 0, 0),
+			Payload: []byte{byte(seq)},
+		}
+		ordered, isDup, err := rb.AddPacket(packet)
+		if err != nil || isDup {
+			t.Fatalf("Failed to add packet %d: duplicate=%v err=%v", seq, isDup, err)
+		}
+		return ordered
+	}
+
+	// Packets after the wrap arrive first and are buffered
+	add(2)
+	add(1)
+	add(0xFFFFFFFE)
+	ackNum, sackBlocks := rb.GenerateSACK()
+	if ackNum != 0xFFFFFFFF || len(sackBlocks) != 1 || sackBlocks[0].Start != 1 || sackBlocks[0].End != 2 {
+		t.Fatalf("Expected ACK 0xFFFFFFFF with SACK [1-2], got %d %v", ackNum, sackBlocks)
+	}
+
+	// The missing packet releases everything across the wrap
+	if ordered := add(0xFFFFFFFF); len(ordered) != 3 {
+		t.Fatalf("Expected 3 ordered packets, got %d", len(ordered))
+	}
+	if rb.NextExpected() != 3 {
+		t.Errorf("NextExpected should be 3, got %d", rb.NextExpected())
+	}
+
+	// Packets before the wrap are now duplicates
+	_, isDup, _ := rb.AddPacket(&transport.Packet{Header: protocol.NewHeader(guid, 0xFFFFFFF0, 0, 0)})
+	if !isDup {
+		t.Error("Expected a packet from before the wrap to be a duplicate")
+	}
+}
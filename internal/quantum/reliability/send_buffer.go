@@ -46,10 +46,23 @@ type SendBuffer struct {
 	sendBase    uint32 // Oldest unacknowledged sequence number
 	sendWindow  uint32 // Maximum number of unacknowledged packets
 
+	// Payload bytes sent but not yet acknowledged, for congestion control
+	bytesInFlight uint64
+
+	// Peer receive window: sequence numbers below peerEdge may be sent.
+	// Unlimited until the peer first advertises a window.
+	peerWindowKnown bool
+	peerAck         uint32 // Cumulative ACK the window was advertised with
+	peerEdge        uint32 // peerAck + advertised window
+
 	// RTT estimation for RTO calculation
 	srtt    time.Duration // Smoothed RTT
 	rttvar  time.Duration // RTT variation
 	rto     time.Duration // Retransmission timeout
+	minRTT  time.Duration // Smallest sample, before taking out ack delay
+
+	// Called with every RTT update, if set
+	rttObserver func(RTTUpdate)
 
 	// Statistics
 	totalSent       uint64
@@ -58,6 +71,15 @@ type SendBuffer struct {
 	timeoutRetrans  uint64
 }
 
+// RTTUpdate is the RTT estimate after a new sample
+type RTTUpdate struct {
+	Latest   time.Duration // The sample
+	AckDelay time.Duration // Time the peer held the ACK, taken out of the sample when possible
+	Smoothed time.Duration // Smoothed RTT
+	Variance time.Duration // RTT variation
+	RTO      time.Duration // Retransmission timeout
+}
+
 // NewSendBuffer creates a new send buffer
 func NewSendBuffer(windowSize uint32) *SendBuffer {
 	return &SendBuffer{
@@ -69,6 +91,24 @@ func NewSendBuffer(windowSize uint32) *SendBuffer {
 	}
 }
 
+// SetInitialSeqNum starts the sequence at seq, usually a random initial
+// sequence number chosen at the handshake. It reports false, changing
+// nothing, once a packet has been added.
+func (sb *SendBuffer) SetInitialSeqNum(seq uint32) bool {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.totalSent > 0 {
+		return false
+	}
+	if seq == 0 {
+		seq = 1
+	}
+	sb.nextSeqNum = seq
+	sb.sendBase = seq
+	return true
+}
+
 // NextSeqNum returns the next sequence number to use
 func (sb *SendBuffer) NextSeqNum() uint32 {
 	sb.mu.RLock()
@@ -76,16 +116,28 @@ func (sb *SendBuffer) NextSeqNum() uint32 {
 	return sb.nextSeqNum
 }
 
-// WindowAvailable returns the number of packets that can be sent
+// WindowAvailable returns the number of packets that can be sent, limited by
+// both the send window and the peer's receive window
 func (sb *SendBuffer) WindowAvailable() uint32 {
 	sb.mu.RLock()
 	defer sb.mu.RUnlock()
 
-	inFlight := sb.nextSeqNum - sb.sendBase
+	inFlight := protocol.SeqDiff(sb.sendBase, sb.nextSeqNum)
 	if inFlight >= sb.sendWindow {
 		return 0
 	}
-	return sb.sendWindow - inFlight
+	available := sb.sendWindow - inFlight
+
+	if sb.peerWindowKnown {
+		if !protocol.SeqLess(sb.nextSeqNum, sb.peerEdge) {
+			return 0
+		}
+		if credit := protocol.SeqDiff(sb.nextSeqNum, sb.peerEdge); credit < available {
+			available = credit
+		}
+	}
+
+	return available
 }
 
 // CanSend checks if a packet can be sent (window not full)
@@ -93,13 +145,14 @@ func (sb *SendBuffer) CanSend() bool {
 	return sb.WindowAvailable() > 0
 }
 
-// AddPacket adds a packet to the send buffer
+// AddPacket adds a packet to the send buffer, assigning it the next sequence number
 func (sb *SendBuffer) AddPacket(packet *transport.Packet) error {
 	sb.mu.Lock()
 	defer sb.mu.Unlock()
 
 	seqNum := sb.nextSeqNum
-	
+	packet.Header.SequenceNumber = seqNum
+
 	sentPkt := &SentPacket{
 		Packet:       packet,
 		SeqNum:       seqNum,
@@ -111,57 +164,74 @@ func (sb *SendBuffer) AddPacket(packet *transport.Packet) error {
 	}
 
 	sb.packets[seqNum] = sentPkt
-	sb.nextSeqNum++
+	sb.nextSeqNum = protocol.SeqNext(seqNum)
 	sb.totalSent++
+	sb.bytesInFlight += uint64(len(packet.Payload))
 
 	return nil
 }
 
-// HandleACK processes an acknowledgment
-func (sb *SendBuffer) HandleACK(ackNum uint32, sackBlocks []protocol.SACKBlock) []uint32 {
+// HandleACK processes an acknowledgment, returning the packets it newly
+// acknowledges
+func (sb *SendBuffer) HandleACK(ackNum uint32, sackBlocks []protocol.SACKBlock) []*SentPacket {
+	return sb.HandleACKWithDelay(ackNum, sackBlocks, 0)
+}
+
+// HandleACKWithDelay processes an acknowledgment the peer held for ackDelay
+// before sending it, returning the packets it newly acknowledges. The
+// largest newly acknowledged packet gives an RTT sample.
+func (sb *SendBuffer) HandleACKWithDelay(ackNum uint32, sackBlocks []protocol.SACKBlock, ackDelay time.Duration) []*SentPacket {
 	sb.mu.Lock()
 	defer sb.mu.Unlock()
 
-	var ackedSeqNums []uint32
-
-	// Process cumulative ACK
-	for seq := sb.sendBase; seq < ackNum && seq < sb.nextSeqNum; seq++ {
+	var acked []*SentPacket
+	var largest *SentPacket
+	ack := func(seq uint32) {
 		if pkt, exists := sb.packets[seq]; exists && !pkt.Acked {
-			pkt.Acked = true
-			ackedSeqNums = append(ackedSeqNums, seq)
-			
-			// Update RTT estimation
-			rtt := time.Since(pkt.SendTime)
-			sb.updateRTO(rtt)
+			sb.markAcked(pkt)
+			acked = append(acked, pkt)
+			if largest == nil || protocol.SeqLess(largest.SeqNum, seq) {
+				largest = pkt
+			}
+		}
+	}
+
+	// Process cumulative ACK, ignoring one beyond anything sent
+	if protocol.SeqLessEq(ackNum, sb.nextSeqNum) {
+		for seq := sb.sendBase; protocol.SeqLess(seq, ackNum); seq = protocol.SeqNext(seq) {
+			ack(seq)
 		}
 	}
 
-	// Process SACK blocks
+	// Process SACK blocks, as far as they cover packets in flight
 	for _, block := range sackBlocks {
-		for seq := block.Start; seq <= block.End && seq < sb.nextSeqNum; seq++ {
-			if pkt, exists := sb.packets[seq]; exists && !pkt.Acked {
-				pkt.Acked = true
-				ackedSeqNums = append(ackedSeqNums, seq)
-				
-				// Update RTT estimation
-				rtt := time.Since(pkt.SendTime)
-				sb.updateRTO(rtt)
-			}
+		for seq := protocol.SeqMax(block.Start, sb.sendBase); protocol.SeqLessEq(seq, block.End) && protocol.SeqLess(seq, sb.nextSeqNum); seq = protocol.SeqNext(seq) {
+			ack(seq)
 		}
 	}
 
+	if largest != nil {
+		sb.updateRTO(time.Since(largest.SendTime), ackDelay)
+	}
+
 	// Update send base to the smallest unacknowledged sequence number
-	for seq := sb.sendBase; seq < sb.nextSeqNum; seq++ {
+	for seq := sb.sendBase; protocol.SeqLess(seq, sb.nextSeqNum); seq = protocol.SeqNext(seq) {
 		if pkt, exists := sb.packets[seq]; exists && !pkt.Acked {
 			sb.sendBase = seq
 			break
 		}
 		// Clean up acknowledged packets
 		delete(sb.packets, seq)
-		sb.sendBase = seq + 1
+		sb.sendBase = protocol.SeqNext(seq)
 	}
 
-	return ackedSeqNums
+	return acked
+}
+
+// markAcked records a packet's acknowledgment
+func (sb *SendBuffer) markAcked(pkt *SentPacket) {
+	pkt.Acked = true
+	sb.bytesInFlight -= uint64(len(pkt.Packet.Payload))
 }
 
 // DetectLostPackets detects packets that should be retransmitted
@@ -173,14 +243,15 @@ func (sb *SendBuffer) DetectLostPackets() (fastRetrans, timeoutRetrans []*transp
 	now := time.Now()
 	highestAcked := sb.findHighestAcked()
 
-	for seq := sb.sendBase; seq < sb.nextSeqNum; seq++ {
+	for seq := sb.sendBase; protocol.SeqLess(seq, sb.nextSeqNum); seq = protocol.SeqNext(seq) {
 		pkt, exists := sb.packets[seq]
 		if !exists || pkt.Acked {
 			continue
 		}
 
-		// Fast retransmit: packet is likely lost if packets after it have been acked
-		if seq < highestAcked && (highestAcked-seq) >= FastRetransmitThreshold {
+		// Fast retransmit: packet is likely lost if packets after it have been acked.
+		// Each packet is fast-retransmitted once; further losses fall back to RTO.
+		if pkt.RetransCount == 0 && protocol.SeqLess(seq, highestAcked) && protocol.SeqDiff(seq, highestAcked) >= FastRetransmitThreshold {
 			fastRetrans = append(fastRetrans, pkt.Packet)
 			pkt.RetransCount++
 			pkt.SendTime = now
@@ -208,7 +279,7 @@ func (sb *SendBuffer) DetectLostPackets() (fastRetrans, timeoutRetrans []*transp
 // findHighestAcked finds the highest acknowledged sequence number
 func (sb *SendBuffer) findHighestAcked() uint32 {
 	highest := sb.sendBase
-	for seq := sb.sendBase; seq < sb.nextSeqNum; seq++ {
+	for seq := sb.sendBase; protocol.SeqLess(seq, sb.nextSeqNum); seq = protocol.SeqNext(seq) {
 		if pkt, exists := sb.packets[seq]; exists && pkt.Acked {
 			highest = seq
 		}
@@ -217,8 +288,18 @@ func (sb *SendBuffer) findHighestAcked() uint32 {
 }
 
 // updateRTO updates the retransmission timeout based on measured RTT
-// Using algorithm from RFC 6298
-func (sb *SendBuffer) updateRTO(rtt time.Duration) {
+// Using algorithm from RFC 6298. As in QUIC (RFC 9002), the time the peer
+// held its ACK is taken out of the sample, unless that would put the sample
+// below the smallest one seen.
+func (sb *SendBuffer) updateRTO(rtt, ackDelay time.Duration) {
+	latest := rtt
+	if sb.minRTT == 0 || rtt < sb.minRTT {
+		sb.minRTT = rtt
+	}
+	if ackDelay > 0 && rtt-ackDelay >= sb.minRTT {
+		rtt -= ackDelay
+	}
+
 	if sb.srtt == 0 {
 		// First RTT measurement
 		sb.srtt = rtt
@@ -246,6 +327,32 @@ func (sb *SendBuffer) updateRTO(rtt time.Duration) {
 	} else if sb.rto > MaxRTO {
 		sb.rto = MaxRTO
 	}
+
+	if sb.rttObserver != nil {
+		sb.rttObserver(RTTUpdate{Latest: latest, AckDelay: ackDelay, Smoothed: sb.srtt, Variance: sb.rttvar, RTO: sb.rto})
+	}
+}
+
+// SetRTTObserver registers a function called with every RTT update. It runs
+// with the buffer locked and must not call back into it.
+func (sb *SendBuffer) SetRTTObserver(observer func(RTTUpdate)) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.rttObserver = observer
+}
+
+// InFlight returns the number of sent but unacknowledged packets
+func (sb *SendBuffer) InFlight() int {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return len(sb.packets)
+}
+
+// BytesInFlight returns the payload bytes sent but not yet acknowledged
+func (sb *SendBuffer) BytesInFlight() uint64 {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.bytesInFlight
 }
 
 // RTO returns the current retransmission timeout
@@ -262,6 +369,41 @@ func (sb *SendBuffer) SRTT() time.Duration {
 	return sb.srtt
 }
 
+// MinRTT returns the smallest RTT sample, or 0 before the first
+func (sb *SendBuffer) MinRTT() time.Duration {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.minRTT
+}
+
+// ResetRTT discards the RTT estimate, returning the RTO to its initial value.
+// Used when the peer moves to a network path with unknown delay.
+func (sb *SendBuffer) ResetRTT() {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	sb.srtt = 0
+	sb.rttvar = 0
+	sb.rto = DefaultRTO
+	sb.minRTT = 0
+}
+
+// SeedRTT starts RTT estimation from an RTT remembered from an earlier
+// connection, as if it were the first sample
+func (sb *SendBuffer) SeedRTT(rtt time.Duration) {
+	if rtt <= 0 {
+		return
+	}
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	// Only samples from this connection bound the ack delay adjustment
+	sb.srtt = 0
+	sb.updateRTO(rtt, 0)
+	sb.minRTT = 0
+}
+
 // UpdateWindow updates the send window size
 func (sb *SendBuffer) UpdateWindow(size uint32) {
 	sb.mu.Lock()
@@ -269,6 +411,29 @@ func (sb *SendBuffer) UpdateWindow(size uint32) {
 	sb.sendWindow = size
 }
 
+// UpdatePeerWindow records the receive window the peer advertised along with
+// cumulative ACK ackNum. The window counts packets from ackNum; ACKs older
+// than the last one seen are ignored, so reordering cannot shrink the window.
+func (sb *SendBuffer) UpdatePeerWindow(ackNum, window uint32) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.peerWindowKnown && protocol.SeqLess(ackNum, sb.peerAck) {
+		return
+	}
+	sb.peerWindowKnown = true
+	sb.peerAck = ackNum
+	sb.peerEdge = protocol.SeqAdd(ackNum, window)
+}
+
+// PeerWindow returns the peer's last advertised receive window, and false if
+// the peer has not advertised one
+func (sb *SendBuffer) PeerWindow() (uint32, bool) {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return protocol.SeqDiff(sb.peerAck, sb.peerEdge), sb.peerWindowKnown
+}
+
 // GetWindow returns the current send window size
 func (sb *SendBuffer) GetWindow() uint32 {
 	sb.mu.RLock()
@@ -288,6 +453,7 @@ func (sb *SendBuffer) Statistics() map[string]uint64 {
 		"timeout_retrans":   sb.timeoutRetrans,
 		"in_flight":         uint64(len(sb.packets)),
 		"window_size":       uint64(sb.sendWindow),
+		"peer_window":       uint64(protocol.SeqDiff(sb.peerAck, sb.peerEdge)),
 	}
 }
 
@@ -299,9 +465,14 @@ func (sb *SendBuffer) Reset() {
 	sb.packets = make(map[uint32]*SentPacket)
 	sb.nextSeqNum = 1
 	sb.sendBase = 1
+	sb.bytesInFlight = 0
+	sb.peerWindowKnown = false
+	sb.peerAck = 0
+	sb.peerEdge = 0
 	sb.srtt = 0
 	sb.rttvar = 0
 	sb.rto = DefaultRTO
+	sb.minRTT = 0
 }
 
 // Helper function for min
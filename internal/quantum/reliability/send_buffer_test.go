@@ -0,0 +1,200 @@
+package reliability
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	guuid "github.com/Lzww0608/GUUID"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+func TestSendBufferPeerWindow(t *testing.T) {
+	sb := NewSendBuffer(256)
+	guid, _ := guuid.NewV7()
+
+	// Without an advertised window only the send window applies
+	if got := sb.WindowAvailable(); got != 256 {
+		t.Fatalf("Expected 256 packets available, got %d", got)
+	}
+
+	for i := 0; i < 4; i++ {
+		sb.AddPacket(transport.NewPacket(guid, 0, 0, 0, []byte{byte(i)}))
+	}
+
+	// The peer acknowledges packets 1-2 and has room for 3 more: 3, 4 and 5
+	sb.HandleACK(3, nil)
+	sb.UpdatePeerWindow(3, 3)
+	if got := sb.WindowAvailable(); got != 1 {
+		t.Errorf("Expected 1 packet of credit, got %d", got)
+	}
+
+	sb.AddPacket(transport.NewPacket(guid, 0, 0, 0, nil))
+	if sb.CanSend() {
+		t.Error("Expected sender to stop at the peer's window edge")
+	}
+
+	// A reordered older ACK does not move the edge back
+	sb.UpdatePeerWindow(2, 0)
+	if window, known := sb.PeerWindow(); !known || window != 3 {
+		t.Errorf("Expected stale ACK to be ignored, got window %d", window)
+	}
+
+	// Freed receive buffer opens the window again
+	sb.UpdatePeerWindow(3, 10)
+	if got := sb.WindowAvailable(); got != 7 {
+		t.Errorf("Expected 7 packets of credit, got %d", got)
+	}
+}
+
+func TestSendBufferResetRTT(t *testing.T) {
+	sb := NewSendBuffer(256)
+
+	sb.updateRTO(50*time.Millisecond, 0)
+	if sb.SRTT() != 50*time.Millisecond {
+		t.Fatalf("Expected SRTT 50ms, got %v", sb.SRTT())
+	}
+
+	sb.ResetRTT()
+	if sb.SRTT() != 0 || sb.RTO() != DefaultRTO {
+		t.Errorf("Expected a fresh estimate, got SRTT %v RTO %v", sb.SRTT(), sb.RTO())
+	}
+
+	// The next sample starts a new estimate
+	sb.updateRTO(300*time.Millisecond, 0)
+	if sb.SRTT() != 300*time.Millisecond {
+		t.Errorf("Expected SRTT 300ms, got %v", sb.SRTT())
+	}
+}
+
+func TestSendBufferSeedRTT(t *testing.T) {
+	sb := NewSendBuffer(256)
+
+	sb.SeedRTT(80 * time.Millisecond)
+	if sb.SRTT() != 80*time.Millisecond {
+		t.Errorf("Expected SRTT 80ms, got %v", sb.SRTT())
+	}
+	if sb.RTO() >= DefaultRTO {
+		t.Errorf("Expected RTO below the initial %v, got %v", DefaultRTO, sb.RTO())
+	}
+}
+
+func TestSendBufferRTTObserver(t *testing.T) {
+	sb := NewSendBuffer(256)
+
+	var updates []RTTUpdate
+	sb.SetRTTObserver(func(u RTTUpdate) { updates = append(updates, u) })
+
+	sb.updateRTO(100*time.Millisecond, 0)
+	sb.updateRTO(60*time.Millisecond, 0)
+	if len(updates) != 2 {
+		t.Fatalf("Expected 2 updates, got %d", len(updates))
+	}
+
+	last := updates[1]
+	if last.Latest != 60*time.Millisecond || last.Smoothed != sb.SRTT() || last.RTO != sb.RTO() {
+		t.Errorf("Update does not match the estimate: %+v", last)
+	}
+}
+
+func TestSendBufferBytesInFlight(t *testing.T) {
+	sb := NewSendBuffer(256)
+	guid, _ := guuid.NewV7()
+
+	for _, size := range []int{100, 200, 300} {
+		sb.AddPacket(transport.NewPacket(guid, 0, 0, 0, make([]byte, size)))
+	}
+	if got := sb.BytesInFlight(); got != 600 {
+		t.Fatalf("Expected 600 bytes in flight, got %d", got)
+	}
+
+	// Packet 1 is acknowledged cumulatively, packet 3 selectively
+	acked := sb.HandleACK(2, []protocol.SACKBlock{{Start: 3, End: 3}})
+	if len(acked) != 2 || acked[0].SeqNum != 1 || acked[1].SeqNum != 3 {
+		t.Fatalf("Expected packets 1 and 3 acknowledged, got %d packets", len(acked))
+	}
+	if got := sb.BytesInFlight(); got != 200 {
+		t.Errorf("Expected 200 bytes in flight, got %d", got)
+	}
+
+	// Duplicate ACKs acknowledge nothing new
+	if acked := sb.HandleACK(2, []protocol.SACKBlock{{Start: 3, End: 3}}); len(acked) != 0 {
+		t.Errorf("Expected no newly acknowledged packets, got %d", len(acked))
+	}
+}
+
+func TestSendBufferWraparound(t *testing.T) {
+	sb := NewSendBuffer(256)
+	guid, _ := guuid.NewV7()
+
+	if !sb.SetInitialSeqNum(0xFFFFFFFE) {
+		t.Fatal("Expected the initial sequence number to be set")
+	}
+
+	// The sequence skips zero: 0xFFFFFFFE, 0xFFFFFFFF, 1, 2
+	var seqs []uint32
+	for i := 0; i < 4; i++ {
+		packet := transport.NewPacket(guid, 0, 0, 0, []byte{byte(i)})
+		sb.AddPacket(packet)
+		seqs = append(seqs, packet.Header.SequenceNumber)
+	}
+	if want := []uint32{0xFFFFFFFE, 0xFFFFFFFF, 1, 2}; !slices.Equal(seqs, want) {
+		t.Fatalf("Expected sequence %v, got %v", want, seqs)
+	}
+	if sb.SetInitialSeqNum(100) {
+		t.Error("Expected the initial sequence number to be fixed once packets are sent")
+	}
+	if got := sb.WindowAvailable(); got != 252 {
+		t.Errorf("Expected 252 packets available, got %d", got)
+	}
+
+	// A SACK across the wrap followed by the cumulative ACK
+	acked := sb.HandleACK(0xFFFFFFFF, []protocol.SACKBlock{{Start: 1, End: 1}})
+	if len(acked) != 2 {
+		t.Fatalf("Expected 2 packets acknowledged, got %d", len(acked))
+	}
+	acked = sb.HandleACK(2, nil)
+	if len(acked) != 1 || acked[0].SeqNum != 0xFFFFFFFF {
+		t.Fatalf("Expected packet 0xFFFFFFFF acknowledged, got %d packets", len(acked))
+	}
+	if got := sb.InFlight(); got != 1 {
+		t.Errorf("Expected 1 packet in flight, got %d", got)
+	}
+
+	// The peer's window edge wraps too
+	sb.UpdatePeerWindow(0xFFFFFFFF, 4)
+	if window, _ := sb.PeerWindow(); window != 4 {
+		t.Errorf("Expected a peer window of 4, got %d", window)
+	}
+	if got := sb.WindowAvailable(); got != 1 {
+		t.Errorf("Expected 1 packet of credit, got %d", got)
+	}
+
+	// An ACK beyond anything sent acknowledges nothing
+	if acked := sb.HandleACK(1000, []protocol.SACKBlock{{Start: 3, End: 1000}}); len(acked) != 0 {
+		t.Errorf("Expected a bogus ACK to be ignored, got %d packets", len(acked))
+	}
+}
+
+func TestSendBufferAckDelay(t *testing.T) {
+	sb := NewSendBuffer(256)
+
+	// The first sample is taken as it is
+	sb.updateRTO(50*time.Millisecond, 20*time.Millisecond)
+	if sb.SRTT() != 50*time.Millisecond || sb.MinRTT() != 50*time.Millisecond {
+		t.Fatalf("Expected SRTT 50ms, got %v", sb.SRTT())
+	}
+
+	// Later ones lose the time the peer held its ACK
+	sb.updateRTO(70*time.Millisecond, 20*time.Millisecond)
+	if sb.SRTT() != 50*time.Millisecond {
+		t.Errorf("Expected the ack delay to be taken out, got SRTT %v", sb.SRTT())
+	}
+
+	// But never below the smallest sample
+	sb.updateRTO(60*time.Millisecond, 20*time.Millisecond)
+	if want := (7*50*time.Millisecond + 60*time.Millisecond) / 8; sb.SRTT() != want {
+		t.Errorf("Expected SRTT %v, got %v", want, sb.SRTT())
+	}
+}
@@ -0,0 +1,398 @@
+package quantum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	guuid "github.com/Lzww0608/GUUID"
+	"github.com/aetherflow/aetherflow/internal/quantum/crypto"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// Session resumption lets a client that has talked to a server before skip
+// the handshake round trip. The server issues tickets over the encrypted
+// connection: an opaque blob sealed under the listener's ticket key, holding
+// a fresh resumption secret, the GUUID of the issuing connection and the
+// server's congestion control estimates, plus a copy of the secret for the client.
+//
+// A resuming client puts the ticket in its SYN after its public key and
+// seals packets sent before the SYN-ACK with 0-RTT keys derived from the
+// secret, so application data leaves with the first flight. A server that
+// accepts the ticket establishes the connection at once and mixes the
+// secret into the handshake keys; one that does not (expired, unknown key,
+// already used) runs a full handshake and the early packets are
+// retransmitted under the new keys. Each ticket is accepted once, which
+// keeps a replayed SYN and its 0-RTT data from being processed twice.
+
+const (
+	// DefaultTicketLifetime is how long a resumption ticket stays valid
+	DefaultTicketLifetime = 24 * time.Hour
+
+	// ticketStateSize is the size of the server state sealed in a ticket:
+	// GUUID, expiry, secret, bandwidth and RTT
+	ticketStateSize = 16 + 8 + crypto.SecretSize + 8 + 8
+
+	// ticketPurgeInterval is how often expired ticket IDs are forgotten
+	ticketPurgeInterval = 1 * time.Second
+
+	// maxUsedTickets bounds the redeemed ticket IDs a listener remembers.
+	// Once full, tickets are refused until some expire, so clients fall
+	// back to a full handshake rather than a ticket being accepted twice.
+	maxUsedTickets = 1 << 16
+)
+
+// Ticket is a resumption ticket held by a client, together with what the
+// client remembers about the connection it came from
+type Ticket struct {
+	Ticket  []byte    // Opaque ticket sealed by the server
+	Secret  []byte    // Resumption secret shared with the server
+	Expires time.Time // When the server stops accepting the ticket
+
+	// The client's own congestion control estimates, used to start the resumed connection
+	Bandwidth uint64        // Bottleneck bandwidth (bytes/sec)
+	RTT       time.Duration // Minimum RTT
+
+	// Connection the ticket was issued on, the wire version it spoke and
+	// whether the server chose a random ISN
+	from      guuid.UUID
+	version   uint8
+	randomISN bool
+}
+
+// TicketCache stores resumption tickets by server address. Set it as
+// Config.Tickets and share it between dials; each ticket is used once and
+// replaced by those the resumed connection receives.
+type TicketCache struct {
+	mu      sync.Mutex
+	tickets map[string]*Ticket
+}
+
+// NewTicketCache creates an empty ticket cache
+func NewTicketCache() *TicketCache {
+	return &TicketCache{
+		tickets: make(map[string]*Ticket),
+	}
+}
+
+// take removes and returns the ticket for a server, if a valid one is cached
+func (tc *TicketCache) take(server string) *Ticket {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	t, exists := tc.tickets[server]
+	delete(tc.tickets, server)
+	if !exists || time.Now().After(t.Expires) {
+		return nil
+	}
+	return t
+}
+
+// put stores the newest ticket for a server
+func (tc *TicketCache) put(server string, t *Ticket) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.tickets[server] = t
+}
+
+// remember updates the estimates kept with a server's ticket
+func (tc *TicketCache) remember(server string, bandwidth uint64, rtt time.Duration) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if t, exists := tc.tickets[server]; exists {
+		t.Bandwidth = bandwidth
+		t.RTT = rtt
+	}
+}
+
+// ticketState is the server state sealed in a ticket
+type ticketState struct {
+	guid      guuid.UUID
+	expires   time.Time
+	secret    []byte
+	bandwidth uint64
+	rtt       time.Duration
+}
+
+// marshal serializes the ticket state
+func (s *ticketState) marshal() []byte {
+	buf := make([]byte, ticketStateSize)
+	copy(buf[0:16], s.guid[:])
+	binary.BigEndian.PutUint64(buf[16:24], uint64(s.expires.UnixNano()))
+	copy(buf[24:24+crypto.SecretSize], s.secret)
+	off := 24 + crypto.SecretSize
+	binary.BigEndian.PutUint64(buf[off:off+8], s.bandwidth)
+	binary.BigEndian.PutUint64(buf[off+8:off+16], uint64(s.rtt))
+	return buf
+}
+
+// unmarshal deserializes the ticket state
+func (s *ticketState) unmarshal(data []byte) error {
+	if len(data) != ticketStateSize {
+		return fmt.Errorf("invalid ticket state size: %d", len(data))
+	}
+
+	copy(s.guid[:], data[0:16])
+	s.expires = time.Unix(0, int64(binary.BigEndian.Uint64(data[16:24])))
+	s.secret = append([]byte{}, data[24:24+crypto.SecretSize]...)
+	off := 24 + crypto.SecretSize
+	s.bandwidth = binary.BigEndian.Uint64(data[off : off+8])
+	s.rtt = time.Duration(binary.BigEndian.Uint64(data[off+8 : off+16]))
+
+	return nil
+}
+
+// ticketIssuer seals and redeems a listener's tickets. Redeemed ticket IDs
+// are kept until the tickets expire so none is accepted twice, up to
+// maxUsedTickets of them.
+type ticketIssuer struct {
+	key      *crypto.TicketKey
+	lifetime time.Duration
+
+	mu        sync.Mutex
+	used      map[[crypto.TicketIDSize]byte]time.Time
+	lastPurge time.Time
+}
+
+// newTicketIssuer creates a ticket issuer from a listener's configuration
+func newTicketIssuer(config *Config) (*ticketIssuer, error) {
+	key, err := crypto.NewTicketKey(config.TicketKey)
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime := config.TicketLifetime
+	if lifetime <= 0 {
+		lifetime = DefaultTicketLifetime
+	}
+
+	return &ticketIssuer{
+		key:       key,
+		lifetime:  lifetime,
+		used:      make(map[[crypto.TicketIDSize]byte]time.Time),
+		lastPurge: time.Now(),
+	}, nil
+}
+
+// issue seals ticket state, returning the ticket
+func (ti *ticketIssuer) issue(state *ticketState) ([]byte, error) {
+	state.expires = time.Now().Add(ti.lifetime)
+	return ti.key.Seal(state.marshal())
+}
+
+// redeem opens a ticket presented in a SYN. It returns nil for tickets that
+// are forged, expired or already used, and for any ticket while the used
+// set is full.
+func (ti *ticketIssuer) redeem(ticket []byte) *ticketState {
+	plaintext, err := ti.key.Open(ticket)
+	if err != nil {
+		return nil
+	}
+
+	state := &ticketState{}
+	if err := state.unmarshal(plaintext); err != nil {
+		return nil
+	}
+	if time.Now().After(state.expires) {
+		return nil
+	}
+
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+
+	id := crypto.TicketID(ticket)
+	if _, replayed := ti.used[id]; replayed || len(ti.used) >= maxUsedTickets {
+		return nil
+	}
+	ti.used[id] = state.expires
+
+	return state
+}
+
+// purge forgets used tickets that have expired anyway
+func (ti *ticketIssuer) purge(now time.Time) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+
+	if now.Sub(ti.lastPurge) < ticketPurgeInterval {
+		return
+	}
+	ti.lastPurge = now
+
+	for id, expires := range ti.used {
+		if now.After(expires) {
+			delete(ti.used, id)
+		}
+	}
+}
+
+// earlyContext binds 0-RTT keys to a connection and the client's key share
+func earlyContext(guid guuid.UUID, clientPublic []byte) []byte {
+	return append(append([]byte{}, guid[:]...), clientPublic...)
+}
+
+// connectEarly starts a resumed connection on the client side. Instead of
+// waiting for the SYN-ACK, the connection is usable at once: packets are
+// sealed with 0-RTT keys until readLoop completes the handshake.
+func (c *Connection) connectEarly(ticket *Ticket) error {
+	early, err := crypto.DeriveEarlySession(ticket.Secret, earlyContext(c.guid, c.kex.PublicKey()))
+	if err != nil {
+		return fmt.Errorf("failed to derive early keys: %w", err)
+	}
+	c.session.Store(early)
+	c.resumption = ticket
+	c.version = ticket.version
+
+	// 0-RTT data goes out before the SYN-ACK says how the server numbers
+	// packets, so servers predating random ISNs are sent ours from 1
+	if !ticket.randomISN {
+		c.setInitialSeqNum(1)
+	}
+
+	// Pick up where the previous connection left off
+	c.cc.Seed(ticket.Bandwidth, ticket.RTT)
+	c.sendBuf.SeedRTT(ticket.RTT)
+
+	c.handshakeStart = time.Now()
+	if err := c.sendResumeSyn(); err != nil {
+		return err
+	}
+
+	c.setState(StateEstablished)
+
+	return nil
+}
+
+// sendResumeSyn sends a SYN carrying our public key followed by the ticket
+func (c *Connection) sendResumeSyn() error {
+	offer := append(c.kex.PublicKey(), c.resumption.Ticket...)
+	syn := c.synPacket(offer)
+	if err := c.conn.Send(syn); err != nil {
+		return fmt.Errorf("failed to send SYN: %w", err)
+	}
+	c.synSentAt = time.Now()
+	return nil
+}
+
+// retryResumeSyn runs from reliabilityLoop, repeating a resuming SYN until
+// the server answers or the handshake times out
+func (c *Connection) retryResumeSyn() {
+	if c.resumption == nil || c.resumed.Load() {
+		return
+	}
+	if time.Since(c.synSentAt) < synRetryInterval || time.Since(c.handshakeStart) > DefaultHandshakeTimeout {
+		return
+	}
+	c.sendResumeSyn()
+}
+
+// completeResumption switches a resuming dialer from 0-RTT to handshake keys
+// when the SYN-ACK arrives. If the server ran a full handshake instead, the
+// keys are derived without the ticket's secret.
+func (c *Connection) completeResumption(packet *transport.Packet) {
+	if c.resumed.Load() {
+		return
+	}
+
+	accepted := true
+	if err := c.acceptSynAck(packet, c.resumption.Secret); err != nil {
+		accepted = false
+		if err := c.acceptSynAck(packet, nil); err != nil {
+			return
+		}
+	}
+
+	c.applyHandshake(packet.Header)
+
+	if accepted {
+		c.mu.Lock()
+		c.resumedFrom = c.resumption.from
+		c.resumedOK = true
+		c.mu.Unlock()
+	}
+	c.resumed.Store(true)
+
+	// Confirm the handshake keys; the server stops accepting 0-RTT keys
+	c.sendAck()
+}
+
+// resume sets up a listener-side connection from a redeemed ticket
+func (c *Connection) resume(state *ticketState, clientPublic []byte) error {
+	early, err := crypto.DeriveEarlySession(state.secret, earlyContext(c.guid, clientPublic))
+	if err != nil {
+		return err
+	}
+	c.early.Store(early)
+
+	c.resumedFrom = state.guid
+	c.resumedOK = true
+
+	c.cc.Seed(state.bandwidth, state.rtt)
+	c.sendBuf.SeedRTT(state.rtt)
+
+	return nil
+}
+
+// issueTicket sends the client a new resumption ticket carrying our current
+// estimates. Listener-side connections issue one when established and, if
+// that one carried no bandwidth estimate yet, a replacement from the first
+// keepalive that has one.
+func (c *Connection) issueTicket() {
+	if c.listener == nil || c.listener.tickets == nil || c.session.Load() == nil {
+		return
+	}
+	bandwidth := c.cc.Bandwidth()
+	c.ticketEstimates.Store(bandwidth > 0)
+
+	secret, err := crypto.NewSecret()
+	if err != nil {
+		return
+	}
+	ticket, err := c.listener.tickets.issue(&ticketState{
+		guid:      c.guid,
+		secret:    secret,
+		bandwidth: bandwidth,
+		rtt:       c.cc.MinRTT(),
+	})
+	if err != nil {
+		return
+	}
+
+	lifetime := uint32(c.listener.tickets.lifetime / time.Second)
+	data := make([]byte, 4, 4+len(secret)+len(ticket))
+	binary.BigEndian.PutUint32(data, lifetime)
+	data = append(data, secret...)
+	data = append(data, ticket...)
+
+	c.sendControl(protocol.ControlNewTicket, data, c.peerAddr())
+}
+
+// storeTicket keeps a ticket received from the server for the next dial
+func (c *Connection) storeTicket(data []byte) {
+	if c.listener != nil || c.config.Tickets == nil || len(data) <= 4+crypto.SecretSize {
+		return
+	}
+
+	lifetime := time.Duration(binary.BigEndian.Uint32(data[0:4])) * time.Second
+	c.config.Tickets.put(c.dialAddr, &Ticket{
+		Ticket:    append([]byte{}, data[4+crypto.SecretSize:]...),
+		Secret:    append([]byte{}, data[4:4+crypto.SecretSize]...),
+		Expires:   time.Now().Add(lifetime),
+		Bandwidth: c.cc.Bandwidth(),
+		RTT:       c.cc.MinRTT(),
+		from:      c.guid,
+		version:   c.version,
+		randomISN: c.randomISN.Load(),
+	})
+}
+
+// ResumedFrom returns the GUUID of the earlier connection whose ticket this
+// connection resumed, and whether it was resumed at all
+func (c *Connection) ResumedFrom() (guuid.UUID, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.resumedFrom, c.resumedOK
+}
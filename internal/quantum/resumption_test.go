@@ -0,0 +1,205 @@
+package quantum
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/crypto"
+)
+
+// waitTicket waits until the cache holds a ticket for server
+func waitTicket(t *testing.T, cache *TicketCache, server string) *Ticket {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		cache.mu.Lock()
+		ticket := cache.tickets[server]
+		cache.mu.Unlock()
+		if ticket != nil {
+			return ticket
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("No ticket received from %s", server)
+	return nil
+}
+
+// dialEarly dials with a cached ticket and sends data before accepting the
+// server side, returning both ends
+func dialEarly(t *testing.T, listener *Listener, config *Config, data []byte) (client, server *Connection) {
+	t.Helper()
+
+	client, err := Dial("udp", listener.Addr().String(), config)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	if err := client.Send(data); err != nil {
+		t.Fatalf("Failed to send before handshake: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	server, err = listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	got, err := server.ReceiveWithTimeout(2 * time.Second)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Expected %q, got %q (%v)", data, got, err)
+	}
+
+	return client, server
+}
+
+func TestSessionResumption(t *testing.T) {
+	config := encryptedConfig()
+	config.Tickets = NewTicketCache()
+	listener := newTestListener(t, config)
+	addr := listener.Addr().String()
+
+	first, _ := newTestPair(t, listener, addr, config)
+	waitTicket(t, config.Tickets, addr)
+	first.Close()
+
+	// The resumed connection is usable before the server has answered
+	client, server := dialEarly(t, listener, config, []byte("0-rtt"))
+
+	if from, ok := server.ResumedFrom(); !ok || from != first.GUID() {
+		t.Errorf("Expected server to resume from %v, got %v (%v)", first.GUID(), from, ok)
+	}
+
+	// Server to client traffic flows once the client has the SYN-ACK
+	if err := server.Send([]byte("reply")); err != nil {
+		t.Fatalf("Failed to send reply: %v", err)
+	}
+	data, err := client.ReceiveWithTimeout(2 * time.Second)
+	if err != nil || string(data) != "reply" {
+		t.Fatalf("Expected %q, got %q (%v)", "reply", data, err)
+	}
+	if from, ok := client.ResumedFrom(); !ok || from != first.GUID() {
+		t.Errorf("Expected client to resume from %v, got %v (%v)", first.GUID(), from, ok)
+	}
+
+	// The resumed connection issues a ticket for the next dial
+	if ticket := waitTicket(t, config.Tickets, addr); ticket.from != client.GUID() {
+		t.Errorf("Expected a ticket from %v, got one from %v", client.GUID(), ticket.from)
+	}
+}
+
+func TestSessionResumptionFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		// spoil makes the cached ticket unusable, returning the listener
+		// to present it to
+		spoil func(t *testing.T, config *Config, listener *Listener, ticket *Ticket) *Listener
+	}{
+		{
+			name: "Replayed",
+			spoil: func(t *testing.T, config *Config, listener *Listener, ticket *Ticket) *Listener {
+				replay := *ticket
+				dialEarly(t, listener, config, []byte("first use"))
+				waitTicket(t, config.Tickets, listener.Addr().String())
+				config.Tickets.put(listener.Addr().String(), &replay)
+				return listener
+			},
+		},
+		{
+			name: "UnknownKey",
+			spoil: func(t *testing.T, config *Config, listener *Listener, ticket *Ticket) *Listener {
+				other := newTestListener(t, config)
+				config.Tickets.put(other.Addr().String(), ticket)
+				return other
+			},
+		},
+		{
+			name:     "Expired",
+			lifetime: time.Second,
+			spoil: func(t *testing.T, config *Config, listener *Listener, ticket *Ticket) *Listener {
+				// The client still believes the ticket valid
+				config.Tickets.take(listener.Addr().String())
+				ticket.Expires = time.Now().Add(time.Hour)
+				config.Tickets.put(listener.Addr().String(), ticket)
+				time.Sleep(1100 * time.Millisecond)
+				return listener
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := encryptedConfig()
+			config.Tickets = NewTicketCache()
+			if tt.lifetime > 0 {
+				config.TicketLifetime = tt.lifetime
+			}
+			listener := newTestListener(t, config)
+
+			first, _ := newTestPair(t, listener, listener.Addr().String(), config)
+			ticket := waitTicket(t, config.Tickets, listener.Addr().String())
+			first.Close()
+
+			// The server runs a full handshake; 0-RTT data is retransmitted
+			// under the new keys
+			target := tt.spoil(t, config, listener, ticket)
+			client, server := dialEarly(t, target, config, []byte("retransmitted"))
+
+			if _, ok := server.ResumedFrom(); ok {
+				t.Error("Expected server not to resume")
+			}
+			if _, ok := client.ResumedFrom(); ok {
+				t.Error("Expected client not to resume")
+			}
+		})
+	}
+}
+
+func TestTicketIssuerBoundsUsedTickets(t *testing.T) {
+	issuer, err := newTicketIssuer(encryptedConfig())
+	if err != nil {
+		t.Fatalf("Failed to create ticket issuer: %v", err)
+	}
+
+	newTicket := func() []byte {
+		secret, _ := crypto.NewSecret()
+		ticket, err := issuer.issue(&ticketState{secret: secret})
+		if err != nil {
+			t.Fatalf("Failed to issue ticket: %v", err)
+		}
+		return ticket
+	}
+
+	// Fill the used set with tickets that have already expired
+	now := time.Now()
+	for i := 0; i < maxUsedTickets; i++ {
+		var id [crypto.TicketIDSize]byte
+		binary.BigEndian.PutUint32(id[:], uint32(i))
+		issuer.used[id] = now.Add(-time.Second)
+	}
+
+	// A full used set refuses even fresh tickets
+	ticket := newTicket()
+	if issuer.redeem(ticket) != nil {
+		t.Fatal("Expected ticket to be refused while the used set is full")
+	}
+
+	// Purging the expired IDs makes room again
+	issuer.purge(now.Add(ticketPurgeInterval))
+	if len(issuer.used) != 0 {
+		t.Fatalf("Expected expired ticket IDs purged, %d left", len(issuer.used))
+	}
+	if issuer.redeem(ticket) == nil {
+		t.Fatal("Expected ticket to be accepted after the purge")
+	}
+	if issuer.redeem(ticket) != nil {
+		t.Error("Expected ticket to be accepted only once")
+	}
+}
@@ -0,0 +1,147 @@
+package quantum
+
+import (
+	"fmt"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/crypto"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// seal returns a copy of an outgoing packet with its payload encrypted and
+// its header authenticated. The original is left untouched so retransmissions
+// are sealed afresh with a new nonce.
+func (c *Connection) seal(packet *transport.Packet) (*transport.Packet, error) {
+	header := *packet.Header
+	header.PayloadLength = uint16(len(packet.Payload) + crypto.Overhead)
+
+	aad, err := header.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal header: %w", err)
+	}
+
+	return &transport.Packet{
+		Header:  &header,
+		Payload: c.session.Load().Seal(aad, packet.Payload),
+		Addr:    packet.Addr,
+		ECN:     packet.ECN,
+	}, nil
+}
+
+// open authenticates and decrypts a received packet in place. Without a
+// session packets pass through unchanged. A resumed listener-side connection
+// also accepts the client's 0-RTT keys until a packet under the handshake
+// keys shows the client has switched.
+func (c *Connection) open(packet *transport.Packet) error {
+	session := c.session.Load()
+	if session == nil {
+		return nil
+	}
+
+	aad, err := packet.Header.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal header: %w", err)
+	}
+
+	plaintext, err := session.Open(aad, packet.Payload)
+	if err != nil {
+		early := c.early.Load()
+		if early == nil {
+			return err
+		}
+		if plaintext, err = early.Open(aad, packet.Payload); err != nil {
+			return err
+		}
+	} else if c.early.Load() != nil {
+		c.early.Store(nil)
+	}
+	packet.Payload = plaintext
+
+	return nil
+}
+
+// requiresEncryption reports whether peers that do not encrypt are refused
+// rather than served in plaintext
+func (c *Config) requiresEncryption() bool {
+	return c.Encryption && (!c.AllowPlaintext || len(c.PreSharedKey) > 0)
+}
+
+// deriveSession completes the key exchange with the peer's public key. When
+// resuming, the ticket's secret is mixed in alongside any pre-shared key.
+func (c *Connection) deriveSession(peerPublic, secret []byte, isClient bool) (*crypto.Session, error) {
+	if len(peerPublic) != crypto.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size: %d", len(peerPublic))
+	}
+
+	psk := c.config.PreSharedKey
+	if secret != nil {
+		psk = append(append([]byte{}, psk...), secret...)
+	}
+
+	return c.kex.DeriveSession(peerPublic, psk, c.guid[:], isClient)
+}
+
+// synAckPacket builds the server's SYN-ACK, carrying our ISN and
+// acknowledging the client's. When encrypting, it carries the server's
+// public key followed by a sealed empty payload confirming the keys.
+func (c *Connection) synAckPacket() (*transport.Packet, error) {
+	synAck := transport.NewPacket(c.guid, c.isn.Load(), c.recvBuf.NextExpected(), protocol.FlagSYN|protocol.FlagACK, nil)
+	synAck.Header.Version = c.version
+	synAck.Header.SetAckFrequency(c.config.AckFrequency)
+	session := c.session.Load()
+	if session == nil {
+		return synAck, nil
+	}
+
+	publicKey := c.kex.PublicKey()
+	synAck.Header.PayloadLength = uint16(len(publicKey) + crypto.Overhead)
+	aad, err := synAck.Header.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal header: %w", err)
+	}
+	synAck.Payload = append(publicKey, session.Seal(aad, nil)...)
+
+	return synAck, nil
+}
+
+// acceptSynAck derives the client's session from a SYN-ACK and verifies the
+// server's key confirmation. secret is the resumption secret of the ticket
+// the client presented, if any.
+func (c *Connection) acceptSynAck(packet *transport.Packet, secret []byte) error {
+	if len(packet.Payload) < crypto.PublicKeySize {
+		return fmt.Errorf("peer does not support encryption")
+	}
+
+	session, err := c.deriveSession(packet.Payload[:crypto.PublicKeySize], secret, true)
+	if err != nil {
+		return fmt.Errorf("key exchange failed: %w", err)
+	}
+
+	aad, err := packet.Header.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal header: %w", err)
+	}
+	if _, err := session.Open(aad, packet.Payload[crypto.PublicKeySize:]); err != nil {
+		return fmt.Errorf("handshake authentication failed (pre-shared key mismatch?): %w", err)
+	}
+	c.session.Store(session)
+
+	return nil
+}
+
+// sealOverhead returns the bytes sealing adds to each payload
+func (c *Connection) sealOverhead() int {
+	if c.session.Load() != nil {
+		return crypto.Overhead
+	}
+	return 0
+}
+
+// CryptoStats returns packet sealing statistics, or nil without encryption
+func (c *Connection) CryptoStats() map[string]uint64 {
+	session := c.session.Load()
+	if session == nil {
+		return nil
+	}
+	return session.Statistics()
+}
@@ -0,0 +1,214 @@
+package quantum
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// encryptedConfig returns the default configuration with encryption on
+func encryptedConfig() *Config {
+	config := DefaultConfig()
+	config.Encryption = true
+	return config
+}
+
+func TestEncryptedConnection(t *testing.T) {
+	config := encryptedConfig()
+	config.PreSharedKey = []byte("test pre-shared key")
+
+	listener := newTestListener(t, config)
+	client, server := newTestPair(t, listener, listener.Addr().String(), config)
+
+	if client.session.Load() == nil || server.session.Load() == nil {
+		t.Fatal("Expected both ends to derive a session")
+	}
+
+	if err := client.Send([]byte("secret")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	data, err := server.ReceiveWithTimeout(2 * time.Second)
+	if err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+	if string(data) != "secret" {
+		t.Errorf("Expected %q, got %q", "secret", string(data))
+	}
+
+	if stats := server.CryptoStats(); stats["opened"] == 0 {
+		t.Errorf("Expected server to open sealed packets, got %v", stats)
+	}
+}
+
+func TestEncryptionNegotiation(t *testing.T) {
+	plain := DefaultConfig()
+	fallback := encryptedConfig()
+	fallback.AllowPlaintext = true
+
+	tests := []struct {
+		name      string
+		server    *Config
+		client    *Config
+		encrypted bool
+	}{
+		{"both encrypting", encryptedConfig(), encryptedConfig(), true},
+		{"server without encryption", plain, fallback, false},
+		{"client without encryption", fallback, plain, false},
+		{"neither encrypting", plain, plain, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := newTestListener(t, tt.server)
+			client, server := newTestPair(t, listener, listener.Addr().String(), tt.client)
+
+			if got := client.session.Load() != nil; got != tt.encrypted {
+				t.Errorf("Expected client encrypted %v, got %v", tt.encrypted, got)
+			}
+			if got := server.session.Load() != nil; got != tt.encrypted {
+				t.Errorf("Expected server encrypted %v, got %v", tt.encrypted, got)
+			}
+
+			if err := client.Send([]byte("hello")); err != nil {
+				t.Fatalf("Failed to send: %v", err)
+			}
+			data, err := server.ReceiveWithTimeout(2 * time.Second)
+			if err != nil || string(data) != "hello" {
+				t.Fatalf("Expected %q, got %q (%v)", "hello", data, err)
+			}
+		})
+	}
+}
+
+func TestEncryptionHandshakeFailures(t *testing.T) {
+	withKey := func(key string) *Config {
+		config := encryptedConfig()
+		config.PreSharedKey = []byte(key)
+		return config
+	}
+	required := encryptedConfig()
+	plain := DefaultConfig()
+
+	tests := []struct {
+		name         string
+		server       *Config
+		client       *Config
+		wantErrorMsg string
+	}{
+		{"pre-shared key mismatch", withKey("server key"), withKey("client key"), "authentication failed"},
+		{"server without encryption", plain, required, "does not support encryption"},
+		{"client without encryption", required, plain, "connection refused"},
+		{"client without pre-shared key", withKey("server key"), plain, "connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := newTestListener(t, tt.server)
+
+			conn, err := Dial("udp", listener.Addr().String(), tt.client)
+			if err == nil {
+				conn.Close()
+				t.Fatal("Expected handshake to fail")
+			}
+			if !strings.Contains(err.Error(), tt.wantErrorMsg) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErrorMsg, err)
+			}
+		})
+	}
+}
+
+func TestEncryptionKeyShareStripped(t *testing.T) {
+	// strip drops the payload, the key share, of handshake packets with the
+	// given SYN and ACK flags
+	strip := func(flags protocol.Flags) func([]byte) []byte {
+		return func(data []byte) []byte {
+			header, payload, err := protocol.SplitPacket(data)
+			if err != nil || header.Flags&(protocol.FlagSYN|protocol.FlagACK) != flags || len(payload) == 0 {
+				return data
+			}
+			header.PayloadLength = 0
+			stripped, err := header.Marshal()
+			if err != nil {
+				return data
+			}
+			return stripped
+		}
+	}
+
+	tests := []struct {
+		name         string
+		strip        protocol.Flags
+		wantErrorMsg string
+	}{
+		{"SYN", protocol.FlagSYN, "connection refused"},
+		{"SYN-ACK", protocol.FlagSYN | protocol.FlagACK, "does not support encryption"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := encryptedConfig()
+			listener := newTestListener(t, config)
+			proxy := newMTUProxy(t, listener.Addr(), protocol.MaxPacketSize)
+			proxy.rewrite = strip(tt.strip)
+
+			// An on-path attacker cannot downgrade the connection to plaintext
+			conn, err := Dial("udp", proxy.Addr(), config)
+			if err == nil {
+				conn.Close()
+				t.Fatal("Expected handshake to fail")
+			}
+			if !strings.Contains(err.Error(), tt.wantErrorMsg) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErrorMsg, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedConnectionRejectsForgedPackets(t *testing.T) {
+	config := encryptedConfig()
+	listener := newTestListener(t, config)
+	client, server := newTestPair(t, listener, listener.Addr().String(), config)
+
+	// An off-path attacker who knows the GUUID forges data and a FIN
+	attacker, err := transport.Dial("udp", listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create attacker socket: %v", err)
+	}
+	defer attacker.Close()
+
+	forged := []*transport.Packet{
+		transport.NewPacket(client.GUID(), 1, 0, 0, []byte("forged data")),
+		transport.NewPacket(client.GUID(), 0, 0, protocol.FlagFIN, nil),
+		transport.NewPacket(client.GUID(), 0, 1000, protocol.FlagACK, nil),
+	}
+	for _, p := range forged {
+		if err := attacker.Send(p); err != nil {
+			t.Fatalf("Failed to send forged packet: %v", err)
+		}
+	}
+
+	if data, err := server.ReceiveWithTimeout(200 * time.Millisecond); err == nil {
+		t.Fatalf("Expected forged data to be dropped, got %q", data)
+	}
+	if stats := server.CryptoStats(); stats["rejected"] != uint64(len(forged)) {
+		t.Errorf("Expected %d rejected packets, got %v", len(forged), stats)
+	}
+
+	// The real connection is unaffected
+	if err := client.Send([]byte("genuine")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	data, err := server.ReceiveWithTimeout(2 * time.Second)
+	if err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+	if string(data) != "genuine" {
+		t.Errorf("Expected %q, got %q", "genuine", string(data))
+	}
+	if server.State() != StateEstablished {
+		t.Errorf("Expected connection to stay established, got %v", server.State())
+	}
+}
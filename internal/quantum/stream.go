@@ -0,0 +1,594 @@
+package quantum
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+const (
+	// streamCloseTimeout bounds how long Close waits to queue a stream's FIN
+	streamCloseTimeout = 5 * time.Second
+
+	// maxStreamOpenAhead limits how many streams a single frame may open
+	maxStreamOpenAhead = 256
+)
+
+// Stream is an independent, ordered byte stream multiplexed over a Connection.
+// Streams share the connection's packet sequence space, retransmission and
+// congestion control, but are reassembled separately: a lost packet only
+// stalls the stream whose frame it carried. Stream implements net.Conn.
+type Stream struct {
+	id   uint32
+	conn *Connection
+
+	// writeMu serializes writers so frame sequence numbers reach the send
+	// queue without gaps
+	writeMu sync.Mutex
+	sendSeq uint32
+
+	mu sync.Mutex
+
+	reasm     *frameReassembler
+	readBuf   bytes.Buffer
+	unread    []int // sizes of the data frames left in readBuf, for receive credit
+	remoteFin bool  // peer's FIN delivered in order
+	localFin  bool  // our FIN queued
+	writeShut bool  // CloseWrite called
+	closed    bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// Scheduling class of the stream's frames
+	priority Priority
+
+	// Signalled when data arrives, the stream closes or a deadline changes
+	readNotify  chan struct{}
+	writeNotify chan struct{}
+}
+
+// newStream creates a stream on a connection
+func newStream(c *Connection, id uint32) *Stream {
+	return &Stream{
+		id:          id,
+		conn:        c,
+		reasm:       newFrameReassembler(),
+		readNotify:  make(chan struct{}, 1),
+		writeNotify: make(chan struct{}, 1),
+	}
+}
+
+// ID returns the stream identifier
+func (s *Stream) ID() uint32 {
+	return s.id
+}
+
+// Read reads data from the stream. It returns io.EOF once the peer has
+// closed the stream and all of its data has been read.
+func (s *Stream) Read(b []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		switch {
+		case s.closed:
+			s.mu.Unlock()
+			return 0, net.ErrClosed
+		case !s.readDeadline.IsZero() && !time.Now().Before(s.readDeadline):
+			s.mu.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		case s.readBuf.Len() > 0:
+			n, _ := s.readBuf.Read(b)
+			credit := s.consume(n)
+			s.mu.Unlock()
+			s.conn.consumed(credit)
+			return n, nil
+		case s.remoteFin:
+			s.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline := s.readDeadline
+		s.mu.Unlock()
+
+		if err := s.wait(s.readNotify, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write writes data to the stream, splitting it into frames that fit a packet
+func (s *Stream) Write(b []byte) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	maxData := s.conn.maxFrameData()
+
+	written := 0
+	for written < len(b) {
+		n := len(b) - written
+		if n > maxData {
+			n = maxData
+		}
+
+		frame := &protocol.StreamFrame{
+			StreamID: s.id,
+			Sequence: s.sendSeq,
+			Data:     b[written : written+n],
+		}
+		if err := s.enqueue(frame); err != nil {
+			return written, err
+		}
+		s.sendSeq++
+		written += n
+	}
+
+	return written, nil
+}
+
+// enqueue queues a frame for sending, blocking while the send queue is full.
+// Data frames are bounded by the write deadline; the FIN by streamCloseTimeout.
+func (s *Stream) enqueue(frame *protocol.StreamFrame) error {
+	isFin := frame.HasFlag(protocol.FrameFIN)
+	o := &outgoing{packet: transport.NewPacket(s.conn.guid, 0, 0, 0, frame.Marshal())}
+
+	finDeadline := time.Now().Add(streamCloseTimeout)
+	for {
+		s.mu.Lock()
+		deadline, closed := s.writeDeadline, s.closed || s.writeShut
+		queue := s.conn.sched.queue(s.priority)
+		s.mu.Unlock()
+
+		if isFin {
+			deadline = finDeadline
+		} else if closed {
+			return net.ErrClosed
+		}
+
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return os.ErrDeadlineExceeded
+		}
+
+		// Fast path: room in the send queue
+		o.queuedAt = time.Now()
+		s.conn.unsent.Add(1)
+		select {
+		case queue <- o:
+			return nil
+		default:
+		}
+
+		// Wait for room; the deadline itself is re-checked on wake-up
+		err := s.waitSend(queue, o, deadline)
+		if err == nil {
+			return nil
+		}
+		s.conn.unsent.Add(-1)
+		if err != errStreamWake {
+			return err
+		}
+	}
+}
+
+// errStreamWake reports that a blocked write was woken to re-check its state
+var errStreamWake = fmt.Errorf("stream woken")
+
+// waitSend blocks until the packet is queued, the deadline passes, the
+// connection closes or the stream is woken
+func (s *Stream) waitSend(queue chan<- *outgoing, o *outgoing, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case queue <- o:
+		return nil
+	case <-s.writeNotify:
+		return errStreamWake
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-s.conn.closeSignal:
+		return net.ErrClosed
+	}
+}
+
+// wait blocks until ch is signalled, the deadline passes or the connection closes
+func (s *Stream) wait(ch <-chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-s.conn.closeSignal:
+		return net.ErrClosed
+	}
+}
+
+// consume accounts for n bytes read from readBuf and returns the number of
+// frames read completely, whose receive credit can be returned
+func (s *Stream) consume(n int) int {
+	frames := 0
+	for n > 0 && len(s.unread) > 0 {
+		if s.unread[0] > n {
+			s.unread[0] -= n
+			break
+		}
+		n -= s.unread[0]
+		s.unread = s.unread[1:]
+		frames++
+	}
+	return frames
+}
+
+// receive reassembles an incoming frame and makes in-order data readable.
+// Frames that leave nothing to read return their receive credit at once.
+func (s *Stream) receive(frame *protocol.StreamFrame) {
+	credit := 0
+
+	s.mu.Lock()
+	for _, f := range s.reasm.push(frame) {
+		// Data for a locally closed stream is acknowledged but discarded
+		if !s.closed && len(f.Data) > 0 {
+			s.readBuf.Write(f.Data)
+			s.unread = append(s.unread, len(f.Data))
+		} else {
+			credit++
+		}
+		if f.HasFlag(protocol.FrameFIN) {
+			s.remoteFin = true
+		}
+	}
+	done := s.remoteFin && s.localFin
+	s.mu.Unlock()
+
+	s.conn.consumed(credit)
+
+	notify(s.readNotify)
+
+	if done {
+		s.conn.removeStream(s.id)
+	}
+}
+
+// Close sends FIN to the peer and stops reading. Pending writes are
+// abandoned; data already queued is still delivered.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.readBuf.Reset()
+	credit := len(s.unread)
+	s.unread = nil
+	s.mu.Unlock()
+
+	s.conn.consumed(credit)
+
+	// Wake blocked readers and writers
+	notify(s.readNotify)
+	notify(s.writeNotify)
+
+	return s.finish()
+}
+
+// CloseWrite sends FIN to the peer, which reads io.EOF once it has received
+// all data, while the stream stays open for reading
+func (s *Stream) CloseWrite() error {
+	s.mu.Lock()
+	if s.closed || s.writeShut {
+		s.mu.Unlock()
+		return nil
+	}
+	s.writeShut = true
+	s.mu.Unlock()
+
+	// Wake blocked writers
+	notify(s.writeNotify)
+
+	return s.finish()
+}
+
+// finish queues the stream's FIN once, after any data already written
+func (s *Stream) finish() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	sent := s.localFin
+	s.mu.Unlock()
+	if sent {
+		return nil
+	}
+
+	fin := &protocol.StreamFrame{
+		StreamID: s.id,
+		Sequence: s.sendSeq,
+		Flags:    protocol.FrameFIN,
+	}
+	if err := s.enqueue(fin); err != nil {
+		return fmt.Errorf("failed to send FIN: %w", err)
+	}
+	s.sendSeq++
+
+	s.mu.Lock()
+	s.localFin = true
+	done := s.remoteFin
+	s.mu.Unlock()
+
+	if done {
+		s.conn.removeStream(s.id)
+	}
+
+	return nil
+}
+
+// LocalAddr returns the local network address
+func (s *Stream) LocalAddr() net.Addr {
+	return s.conn.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address
+func (s *Stream) RemoteAddr() net.Addr {
+	return s.conn.peerAddr()
+}
+
+// SetDeadline sets the read and write deadlines
+func (s *Stream) SetDeadline(t time.Time) error {
+	s.SetReadDeadline(t)
+	s.SetWriteDeadline(t)
+	return nil
+}
+
+// SetReadDeadline sets the deadline for future and pending Read calls
+func (s *Stream) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.readDeadline = t
+	s.mu.Unlock()
+	notify(s.readNotify)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future and pending Write calls
+func (s *Stream) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.writeDeadline = t
+	s.mu.Unlock()
+	notify(s.writeNotify)
+	return nil
+}
+
+// SetPriority sets the scheduling class of data written from now on
+func (s *Stream) SetPriority(p Priority) {
+	s.mu.Lock()
+	s.priority = p
+	s.mu.Unlock()
+}
+
+// notify signals a capacity-1 channel without blocking
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// frameReassembler restores the order of one stream's frames
+type frameReassembler struct {
+	next    uint32
+	pending map[uint32]*protocol.StreamFrame
+}
+
+// newFrameReassembler creates a reassembler expecting sequence 0
+func newFrameReassembler() *frameReassembler {
+	return &frameReassembler{
+		pending: make(map[uint32]*protocol.StreamFrame),
+	}
+}
+
+// push adds a frame and returns the frames that are now in order
+func (r *frameReassembler) push(frame *protocol.StreamFrame) []*protocol.StreamFrame {
+	// Frame sequences wrap like packet sequences (though they do use zero),
+	// so a long-lived stream compares them with serial arithmetic
+	if protocol.SeqLess(frame.Sequence, r.next) {
+		return nil // Duplicate
+	}
+	if _, exists := r.pending[frame.Sequence]; exists {
+		return nil
+	}
+	r.pending[frame.Sequence] = frame
+
+	var ordered []*protocol.StreamFrame
+	for {
+		f, exists := r.pending[r.next]
+		if !exists {
+			break
+		}
+		delete(r.pending, r.next)
+		ordered = append(ordered, f)
+		r.next++
+	}
+	return ordered
+}
+
+// OpenStream opens a new stream to the peer. The stream is announced with an
+// empty frame, so the peer's AcceptStream returns it before any data is written.
+func (c *Connection) OpenStream() (*Stream, error) {
+	c.mu.RLock()
+	if c.state != StateEstablished {
+		c.mu.RUnlock()
+		return nil, fmt.Errorf("connection not established")
+	}
+	c.mu.RUnlock()
+
+	c.streamMu.Lock()
+
+	// Dialers use odd stream IDs and listener-side connections even ones,
+	// so both ends can open streams without coordination
+	if c.nextStreamID == 0 {
+		c.nextStreamID = 1
+		if c.listener != nil {
+			c.nextStreamID = 2
+		}
+	}
+
+	if c.nextStreamID >= protocol.ControlStreamID-1 {
+		c.streamMu.Unlock()
+		return nil, fmt.Errorf("stream IDs exhausted")
+	}
+
+	s := newStream(c, c.nextStreamID)
+	c.streams[s.id] = s
+	c.nextStreamID += 2
+
+	c.streamMu.Unlock()
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.enqueue(&protocol.StreamFrame{StreamID: s.id}); err != nil {
+		c.removeStream(s.id)
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	s.sendSeq++
+
+	return s, nil
+}
+
+// AcceptStream waits for and returns the next stream opened by the peer
+func (c *Connection) AcceptStream(ctx context.Context) (*Stream, error) {
+	for {
+		c.streamMu.Lock()
+		if len(c.acceptStreams) > 0 {
+			s := c.acceptStreams[0]
+			c.acceptStreams = c.acceptStreams[1:]
+			c.streamMu.Unlock()
+			return s, nil
+		}
+		c.streamMu.Unlock()
+
+		select {
+		case <-c.streamAccepted:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.closeSignal:
+			return nil, fmt.Errorf("connection closed")
+		}
+	}
+}
+
+// dispatchFrame routes the stream frame in a received data payload. Frames
+// on the default stream become Receive messages; the first frame of an
+// unknown peer stream opens it for AcceptStream. Each frame holds one packet
+// of receive credit until the application consumes it.
+func (c *Connection) dispatchFrame(payload []byte) {
+	c.pendingRecv.Add(1)
+
+	frame := &protocol.StreamFrame{}
+	if err := frame.Unmarshal(payload); err != nil {
+		c.consumed(1)
+		return
+	}
+
+	if frame.StreamID == protocol.DefaultStreamID {
+		// Only recvLoop touches the default stream's reassembler. Receive
+		// credit keeps the queue from filling; should a peer ignore it,
+		// wait for the application rather than drop acknowledged data.
+		for _, f := range c.defaultReasm.push(frame) {
+			select {
+			case c.recvQueue <- f.Data:
+			case <-c.closeSignal:
+				return
+			}
+		}
+		return
+	}
+
+	if s := c.peerStream(frame.StreamID); s != nil {
+		s.receive(frame)
+	} else {
+		c.consumed(1)
+	}
+}
+
+// peerStream looks up a stream for an incoming frame, creating it if the peer
+// is opening it. It returns nil for streams that have already finished.
+func (c *Connection) peerStream(id uint32) *Stream {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+
+	if s, exists := c.streams[id]; exists {
+		return s
+	}
+
+	// Dialers open odd stream IDs, listener-side connections even ones
+	first := uint32(2)
+	if c.listener != nil {
+		first = 1
+	}
+	if id%2 != first%2 || id <= c.maxPeerStream {
+		// One of ours, or a peer stream that has already finished
+		return nil
+	}
+
+	// Peers open streams in increasing ID order, so a frame for a new ID
+	// implicitly opens any lower ones whose first frame was lost or reordered
+	next := first
+	if c.maxPeerStream != 0 {
+		next = c.maxPeerStream + 2
+	}
+	if (id-next)/2 >= maxStreamOpenAhead {
+		return nil
+	}
+
+	var s *Stream
+	for ; next <= id; next += 2 {
+		s = newStream(c, next)
+		c.streams[next] = s
+		c.acceptStreams = append(c.acceptStreams, s)
+	}
+	c.maxPeerStream = id
+	notify(c.streamAccepted)
+
+	return s
+}
+
+// removeStream forgets a stream once both directions have finished
+func (c *Connection) removeStream(id uint32) {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	delete(c.streams, id)
+}
+
+// StreamCount returns the number of open streams, excluding the default stream
+func (c *Connection) StreamCount() int {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	return len(c.streams)
+}
+
+// maxFrameData returns the largest amount of stream data a single packet carries
+func (c *Connection) maxFrameData() int {
+	return c.maxPayloadSize() - protocol.StreamFrameHeaderSize
+}
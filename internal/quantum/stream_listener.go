@@ -0,0 +1,195 @@
+package quantum
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// StreamListener adapts a Listener to net.Listener so stream-oriented
+// servers such as grpc.Server can serve over Quantum. Every stream a peer
+// opens is returned by Accept as a net.Conn. A connection is closed once the
+// last of its accepted streams is closed.
+type StreamListener struct {
+	listener *Listener
+
+	mu     sync.Mutex
+	conns  map[*Connection]int // Open accepted streams per connection
+	closed bool
+
+	accepted chan *listenerStream
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// ListenStreams creates a StreamListener accepting Quantum connections on an address
+func ListenStreams(network, address string, config *Config) (*StreamListener, error) {
+	l, err := Listen(network, address, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamListener(l), nil
+}
+
+// NewStreamListener wraps a Listener. The StreamListener takes ownership of
+// it and closes it once Close was called and all accepted streams are closed.
+func NewStreamListener(l *Listener) *StreamListener {
+	ctx, cancel := context.WithCancel(context.Background())
+	sl := &StreamListener{
+		listener: l,
+		conns:    make(map[*Connection]int),
+		accepted: make(chan *listenerStream),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	sl.wg.Add(1)
+	go sl.acceptLoop()
+
+	return sl
+}
+
+// acceptLoop accepts connections and starts accepting streams on each
+func (sl *StreamListener) acceptLoop() {
+	defer sl.wg.Done()
+
+	for {
+		c, err := sl.listener.Accept(sl.ctx)
+		if err != nil {
+			return
+		}
+
+		sl.mu.Lock()
+		if sl.closed {
+			sl.mu.Unlock()
+			c.Close()
+			return
+		}
+		sl.conns[c] = 0
+		sl.mu.Unlock()
+
+		sl.wg.Add(1)
+		go sl.acceptStreams(c)
+	}
+}
+
+// acceptStreams hands the streams a peer opens on c to Accept
+func (sl *StreamListener) acceptStreams(c *Connection) {
+	defer sl.wg.Done()
+
+	for {
+		s, err := c.AcceptStream(sl.ctx)
+		if err != nil {
+			// Close the connection unless accepted streams still use it
+			sl.release(c, false)
+			return
+		}
+
+		sl.mu.Lock()
+		sl.conns[c]++
+		sl.mu.Unlock()
+
+		select {
+		case sl.accepted <- &listenerStream{Stream: s, listener: sl, conn: c}:
+		case <-sl.ctx.Done():
+			s.Close()
+			sl.release(c, true)
+			return
+		}
+	}
+}
+
+// release drops one accepted stream of c if stream is set, and closes c once
+// none remain. The underlying Listener is closed after the last connection
+// when the StreamListener is closed.
+func (sl *StreamListener) release(c *Connection, stream bool) {
+	sl.mu.Lock()
+	n, ok := sl.conns[c]
+	if !ok {
+		sl.mu.Unlock()
+		return
+	}
+	if stream {
+		n--
+		sl.conns[c] = n
+	}
+	if n > 0 {
+		sl.mu.Unlock()
+		return
+	}
+	delete(sl.conns, c)
+	closeListener := sl.closed && len(sl.conns) == 0
+	sl.mu.Unlock()
+
+	// Let the peer acknowledge the final data and FINs before closing
+	ctx, cancel := context.WithTimeout(context.Background(), streamCloseTimeout)
+	c.Flush(ctx)
+	cancel()
+	c.Close()
+
+	if closeListener {
+		sl.listener.Close()
+	}
+}
+
+// Accept waits for and returns the next stream opened by a peer
+func (sl *StreamListener) Accept() (net.Conn, error) {
+	select {
+	case s := <-sl.accepted:
+		return s, nil
+	case <-sl.ctx.Done():
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting streams. Streams already accepted keep working, and
+// the underlying Listener is closed once they are all closed.
+func (sl *StreamListener) Close() error {
+	sl.mu.Lock()
+	if sl.closed {
+		sl.mu.Unlock()
+		return nil
+	}
+	sl.closed = true
+	sl.mu.Unlock()
+
+	sl.cancel()
+	sl.wg.Wait()
+
+	sl.mu.Lock()
+	closeListener := len(sl.conns) == 0
+	sl.mu.Unlock()
+
+	if closeListener {
+		return sl.listener.Close()
+	}
+	return nil
+}
+
+// Addr returns the listener's local address
+func (sl *StreamListener) Addr() net.Addr {
+	return sl.listener.Addr()
+}
+
+// listenerStream is a stream returned by StreamListener.Accept
+type listenerStream struct {
+	*Stream
+
+	listener  *StreamListener
+	conn      *Connection
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Close closes the stream, and its connection if it was the last stream
+// accepted on it
+func (s *listenerStream) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.Stream.Close()
+		s.listener.release(s.conn, true)
+	})
+	return s.closeErr
+}
+
+var _ net.Listener = (*StreamListener)(nil)
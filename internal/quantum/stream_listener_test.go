@@ -0,0 +1,118 @@
+package quantum
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStreamListenerAcceptsStreams(t *testing.T) {
+	listener := newTestListener(t, nil)
+	sl := NewStreamListener(listener)
+	defer sl.Close()
+
+	// Echo every accepted stream until the peer closes it
+	go func() {
+		for {
+			conn, err := sl.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}(conn)
+		}
+	}()
+
+	const numPeers = 2
+	for i := 0; i < numPeers; i++ {
+		client, err := Dial("udp", sl.Addr().String(), nil)
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		defer client.Close()
+
+		stream, err := client.OpenStream()
+		if err != nil {
+			t.Fatalf("Failed to open stream: %v", err)
+		}
+		stream.SetDeadline(time.Now().Add(5 * time.Second))
+
+		msg := []byte("hello stream listener")
+		if _, err := stream.Write(msg); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			t.Fatalf("Failed to read echo: %v", err)
+		}
+		if string(buf) != string(msg) {
+			t.Errorf("Expected %q, got %q", msg, buf)
+		}
+
+		// The server closes its end, and then the connection, once we finish writing
+		stream.CloseWrite()
+		if _, err := stream.Read(buf); err != io.EOF {
+			t.Fatalf("Expected EOF after the server closed, got %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for listener.ConnectionCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected server connections to close, %d remain", listener.ConnectionCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamListenerCloseKeepsAcceptedStreams(t *testing.T) {
+	listener := newTestListener(t, nil)
+	sl := NewStreamListener(listener)
+
+	client, err := Dial("udp", sl.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	stream, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	server, err := sl.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	if err := sl.Close(); err != nil {
+		t.Fatalf("Failed to close listener: %v", err)
+	}
+	if _, err := sl.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed after Close, got %v", err)
+	}
+
+	// The accepted stream outlives the listener, like a TCP connection
+	stream.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := stream.Write([]byte("still here")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	buf := make([]byte, len("still here"))
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("Failed to read after listener close: %v", err)
+	}
+
+	// Closing the last stream releases the socket
+	server.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for listener.ConnectionCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the connection to close with its last stream")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
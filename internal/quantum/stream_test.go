@@ -0,0 +1,306 @@
+package quantum
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+// Stream must satisfy net.Conn
+var _ net.Conn = (*Stream)(nil)
+
+// newTestPair dials a listener and returns both ends of the connection
+func newTestPair(t *testing.T, listener *Listener, addr string, config *Config) (client, server *Connection) {
+	t.Helper()
+
+	client, err := Dial("udp", addr, config)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	server, err = listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+
+	return client, server
+}
+
+func TestFrameReassembler(t *testing.T) {
+	r := newFrameReassembler()
+	frame := func(seq uint32) *protocol.StreamFrame {
+		return &protocol.StreamFrame{Sequence: seq}
+	}
+
+	if got := r.push(frame(1)); len(got) != 0 {
+		t.Fatalf("Expected out-of-order frame to be held, got %d frames", len(got))
+	}
+	if got := r.push(frame(2)); len(got) != 0 {
+		t.Fatalf("Expected out-of-order frame to be held, got %d frames", len(got))
+	}
+
+	got := r.push(frame(0))
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 frames in order, got %d", len(got))
+	}
+	for i, f := range got {
+		if f.Sequence != uint32(i) {
+			t.Errorf("Frame %d has sequence %d", i, f.Sequence)
+		}
+	}
+
+	if got := r.push(frame(1)); len(got) != 0 {
+		t.Errorf("Expected duplicate to be dropped, got %d frames", len(got))
+	}
+
+	// Across the wrap, frames after the last sequence are held, not dropped
+	r = newFrameReassembler()
+	r.next = 0xFFFFFFFE
+	if got := r.push(frame(0)); len(got) != 0 {
+		t.Fatalf("Expected frame after the wrap to be held, got %d frames", len(got))
+	}
+	if got := r.push(frame(0xFFFFFFFE)); len(got) != 1 {
+		t.Fatalf("Expected 1 frame in order, got %d", len(got))
+	}
+	if got := r.push(frame(0xFFFFFFFF)); len(got) != 2 || got[1].Sequence != 0 {
+		t.Fatalf("Expected frames to continue through the wrap, got %d", len(got))
+	}
+	if got := r.push(frame(0xFFFFFFFD)); len(got) != 0 {
+		t.Errorf("Expected frame before the wrap to be dropped, got %d frames", len(got))
+	}
+}
+
+func TestStreamsOpenAndAccept(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, server := newTestPair(t, listener, listener.Addr().String(), nil)
+
+	// Echo every accepted stream until the peer closes it
+	go func() {
+		for {
+			s, err := server.AcceptStream(context.Background())
+			if err != nil {
+				return
+			}
+			go func(s *Stream) {
+				io.Copy(s, s)
+				s.Close()
+			}(s)
+		}
+	}()
+
+	// Larger than one packet, so writes are segmented
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+
+	const numStreams = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, numStreams)
+	for i := 0; i < numStreams; i++ {
+		s, err := client.OpenStream()
+		if err != nil {
+			t.Fatalf("Failed to open stream: %v", err)
+		}
+
+		wg.Add(1)
+		go func(s *Stream) {
+			defer wg.Done()
+			s.SetDeadline(time.Now().Add(10 * time.Second))
+
+			if _, err := s.Write(payload); err != nil {
+				errs <- err
+				return
+			}
+
+			got := make([]byte, len(payload))
+			if _, err := io.ReadFull(s, got); err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(got, payload) {
+				errs <- errors.New("echoed data mismatch")
+			}
+			s.Close()
+		}(s)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Messages on the default stream are unaffected by open streams
+	if err := client.Send([]byte("default")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	data, err := server.ReceiveWithTimeout(2 * time.Second)
+	if err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+	if string(data) != "default" {
+		t.Errorf("Expected %q, got %q", "default", string(data))
+	}
+}
+
+func TestStreamEOFAfterPeerClose(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, server := newTestPair(t, listener, listener.Addr().String(), nil)
+
+	s, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	if _, err := s.Write([]byte("last words")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Failed to close stream: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	peer, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept stream: %v", err)
+	}
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	data, err := io.ReadAll(peer)
+	if err != nil {
+		t.Fatalf("Expected clean EOF, got %v", err)
+	}
+	if string(data) != "last words" {
+		t.Errorf("Expected %q, got %q", "last words", string(data))
+	}
+
+	// Closing our side finishes the stream on both ends
+	peer.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for (client.StreamCount() != 0 || server.StreamCount() != 0) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.StreamCount() != 0 || server.StreamCount() != 0 {
+		t.Errorf("Expected finished streams to be removed, got %d client and %d server",
+			client.StreamCount(), server.StreamCount())
+	}
+}
+
+func TestStreamReadDeadline(t *testing.T) {
+	listener := newTestListener(t, nil)
+	client, _ := newTestPair(t, listener, listener.Addr().String(), nil)
+
+	s, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+
+	s.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := s.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected os.ErrDeadlineExceeded, got %v", err)
+	}
+
+	// Moving the deadline into the past unblocks a pending Read
+	s.SetReadDeadline(time.Time{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.SetReadDeadline(time.Now())
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("Expected os.ErrDeadlineExceeded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Read was not unblocked by the new deadline")
+	}
+}
+
+func TestStreamLossStallsOnlyItsOwnStream(t *testing.T) {
+	config := DefaultConfig()
+	config.FECEnabled = false
+
+	listener := newTestListener(t, config)
+
+	// Drop the first data packet, which announces stream A
+	var once sync.Once
+	proxy := newLossyProxy(t, listener.Addr(), func(h *protocol.Header) bool {
+		if h.Flags != 0 {
+			return false // Handshake packets
+		}
+		drop := false
+		once.Do(func() { drop = true })
+		return drop
+	})
+
+	client, server := newTestPair(t, listener, proxy.Addr(), config)
+
+	a, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("Failed to open stream A: %v", err)
+	}
+	b, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("Failed to open stream B: %v", err)
+	}
+
+	if _, err := a.Write([]byte("stream A")); err != nil {
+		t.Fatalf("Failed to write to stream A: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := b.Write([]byte("stream B")); err != nil {
+		t.Fatalf("Failed to write to stream B: %v", err)
+	}
+
+	// Both streams are accepted, but A's data waits behind its lost
+	// announcement until that packet is retransmitted
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	streams := make(map[uint32]*Stream)
+	for len(streams) < 2 {
+		s, err := server.AcceptStream(ctx)
+		if err != nil {
+			t.Fatalf("Failed to accept streams: %v", err)
+		}
+		streams[s.ID()] = s
+	}
+
+	buf := make([]byte, 64)
+
+	// Stream B is readable well before A's retransmission timeout
+	streams[b.ID()].SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	n, err := streams[b.ID()].Read(buf)
+	if err != nil {
+		t.Fatalf("Stream B was held back by loss on stream A: %v", err)
+	}
+	if string(buf[:n]) != "stream B" {
+		t.Errorf("Expected %q, got %q", "stream B", string(buf[:n]))
+	}
+
+	// Stream A completes once its packet is retransmitted
+	streams[a.ID()].SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err = streams[a.ID()].Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read stream A: %v", err)
+	}
+	if string(buf[:n]) != "stream A" {
+		t.Errorf("Expected %q, got %q", "stream A", string(buf[:n]))
+	}
+
+	if client.Statistics().Retransmissions == 0 {
+		t.Error("Expected stream A's packet to be retransmitted")
+	}
+}
@@ -0,0 +1,268 @@
+package quantum
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/bbr"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"github.com/aetherflow/aetherflow/internal/quantum/qlog"
+	"github.com/aetherflow/aetherflow/internal/quantum/reliability"
+	"github.com/aetherflow/aetherflow/internal/quantum/transport"
+)
+
+// A connection configured with Config.Qlog records a qlog trace: packets
+// sent, received, acknowledged and lost, every RTT sample, congestion state,
+// window and pacing rate changes, FEC recoveries, ECN validation and
+// connection state transitions. Congestion control has no hooks of its own,
+// so its state is compared with the last one traced after every ACK and
+// loss.
+
+// tracer records a connection's events to its qlog sink
+type tracer struct {
+	sink      qlog.Sink
+	reference time.Time
+
+	mu     sync.Mutex
+	closed bool
+
+	// Congestion control values last traced
+	ccState string
+	cwnd    uint32
+	pacing  uint64
+}
+
+// record adds an event to the trace
+func (t *tracer) record(name string, data any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.sink.Record(qlog.Event{Time: time.Since(t.reference), Name: name, Data: data})
+	}
+}
+
+// rttUpdated traces an RTT sample and the estimates it updated
+func (t *tracer) rttUpdated(u reliability.RTTUpdate) {
+	t.record(qlog.EventMetricsUpdated, qlog.MetricsUpdated{
+		LatestRTT:   qlog.Milliseconds(u.Latest),
+		SmoothedRTT: qlog.Milliseconds(u.Smoothed),
+		RTTVariance: qlog.Milliseconds(u.Variance),
+		RTO:         qlog.Milliseconds(u.RTO),
+	})
+}
+
+// startTrace opens the connection's trace if Config.Qlog is set. It must be
+// called before the connection starts its goroutines.
+func (c *Connection) startTrace() {
+	if c.config.Qlog == nil {
+		return
+	}
+
+	vantage := qlog.VantageClient
+	if c.listener != nil {
+		vantage = qlog.VantageServer
+	}
+	info := qlog.TraceInfo{
+		ODCID:         c.guid.String(),
+		VantagePoint:  vantage,
+		ReferenceTime: time.Now(),
+	}
+	sink := c.config.Qlog(info)
+	if sink == nil {
+		return
+	}
+
+	c.tracer = &tracer{sink: sink, reference: info.ReferenceTime}
+	c.sendBuf.SetRTTObserver(c.observeRTT)
+	c.traceCongestion()
+}
+
+// stopTrace closes the connection's trace
+func (c *Connection) stopTrace() {
+	if c.tracer == nil {
+		return
+	}
+	c.tracer.mu.Lock()
+	defer c.tracer.mu.Unlock()
+	if !c.tracer.closed {
+		c.tracer.closed = true
+		c.tracer.sink.Close()
+	}
+}
+
+// tracePacket traces a packet sent or received. wire is the packet as it
+// went on the wire, sealed when encrypting.
+func (c *Connection) tracePacket(name string, packet, wire *transport.Packet) {
+	if c.tracer == nil {
+		return
+	}
+	c.tracer.record(name, qlog.PacketEvent{
+		Header: packetHeader(packet.Header),
+		Raw: qlog.RawInfo{
+			Length:        wire.Header.Size() + len(wire.Payload),
+			PayloadLength: len(wire.Payload),
+		},
+		Frames: c.packetFrames(name, packet, wire),
+	})
+}
+
+// traceAcked traces packets newly acknowledged
+func (c *Connection) traceAcked(acked []*reliability.SentPacket) {
+	if c.tracer == nil {
+		return
+	}
+	for _, pkt := range acked {
+		c.tracer.record(qlog.EventPacketAcked, qlog.PacketAcked{Header: packetHeader(pkt.Packet.Header)})
+	}
+}
+
+// traceLost traces packets detected as lost
+func (c *Connection) traceLost(packets []*transport.Packet, trigger string) {
+	if c.tracer == nil {
+		return
+	}
+	for _, packet := range packets {
+		c.tracer.record(qlog.EventPacketLost, qlog.PacketLost{Header: packetHeader(packet.Header), Trigger: trigger})
+	}
+}
+
+// traceRecovered traces a data packet rebuilt by FEC
+func (c *Connection) traceRecovered(packet *transport.Packet) {
+	if c.tracer == nil {
+		return
+	}
+	c.tracer.record(qlog.EventFECRecovered, qlog.FECRecovered{
+		GroupID:      packet.Header.FECGroupID,
+		PacketNumber: packet.Header.SequenceNumber,
+	})
+}
+
+// traceState traces a connection state transition
+func (c *Connection) traceState(from, to State) {
+	if c.tracer == nil {
+		return
+	}
+	c.tracer.record(qlog.EventConnectionStateUpdated, qlog.StateUpdated{Old: from.String(), New: to.String()})
+}
+
+// traceECN traces a change in ECN validation
+func (c *Connection) traceECN(from, to ecnValidation) {
+	if c.tracer == nil {
+		return
+	}
+	c.tracer.record(qlog.EventECNStateUpdated, qlog.StateUpdated{Old: from.String(), New: to.String()})
+}
+
+// traceCongestion traces congestion control state, window and pacing rate
+// changes since they were last traced
+func (c *Connection) traceCongestion() {
+	t := c.tracer
+	if t == nil {
+		return
+	}
+
+	state := congestionState(c.cc)
+	cwnd := c.cc.Cwnd()
+	var pacing uint64
+	if delay := c.cc.PacingDelay(protocol.DefaultPayloadSize); delay > 0 {
+		pacing = uint64(protocol.DefaultPayloadSize * 8 / delay.Seconds())
+	}
+
+	t.mu.Lock()
+	oldState := t.ccState
+	metricsChanged := cwnd != t.cwnd || pacing != t.pacing
+	t.ccState, t.cwnd, t.pacing = state, cwnd, pacing
+	t.mu.Unlock()
+
+	if state != oldState {
+		t.record(qlog.EventCongestionStateUpdated, qlog.StateUpdated{Old: oldState, New: state})
+	}
+	if metricsChanged {
+		t.record(qlog.EventMetricsUpdated, qlog.MetricsUpdated{
+			MinRTT:           qlog.Milliseconds(c.cc.MinRTT()),
+			CongestionWindow: cwnd,
+			BytesInFlight:    c.sendBuf.BytesInFlight(),
+			PacingRate:       pacing,
+		})
+	}
+}
+
+// congestionState names the congestion controller's state: the BBR state
+// machine's, or for CUBIC whether it is in slow start
+func congestionState(cc CongestionController) string {
+	switch cc := cc.(type) {
+	case interface{ GetState() bbr.State }:
+		return cc.GetState().String()
+	case interface{ InSlowStart() bool }:
+		if cc.InSlowStart() {
+			return "slow_start"
+		}
+		return "congestion_avoidance"
+	default:
+		return ""
+	}
+}
+
+// packetHeader describes a packet header for the trace
+func packetHeader(h *protocol.Header) qlog.PacketHeader {
+	packetType := qlog.PacketType1RTT
+	if h.HasFlag(protocol.FlagSYN) {
+		packetType = qlog.PacketTypeInitial
+	}
+	return qlog.PacketHeader{
+		PacketType:   packetType,
+		PacketNumber: h.SequenceNumber,
+		Flags:        h.Flags.String(),
+	}
+}
+
+// packetFrames summarizes a packet's acknowledgment and payload as frames.
+// The acknowledgment is read from the wire header, which may carry one
+// piggybacked on data.
+func (c *Connection) packetFrames(name string, packet, wire *transport.Packet) []qlog.Frame {
+	var frames []qlog.Frame
+
+	h := wire.Header
+	if h.HasFlag(protocol.FlagACK) {
+		// The cumulative ACK covers the acknowledged side's sequence from
+		// its ISN
+		first := c.isn.Load()
+		if name == qlog.EventPacketSent {
+			first = c.peerISN.Load()
+		}
+
+		var ranges [][2]uint32
+		if h.AckNumber != first {
+			last := h.AckNumber - 1
+			if last == 0 {
+				last--
+			}
+			ranges = append(ranges, [2]uint32{first, last})
+		}
+		for _, block := range h.SACKBlocks {
+			ranges = append(ranges, [2]uint32{block.Start, block.End})
+		}
+		frame := qlog.Frame{FrameType: qlog.FrameTypeAck, AckedRanges: ranges}
+		if delay, ok := h.AckDelay(); ok {
+			frame.AckDelay = qlog.Milliseconds(delay)
+		}
+		if counts, ok := h.ECNCounts(); ok {
+			frame.ECT0, frame.ECT1, frame.CE = counts.ECT0, counts.ECT1, counts.CE
+		}
+		frames = append(frames, frame)
+	}
+
+	switch {
+	case len(packet.Payload) == 0:
+	case isControl(packet):
+		frames = append(frames, qlog.Frame{FrameType: qlog.FrameTypeControl})
+	case isDatagram(packet):
+		frames = append(frames, qlog.Frame{FrameType: qlog.FrameTypeDatagram})
+	case h.HasFlag(protocol.FlagFEC) && h.FECShardIndex >= h.FECDataShards:
+		frames = append(frames, qlog.Frame{FrameType: qlog.FrameTypeFEC})
+	default:
+		frames = append(frames, qlog.Frame{FrameType: qlog.FrameTypeStream})
+	}
+
+	return frames
+}
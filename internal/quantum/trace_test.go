@@ -0,0 +1,99 @@
+package quantum
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/qlog"
+)
+
+// traceRecorder keeps the trace of every connection in a ring buffer
+type traceRecorder struct {
+	mu     sync.Mutex
+	traces map[string]*qlog.RingBuffer
+}
+
+func (r *traceRecorder) sink(info qlog.TraceInfo) qlog.Sink {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.traces == nil {
+		r.traces = make(map[string]*qlog.RingBuffer)
+	}
+	buf := qlog.NewRingBuffer(100000)
+	r.traces[info.VantagePoint] = buf
+	return buf
+}
+
+// events returns the events of one vantage point's trace by name
+func (r *traceRecorder) events(vantage string) map[string][]qlog.Event {
+	r.mu.Lock()
+	buf := r.traces[vantage]
+	r.mu.Unlock()
+
+	byName := make(map[string][]qlog.Event)
+	if buf != nil {
+		for _, e := range buf.Events() {
+			byName[e.Name] = append(byName[e.Name], e)
+		}
+	}
+	return byName
+}
+
+func TestQlogTrace(t *testing.T) {
+	t.Run("Loss", func(t *testing.T) {
+		var traces traceRecorder
+		config := DefaultConfig()
+		config.FECEnabled = false
+		config.Qlog = traces.sink
+		transferOverLossyLink(t, config, 50)
+
+		client := traces.events(qlog.VantageClient)
+		for _, name := range []string{qlog.EventPacketSent, qlog.EventPacketReceived, qlog.EventPacketAcked, qlog.EventPacketLost} {
+			if len(client[name]) == 0 {
+				t.Errorf("Expected %s events in the client trace", name)
+			}
+		}
+
+		// RTT samples and congestion control changes are traced
+		var rtt, cwnd bool
+		for _, e := range client[qlog.EventMetricsUpdated] {
+			m := e.Data.(qlog.MetricsUpdated)
+			rtt = rtt || m.SmoothedRTT > 0
+			cwnd = cwnd || m.CongestionWindow > 0
+		}
+		if !rtt || !cwnd {
+			t.Errorf("Expected RTT and congestion window updates, got RTT %v window %v", rtt, cwnd)
+		}
+		states := client[qlog.EventCongestionStateUpdated]
+		if len(states) == 0 || states[0].Data.(qlog.StateUpdated).New != "STARTUP" {
+			t.Errorf("Expected BBR to start in STARTUP, got %+v", states)
+		}
+
+		// The handshake opens the server's trace
+		server := traces.events(qlog.VantageServer)
+		received := server[qlog.EventPacketReceived]
+		if len(received) == 0 || received[0].Data.(qlog.PacketEvent).Header.PacketType != qlog.PacketTypeInitial {
+			t.Error("Expected the server trace to start with the client's SYN")
+		}
+		if len(server[qlog.EventConnectionStateUpdated]) == 0 {
+			t.Error("Expected connection state transitions in the server trace")
+		}
+	})
+
+	t.Run("FEC", func(t *testing.T) {
+		var traces traceRecorder
+		config := DefaultConfig()
+		config.FECDataShards = 4
+		config.FECParityShards = 2
+		config.Qlog = traces.sink
+		transferOverLossyLink(t, config, 50)
+
+		recovered := traces.events(qlog.VantageServer)[qlog.EventFECRecovered]
+		if len(recovered) == 0 {
+			t.Fatal("Expected FEC recoveries in the server trace")
+		}
+		if r := recovered[0].Data.(qlog.FECRecovered); r.PacketNumber%7 != 3 {
+			t.Errorf("Expected a dropped packet to be recovered, got %+v", r)
+		}
+	})
+}
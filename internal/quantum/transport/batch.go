@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+// maxBatchSize is the most datagrams read or written per system call
+const maxBatchSize = 64
+
+// batchIO moves several datagrams per system call. It is only available on
+// some platforms; elsewhere Conn reads and writes one datagram at a time.
+type batchIO interface {
+	// read returns the next received datagram, its sender and its ECN
+	// codepoint, reading a new batch once the previous one is used up. The
+	// datagram is only valid until the next call, and read must not be
+	// called concurrently.
+	read() ([]byte, *net.UDPAddr, protocol.ECN, error)
+
+	// write sends datagrams in order to addr, or to the peer of a
+	// connected socket if addr is nil, each with the control messages in
+	// oob. It stops at the first datagram that cannot be sent and returns
+	// how many were sent before it.
+	write(datagrams [][]byte, addr *net.UDPAddr, oob []byte) (int, error)
+}
+
+// SendBatch sends packets in order to the specified address with as few
+// system calls as the platform allows. It stops at the first packet that
+// cannot be sent and returns how many were sent before it.
+func (c *Conn) SendBatch(packets []*Packet, addr *net.UDPAddr) (int, error) {
+	if c.batch == nil {
+		for i, packet := range packets {
+			if err := c.SendPacket(packet, addr); err != nil {
+				return i, err
+			}
+		}
+		return len(packets), nil
+	}
+
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return 0, fmt.Errorf("connection closed")
+	}
+	c.mu.RUnlock()
+
+	addr, err := c.destination(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	// Marshal into pooled buffers, sending whatever precedes a packet that
+	// fails to marshal
+	bufs := make([]*Packet, 0, len(packets))
+	datagrams := make([][]byte, 0, len(packets))
+	defer func() {
+		for _, buf := range bufs {
+			PutPacket(buf)
+		}
+	}()
+	var marshalErr error
+	for _, packet := range packets {
+		buf, err := c.marshalPacket(packet)
+		if err != nil {
+			marshalErr = err
+			break
+		}
+		bufs = append(bufs, buf)
+		datagrams = append(datagrams, buf.Payload)
+	}
+
+	// Packets go out in runs sharing an ECN codepoint
+	n := 0
+	for n < len(datagrams) {
+		end := n + 1
+		for end < len(datagrams) && packets[end].ECN == packets[n].ECN {
+			end++
+		}
+		var sent int
+		sent, err = c.batch.write(datagrams[n:end], addr, c.ecnControl(packets[n].ECN, addr))
+		n += sent
+		if err != nil {
+			break
+		}
+	}
+
+	var bytes uint64
+	for _, d := range datagrams[:n] {
+		bytes += uint64(len(d))
+	}
+	c.mu.Lock()
+	c.stats.PacketsSent += uint64(n)
+	c.stats.BytesSent += bytes
+	c.mu.Unlock()
+
+	if err != nil {
+		c.recordError()
+		return n, sendError(err, len(datagrams[n]))
+	}
+	return n, marshalErr
+}
@@ -0,0 +1,285 @@
+//go:build linux
+
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// UDP socket options from linux/udp.h, missing from package syscall
+const (
+	udpSegment = 103 // UDP_SEGMENT: segmentation offload (GSO) size
+	udpGRO     = 104 // UDP_GRO: receive coalesced datagrams
+)
+
+const (
+	// maxGSOSegments is the most datagrams one GSO write may carry
+	// (UDP_MAX_SEGMENTS in older kernels)
+	maxGSOSegments = 64
+
+	// maxGSOSize bounds the bytes of one GSO write, which the kernel sends
+	// as a single IP datagram until it is segmented
+	maxGSOSize = 65000
+
+	// groBufferSize holds a fully coalesced GRO read
+	groBufferSize = 65535
+
+	// groBatchSize is the number of GRO reads per system call. Each may
+	// hold many datagrams, so fewer are needed than without GRO.
+	groBatchSize = 16
+)
+
+// batchReadWriter is implemented by both ipv4.PacketConn and
+// ipv6.PacketConn, which share their message type
+type batchReadWriter interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// batchConn reads and writes with recvmmsg and sendmmsg. Where the kernel
+// supports it, runs of equal sized datagrams are written as one GSO send
+// and the kernel coalesces received datagrams (GRO), which read splits
+// again.
+type batchConn struct {
+	rw batchReadWriter
+
+	// gso is cleared if the kernel or device turns out not to support
+	// segmentation offload after all
+	gso atomic.Bool
+
+	// Read state, owned by the single reader
+	readMsgs []ipv4.Message
+	next     int          // Next message of the last batch to return
+	count    int          // Messages in the last batch
+	segments []byte       // Data of the current message not yet returned
+	segSize  int          // Size of each datagram in segments
+	segAddr  *net.UDPAddr // Sender of segments
+	segECN   protocol.ECN // ECN codepoint of segments, which GRO only coalesces if equal
+
+	// Write state
+	writeMu   sync.Mutex
+	writeMsgs []ipv4.Message
+	writeOOB  [][]byte
+}
+
+// newBatchIO sets up batched I/O on a socket, enabling GRO and detecting
+// GSO support. With ecn, the socket has been set up to report the ECN
+// codepoints of received datagrams.
+func newBatchIO(conn *net.UDPConn, ecn bool) batchIO {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	var gso, gro bool
+	err = raw.Control(func(fd uintptr) {
+		_, sockErr := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpSegment)
+		gso = sockErr == nil
+		gro = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpGRO, 1) == nil
+	})
+	if err != nil {
+		return nil
+	}
+
+	b := &batchConn{}
+	if conn.LocalAddr().(*net.UDPAddr).IP.To4() != nil {
+		b.rw = ipv4.NewPacketConn(conn)
+	} else {
+		b.rw = ipv6.NewPacketConn(conn)
+	}
+	b.gso.Store(gso)
+
+	batchSize, bufSize := maxBatchSize, protocol.MaxPacketSize
+	if gro {
+		batchSize, bufSize = groBatchSize, groBufferSize
+	}
+	var oobSize int
+	if gro {
+		oobSize += syscall.CmsgSpace(4)
+	}
+	if ecn {
+		oobSize += ecnControlSize
+	}
+	b.readMsgs = make([]ipv4.Message, batchSize)
+	for i := range b.readMsgs {
+		b.readMsgs[i].Buffers = [][]byte{make([]byte, bufSize)}
+		if oobSize > 0 {
+			b.readMsgs[i].OOB = make([]byte, oobSize)
+		}
+	}
+
+	// Each GSO write carries its segment size, and may carry an ECN
+	// codepoint after it
+	b.writeMsgs = make([]ipv4.Message, 0, maxBatchSize)
+	if gso {
+		space := syscall.CmsgSpace(2) + ecnControlSize
+		oob := make([]byte, maxBatchSize*space)
+		b.writeOOB = make([][]byte, maxBatchSize)
+		for i := range b.writeOOB {
+			b.writeOOB[i] = oob[i*space : (i+1)*space : (i+1)*space]
+		}
+	}
+
+	return b
+}
+
+func (b *batchConn) read() ([]byte, *net.UDPAddr, protocol.ECN, error) {
+	for len(b.segments) == 0 {
+		if b.next == b.count {
+			n, err := b.rw.ReadBatch(b.readMsgs, 0)
+			if err != nil {
+				return nil, nil, protocol.ECNNotECT, err
+			}
+			b.next, b.count = 0, n
+			continue
+		}
+
+		msg := &b.readMsgs[b.next]
+		b.next++
+
+		// A datagram larger than the buffer is not a valid packet
+		if msg.Flags&syscall.MSG_TRUNC != 0 {
+			continue
+		}
+		addr, ok := msg.Addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		b.segments = msg.Buffers[0][:msg.N]
+		b.segSize = msg.N
+		b.segECN = protocol.ECNNotECT
+		if msg.NN > 0 {
+			if size := groSegmentSize(msg.OOB[:msg.NN]); size > 0 {
+				b.segSize = size
+			}
+			b.segECN = parseECN(msg.OOB[:msg.NN])
+		}
+		b.segAddr = addr
+	}
+
+	// Coalesced datagrams all have the segment size but the last
+	n := min(b.segSize, len(b.segments))
+	data := b.segments[:n]
+	b.segments = b.segments[n:]
+	return data, b.segAddr, b.segECN, nil
+}
+
+func (b *batchConn) write(datagrams [][]byte, addr *net.UDPAddr, oob []byte) (int, error) {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	// A nil *net.UDPAddr must not become a non-nil net.Addr
+	var to net.Addr
+	if addr != nil {
+		to = addr
+	}
+
+	sent := 0
+	gso := b.gso.Load()
+	for sent < len(datagrams) {
+		msgs := b.pack(datagrams[sent:], to, oob, gso)
+		n, err := b.rw.WriteBatch(msgs, 0)
+		n = max(n, 0) // sendmmsg reports -1 when the first message fails
+		for _, msg := range msgs[:n] {
+			sent += len(msg.Buffers)
+		}
+		if err == nil {
+			continue
+		}
+
+		// A failed GSO send is retried a datagram at a time, so the error
+		// is reported against the datagram that caused it. EIO means the
+		// device cannot segment at all.
+		if n < len(msgs) && len(msgs[n].Buffers) > 1 {
+			if errors.Is(err, syscall.EIO) {
+				b.gso.Store(false)
+			}
+			gso = false
+			continue
+		}
+		clear(b.writeMsgs[:cap(b.writeMsgs)])
+		return sent, err
+	}
+
+	// Do not keep the caller's buffers alive
+	clear(b.writeMsgs[:cap(b.writeMsgs)])
+	return sent, nil
+}
+
+// pack fills the write messages from the start of datagrams, one message
+// per datagram or, with GSO, one per run of datagrams the kernel can segment
+func (b *batchConn) pack(datagrams [][]byte, addr net.Addr, oob []byte, gso bool) []ipv4.Message {
+	msgs := b.writeMsgs[:0]
+	for len(datagrams) > 0 && len(msgs) < cap(msgs) {
+		n := 1
+		if gso {
+			n = gsoSegments(datagrams)
+		}
+
+		msg := ipv4.Message{Buffers: datagrams[:n], Addr: addr, OOB: oob}
+		if n > 1 {
+			buf := b.writeOOB[len(msgs)]
+			putSegmentSize(buf, len(datagrams[0]))
+			msg.OOB = append(buf[:syscall.CmsgSpace(2)], oob...)
+		}
+		msgs = append(msgs, msg)
+		datagrams = datagrams[n:]
+	}
+	return msgs
+}
+
+// gsoSegments returns how many datagrams from the start of datagrams one
+// GSO send can carry. The kernel cuts the data into datagrams of the first
+// one's size, so only the last may be shorter.
+func gsoSegments(datagrams [][]byte) int {
+	size := len(datagrams[0])
+	total := size
+	n := 1
+	for n < len(datagrams) && n < maxGSOSegments {
+		next := len(datagrams[n])
+		if next > size || total+next > maxGSOSize {
+			break
+		}
+		total += next
+		n++
+		if next < size {
+			break
+		}
+	}
+	return n
+}
+
+// putSegmentSize writes a UDP_SEGMENT control message to oob
+func putSegmentSize(oob []byte, size int) {
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = syscall.IPPROTO_UDP
+	h.Type = udpSegment
+	h.SetLen(syscall.CmsgLen(2))
+	binary.NativeEndian.PutUint16(oob[syscall.CmsgLen(0):], uint16(size))
+}
+
+// groSegmentSize returns the datagram size of a coalesced read from its
+// UDP_GRO control message, or 0 if there is none
+func groSegmentSize(oob []byte) int {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level == syscall.IPPROTO_UDP && msg.Header.Type == udpGRO && len(msg.Data) >= 4 {
+			return int(binary.NativeEndian.Uint32(msg.Data))
+		}
+	}
+	return 0
+}
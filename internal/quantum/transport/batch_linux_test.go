@@ -0,0 +1,115 @@
+//go:build linux
+
+package transport
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+func TestGSOSegments(t *testing.T) {
+	sizes := func(s ...int) [][]byte {
+		datagrams := make([][]byte, len(s))
+		for i, n := range s {
+			datagrams[i] = make([]byte, n)
+		}
+		return datagrams
+	}
+
+	tests := []struct {
+		name      string
+		datagrams [][]byte
+		want      int
+	}{
+		{"Single", sizes(1000), 1},
+		{"EqualRun", sizes(1000, 1000, 1000, 500), 4},
+		{"ShorterEndsRun", sizes(1000, 500, 500), 2},
+		{"LongerEndsRun", sizes(500, 1000), 1},
+		{"SegmentLimit", sizes(slices.Repeat([]int{10}, 100)...), maxGSOSegments},
+		{"SizeLimit", sizes(slices.Repeat([]int{9000}, 10)...), maxGSOSize / 9000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gsoSegments(tt.datagrams); got != tt.want {
+				t.Errorf("Expected %d segments, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBatchInterop(t *testing.T) {
+	// A GSO send reaches a socket reading one datagram at a time as
+	// separate datagrams, and a batched reader splits coalesced reads
+	for _, receiverBatch := range []bool{false, true} {
+		server, _ := newTestConns(t, receiverBatch)
+		client, err := Listen("udp", "127.0.0.1:0", DefaultConfig())
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer client.Close()
+
+		batch, ok := client.batch.(*batchConn)
+		if !ok {
+			t.Skip("Batched I/O is not available")
+		}
+		if !batch.gso.Load() {
+			t.Log("UDP GSO is not supported; testing plain batches")
+		}
+
+		packets := testPackets(50, 1200)
+		if n, err := client.SendBatch(packets, server.LocalAddr()); err != nil || n != len(packets) {
+			t.Fatalf("Sent %d of %d packets: %v", n, len(packets), err)
+		}
+
+		received := receiveAll(t, server)
+		if len(received) != len(packets) {
+			t.Fatalf("Expected %d packets with batched reads %v, got %d", len(packets), receiverBatch, len(received))
+		}
+		for i, packet := range received {
+			if !bytes.Equal(packet.Payload, packets[i].Payload) {
+				t.Fatalf("Packet %d does not match what was sent", i)
+			}
+		}
+	}
+}
+
+func TestECNCodepoints(t *testing.T) {
+	// Codepoints survive the loopback interface, whether sent one at a time
+	// or in GSO runs, and read one at a time or from coalesced batches
+	codepoints := []protocol.ECN{
+		protocol.ECNECT0, protocol.ECNECT0, protocol.ECNECT0, protocol.ECNCE,
+		protocol.ECNCE, protocol.ECNNotECT, protocol.ECNECT1, protocol.ECNECT0,
+	}
+	for _, batch := range []bool{false, true} {
+		server, client := newTestConns(t, batch)
+		if !server.ECN() || !client.ECN() {
+			t.Skip("ECN is not available")
+		}
+
+		packets := testPackets(len(codepoints), 1000)
+		for i, packet := range packets {
+			packet.ECN = codepoints[i]
+		}
+		if n, err := client.SendBatch(packets, nil); err != nil || n != len(packets) {
+			t.Fatalf("Sent %d of %d packets: %v", n, len(packets), err)
+		}
+		for _, packet := range packets {
+			if err := client.Send(packet); err != nil {
+				t.Fatalf("Failed to send packet: %v", err)
+			}
+		}
+
+		received := receiveAll(t, server)
+		if len(received) != 2*len(packets) {
+			t.Fatalf("Expected %d packets with batched I/O %v, got %d", 2*len(packets), batch, len(received))
+		}
+		for i, packet := range received {
+			if want := codepoints[i%len(codepoints)]; packet.ECN != want {
+				t.Errorf("Packet %d with batched I/O %v: expected %v, got %v", i, batch, want, packet.ECN)
+			}
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package transport
+
+import "net"
+
+// newBatchIO is not supported on this platform; datagrams are read and
+// written one at a time
+func newBatchIO(conn *net.UDPConn, ecn bool) batchIO {
+	return nil
+}
@@ -0,0 +1,169 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+// newTestConns returns a listening socket and a socket dialed to it
+func newTestConns(tb testing.TB, batch bool) (*Conn, *Conn) {
+	tb.Helper()
+
+	config := DefaultConfig()
+	config.BatchIO = batch
+
+	server, err := Listen("udp", "127.0.0.1:0", config)
+	if err != nil {
+		tb.Fatalf("Failed to listen: %v", err)
+	}
+	tb.Cleanup(func() { server.Close() })
+
+	client, err := Dial("udp", server.LocalAddr().String(), config)
+	if err != nil {
+		tb.Fatalf("Failed to dial: %v", err)
+	}
+	tb.Cleanup(func() { client.Close() })
+
+	return server, client
+}
+
+// testPackets returns packets whose payloads hold their index, padded to
+// the given sizes in turn
+func testPackets(n int, sizes ...int) []*Packet {
+	packets := make([]*Packet, n)
+	for i := range packets {
+		payload := fmt.Appendf(nil, "packet %d ", i)
+		payload = append(payload, bytes.Repeat([]byte{'x'}, sizes[i%len(sizes)]-len(payload))...)
+		packets[i] = NewPacket([16]byte{1}, uint32(i+1), 0, 0, payload)
+	}
+	return packets
+}
+
+// receiveAll reads packets until none arrives for a while
+func receiveAll(t *testing.T, c *Conn) []*Packet {
+	t.Helper()
+
+	var received []*Packet
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		packet, err := c.ReceivePacket(ctx)
+		cancel()
+		if err != nil {
+			return received
+		}
+		received = append(received, packet)
+	}
+}
+
+func TestSendBatch(t *testing.T) {
+	for _, batch := range []bool{false, true} {
+		t.Run(fmt.Sprintf("BatchIO=%v", batch), func(t *testing.T) {
+			server, client := newTestConns(t, batch)
+
+			// Runs of equal sizes and odd sizes in between
+			packets := testPackets(300, 1000, 1000, 1000, 700, 1200, 1200, 40)
+			n, err := client.SendBatch(packets, nil)
+			if err != nil || n != len(packets) {
+				t.Fatalf("Sent %d of %d packets: %v", n, len(packets), err)
+			}
+
+			received := receiveAll(t, server)
+			if len(received) != len(packets) {
+				t.Fatalf("Expected %d packets, got %d", len(packets), len(received))
+			}
+			for i, packet := range received {
+				if packet.Header.SequenceNumber != packets[i].Header.SequenceNumber || !bytes.Equal(packet.Payload, packets[i].Payload) {
+					t.Fatalf("Packet %d does not match what was sent", i)
+				}
+				if packet.Addr.String() != client.LocalAddr().String() {
+					t.Fatalf("Expected packet %d from %v, got %v", i, client.LocalAddr(), packet.Addr)
+				}
+			}
+
+			// Replies go back through the unconnected socket
+			if n, err := server.SendBatch(packets[:10], received[0].Addr); err != nil || n != 10 {
+				t.Fatalf("Sent %d of 10 replies: %v", n, err)
+			}
+			if got := len(receiveAll(t, client)); got != 10 {
+				t.Errorf("Expected 10 replies, got %d", got)
+			}
+
+			stats := client.Statistics()
+			if stats.PacketsSent != uint64(len(packets)) || stats.PacketsReceived != 10 {
+				t.Errorf("Unexpected statistics: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestSendBatchTooLarge(t *testing.T) {
+	server, client := newTestConns(t, true)
+
+	// A payload too large for UDP stops the batch at that packet
+	packets := testPackets(5, 500)
+	packets[3].Payload = make([]byte, 70000)
+	n, err := client.SendBatch(packets, nil)
+	if err == nil || n != 3 {
+		t.Fatalf("Expected the batch to stop after 3 packets, got %d: %v", n, err)
+	}
+
+	if got := len(receiveAll(t, server)); got != 3 {
+		t.Errorf("Expected 3 packets, got %d", got)
+	}
+}
+
+// BenchmarkSend measures packets per second through a loopback socket pair,
+// one system call per packet against batched I/O
+func BenchmarkSend(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		batch bool
+	}{
+		{"PerPacket", false},
+		{"Batch", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			server, client := newTestConns(b, bc.batch)
+			packets := testPackets(maxBatchSize, protocol.DefaultPayloadSize)
+
+			// Drain the receiver so the socket buffer does not fill
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					if _, err := server.Receive(); err != nil {
+						return
+					}
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			for sent := 0; sent < b.N; sent += len(packets) {
+				batch := packets[:min(len(packets), b.N-sent)]
+				if bc.batch {
+					if _, err := client.SendBatch(batch, nil); err != nil {
+						b.Fatalf("Failed to send: %v", err)
+					}
+					continue
+				}
+				for _, packet := range batch {
+					if err := client.SendPacket(packet, nil); err != nil {
+						b.Fatalf("Failed to send: %v", err)
+					}
+				}
+			}
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "pkts/s")
+			b.StopTimer()
+
+			server.Close()
+			<-done
+		})
+	}
+}
@@ -3,6 +3,7 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -23,21 +24,51 @@ const (
 	DefaultReadTimeout = 30 * time.Second
 )
 
+// ErrMessageTooLarge is returned when a datagram is larger than the local
+// interface MTU and fragmentation is disabled
+var ErrMessageTooLarge = errors.New("message too large")
+
 // Packet represents a complete Quantum protocol packet
 type Packet struct {
 	Header  *protocol.Header
 	Payload []byte
 	Addr    *net.UDPAddr // Remote address for received packets
+
+	// ECN is the codepoint to send the packet with, or the one it was
+	// received with, where the Conn supports ECN
+	ECN protocol.ECN
+}
+
+// ecnPacketConn is a packet connection that carries ECN codepoints itself,
+// such as a simulated path from package netsim
+type ecnPacketConn interface {
+	ReadFromECN(p []byte) (int, net.Addr, uint8, error)
+	WriteToECN(p []byte, addr net.Addr, ecn uint8) (int, error)
 }
 
 // Conn represents a UDP connection for Quantum protocol
 type Conn struct {
-	udpConn    *net.UDPConn
+	pc         net.PacketConn
+	udpConn    *net.UDPConn // pc if it is a UDP socket, nil otherwise
 	localAddr  *net.UDPAddr
 	remoteAddr *net.UDPAddr
+
+	// connected is true for dialed sockets, which must use Write instead of WriteTo
+	connected bool
 	
 	// Read buffer for receiving packets
 	readBuf []byte
+
+	// ecn is true when sent packets carry their ECN codepoint and the
+	// codepoints of received ones are read, into readOOB for UDP sockets or
+	// through ecnConn for packet connections that carry them
+	ecn     bool
+	ecnConn ecnPacketConn
+	readOOB []byte
+
+	// batch reads and writes several datagrams per system call, nil where
+	// the platform does not support it
+	batch batchIO
 	
 	// Mutex for thread-safe operations
 	mu sync.RWMutex
@@ -63,6 +94,14 @@ type Config struct {
 	ReadBufferSize  int
 	WriteBufferSize int
 	ReadTimeout     time.Duration
+
+	// BatchIO reads and writes several datagrams per system call where the
+	// platform supports it, using UDP segmentation offload when available
+	BatchIO bool
+
+	// ECN sends packets with the ECN codepoint they carry and reads the
+	// codepoints of received packets where the platform supports it
+	ECN bool
 }
 
 // DefaultConfig returns default configuration
@@ -71,6 +110,8 @@ func DefaultConfig() *Config {
 		ReadBufferSize:  DefaultReadBufferSize,
 		WriteBufferSize: DefaultWriteBufferSize,
 		ReadTimeout:     DefaultReadTimeout,
+		BatchIO:         true,
+		ECN:             true,
 	}
 }
 
@@ -101,12 +142,15 @@ func Listen(network, address string, config *Config) (*Conn, error) {
 		return nil, fmt.Errorf("failed to set write buffer: %w", err)
 	}
 
-	return &Conn{
+	conn := &Conn{
+		pc:        udpConn,
 		udpConn:   udpConn,
-		localAddr: addr,
-		readBuf:   make([]byte, protocol.HeaderMinSize+protocol.MaxPayloadSize+protocol.MaxSACKBlocks*8),
+		localAddr: udpConn.LocalAddr().(*net.UDPAddr),
+		readBuf:   make([]byte, protocol.MaxPacketSize),
 		closed:    false,
-	}, nil
+	}
+	conn.setupUDP(udpConn, config)
+	return conn, nil
 }
 
 // Dial creates a new UDP connection to a remote address
@@ -136,13 +180,61 @@ func Dial(network, address string, config *Config) (*Conn, error) {
 		return nil, fmt.Errorf("failed to set write buffer: %w", err)
 	}
 
-	return &Conn{
+	conn := &Conn{
+		pc:         udpConn,
 		udpConn:    udpConn,
 		localAddr:  udpConn.LocalAddr().(*net.UDPAddr),
 		remoteAddr: addr,
-		readBuf:    make([]byte, protocol.HeaderMinSize+protocol.MaxPayloadSize+protocol.MaxSACKBlocks*8),
+		connected:  true,
+		readBuf:    make([]byte, protocol.MaxPacketSize),
 		closed:     false,
-	}, nil
+	}
+	conn.setupUDP(udpConn, config)
+	return conn, nil
+}
+
+// NewConn runs the Quantum transport over an existing packet connection,
+// such as a simulated path from package netsim. Its addresses must be UDP
+// addresses. Sends without an address go to remote if it is not nil. The
+// Conn takes ownership of pc and closes it when closed.
+func NewConn(pc net.PacketConn, remote *net.UDPAddr, config *Config) *Conn {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	localAddr, _ := pc.LocalAddr().(*net.UDPAddr)
+	conn := &Conn{
+		pc:         pc,
+		localAddr:  localAddr,
+		remoteAddr: remote,
+		readBuf:    make([]byte, protocol.MaxPacketSize),
+	}
+	if udpConn, ok := pc.(*net.UDPConn); ok {
+		conn.udpConn = udpConn
+		conn.setupUDP(udpConn, config)
+	} else if ecnConn, ok := pc.(ecnPacketConn); ok && config.ECN {
+		conn.ecn = true
+		conn.ecnConn = ecnConn
+	}
+	return conn
+}
+
+// setupUDP enables the optional features of a UDP socket that config asks
+// for and the platform supports
+func (c *Conn) setupUDP(udpConn *net.UDPConn, config *Config) {
+	if config.ECN && enableECN(udpConn) {
+		c.ecn = true
+		c.readOOB = make([]byte, ecnControlSize)
+	}
+	if config.BatchIO {
+		c.batch = newBatchIO(udpConn, c.ecn)
+	}
+}
+
+// ECN reports whether sent packets carry their ECN codepoint and received
+// packets report theirs
+func (c *Conn) ECN() bool {
+	return c.ecn
 }
 
 // SendPacket sends a Quantum packet to the specified address
@@ -154,49 +246,171 @@ func (c *Conn) SendPacket(packet *Packet, addr *net.UDPAddr) error {
 	}
 	c.mu.RUnlock()
 
-	// Set payload length in header
-	packet.Header.PayloadLength = uint16(len(packet.Payload))
-
-	// Validate header
-	if err := packet.Header.Validate(); err != nil {
-		c.stats.Errors++
-		return fmt.Errorf("invalid header: %w", err)
+	addr, err := c.destination(addr)
+	if err != nil {
+		return err
 	}
 
-	// Marshal header
-	headerBytes, err := packet.Header.Marshal()
+	buf, err := c.marshalPacket(packet)
 	if err != nil {
-		c.stats.Errors++
-		return fmt.Errorf("failed to marshal header: %w", err)
+		return err
 	}
+	defer PutPacket(buf)
 
-	// Combine header and payload
-	data := make([]byte, len(headerBytes)+len(packet.Payload))
-	copy(data, headerBytes)
-	copy(data[len(headerBytes):], packet.Payload)
-
-	// Send to specified address or remote address
+	// Connected sockets can only write to their peer
 	var n int
-	if addr != nil {
-		n, err = c.udpConn.WriteToUDP(data, addr)
-	} else if c.remoteAddr != nil {
-		n, err = c.udpConn.WriteToUDP(data, c.remoteAddr)
-	} else {
-		return fmt.Errorf("no remote address specified")
+	switch {
+	case c.ecn && packet.ECN != protocol.ECNNotECT:
+		n, err = c.writeECN(buf.Payload, addr, packet.ECN)
+	case c.connected:
+		n, err = c.udpConn.Write(buf.Payload)
+	default:
+		n, err = c.writeTo(buf.Payload, addr)
 	}
-
 	if err != nil {
-		c.stats.Errors++
-		return fmt.Errorf("failed to send packet: %w", err)
+		c.recordError()
+		return sendError(err, len(buf.Payload))
 	}
 
 	// Update statistics
+	c.mu.Lock()
 	c.stats.PacketsSent++
 	c.stats.BytesSent += uint64(n)
+	c.mu.Unlock()
 
 	return nil
 }
 
+// writeTo sends a datagram to addr
+func (c *Conn) writeTo(data []byte, addr *net.UDPAddr) (int, error) {
+	if c.udpConn != nil {
+		return c.udpConn.WriteToUDP(data, addr)
+	}
+	return c.pc.WriteTo(data, addr)
+}
+
+// writeECN sends a datagram with an ECN codepoint to addr, or to the peer of
+// a connected socket if addr is nil
+func (c *Conn) writeECN(data []byte, addr *net.UDPAddr, ecn protocol.ECN) (int, error) {
+	if c.ecnConn != nil {
+		return c.ecnConn.WriteToECN(data, addr, uint8(ecn))
+	}
+	n, _, err := c.udpConn.WriteMsgUDP(data, c.ecnControl(ecn, addr), addr)
+	return n, err
+}
+
+// ecnControl returns the control message that sends a datagram to addr with
+// an ECN codepoint, nil for Not-ECT
+func (c *Conn) ecnControl(ecn protocol.ECN, addr *net.UDPAddr) []byte {
+	if !c.ecn || c.ecnConn != nil || ecn == protocol.ECNNotECT {
+		return nil
+	}
+	if addr == nil {
+		addr = c.remoteAddr
+	}
+	return ecnControl(ecn, addr)
+}
+
+// readFrom reads a datagram into buf, returning its sender and ECN codepoint
+func (c *Conn) readFrom(buf []byte) (int, *net.UDPAddr, protocol.ECN, error) {
+	if c.udpConn != nil {
+		if !c.ecn {
+			n, addr, err := c.udpConn.ReadFromUDP(buf)
+			return n, addr, protocol.ECNNotECT, err
+		}
+		n, oobn, _, addr, err := c.udpConn.ReadMsgUDP(buf, c.readOOB)
+		if err != nil {
+			return 0, nil, protocol.ECNNotECT, err
+		}
+		return n, addr, parseECN(c.readOOB[:oobn]), nil
+	}
+
+	var n int
+	var addr net.Addr
+	var ecn uint8
+	var err error
+	if c.ecnConn != nil {
+		n, addr, ecn, err = c.ecnConn.ReadFromECN(buf)
+	} else {
+		n, addr, err = c.pc.ReadFrom(buf)
+	}
+	if err != nil {
+		return n, nil, protocol.ECNNotECT, err
+	}
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return n, nil, protocol.ECNNotECT, fmt.Errorf("unexpected address type %T", addr)
+	}
+	return n, udpAddr, protocol.ECN(ecn), nil
+}
+
+// destination returns the address to send to: nil for connected sockets,
+// which can only write to their peer, otherwise the specified address or
+// the default remote address
+func (c *Conn) destination(addr *net.UDPAddr) (*net.UDPAddr, error) {
+	switch {
+	case c.connected:
+		return nil, nil
+	case addr != nil:
+		return addr, nil
+	case c.remoteAddr != nil:
+		return c.remoteAddr, nil
+	default:
+		return nil, fmt.Errorf("no remote address specified")
+	}
+}
+
+// marshalPacket serializes a packet into a buffer from the packet pool,
+// which the caller returns with PutPacket once it has been sent
+func (c *Conn) marshalPacket(packet *Packet) (*Packet, error) {
+	// Set payload length in header
+	packet.Header.PayloadLength = uint16(len(packet.Payload))
+
+	// Validate header
+	if err := packet.Header.Validate(); err != nil {
+		c.recordError()
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	// Marshal header followed by payload
+	buf := GetPacket()
+	data, err := packet.Header.AppendBinary(buf.Payload)
+	if err != nil {
+		PutPacket(buf)
+		c.recordError()
+		return nil, fmt.Errorf("failed to marshal header: %w", err)
+	}
+	buf.Payload = append(data, packet.Payload...)
+
+	return buf, nil
+}
+
+// sendError wraps an error from sending a datagram of the given size
+func sendError(err error, size int) error {
+	if isMessageTooLarge(err) {
+		return fmt.Errorf("failed to send packet: %w (%d bytes)", ErrMessageTooLarge, size)
+	}
+	return fmt.Errorf("failed to send packet: %w", err)
+}
+
+// SetDontFragment stops datagrams from being fragmented, so that a datagram
+// larger than the path MTU is lost. Path MTU discovery depends on this; on
+// platforms that cannot disable fragmentation, and for packet connections
+// other than UDP sockets, it does nothing.
+func (c *Conn) SetDontFragment() error {
+	if c.udpConn == nil {
+		return nil
+	}
+	return setDontFragment(c.udpConn)
+}
+
+// recordError increments the error counter
+func (c *Conn) recordError() {
+	c.mu.Lock()
+	c.stats.Errors++
+	c.mu.Unlock()
+}
+
 // Send sends a packet to the default remote address (for connected sockets)
 func (c *Conn) Send(packet *Packet) error {
 	return c.SendPacket(packet, nil)
@@ -211,49 +425,66 @@ func (c *Conn) ReceivePacket(ctx context.Context) (*Packet, error) {
 	}
 	c.mu.RUnlock()
 
-	// Set read deadline if context has deadline
-	if deadline, ok := ctx.Deadline(); ok {
-		if err := c.udpConn.SetReadDeadline(deadline); err != nil {
-			return nil, fmt.Errorf("failed to set read deadline: %w", err)
-		}
+	// Set read deadline from context, clearing any deadline left by a previous call
+	deadline, _ := ctx.Deadline()
+	if err := c.pc.SetReadDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("failed to set read deadline: %w", err)
 	}
 
-	// Read from UDP connection
-	n, addr, err := c.udpConn.ReadFromUDP(c.readBuf)
+	// Read from UDP connection, taking the next datagram of a batch where
+	// supported
+	var packetData []byte
+	var addr *net.UDPAddr
+	var ecn protocol.ECN
+	var err error
+	if c.batch != nil {
+		packetData, addr, ecn, err = c.batch.read()
+	} else {
+		var n int
+		n, addr, ecn, err = c.readFrom(c.readBuf)
+		packetData = c.readBuf[:n]
+	}
 	if err != nil {
 		// Check if context is cancelled
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		default:
-			c.stats.Errors++
+			c.recordError()
 			return nil, fmt.Errorf("failed to read packet: %w", err)
 		}
 	}
 
 	// Update statistics
+	c.mu.Lock()
 	c.stats.PacketsReceived++
-	c.stats.BytesReceived += uint64(n)
+	c.stats.BytesReceived += uint64(len(packetData))
+	c.mu.Unlock()
 
-	// Parse header
-	header := &protocol.Header{}
-	if err := header.Unmarshal(c.readBuf[:n]); err != nil {
-		c.stats.Errors++
+	// Parse header. A packet in a version we do not speak is returned with
+	// its version-independent header fields alongside the error, so the
+	// caller can answer with a version negotiation packet.
+	header, data, err := protocol.SplitPacket(packetData)
+	if err != nil {
+		c.recordError()
+		if verr, ok := err.(*protocol.VersionError); ok {
+			return &Packet{Header: header, Addr: addr, ECN: ecn}, fmt.Errorf("failed to unmarshal header: %w", verr)
+		}
 		return nil, fmt.Errorf("failed to unmarshal header: %w", err)
 	}
 
 	// Extract payload
-	headerSize := header.Size()
 	var payload []byte
-	if n > headerSize {
-		payload = make([]byte, n-headerSize)
-		copy(payload, c.readBuf[headerSize:n])
+	if len(data) > 0 {
+		payload = make([]byte, len(data))
+		copy(payload, data)
 	}
 
 	return &Packet{
 		Header:  header,
 		Payload: payload,
 		Addr:    addr,
+		ECN:     ecn,
 	}, nil
 }
 
@@ -296,7 +527,7 @@ func (c *Conn) Close() error {
 	}
 
 	c.closed = true
-	return c.udpConn.Close()
+	return c.pc.Close()
 }
 
 // IsClosed returns whether the connection is closed
@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	guuid "github.com/Lzww0608/GUUID"
+	"github.com/aetherflow/aetherflow/internal/quantum/netsim"
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+func TestNewConn(t *testing.T) {
+	a, b := netsim.Pipe(netsim.Config{})
+	client := NewConn(a, a.PeerAddr(), nil)
+	server := NewConn(b, nil, nil)
+	defer client.Close()
+	defer server.Close()
+
+	// Fragmentation cannot be controlled on a simulated path
+	if err := client.SetDontFragment(); err != nil {
+		t.Fatalf("Expected SetDontFragment to do nothing, got %v", err)
+	}
+
+	guid, _ := guuid.NewV7()
+	if err := client.Send(NewPacket(guid, 1, 0, protocol.FlagSYN, []byte("hello"))); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	packets := []*Packet{
+		NewPacket(guid, 2, 0, 0, []byte("a")),
+		NewPacket(guid, 3, 0, 0, []byte("b")),
+	}
+	if n, err := client.SendBatch(packets, nil); n != 2 || err != nil {
+		t.Fatalf("Expected 2 packets sent, got %d: %v", n, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, want := range []string{"hello", "a", "b"} {
+		packet, err := server.ReceivePacket(ctx)
+		if err != nil {
+			t.Fatalf("Failed to receive: %v", err)
+		}
+		if string(packet.Payload) != want || packet.Addr.String() != client.LocalAddr().String() {
+			t.Errorf("Expected %q from %v, got %q from %v", want, client.LocalAddr(), packet.Payload, packet.Addr)
+		}
+	}
+
+	// The read deadline comes from the context
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := server.ReceivePacket(ctx); err == nil {
+		t.Error("Expected the read to time out")
+	}
+
+	// Closing the Conn closes the packet connection
+	server.Close()
+	if _, _, err := b.ReadFrom(make([]byte, 16)); err == nil {
+		t.Error("Expected the packet connection to be closed")
+	}
+}
@@ -3,8 +3,14 @@ package transport
 
 import (
 	"sync"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
 )
 
+// pooledBufferSize is the payload capacity of new pooled packets, room for a
+// full sized packet at the default payload size
+const pooledBufferSize = 2048
+
 // PacketPool manages a pool of reusable packets to reduce GC pressure
 type PacketPool struct {
 	pool sync.Pool
@@ -16,7 +22,7 @@ func NewPacketPool() *PacketPool {
 		pool: sync.Pool{
 			New: func() interface{} {
 				return &Packet{
-					Payload: make([]byte, 0, 1400),
+					Payload: make([]byte, 0, pooledBufferSize),
 				}
 			},
 		},
@@ -39,7 +45,7 @@ func (p *PacketPool) Put(pkt *Packet) {
 	}
 	// Clear sensitive data before returning to pool
 	pkt.Header = nil
-	if cap(pkt.Payload) <= 2048 { // Only pool reasonably-sized buffers
+	if cap(pkt.Payload) <= protocol.MaxPacketSize { // Only pool buffers a packet can fill
 		pkt.Payload = pkt.Payload[:0]
 		p.pool.Put(pkt)
 	}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+// setDontFragment sets the Don't Fragment bit on every datagram and stops
+// the kernel from applying its own path MTU estimate, so datagrams larger
+// than the path MTU are dropped rather than fragmented (IP_PMTUDISC_PROBE)
+func setDontFragment(conn *net.UDPConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	ipv6 := conn.LocalAddr().(*net.UDPAddr).IP.To4() == nil
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if ipv6 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_PROBE)
+			return
+		}
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// isMessageTooLarge reports whether a send failed because the datagram
+// exceeds the local interface MTU
+func isMessageTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE)
+}
+
+// enableECN asks the kernel to report the traffic class of received
+// datagrams, from which their ECN codepoints are read, and reports whether
+// it will. A dual-stack IPv6 socket reports IPv4 datagrams through IP_TOS.
+func enableECN(conn *net.UDPConn) bool {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	ipv6 := conn.LocalAddr().(*net.UDPAddr).IP.To4() == nil
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if ipv6 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVTCLASS, 1)
+			// IPv6-only sockets refuse IPv4 options and need none
+			syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTOS, 1)
+			return
+		}
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTOS, 1)
+	})
+	return err == nil && sockErr == nil
+}
+
+// ecnControlSize is the space of the control message ecnControl returns
+var ecnControlSize = syscall.CmsgSpace(4)
+
+// ecnControl returns a control message setting the ECN codepoint of a
+// datagram sent to addr, IP_TOS for IPv4 destinations and IPV6_TCLASS for
+// IPv6 ones
+func ecnControl(ecn protocol.ECN, addr *net.UDPAddr) []byte {
+	oob := make([]byte, ecnControlSize)
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level, h.Type = syscall.IPPROTO_IP, syscall.IP_TOS
+	if addr != nil && addr.IP.To4() == nil {
+		h.Level, h.Type = syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+	}
+	h.SetLen(syscall.CmsgLen(4))
+	binary.NativeEndian.PutUint32(oob[syscall.CmsgLen(0):], uint32(ecn&protocol.ECNCE))
+	return oob
+}
+
+// parseECN returns the ECN codepoint of a received datagram from its
+// IP_TOS or IPV6_TCLASS control message, Not-ECT if there is none
+func parseECN(oob []byte) protocol.ECN {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return protocol.ECNNotECT
+	}
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_TOS && len(msg.Data) >= 1:
+			return protocol.ECN(msg.Data[0]) & protocol.ECNCE
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_TCLASS && len(msg.Data) >= 4:
+			return protocol.ECN(binary.NativeEndian.Uint32(msg.Data)) & protocol.ECNCE
+		}
+	}
+	return protocol.ECNNotECT
+}
@@ -0,0 +1,40 @@
+//go:build !linux
+
+package transport
+
+import (
+	"net"
+
+	"github.com/aetherflow/aetherflow/internal/quantum/protocol"
+)
+
+// setDontFragment is not supported on this platform; datagrams may be
+// fragmented
+func setDontFragment(conn *net.UDPConn) error {
+	return nil
+}
+
+// isMessageTooLarge reports whether a send failed because the datagram
+// exceeds the local interface MTU
+func isMessageTooLarge(err error) bool {
+	return false
+}
+
+// enableECN is not supported on this platform; datagrams are sent Not-ECT
+// and the codepoints of received ones are unknown
+func enableECN(conn *net.UDPConn) bool {
+	return false
+}
+
+// ecnControlSize is the space of the control message ecnControl returns
+const ecnControlSize = 0
+
+// ecnControl is not supported on this platform
+func ecnControl(ecn protocol.ECN, addr *net.UDPAddr) []byte {
+	return nil
+}
+
+// parseECN is not supported on this platform
+func parseECN(oob []byte) protocol.ECN {
+	return protocol.ECNNotECT
+}
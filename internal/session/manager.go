@@ -196,6 +196,33 @@ func (m *Manager) UpdateSession(ctx context.Context, sessionID guuid.UUID, state
 	return session, nil
 }
 
+// UpdateClientAddr records a new client address for a session, as reported
+// when its Quantum connection migrates to another network path
+func (m *Manager) UpdateClientAddr(ctx context.Context, sessionID guuid.UUID, clientIP string, clientPort uint32) (*Session, error) {
+	session, err := m.store.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.Info("session client address changed",
+		zap.String("session_id", sessionID.String()),
+		zap.String("old_addr", fmt.Sprintf("%s:%d", session.ClientIP, session.ClientPort)),
+		zap.String("new_addr", fmt.Sprintf("%s:%d", clientIP, clientPort)))
+
+	session.ClientIP = clientIP
+	session.ClientPort = clientPort
+	session.LastActiveAt = time.Now()
+
+	if err := m.store.Update(ctx, session); err != nil {
+		m.logger.Error("failed to update session",
+			zap.String("session_id", sessionID.String()),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	return session, nil
+}
+
 // DeleteSession deletes a session
 func (m *Manager) DeleteSession(ctx context.Context, sessionID guuid.UUID, reason string) error {
 	// Get session info for logging
@@ -154,6 +154,39 @@ func TestManagerUpdateSession(t *testing.T) {
 	}
 }
 
+func TestManagerUpdateClientAddr(t *testing.T) {
+	store := NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+
+	manager := NewManager(&ManagerConfig{
+		Store:  store,
+		Logger: logger,
+	})
+	defer manager.Close()
+
+	ctx := context.Background()
+
+	connID, _ := guuid.NewV7()
+	session, _, err := manager.CreateSession(ctx, "user123", "192.168.1.1", 12345, connID, nil)
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	// Client moved from Wi-Fi to cellular
+	if _, err := manager.UpdateClientAddr(ctx, session.SessionID, "10.20.30.40", 54321); err != nil {
+		t.Fatalf("UpdateClientAddr failed: %v", err)
+	}
+
+	// The session is still found by its connection, at the new address
+	migrated, err := manager.GetSessionByConnection(ctx, connID)
+	if err != nil {
+		t.Fatalf("GetSessionByConnection failed: %v", err)
+	}
+	if migrated.ClientIP != "10.20.30.40" || migrated.ClientPort != 54321 {
+		t.Errorf("expected client address 10.20.30.40:54321, got %s:%d", migrated.ClientIP, migrated.ClientPort)
+	}
+}
+
 func TestManagerDeleteSession(t *testing.T) {
 	store := NewMemoryStore()
 	logger, _ := zap.NewDevelopment()
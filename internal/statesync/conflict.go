@@ -1,8 +1,14 @@
 package statesync
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	guuid "github.com/Lzww0608/GUUID"
@@ -110,7 +116,8 @@ func (r *ManualConflictResolver) GetStrategy() ConflictResolution {
 }
 
 // MergeConflictResolver 合并冲突解决器
-// 尝试自动合并不冲突的部分
+// 按字段合并操作: 操作数据是对象ID加属性补丁 (MergePatch), 不同对象或同一对象不同属性的修改
+// 合并成一个新操作; 多个操作把同一属性改成不同的值时, 该属性作为部分冲突返回
 type MergeConflictResolver struct {
 	logger *zap.Logger
 }
@@ -125,7 +132,33 @@ func NewMergeConflictResolver(logger *zap.Logger) *MergeConflictResolver {
 	}
 }
 
-// Resolve 尝试合并操作
+// MergePatch 合并解决器理解的操作数据, 如:
+// {"object":"shape1","props":{"x":100,"fill":"red"}}
+// 合并后的操作数据是按对象ID排序的补丁数组, 删除操作合并为 "deleted": true
+type MergePatch struct {
+	Object  string                     `json:"object"`            // 对象ID
+	Props   map[string]json.RawMessage `json:"props,omitempty"`   // 属性补丁
+	Deleted bool                       `json:"deleted,omitempty"` // 对象已删除
+}
+
+// PartialConflictError 部分冲突: 其余修改已合并, Fields 中的字段被多个操作改成了不同的值
+type PartialConflictError struct {
+	Fields []ConflictField
+}
+
+func (e *PartialConflictError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Object
+		if f.Field != "" {
+			fields[i] += "." + f.Field
+		}
+	}
+	return fmt.Sprintf("partial conflict on %d fields: %s", len(e.Fields), strings.Join(fields, ", "))
+}
+
+// Resolve 按字段合并操作, 返回合成的新操作。
+// 存在重叠字段时同时返回只含无冲突修改的操作和 *PartialConflictError。
 func (r *MergeConflictResolver) Resolve(ctx context.Context, ops []*Operation) (*Operation, error) {
 	if len(ops) == 0 {
 		return nil, fmt.Errorf("no operations to resolve")
@@ -140,21 +173,114 @@ func (r *MergeConflictResolver) Resolve(ctx context.Context, ops []*Operation) (
 	copy(sortedOps, ops)
 	sortOperationsByTimestamp(sortedOps)
 
-	// 尝试合并操作
-	// 这里是简化实现，实际应该根据操作类型进行智能合并
-	// 例如：
-	// - 如果操作在不同的对象上，可以并行应用
-	// - 如果操作在同一对象的不同属性上，可以合并
-	// - 如果操作完全冲突，则需要选择一个
+	// 每个字段的修改: 对象 -> 属性 -> 值和修改它的操作; 属性名为空表示删除整个对象
+	type change struct {
+		value json.RawMessage
+		ops   []*Operation
+		clash bool
+	}
+	changes := make(map[string]map[string]*change)
+	record := func(object, field string, value json.RawMessage, op *Operation) {
+		fields := changes[object]
+		if fields == nil {
+			fields = make(map[string]*change)
+			changes[object] = fields
+		}
+		c := fields[field]
+		if c == nil {
+			fields[field] = &change{value: value, ops: []*Operation{op}}
+			return
+		}
+		c.ops = append(c.ops, op)
+		if !jsonEqual(c.value, value) {
+			c.clash = true
+		}
+	}
+
+	for _, op := range sortedOps {
+		patches, err := decodeMergePatches(op.Data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot merge operation %s: %w", op.ID.String(), err)
+		}
+		for _, patch := range patches {
+			if patch.Deleted || op.Type == OperationTypeDelete {
+				record(patch.Object, "", nil, op)
+				continue
+			}
+			for field, value := range patch.Props {
+				record(patch.Object, field, value, op)
+			}
+		}
+	}
 
-	merged := sortedOps[0]
+	// 删除与同一对象上的其他修改重叠
+	for _, fields := range changes {
+		if deleted, ok := fields[""]; ok && len(fields) > 1 {
+			deleted.clash = true
+			for field, c := range fields {
+				if field != "" {
+					deleted.ops = append(deleted.ops, c.ops...)
+					delete(fields, field)
+				}
+			}
+		}
+	}
+
+	objects := make([]string, 0, len(changes))
+	for object := range changes {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+
+	patches := []MergePatch{}
+	var overlaps []ConflictField
+	for _, object := range objects {
+		fields := make([]string, 0, len(changes[object]))
+		for field := range changes[object] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		patch := MergePatch{Object: object}
+		for _, field := range fields {
+			c := changes[object][field]
+			if c.clash {
+				overlap := ConflictField{Object: object, Field: field}
+				for _, op := range c.ops {
+					overlap.OpIDs = append(overlap.OpIDs, op.ID)
+				}
+				overlaps = append(overlaps, overlap)
+				continue
+			}
+			if field == "" {
+				patch.Deleted = true
+				continue
+			}
+			if patch.Props == nil {
+				patch.Props = make(map[string]json.RawMessage)
+			}
+			patch.Props[field] = c.value
+		}
+		if patch.Deleted || patch.Props != nil {
+			patches = append(patches, patch)
+		}
+	}
+
+	data, err := json.Marshal(patches)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode merged operation: %w", err)
+	}
+	merged := mergedOperation(sortedOps, data)
 
 	r.logger.Debug("Merge conflict resolution",
 		zap.Int("total_ops", len(ops)),
 		zap.String("merged_op_id", merged.ID.String()),
+		zap.Int("overlapping_fields", len(overlaps)),
 	)
 
-	// 实际实现应该更复杂，这里返回最早的操作作为基础
+	if len(overlaps) > 0 {
+		return merged, &PartialConflictError{Fields: overlaps}
+	}
 	return merged, nil
 }
 
@@ -163,6 +289,168 @@ func (r *MergeConflictResolver) GetStrategy() ConflictResolution {
 	return ConflictResolutionMerge
 }
 
+// decodeMergePatches 解析操作数据, 可以是单个补丁或补丁数组
+func decodeMergePatches(data []byte) ([]MergePatch, error) {
+	var patches []MergePatch
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(data, &patches); err != nil {
+			return nil, err
+		}
+	} else {
+		var patch MergePatch
+		if err := json.Unmarshal(data, &patch); err != nil {
+			return nil, err
+		}
+		patches = []MergePatch{patch}
+	}
+
+	for _, patch := range patches {
+		if patch.Object == "" {
+			return nil, fmt.Errorf("missing object id")
+		}
+	}
+	return patches, nil
+}
+
+// applyMergedOperation 把合并后的补丁应用到文档当前内容上, 补丁未涉及的对象保持不变。
+// 白板/画布的CRDT状态经 CanvasState.Apply 合入; 其他文档的内容是以对象ID为键的JSON对象,
+// 补丁的属性并入对应对象, 删除的对象被移除
+func applyMergedOperation(doc *Document, op *Operation) ([]byte, error) {
+	patches, err := decodeMergePatches(op.Data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot apply merged operation: %w", err)
+	}
+
+	if (doc.Type == DocumentTypeWhiteboard || doc.Type == DocumentTypeCanvas) && isCanvasContent(doc.Content) {
+		state, err := ParseCanvasState(doc.Content)
+		if err != nil {
+			return nil, err
+		}
+		for i, patch := range patches {
+			opType := OperationTypeUpdate
+			switch {
+			case patch.Deleted:
+				opType = OperationTypeDelete
+			case op.Type == OperationTypeCreate:
+				opType = OperationTypeCreate
+			}
+			canvasOp := &CanvasOp{Object: patch.Object, Props: patch.Props}
+			if err := state.prepare(opType, canvasOp); err != nil {
+				return nil, err
+			}
+			// 合并结果基于文档当前版本, 覆盖已合入的修改; 每个补丁各占一个时间戳
+			state.Apply(opType, canvasOp, CanvasStamp{Counter: doc.Version, OpID: fmt.Sprintf("%s/%d", op.ID.String(), i)})
+		}
+		content, err := state.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode canvas state: %w", err)
+		}
+		return content, nil
+	}
+
+	objects := make(map[string]json.RawMessage)
+	if !isEmptyContent(doc.Content) {
+		if err := json.Unmarshal(doc.Content, &objects); err != nil {
+			return nil, fmt.Errorf("cannot apply merged operation to document content: %w", err)
+		}
+	}
+	for _, patch := range patches {
+		if patch.Deleted {
+			delete(objects, patch.Object)
+			continue
+		}
+		props := make(map[string]json.RawMessage)
+		if existing, ok := objects[patch.Object]; ok {
+			if err := json.Unmarshal(existing, &props); err != nil {
+				return nil, fmt.Errorf("cannot apply merged operation to object %s: %w", patch.Object, err)
+			}
+		}
+		for field, value := range patch.Props {
+			props[field] = value
+		}
+		data, err := json.Marshal(props)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode object %s: %w", patch.Object, err)
+		}
+		objects[patch.Object] = data
+	}
+
+	content, err := json.Marshal(objects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document content: %w", err)
+	}
+	return content, nil
+}
+
+// mergedOperation 合成合并后的操作: 基于各操作共同的最早版本, 用户和时间取最后一个操作
+func mergedOperation(sortedOps []*Operation, data []byte) *Operation {
+	latest := sortedOps[len(sortedOps)-1]
+	opType := sortedOps[0].Type
+	prevVersion := sortedOps[0].PrevVersion
+	ids := make([]string, len(sortedOps))
+	for i, op := range sortedOps {
+		if op.Type != opType {
+			opType = OperationTypeUpdate
+		}
+		prevVersion = min(prevVersion, op.PrevVersion)
+		ids[i] = op.ID.String()
+	}
+
+	id, _ := guuid.NewV7()
+	return &Operation{
+		ID:          id,
+		DocID:       latest.DocID,
+		UserID:      latest.UserID,
+		SessionID:   latest.SessionID,
+		Type:        opType,
+		Data:        data,
+		Timestamp:   latest.Timestamp,
+		PrevVersion: prevVersion,
+		Status:      OperationStatusResolved,
+		ClientID:    latest.ClientID,
+		Metadata: OpMetadata{
+			Extra: map[string]string{"merged_from": strings.Join(ids, ",")},
+		},
+	}
+}
+
+// jsonEqual 比较两个JSON值, 忽略空白
+func jsonEqual(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
+
+// ResolverRegistry 按文档类型注册冲突解决器, 未注册的类型使用 ManagerConfig.ConflictResolver
+type ResolverRegistry struct {
+	mu        sync.RWMutex
+	resolvers map[DocumentType]ConflictResolver
+}
+
+// NewResolverRegistry 创建冲突解决器注册表
+func NewResolverRegistry() *ResolverRegistry {
+	return &ResolverRegistry{
+		resolvers: make(map[DocumentType]ConflictResolver),
+	}
+}
+
+// Register 为文档类型注册冲突解决器, 覆盖已有的注册
+func (r *ResolverRegistry) Register(docType DocumentType, resolver ConflictResolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolvers[docType] = resolver
+}
+
+// Get 返回文档类型的冲突解决器
+func (r *ResolverRegistry) Get(docType DocumentType) (ConflictResolver, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	resolver, ok := r.resolvers[docType]
+	return resolver, ok
+}
+
 // ConflictDetector 冲突检测器
 type ConflictDetector struct {
 	logger *zap.Logger
@@ -256,6 +544,15 @@ func ResolveConflict(ctx context.Context, conflict *Conflict, resolver ConflictR
 
 	// 使用解决器解决冲突
 	resolvedOp, err := resolver.Resolve(ctx, conflict.Ops)
+	var partial *PartialConflictError
+	if errors.As(err, &partial) {
+		// 部分冲突: 记录已合并的部分和重叠字段, 冲突仍待解决
+		conflict.ResolvedOp = resolvedOp
+		conflict.Fields = partial.Fields
+		conflict.Resolution = resolver.GetStrategy()
+		conflict.Description = partial.Error()
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("failed to resolve conflict: %w", err)
 	}
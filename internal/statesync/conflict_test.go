@@ -0,0 +1,247 @@
+package statesync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	guuid "github.com/Lzww0608/GUUID"
+	"go.uber.org/zap"
+)
+
+// mergeOps 构造基于同一版本的一组操作, 时间戳依次递增
+func mergeOps(opType OperationType, data ...string) []*Operation {
+	docID, _ := guuid.NewV7()
+	base := time.Now()
+	ops := make([]*Operation, len(data))
+	for i, d := range data {
+		opID, _ := guuid.NewV7()
+		ops[i] = &Operation{
+			ID:          opID,
+			DocID:       docID,
+			UserID:      "user" + string(rune('1'+i)),
+			Type:        opType,
+			Data:        []byte(d),
+			Timestamp:   base.Add(time.Duration(i) * time.Millisecond),
+			PrevVersion: 3,
+			Status:      OperationStatusPending,
+		}
+	}
+	return ops
+}
+
+func TestMergeConflictResolver(t *testing.T) {
+	resolver := NewMergeConflictResolver(zap.NewNop())
+	ctx := context.Background()
+
+	// 不同对象、同一对象的不同属性、同一属性改成相同的值都能合并
+	ops := mergeOps(OperationTypeMove,
+		`{"object": "b", "props": {"x": 10}}`,
+		`{"object": "a", "props": {"x": 1, "y": 2}}`,
+		`{"object": "a", "props": {"fill": "red", "x": 1}}`,
+	)
+	merged, err := resolver.Resolve(ctx, ops)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	want := `[{"object":"a","props":{"fill":"red","x":1,"y":2}},{"object":"b","props":{"x":10}}]`
+	if string(merged.Data) != want {
+		t.Errorf("Expected %s, got %s", want, merged.Data)
+	}
+	if merged.Type != OperationTypeMove || merged.Status != OperationStatusResolved {
+		t.Errorf("Unexpected merged operation %s/%s", merged.Type, merged.Status)
+	}
+	if merged.UserID != "user3" || merged.PrevVersion != 3 {
+		t.Errorf("Expected latest user on the common base, got %s at %d", merged.UserID, merged.PrevVersion)
+	}
+
+	// 同一属性的不同值是部分冲突, 其余修改照常合并
+	ops = mergeOps(OperationTypeUpdate,
+		`{"object": "a", "props": {"x": 1, "y": 2}}`,
+		`{"object": "a", "props": {"x": 5}}`,
+		`[{"object": "b"}, {"object": "c", "props": {"w": 3}}]`,
+	)
+	ops[2].Type = OperationTypeDelete
+	merged, err = resolver.Resolve(ctx, ops)
+	var partial *PartialConflictError
+	if !errors.As(err, &partial) {
+		t.Fatalf("Expected partial conflict, got %v", err)
+	}
+	wantFields := []ConflictField{{Object: "a", Field: "x", OpIDs: []guuid.UUID{ops[0].ID, ops[1].ID}}}
+	if !reflect.DeepEqual(partial.Fields, wantFields) {
+		t.Errorf("Expected %+v, got %+v", wantFields, partial.Fields)
+	}
+	want = `[{"object":"a","props":{"y":2}},{"object":"b","deleted":true},{"object":"c","deleted":true}]`
+	if merged == nil || string(merged.Data) != want {
+		t.Errorf("Expected %s, got %s", want, merged.Data)
+	}
+	if merged.Type != OperationTypeUpdate {
+		t.Errorf("Expected mixed operations to merge into update, got %s", merged.Type)
+	}
+
+	// 删除与同一对象上的修改重叠
+	ops = mergeOps(OperationTypeUpdate,
+		`{"object": "a", "props": {"x": 1}}`,
+		`{"object": "a"}`,
+	)
+	ops[1].Type = OperationTypeDelete
+	merged, err = resolver.Resolve(ctx, ops)
+	if !errors.As(err, &partial) || len(partial.Fields) != 1 || partial.Fields[0].Field != "" {
+		t.Fatalf("Expected the deleted object to conflict, got %v", err)
+	}
+	if string(merged.Data) != "[]" {
+		t.Errorf("Expected nothing to merge, got %s", merged.Data)
+	}
+
+	// 无法解析的操作
+	ops = mergeOps(OperationTypeUpdate, `{"x": 1}`, `{"object": "a"}`)
+	if _, err := resolver.Resolve(ctx, ops); err == nil || errors.As(err, &partial) {
+		t.Errorf("Expected operation without object id to be rejected, got %v", err)
+	}
+}
+
+func TestManager_ResolverRegistry(t *testing.T) {
+	logger := zap.NewNop()
+	registry := NewResolverRegistry()
+	registry.Register(DocumentTypeSheet, NewMergeConflictResolver(logger))
+
+	manager, err := NewManager(&ManagerConfig{
+		Store:                NewMemoryStore(),
+		Logger:               logger,
+		Resolvers:            registry,
+		AutoResolveConflicts: true,
+	})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	store := manager.GetStore()
+
+	// conflictOn 在表格文档上制造一个冲突: 文档中已有冲突操作不涉及的单元格C3,
+	// 一个基于旧版本的待处理操作, 再提交另一个
+	conflictOn := func(pending, incoming string) (*Operation, *Conflict) {
+		doc, _ := manager.CreateDocument(ctx, "Sheet", DocumentTypeSheet, "user1", []byte("{}"))
+		for v := doc.Version; v < 3; v++ {
+			opID, _ := guuid.NewV7()
+			_ = manager.ApplyOperation(ctx, &Operation{ID: opID, DocID: doc.ID, UserID: "user1",
+				Type: OperationTypeUpdate, Data: []byte(`{"C3": {"value": 3}}`), PrevVersion: v})
+		}
+
+		opID, _ := guuid.NewV7()
+		_ = store.CreateOperation(ctx, &Operation{ID: opID, DocID: doc.ID, UserID: "user2",
+			Type: OperationTypeUpdate, Data: []byte(pending), Timestamp: time.Now(),
+			PrevVersion: 1, Status: OperationStatusPending})
+
+		opID, _ = guuid.NewV7()
+		op := &Operation{ID: opID, DocID: doc.ID, UserID: "user3",
+			Type: OperationTypeUpdate, Data: []byte(incoming), Timestamp: time.Now(),
+			PrevVersion: 2, Status: OperationStatusPending}
+		if err := manager.ApplyOperation(ctx, op); err != nil {
+			t.Fatalf("ApplyOperation failed: %v", err)
+		}
+
+		conflicts, _ := store.ListConflicts(ctx, doc.ID)
+		if len(conflicts) != 1 {
+			t.Fatalf("Expected 1 conflict, got %d", len(conflicts))
+		}
+		return op, conflicts[0]
+	}
+
+	// 不重叠的修改由注册的合并解决器合并
+	op, conflict := conflictOn(`{"object": "A1", "props": {"value": 1}}`, `{"object": "B2", "props": {"value": 2}}`)
+	if op.Status != OperationStatusResolved {
+		t.Errorf("Expected operation resolved, got %s", op.Status)
+	}
+	if conflict.Resolution != ConflictResolutionMerge || conflict.ResolvedOp == nil {
+		t.Fatalf("Expected merge resolution, got %s", conflict.Resolution)
+	}
+	want := `[{"object":"A1","props":{"value":1}},{"object":"B2","props":{"value":2}}]`
+	if string(conflict.ResolvedOp.Data) != want {
+		t.Errorf("Expected %s, got %s", want, conflict.ResolvedOp.Data)
+	}
+
+	// 合并后的补丁应用到文档内容上作为新版本提交, 未涉及的C3保持不变
+	doc, _ := manager.GetDocument(ctx, op.DocID)
+	if doc.Version != 4 {
+		t.Errorf("Expected version 4, got %d", doc.Version)
+	}
+	var cells map[string]map[string]int
+	if err := json.Unmarshal(doc.Content, &cells); err != nil {
+		t.Fatalf("Expected content to stay a JSON object of cells, got %s: %v", doc.Content, err)
+	}
+	wantCells := map[string]map[string]int{"A1": {"value": 1}, "B2": {"value": 2}, "C3": {"value": 3}}
+	if !reflect.DeepEqual(cells, wantCells) {
+		t.Errorf("Expected %v, got %v", wantCells, cells)
+	}
+	if conflict.ResolvedOp.Version != 4 || conflict.ResolvedOp.Status != OperationStatusApplied {
+		t.Errorf("Expected resolved operation applied at version 4, got %d (%s)", conflict.ResolvedOp.Version, conflict.ResolvedOp.Status)
+	}
+	if _, err := store.GetOperation(ctx, conflict.ResolvedOp.ID); err != nil {
+		t.Errorf("Expected resolved operation recorded: %v", err)
+	}
+
+	// 重叠的字段作为部分冲突保存, 冲突仍待解决
+	op, conflict = conflictOn(`{"object": "A1", "props": {"value": 1, "bold": true}}`, `{"object": "A1", "props": {"value": 2}}`)
+	if op.Status != OperationStatusConflict {
+		t.Errorf("Expected operation in conflict, got %s", op.Status)
+	}
+	if len(conflict.Fields) != 1 || conflict.Fields[0].Field != "value" || !conflict.ResolvedAt.IsZero() {
+		t.Errorf("Expected unresolved conflict on A1.value, got %+v", conflict)
+	}
+	if conflict.ResolvedOp == nil || string(conflict.ResolvedOp.Data) != `[{"object":"A1","props":{"bold":true}}]` {
+		t.Errorf("Expected the bold change to be merged, got %+v", conflict.ResolvedOp)
+	}
+
+	// 部分冲突待解决, 文档保持不变
+	if doc, _ := manager.GetDocument(ctx, op.DocID); doc.Version != 3 {
+		t.Errorf("Expected document left at version 3, got %d", doc.Version)
+	}
+}
+
+func TestApplyMergedOperation_Canvas(t *testing.T) {
+	state, _ := ParseCanvasState(nil)
+	applyCanvas(t, state, OperationTypeCreate, `{"object":"a","props":{"x":0,"fill":"red"}}`, CanvasStamp{Counter: 1, OpID: "1"})
+	applyCanvas(t, state, OperationTypeCreate, `{"object":"b","props":{"x":0}}`, CanvasStamp{Counter: 2, OpID: "2"})
+	applyCanvas(t, state, OperationTypeCreate, `{"object":"c","props":{"x":0}}`, CanvasStamp{Counter: 3, OpID: "3"})
+	content, _ := state.Marshal()
+
+	docID, _ := guuid.NewV7()
+	doc := &Document{ID: docID, Type: DocumentTypeCanvas, Version: 4, Content: content}
+	opID, _ := guuid.NewV7()
+	merged := &Operation{ID: opID, DocID: docID, Type: OperationTypeUpdate, PrevVersion: 3,
+		Data: []byte(`[{"object":"a","props":{"x":10}},{"object":"b","deleted":true}]`)}
+
+	updated, err := applyMergedOperation(doc, merged)
+	if err != nil {
+		t.Fatalf("applyMergedOperation failed: %v", err)
+	}
+
+	// 结果仍是CRDT状态: 补丁并入a, 删除b, 未涉及的c保持不变
+	result, err := ParseCanvasState(updated)
+	if err != nil {
+		t.Fatalf("Expected canvas state, got %s: %v", updated, err)
+	}
+	if a, _ := result.Props("a"); string(a["x"]) != "10" || string(a["fill"]) != `"red"` {
+		t.Errorf("Expected a moved and still red, got %s", a)
+	}
+	if _, ok := result.Props("b"); ok {
+		t.Error("Expected b deleted")
+	}
+	if c, ok := result.Props("c"); !ok || string(c["x"]) != "0" {
+		t.Errorf("Expected c untouched, got %s", c)
+	}
+	if order := result.Order(); !reflect.DeepEqual(order, []string{"a", "c"}) {
+		t.Errorf("Expected [a c], got %v", order)
+	}
+
+	// 不是JSON对象的内容无法合入
+	doc = &Document{ID: docID, Type: DocumentTypeSheet, Version: 4, Content: []byte(`[1,2]`)}
+	if _, err := applyMergedOperation(doc, merged); err == nil {
+		t.Error("Expected merging into non-object content to fail")
+	}
+}
@@ -0,0 +1,326 @@
+package statesync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// 白板/画布文档的CRDT状态
+//
+// 白板和画布由一个个对象 (图形) 组成, 文档内容 (Document.Content) 是以下状态的序列化:
+//   - 对象表: 对象ID到对象的LWW-element map, 创建与删除各带一个时间戳, 后者较新时对象不可见
+//   - 属性寄存器: 每个对象的每个属性 (x、y、width、fill…) 是一个独立的LWW寄存器
+//   - 层级序列: z-order 是一个RGA序列, 调整层级即在新位置插入元素, 对象只认最新的元素
+//
+// 操作的时间戳由 PrevVersion 和操作ID组成。看到过某操作的后续操作 PrevVersion 必然更大,
+// 因此总是覆盖它; 互不知情的并发操作则比较操作ID, 结果与应用顺序无关。
+// 于是并发修改不同对象或同一对象的不同属性都会自动合并,
+// 只有同时修改同一对象的同一属性时才按时间戳决出胜者。
+//
+// 旧客户端把整个白板作为一块内容写入 Content, 这类文档和不带对象ID的操作仍走LWW。
+// 状态带有 format 标记以便与旧内容区分, 只有空白文档 (内容为空、{} 或 null) 或已是CRDT状态的文档才合并对象操作。
+
+var (
+	ErrInvalidCanvasOp    = errors.New("invalid canvas operation")
+	ErrInvalidCanvasState = errors.New("invalid canvas state")
+)
+
+// CanvasStamp CRDT时间戳
+type CanvasStamp struct {
+	Counter uint64 `json:"counter"` // 操作所基于的文档版本
+	OpID    string `json:"op_id"`   // 操作ID, 用于并发操作间的排序
+}
+
+// canvasStamp 返回操作的时间戳
+func canvasStamp(op *Operation) CanvasStamp {
+	return CanvasStamp{Counter: op.PrevVersion, OpID: op.ID.String()}
+}
+
+// Less 判断时间戳是否早于另一个
+func (s CanvasStamp) Less(other CanvasStamp) bool {
+	if s.Counter != other.Counter {
+		return s.Counter < other.Counter
+	}
+	return s.OpID < other.OpID
+}
+
+// IsZero 判断是否为零值 (层级序列的起点)
+func (s CanvasStamp) IsZero() bool {
+	return s == CanvasStamp{}
+}
+
+// CanvasRegister 属性的LWW寄存器
+type CanvasRegister struct {
+	Value json.RawMessage `json:"value"`
+	Stamp CanvasStamp     `json:"stamp"`
+}
+
+// CanvasObject 白板对象
+type CanvasObject struct {
+	Created CanvasStamp               `json:"created"`           // 最近一次创建
+	Deleted *CanvasStamp              `json:"deleted,omitempty"` // 最近一次删除
+	Props   map[string]CanvasRegister `json:"props"`             // 属性
+	Layer   CanvasStamp               `json:"layer"`             // 当前所在的层级序列元素
+}
+
+// visible 判断对象是否存在: 已创建且创建晚于删除
+func (o *CanvasObject) visible() bool {
+	if o.Created.IsZero() {
+		return false
+	}
+	return o.Deleted == nil || o.Deleted.Less(o.Created)
+}
+
+// CanvasLayer 层级序列元素, 位于 After 元素之后 (之上)
+type CanvasLayer struct {
+	ID     CanvasStamp `json:"id"`
+	After  CanvasStamp `json:"after"` // 零值表示序列起点 (最底层)
+	Object string      `json:"object"`
+}
+
+// canvasStateFormat CRDT状态的格式标记
+const canvasStateFormat = "canvas-crdt/v1"
+
+// CanvasState 白板/画布文档状态
+type CanvasState struct {
+	Format  string                   `json:"format"`
+	Objects map[string]*CanvasObject `json:"objects"`
+	Layers  []CanvasLayer            `json:"layers"`
+}
+
+// ParseCanvasState 解析文档内容, 空内容 (包括 {} 和 null) 为空白板;
+// 不是CRDT状态的内容 (如旧客户端写入的整块内容) 返回错误
+func ParseCanvasState(content []byte) (*CanvasState, error) {
+	state := &CanvasState{Format: canvasStateFormat}
+	if !isEmptyContent(content) {
+		state.Format = ""
+		if err := json.Unmarshal(content, state); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCanvasState, err)
+		}
+		if state.Format != canvasStateFormat {
+			return nil, fmt.Errorf("%w: content is not a canvas CRDT state", ErrInvalidCanvasState)
+		}
+	}
+	if state.Objects == nil {
+		state.Objects = make(map[string]*CanvasObject)
+	}
+	return state, nil
+}
+
+// Marshal 序列化状态
+func (s *CanvasState) Marshal() ([]byte, error) {
+	s.Format = canvasStateFormat
+	return json.Marshal(s)
+}
+
+// isEmptyContent 判断文档内容是否为空: 无内容、{} 或 null
+func isEmptyContent(content []byte) bool {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return true
+	}
+	var fields map[string]json.RawMessage
+	return json.Unmarshal(content, &fields) == nil && len(fields) == 0
+}
+
+// isCanvasContent 判断文档内容能否按CRDT合并: 为空或已是CRDT状态
+func isCanvasContent(content []byte) bool {
+	if isEmptyContent(content) {
+		return true
+	}
+	var probe struct {
+		Format string `json:"format"`
+	}
+	return json.Unmarshal(content, &probe) == nil && probe.Format == canvasStateFormat
+}
+
+// Props 返回对象当前的属性, 对象不存在时返回false
+func (s *CanvasState) Props(id string) (map[string]json.RawMessage, bool) {
+	obj, ok := s.Objects[id]
+	if !ok || !obj.visible() {
+		return nil, false
+	}
+	props := make(map[string]json.RawMessage, len(obj.Props))
+	for name, reg := range obj.Props {
+		props[name] = reg.Value
+	}
+	return props, true
+}
+
+// Order 返回存在的对象从底层到顶层的顺序
+func (s *CanvasState) Order() []string {
+	var order []string
+	for _, layer := range s.sequence() {
+		obj := s.Objects[layer.Object]
+		if obj != nil && obj.Layer == layer.ID && obj.visible() {
+			order = append(order, layer.Object)
+		}
+	}
+	return order
+}
+
+// sequence 按RGA规则展开层级序列: 每个元素紧跟在 After 元素之后,
+// 同一位置的多个元素较新的在前
+func (s *CanvasState) sequence() []*CanvasLayer {
+	children := make(map[CanvasStamp][]*CanvasLayer)
+	for i := range s.Layers {
+		layer := &s.Layers[i]
+		children[layer.After] = append(children[layer.After], layer)
+	}
+	for _, c := range children {
+		sort.Slice(c, func(i, j int) bool { return c[j].ID.Less(c[i].ID) })
+	}
+
+	// 先序遍历, 较新的子元素先出栈
+	seq := make([]*CanvasLayer, 0, len(s.Layers))
+	stack := make([]*CanvasLayer, 0, len(s.Layers))
+	push := func(parent CanvasStamp) {
+		c := children[parent]
+		for i := len(c) - 1; i >= 0; i-- {
+			stack = append(stack, c[i])
+		}
+	}
+	push(CanvasStamp{})
+	for len(stack) > 0 {
+		layer := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		seq = append(seq, layer)
+		push(layer.ID)
+	}
+	return seq
+}
+
+// CanvasOp 白板/画布操作, 序列化后作为 Operation.Data, 如:
+// {"object":"shape1","props":{"x":100,"y":200},"z":"front"}
+type CanvasOp struct {
+	Object string                     `json:"object"`          // 对象ID
+	Props  map[string]json.RawMessage `json:"props,omitempty"` // 要设置的属性
+	Z      string                     `json:"z,omitempty"`     // 层级调整: front 置顶, back 置底
+	Above  string                     `json:"above,omitempty"` // 层级调整: 放在该对象之上
+	After  *CanvasStamp               `json:"after,omitempty"` // 服务端解析出的层级位置, 客户端无需填写
+}
+
+// 层级调整
+const (
+	CanvasZFront = "front"
+	CanvasZBack  = "back"
+)
+
+// isCanvasOperation 判断操作类型是否作用于白板对象
+func isCanvasOperation(t OperationType) bool {
+	switch t {
+	case OperationTypeCreate, OperationTypeUpdate, OperationTypeDelete,
+		OperationTypeMove, OperationTypeResize, OperationTypeStyle:
+		return true
+	}
+	return false
+}
+
+// isCanvasOpData 判断操作数据是否为白板对象操作, 即带有字符串类型的 object 字段;
+// 其他数据是旧客户端的整块内容
+func isCanvasOpData(data []byte) bool {
+	var probe struct {
+		Object json.RawMessage `json:"object"`
+	}
+	if json.Unmarshal(data, &probe) != nil {
+		return false
+	}
+	return len(probe.Object) > 0 && probe.Object[0] == '"'
+}
+
+// ParseCanvasOp 解析并校验 Operation.Data 中的白板操作
+func ParseCanvasOp(data []byte) (*CanvasOp, error) {
+	op := &CanvasOp{}
+	if err := json.Unmarshal(data, op); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCanvasOp, err)
+	}
+	if op.Object == "" {
+		return nil, fmt.Errorf("%w: missing object id", ErrInvalidCanvasOp)
+	}
+	if op.Z != "" && op.Z != CanvasZFront && op.Z != CanvasZBack {
+		return nil, fmt.Errorf("%w: unknown z %q", ErrInvalidCanvasOp, op.Z)
+	}
+	if op.Z != "" && op.Above != "" {
+		return nil, fmt.Errorf("%w: both z and above given", ErrInvalidCanvasOp)
+	}
+	return op, nil
+}
+
+// prepare 在当前状态上把相对的层级调整解析为序列位置 (After)。
+// 解析后的操作可在任意状态上以任意顺序应用, 结果相同。新建的对象默认置顶。
+func (s *CanvasState) prepare(opType OperationType, op *CanvasOp) error {
+	z := op.Z
+	if z == "" && op.Above == "" {
+		if opType != OperationTypeCreate {
+			return nil
+		}
+		z = CanvasZFront
+	}
+
+	after := CanvasStamp{}
+	switch {
+	case op.Above != "":
+		target, ok := s.Objects[op.Above]
+		if !ok || !target.visible() {
+			return fmt.Errorf("%w: object %s not found", ErrInvalidCanvasOp, op.Above)
+		}
+		after = target.Layer
+	case z == CanvasZFront:
+		if seq := s.sequence(); len(seq) > 0 {
+			after = seq[len(seq)-1].ID
+		}
+	}
+	op.After = &after
+	return nil
+}
+
+// Apply 以时间戳 stamp 合入一个已解析的操作。
+// 合入满足交换律、结合律和幂等性, 各副本以任意顺序收到同一组操作后状态一致。
+func (s *CanvasState) Apply(opType OperationType, op *CanvasOp, stamp CanvasStamp) {
+	obj, ok := s.Objects[op.Object]
+	if !ok {
+		// 对象可能在创建之前先收到修改, 先占位
+		obj = &CanvasObject{Props: make(map[string]CanvasRegister)}
+		s.Objects[op.Object] = obj
+	}
+	if obj.Props == nil {
+		obj.Props = make(map[string]CanvasRegister)
+	}
+
+	switch opType {
+	case OperationTypeCreate:
+		if obj.Created.Less(stamp) {
+			obj.Created = stamp
+		}
+	case OperationTypeDelete:
+		if obj.Deleted == nil || obj.Deleted.Less(stamp) {
+			deleted := stamp
+			obj.Deleted = &deleted
+		}
+		return
+	}
+
+	for name, value := range op.Props {
+		if reg, ok := obj.Props[name]; !ok || reg.Stamp.Less(stamp) {
+			obj.Props[name] = CanvasRegister{Value: value, Stamp: stamp}
+		}
+	}
+
+	if op.After != nil {
+		exists := false
+		for _, layer := range s.Layers {
+			if layer.ID == stamp {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			s.Layers = append(s.Layers, CanvasLayer{ID: stamp, After: *op.After, Object: op.Object})
+		}
+		if obj.Layer.Less(stamp) {
+			obj.Layer = stamp
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package statesync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	guuid "github.com/Lzww0608/GUUID"
+)
+
+// applyCanvas 解析并在状态上应用一个操作
+func applyCanvas(t *testing.T, state *CanvasState, opType OperationType, data string, stamp CanvasStamp) *CanvasOp {
+	t.Helper()
+
+	op, err := ParseCanvasOp([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseCanvasOp failed: %v", err)
+	}
+	if err := state.prepare(opType, op); err != nil {
+		t.Fatalf("prepare failed: %v", err)
+	}
+	state.Apply(opType, op, stamp)
+	return op
+}
+
+func TestCanvasState_Apply(t *testing.T) {
+	state, err := ParseCanvasState(nil)
+	if err != nil {
+		t.Fatalf("ParseCanvasState failed: %v", err)
+	}
+	stamp := func(n uint64) CanvasStamp { return CanvasStamp{Counter: n, OpID: fmt.Sprint(n)} }
+
+	applyCanvas(t, state, OperationTypeCreate, `{"object":"a","props":{"x":0,"fill":"red"}}`, stamp(1))
+	applyCanvas(t, state, OperationTypeCreate, `{"object":"b","props":{"x":10}}`, stamp(2))
+	applyCanvas(t, state, OperationTypeCreate, `{"object":"c"}`, stamp(3))
+	if order := state.Order(); !reflect.DeepEqual(order, []string{"a", "b", "c"}) {
+		t.Errorf("Expected new objects on top, got %v", order)
+	}
+
+	// 不同属性各自保留最新的值, 较旧的修改被忽略
+	applyCanvas(t, state, OperationTypeMove, `{"object":"a","props":{"x":5}}`, stamp(5))
+	applyCanvas(t, state, OperationTypeStyle, `{"object":"a","props":{"x":3,"fill":"blue"}}`, stamp(4))
+	props, _ := state.Props("a")
+	if string(props["x"]) != "5" || string(props["fill"]) != `"blue"` {
+		t.Errorf("Expected x 5 and fill blue, got %s", props)
+	}
+
+	// 层级调整
+	applyCanvas(t, state, OperationTypeUpdate, `{"object":"c","z":"back"}`, stamp(6))
+	applyCanvas(t, state, OperationTypeUpdate, `{"object":"a","above":"b"}`, stamp(7))
+	if order := state.Order(); !reflect.DeepEqual(order, []string{"c", "b", "a"}) {
+		t.Errorf("Expected [c b a], got %v", order)
+	}
+
+	// 删除后修改不会恢复对象, 重新创建会
+	applyCanvas(t, state, OperationTypeDelete, `{"object":"b"}`, stamp(8))
+	applyCanvas(t, state, OperationTypeMove, `{"object":"b","props":{"x":20}}`, stamp(9))
+	if _, ok := state.Props("b"); ok {
+		t.Error("Expected b to stay deleted")
+	}
+	if order := state.Order(); !reflect.DeepEqual(order, []string{"c", "a"}) {
+		t.Errorf("Expected [c a], got %v", order)
+	}
+	applyCanvas(t, state, OperationTypeCreate, `{"object":"b"}`, stamp(10))
+	if props, ok := state.Props("b"); !ok || string(props["x"]) != "20" {
+		t.Errorf("Expected b recreated at x 20, got %s", props)
+	}
+
+	// 序列化往返
+	data, err := state.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	parsed, err := ParseCanvasState(data)
+	if err != nil {
+		t.Fatalf("ParseCanvasState failed: %v", err)
+	}
+	if !reflect.DeepEqual(parsed.Order(), state.Order()) {
+		t.Errorf("Expected %v after round trip, got %v", state.Order(), parsed.Order())
+	}
+
+	for _, invalid := range []string{`[]`, `{}`, `{"object":"a","z":"top"}`, `{"object":"a","z":"front","above":"b"}`} {
+		if _, err := ParseCanvasOp([]byte(invalid)); err == nil {
+			t.Errorf("Expected %s to be rejected", invalid)
+		}
+	}
+	if err := state.prepare(OperationTypeUpdate, &CanvasOp{Object: "a", Above: "missing"}); err == nil {
+		t.Error("Expected placing above a missing object to be rejected")
+	}
+
+	// 旧客户端写入的整块内容不是CRDT状态
+	for _, legacy := range []string{`{"x":100}`, `{"objects":{}}`, `not json`} {
+		if _, err := ParseCanvasState([]byte(legacy)); !errors.Is(err, ErrInvalidCanvasState) {
+			t.Errorf("Expected %s to be rejected as canvas state, got %v", legacy, err)
+		}
+		if isCanvasContent([]byte(legacy)) {
+			t.Errorf("Expected %s not to be treated as canvas state", legacy)
+		}
+	}
+	for _, empty := range []string{``, ` `, `{}`, `{ }`, `null`} {
+		parsed, err := ParseCanvasState([]byte(empty))
+		if err != nil || len(parsed.Objects) != 0 {
+			t.Errorf("Expected %q to parse as an empty canvas, got %v", empty, err)
+		}
+		if !isCanvasContent([]byte(empty)) {
+			t.Errorf("Expected %q to be treated as canvas state", empty)
+		}
+	}
+	if !isCanvasContent(data) {
+		t.Error("Expected marshalled state to be canvas state")
+	}
+	for data, want := range map[string]bool{
+		`{"object":"a"}`:        true,
+		`{"object":""}`:         true,
+		`{"object":{"id":"a"}}`: false,
+		`{"x":100}`:             false,
+		`{}`:                    false,
+		`blob`:                  false,
+	} {
+		if got := isCanvasOpData([]byte(data)); got != want {
+			t.Errorf("isCanvasOpData(%s) = %v, want %v", data, got, want)
+		}
+	}
+}
+
+// canvasView 返回状态的可见部分: 对象属性和层级顺序
+func canvasView(state *CanvasState) (map[string]map[string]json.RawMessage, []string) {
+	objects := make(map[string]map[string]json.RawMessage)
+	for id := range state.Objects {
+		if props, ok := state.Props(id); ok {
+			objects[id] = props
+		}
+	}
+	return objects, state.Order()
+}
+
+func TestCanvasState_Convergence(t *testing.T) {
+	type appliedOp struct {
+		opType OperationType
+		op     *CanvasOp
+		stamp  CanvasStamp
+	}
+	types := []OperationType{
+		OperationTypeCreate, OperationTypeUpdate, OperationTypeDelete,
+		OperationTypeMove, OperationTypeResize, OperationTypeStyle,
+	}
+	zs := []string{"", "", CanvasZFront, CanvasZBack}
+
+	for seed := int64(1); seed <= 50; seed++ {
+		r := rand.New(rand.NewSource(seed))
+
+		// 在服务端依次解析操作, 时间戳中的版本随机落后以模拟并发
+		server, _ := ParseCanvasState(nil)
+		var ops []appliedOp
+		for i := 0; i < 60; i++ {
+			op := &CanvasOp{Object: fmt.Sprintf("shape%d", r.Intn(5))}
+			if r.Intn(2) == 0 {
+				op.Props = map[string]json.RawMessage{
+					[]string{"x", "y", "fill"}[r.Intn(3)]: json.RawMessage(fmt.Sprint(r.Intn(100))),
+				}
+			}
+			op.Z = zs[r.Intn(len(zs))]
+			opType := types[r.Intn(len(types))]
+			if err := server.prepare(opType, op); err != nil {
+				t.Fatalf("prepare failed: %v", err)
+			}
+			stamp := CanvasStamp{Counter: uint64(max(0, i-r.Intn(5))), OpID: fmt.Sprintf("op%03d", i)}
+			server.Apply(opType, op, stamp)
+			ops = append(ops, appliedOp{opType, op, stamp})
+		}
+		wantObjects, wantOrder := canvasView(server)
+
+		// 各副本以不同顺序收到操作, 部分操作重复收到
+		for replica := 0; replica < 5; replica++ {
+			state, _ := ParseCanvasState(nil)
+			for _, i := range r.Perm(len(ops)) {
+				state.Apply(ops[i].opType, ops[i].op, ops[i].stamp)
+				if r.Intn(10) == 0 {
+					state.Apply(ops[i].opType, ops[i].op, ops[i].stamp)
+				}
+			}
+			objects, order := canvasView(state)
+			if !reflect.DeepEqual(objects, wantObjects) || !reflect.DeepEqual(order, wantOrder) {
+				t.Fatalf("seed %d: replica %d diverged: %v %v, want %v %v",
+					seed, replica, objects, order, wantObjects, wantOrder)
+			}
+		}
+	}
+}
+
+func TestManager_CanvasConcurrentEdits(t *testing.T) {
+	manager := createTestManager(t)
+	defer manager.Close()
+
+	ctx := context.Background()
+	doc, _ := manager.CreateDocument(ctx, "Board", DocumentTypeCanvas, "user1", nil)
+
+	apply := func(user string, opType OperationType, data string, prevVersion uint64) *Operation {
+		opID, _ := guuid.NewV7()
+		op := &Operation{
+			ID:          opID,
+			DocID:       doc.ID,
+			UserID:      user,
+			Type:        opType,
+			Data:        []byte(data),
+			PrevVersion: prevVersion,
+			Status:      OperationStatusPending,
+		}
+		if err := manager.ApplyOperation(ctx, op); err != nil {
+			t.Fatalf("ApplyOperation failed: %v", err)
+		}
+		return op
+	}
+
+	apply("user1", OperationTypeCreate, `{"object":"a","props":{"x":0,"y":0}}`, 1)
+	apply("user1", OperationTypeCreate, `{"object":"b","props":{"x":0,"y":0}}`, 2)
+
+	// 基于同一版本的并发操作: 移动不同对象, 以及同一对象的不同属性
+	apply("user1", OperationTypeMove, `{"object":"a","props":{"x":10,"y":10}}`, 3)
+	apply("user2", OperationTypeMove, `{"object":"b","props":{"x":20,"y":20}}`, 3)
+	apply("user3", OperationTypeStyle, `{"object":"a","props":{"fill":"red"},"z":"front"}`, 3)
+
+	// 同一属性的并发修改
+	op1 := apply("user1", OperationTypeResize, `{"object":"b","props":{"width":100}}`, 5)
+	op2 := apply("user2", OperationTypeResize, `{"object":"b","props":{"width":200}}`, 5)
+
+	updated, _ := manager.GetDocument(ctx, doc.ID)
+	if updated.Version != 8 {
+		t.Errorf("Expected version 8, got %d", updated.Version)
+	}
+	state, err := ParseCanvasState(updated.Content)
+	if err != nil {
+		t.Fatalf("ParseCanvasState failed: %v", err)
+	}
+
+	a, _ := state.Props("a")
+	if string(a["x"]) != "10" || string(a["fill"]) != `"red"` {
+		t.Errorf("Expected a moved and styled, got %s", a)
+	}
+	b, _ := state.Props("b")
+	if string(b["x"]) != "20" {
+		t.Errorf("Expected b moved, got %s", b)
+	}
+	want := "100"
+	if canvasStamp(op1).Less(canvasStamp(op2)) {
+		want = "200"
+	}
+	if string(b["width"]) != want {
+		t.Errorf("Expected width %s, got %s", want, b["width"])
+	}
+	if order := state.Order(); !reflect.DeepEqual(order, []string{"b", "a"}) {
+		t.Errorf("Expected [b a], got %v", order)
+	}
+
+	if n, _ := manager.GetStore().CountConflicts(ctx, &doc.ID); n != 0 {
+		t.Errorf("Expected no conflicts, got %d", n)
+	}
+
+	// 保存的操作带有解析后的层级位置
+	ops, _ := manager.GetOperationHistory(ctx, doc.ID, 10)
+	for _, op := range ops {
+		parsed, err := ParseCanvasOp(op.Data)
+		if err != nil {
+			t.Fatalf("ParseCanvasOp failed: %v", err)
+		}
+		if (op.Type == OperationTypeCreate || parsed.Z != "") && parsed.After == nil {
+			t.Errorf("Expected %s operation to carry its layer position", op.Type)
+		}
+	}
+}
+
+func TestManager_CanvasEmptyObjectContent(t *testing.T) {
+	manager := createTestManager(t)
+	defer manager.Close()
+
+	ctx := context.Background()
+
+	// 以 {} 创建的白板同样按CRDT合并
+	doc, _ := manager.CreateDocument(ctx, "Board", DocumentTypeWhiteboard, "user1", []byte("{}"))
+	for i, data := range []string{
+		`{"object":"a","props":{"x":0}}`,
+		`{"object":"b","props":{"x":0}}`,
+	} {
+		opID, _ := guuid.NewV7()
+		op := &Operation{ID: opID, DocID: doc.ID, UserID: "user1", Type: OperationTypeCreate,
+			Data: []byte(data), PrevVersion: uint64(i + 1), Status: OperationStatusPending}
+		if err := manager.ApplyOperation(ctx, op); err != nil {
+			t.Fatalf("ApplyOperation failed: %v", err)
+		}
+	}
+
+	// 基于同一版本并发移动不同对象, 两者都保留
+	for _, data := range []string{
+		`{"object":"a","props":{"x":10}}`,
+		`{"object":"b","props":{"x":20}}`,
+	} {
+		opID, _ := guuid.NewV7()
+		op := &Operation{ID: opID, DocID: doc.ID, UserID: "user2", Type: OperationTypeMove,
+			Data: []byte(data), PrevVersion: 3, Status: OperationStatusPending}
+		if err := manager.ApplyOperation(ctx, op); err != nil {
+			t.Fatalf("ApplyOperation failed: %v", err)
+		}
+	}
+
+	updated, _ := manager.GetDocument(ctx, doc.ID)
+	state, err := ParseCanvasState(updated.Content)
+	if err != nil {
+		t.Fatalf("Expected canvas state, got %s: %v", updated.Content, err)
+	}
+	a, _ := state.Props("a")
+	b, _ := state.Props("b")
+	if string(a["x"]) != "10" || string(b["x"]) != "20" {
+		t.Errorf("Expected both moves kept, got a %s and b %s", a, b)
+	}
+	if n, _ := manager.GetStore().CountConflicts(ctx, &doc.ID); n != 0 {
+		t.Errorf("Expected no conflicts, got %d", n)
+	}
+}
+
+func TestManager_CanvasLegacyContent(t *testing.T) {
+	manager := createTestManager(t)
+	defer manager.Close()
+
+	ctx := context.Background()
+
+	apply := func(doc *Document, opType OperationType, data string) *Document {
+		opID, _ := guuid.NewV7()
+		op := &Operation{
+			ID:          opID,
+			DocID:       doc.ID,
+			UserID:      "user1",
+			Type:        opType,
+			Data:        []byte(data),
+			PrevVersion: doc.Version,
+			Status:      OperationStatusPending,
+		}
+		if err := manager.ApplyOperation(ctx, op); err != nil {
+			t.Fatalf("ApplyOperation failed: %v", err)
+		}
+		updated, _ := manager.GetDocument(ctx, doc.ID)
+		return updated
+	}
+
+	// 存有整块内容的文档, 对象操作也按LWW整体覆盖, 原内容不会被当作CRDT状态解析丢弃
+	legacy, _ := manager.CreateDocument(ctx, "Legacy", DocumentTypeWhiteboard, "user1", []byte(`{"shapes":[1,2]}`))
+	legacy = apply(legacy, OperationTypeMove, `{"object":"shape1","props":{"x":100}}`)
+	if string(legacy.Content) != `{"object":"shape1","props":{"x":100}}` {
+		t.Errorf("Expected legacy document content replaced, got %s", legacy.Content)
+	}
+
+	// CRDT文档上旧客户端的整块内容同样按LWW写入
+	board, _ := manager.CreateDocument(ctx, "Board", DocumentTypeWhiteboard, "user1", nil)
+	board = apply(board, OperationTypeCreate, `{"object":"shape1","props":{"x":100}}`)
+	if !isCanvasContent(board.Content) {
+		t.Fatalf("Expected canvas state, got %s", board.Content)
+	}
+	board = apply(board, OperationTypeUpdate, `{"shapes":[3]}`)
+	if string(board.Content) != `{"shapes":[3]}` {
+		t.Errorf("Expected content replaced by legacy update, got %s", board.Content)
+	}
+	if board.Version != 3 {
+		t.Errorf("Expected version 3, got %d", board.Version)
+	}
+}
@@ -2,7 +2,10 @@ package statesync
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -21,6 +24,9 @@ type ManagerConfig struct {
 	// 冲突解决器
 	ConflictResolver ConflictResolver
 
+	// 按文档类型注册的冲突解决器, 未注册的类型使用 ConflictResolver
+	Resolvers *ResolverRegistry
+
 	// 日志
 	Logger *zap.Logger
 
@@ -39,6 +45,7 @@ type Manager struct {
 	store            Store
 	broadcaster      Broadcaster
 	conflictResolver ConflictResolver
+	resolvers        *ResolverRegistry
 	conflictDetector *ConflictDetector
 	logger           *zap.Logger
 
@@ -79,6 +86,10 @@ func NewManager(config *ManagerConfig) (*Manager, error) {
 		config.ConflictResolver = NewLWWConflictResolver(config.Logger)
 	}
 
+	if config.Resolvers == nil {
+		config.Resolvers = NewResolverRegistry()
+	}
+
 	if config.LockTimeout == 0 {
 		config.LockTimeout = 30 * time.Second
 	}
@@ -91,6 +102,7 @@ func NewManager(config *ManagerConfig) (*Manager, error) {
 		store:                config.Store,
 		broadcaster:          config.Broadcaster,
 		conflictResolver:     config.ConflictResolver,
+		resolvers:            config.Resolvers,
 		conflictDetector:     NewConflictDetector(config.Logger),
 		logger:               config.Logger,
 		lockTimeout:          config.LockTimeout,
@@ -240,6 +252,18 @@ func (m *Manager) ApplyOperation(ctx context.Context, op *Operation) error {
 		return fmt.Errorf("failed to get document: %w", err)
 	}
 
+	// 文本文档的编辑经操作变换后合入，并发编辑不产生冲突
+	if doc.Type == DocumentTypeText && op.Type == OperationTypeText {
+		return m.applyTextOperation(ctx, op)
+	}
+
+	// 白板/画布的对象操作经CRDT合并，只有同一属性的并发修改按时间戳决出胜者；
+	// 旧客户端的整块内容和已存有整块内容的文档仍走LWW
+	if (doc.Type == DocumentTypeWhiteboard || doc.Type == DocumentTypeCanvas) && isCanvasOperation(op.Type) &&
+		isCanvasOpData(op.Data) && isCanvasContent(doc.Content) {
+		return m.applyCanvasOperation(ctx, op)
+	}
+
 	// 2. 检查版本冲突
 	if op.PrevVersion != doc.Version {
 		// 版本不匹配，可能有冲突
@@ -283,7 +307,7 @@ func (m *Manager) ApplyOperation(ctx context.Context, op *Operation) error {
 
 			// 如果启用自动解决
 			if m.autoResolveConflicts {
-				if err := m.resolveConflict(ctx, conflict, op.UserID); err != nil {
+				if err := m.resolveConflict(ctx, conflict, doc.Type, op.UserID); err != nil {
 					m.logger.Error("Failed to auto-resolve conflict",
 						zap.Error(err),
 						zap.String("conflict_id", conflict.ID.String()),
@@ -317,20 +341,163 @@ func (m *Manager) ApplyOperation(ctx context.Context, op *Operation) error {
 		return fmt.Errorf("failed to update document version: %w", err)
 	}
 
-	// 4. 保存操作记录
+	// 4. 保存操作记录并广播
+	return m.recordAppliedOperation(ctx, op)
+}
+
+// applyTextOperation 应用文本操作
+// 操作基于客户端所见的 op.PrevVersion, 先依次对之后已应用的操作做变换再合入当前版本;
+// 保存和广播的是变换后的操作, 其 PrevVersion 为实际合入的版本
+func (m *Manager) applyTextOperation(ctx context.Context, op *Operation) error {
+	textOp, err := ParseTextOp(op.Data)
+	if err != nil {
+		return err
+	}
+
+	return m.mergeOperation(ctx, op, func(doc *Document, merged *Operation) ([]byte, error) {
+		transformed, err := m.transformTextOperation(ctx, doc, op.PrevVersion, textOp)
+		if err != nil {
+			return nil, err
+		}
+		content, err := transformed.Apply(string(doc.Content))
+		if err != nil {
+			return nil, err
+		}
+		data, err := transformed.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode text operation: %w", err)
+		}
+
+		merged.Data = data
+		merged.PrevVersion = doc.Version
+		return []byte(content), nil
+	})
+}
+
+// applyCanvasOperation 应用白板/画布操作
+// 操作以 PrevVersion 和操作ID为时间戳合入文档的CRDT状态; 保存和广播的操作带有
+// 解析后的层级位置, 按任意顺序重放都得到同一状态
+func (m *Manager) applyCanvasOperation(ctx context.Context, op *Operation) error {
+	canvasOp, err := ParseCanvasOp(op.Data)
+	if err != nil {
+		return err
+	}
+
+	return m.mergeOperation(ctx, op, func(doc *Document, merged *Operation) ([]byte, error) {
+		if op.PrevVersion > doc.Version {
+			return nil, fmt.Errorf("%w: operation based on version %d, document at %d", ErrVersionMismatch, op.PrevVersion, doc.Version)
+		}
+		state, err := ParseCanvasState(doc.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved := *canvasOp
+		if err := state.prepare(op.Type, &resolved); err != nil {
+			return nil, err
+		}
+		state.Apply(op.Type, &resolved, canvasStamp(op))
+
+		content, err := state.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode canvas state: %w", err)
+		}
+		if merged.Data, err = json.Marshal(&resolved); err != nil {
+			return nil, fmt.Errorf("failed to encode canvas operation: %w", err)
+		}
+		return content, nil
+	})
+}
+
+// mergeOperation 在文档当前版本上合并操作并提交。merge 根据文档计算新内容,
+// 可修改 merged (op的副本) 中要保存的操作。版本和操作记录经 Store.CommitOperation 一起提交,
+// 任一实例 (包括其他网关后的实例) 先行提交导致版本检查失败时, 基于新的版本和操作记录重新合并
+func (m *Manager) mergeOperation(ctx context.Context, op *Operation, merge func(doc *Document, merged *Operation) ([]byte, error)) error {
+	for attempt := 0; ; attempt++ {
+		doc, err := m.store.GetDocument(ctx, op.DocID)
+		if err != nil {
+			return fmt.Errorf("failed to get document: %w", err)
+		}
+
+		merged := *op
+		content, err := merge(doc, &merged)
+		if err != nil {
+			return err
+		}
+		merged.Version = doc.Version + 1
+		merged.Status = OperationStatusApplied
+		merged.Timestamp = time.Now()
+
+		err = m.store.CommitOperation(ctx, &merged, doc.Version, content)
+		if errors.Is(err, ErrVersionMismatch) && attempt < maxMergeRetries {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to commit operation: %w", err)
+		}
+
+		*op = merged
+		return m.broadcastAppliedOperation(ctx, op)
+	}
+}
+
+// maxMergeRetries 操作因并发提交而重新合并的最多次数
+const maxMergeRetries = 20
+
+// transformTextOperation 将基于 prevVersion 的文本操作依次对之后已应用的文本操作做变换,
+// 得到可作用于文档当前版本的操作。PrevVersion 为0 (客户端未跟踪版本) 时视为基于当前版本;
+// 其间的非文本操作不参与变换, 变换结果与当前内容长度不符时由 Apply 报错
+func (m *Manager) transformTextOperation(ctx context.Context, doc *Document, prevVersion uint64, textOp TextOp) (TextOp, error) {
+	if prevVersion > doc.Version {
+		return nil, fmt.Errorf("%w: operation based on version %d, document at %d", ErrVersionMismatch, prevVersion, doc.Version)
+	}
+	if prevVersion == 0 || prevVersion == doc.Version {
+		return textOp, nil
+	}
+
+	applied, err := m.store.GetOperationsByVersion(ctx, doc.ID, prevVersion+1, doc.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operations since version %d: %w", prevVersion, err)
+	}
+	sort.Slice(applied, func(i, j int) bool { return applied[i].Version < applied[j].Version })
+
+	for _, prior := range applied {
+		if prior.Type != OperationTypeText || prior.Status != OperationStatusApplied {
+			continue
+		}
+		priorOp, err := ParseTextOp(prior.Data)
+		if err != nil {
+			return nil, fmt.Errorf("operation at version %d: %w", prior.Version, err)
+		}
+		// 已应用的操作在前, 同一位置的插入排在它之后
+		_, textOp, err = TransformText(priorOp, textOp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform against version %d: %w", prior.Version, err)
+		}
+	}
+	return textOp, nil
+}
+
+// recordAppliedOperation 保存已应用的操作并广播
+func (m *Manager) recordAppliedOperation(ctx context.Context, op *Operation) error {
 	if err := m.store.CreateOperation(ctx, op); err != nil {
 		return fmt.Errorf("failed to save operation: %w", err)
 	}
 
+	return m.broadcastAppliedOperation(ctx, op)
+}
+
+// broadcastAppliedOperation 广播已保存的操作
+func (m *Manager) broadcastAppliedOperation(ctx context.Context, op *Operation) error {
 	m.logger.Debug("Operation applied",
 		zap.String("op_id", op.ID.String()),
 		zap.String("doc_id", op.DocID.String()),
 		zap.String("user_id", op.UserID),
 		zap.String("type", string(op.Type)),
-		zap.Uint64("version", newVersion),
+		zap.Uint64("version", op.Version),
 	)
 
-	// 5. 广播操作已应用事件
+	// 广播操作已应用事件
 	eventID, _ := guuid.NewV7()
 	event := &Event{
 		ID:        eventID,
@@ -527,12 +694,45 @@ func (m *Manager) GetStats(ctx context.Context) (*Stats, error) {
 
 // ==================== 私有方法 ====================
 
-// resolveConflict 解决冲突
-func (m *Manager) resolveConflict(ctx context.Context, conflict *Conflict, userID string) error {
-	if err := ResolveConflict(ctx, conflict, m.conflictResolver, userID); err != nil {
+// containsOperation 判断操作列表中是否有该ID的操作
+func containsOperation(ops []*Operation, id guuid.UUID) bool {
+	for _, op := range ops {
+		if op.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConflict 用文档类型对应的解决器解决冲突
+func (m *Manager) resolveConflict(ctx context.Context, conflict *Conflict, docType DocumentType, userID string) error {
+	resolver, ok := m.resolvers.Get(docType)
+	if !ok {
+		resolver = m.conflictResolver
+	}
+
+	if err := ResolveConflict(ctx, conflict, resolver, userID); err != nil {
+		var partial *PartialConflictError
+		if errors.As(err, &partial) {
+			// 保存已合并的部分和重叠字段
+			if updateErr := m.store.UpdateConflict(ctx, conflict); updateErr != nil {
+				return fmt.Errorf("failed to update conflict: %w", updateErr)
+			}
+		}
 		return err
 	}
 
+	// 解决器合成的新操作 (如字段合并的结果) 应用到文档当前内容上, 作为新版本提交;
+	// 选中已有操作的解决器 (如LWW) 保持原有行为, 不修改文档
+	if resolved := conflict.ResolvedOp; resolved != nil && !containsOperation(conflict.Ops, resolved.ID) {
+		err := m.mergeOperation(ctx, resolved, func(doc *Document, merged *Operation) ([]byte, error) {
+			return applyMergedOperation(doc, merged)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply resolved operation: %w", err)
+		}
+	}
+
 	// 更新冲突记录
 	if err := m.store.UpdateConflict(ctx, conflict); err != nil {
 		return fmt.Errorf("failed to update conflict: %w", err)
@@ -124,6 +124,14 @@ type Conflict struct {
 	ResolvedOp  *Operation         `json:"resolved_op"` // 解决后的操作
 	ResolvedAt  time.Time          `json:"resolved_at"` // 解决时间
 	Description string             `json:"description"` // 冲突描述
+	Fields      []ConflictField    `json:"fields"`      // 无法自动合并的字段 (部分冲突)
+}
+
+// ConflictField 被多个操作改成不同值的字段
+type ConflictField struct {
+	Object string       `json:"object"` // 对象ID
+	Field  string       `json:"field"`  // 属性名, 为空表示删除整个对象
+	OpIDs  []guuid.UUID `json:"op_ids"` // 修改该字段的操作
 }
 
 // Subscriber 订阅者信息
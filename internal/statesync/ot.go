@@ -0,0 +1,315 @@
+package statesync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// 文本文档的操作变换 (Operational Transformation)
+//
+// 文本操作 (TextOp) 从头到尾遍历整个文档, 由三种分量依次组成:
+//   - 保留 (Retain): 跳过n个字符
+//   - 插入 (Insert): 在当前位置插入字符串
+//   - 删除 (Delete): 删除当前位置起的n个字符
+//
+// 长度一律以Unicode码点计。操作的基准长度 (BaseLen) 必须等于所作用文档的长度,
+// 应用后得到目标长度 (TargetLen) 的文档。
+//
+// 基于同一版本的两个并发操作a、b经 TransformText(a, b) 得到 a'、b',
+// 满足 b' 作用于 a 之后、a' 作用于 b 之后得到同一文档; 在同一位置插入时a的内容在前。
+// 服务端总是以已应用的操作作为a, 客户端变换自己未确认的操作时也必须如此, 两端才会收敛。
+// ComposeText(a, b) 把先后应用的两个操作合并成一个。
+
+var (
+	ErrInvalidTextOp      = errors.New("invalid text operation")
+	ErrTextOpBaseLen      = errors.New("text operation base length does not match document")
+	ErrTextOpIncompatible = errors.New("text operations are not compatible")
+)
+
+// TextComponent 文本操作分量, 三个字段中恰有一个非零
+type TextComponent struct {
+	Retain int    `json:"retain,omitempty"` // 保留的字符数
+	Insert string `json:"insert,omitempty"` // 插入的字符串
+	Delete int    `json:"delete,omitempty"` // 删除的字符数
+}
+
+// TextOp 文本操作, 序列化后作为 Operation.Data, 如:
+// [{"retain":5},{"insert":"abc"},{"delete":2},{"retain":10}]
+type TextOp []TextComponent
+
+// ParseTextOp 解析并校验 Operation.Data 中的文本操作
+func ParseTextOp(data []byte) (TextOp, error) {
+	var components []TextComponent
+	if err := json.Unmarshal(data, &components); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTextOp, err)
+	}
+
+	// 重新拼接, 合并相邻的同类分量
+	var op TextOp
+	for i, c := range components {
+		fields := 0
+		if c.Retain != 0 {
+			fields++
+		}
+		if c.Insert != "" {
+			fields++
+		}
+		if c.Delete != 0 {
+			fields++
+		}
+		if fields != 1 || c.Retain < 0 || c.Delete < 0 || !utf8.ValidString(c.Insert) {
+			return nil, fmt.Errorf("%w: component %d", ErrInvalidTextOp, i)
+		}
+		op = op.Retain(c.Retain).Insert(c.Insert).Delete(c.Delete)
+	}
+	return op, nil
+}
+
+// Marshal 序列化文本操作
+func (op TextOp) Marshal() ([]byte, error) {
+	if op == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]TextComponent(op))
+}
+
+// Retain 追加保留n个字符。与append一样, 构造方法可能修改op的底层数组, 应只使用返回值。
+func (op TextOp) Retain(n int) TextOp {
+	if n <= 0 {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].Retain > 0 {
+		op[last].Retain += n
+		return op
+	}
+	return append(op, TextComponent{Retain: n})
+}
+
+// Insert 追加插入字符串。紧接删除之后的插入放到删除之前, 使等价的操作有相同的形式。
+func (op TextOp) Insert(s string) TextOp {
+	if s == "" {
+		return op
+	}
+	last := len(op) - 1
+	if last >= 0 && op[last].Insert != "" {
+		op[last].Insert += s
+		return op
+	}
+	if last >= 0 && op[last].Delete > 0 {
+		if last >= 1 && op[last-1].Insert != "" {
+			op[last-1].Insert += s
+			return op
+		}
+		op = append(op, op[last])
+		op[last] = TextComponent{Insert: s}
+		return op
+	}
+	return append(op, TextComponent{Insert: s})
+}
+
+// Delete 追加删除n个字符
+func (op TextOp) Delete(n int) TextOp {
+	if n <= 0 {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].Delete > 0 {
+		op[last].Delete += n
+		return op
+	}
+	return append(op, TextComponent{Delete: n})
+}
+
+// BaseLen 返回操作作用的文档长度
+func (op TextOp) BaseLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// TargetLen 返回应用操作后的文档长度
+func (op TextOp) TargetLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + utf8.RuneCountInString(c.Insert)
+	}
+	return n
+}
+
+// Apply 将操作应用于文档
+func (op TextOp) Apply(doc string) (string, error) {
+	text := []rune(doc)
+	if op.BaseLen() != len(text) {
+		return "", fmt.Errorf("%w: %d != %d", ErrTextOpBaseLen, op.BaseLen(), len(text))
+	}
+
+	result := make([]rune, 0, op.TargetLen())
+	pos := 0
+	for _, c := range op {
+		switch {
+		case c.Retain > 0:
+			result = append(result, text[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.Insert != "":
+			result = append(result, []rune(c.Insert)...)
+		case c.Delete > 0:
+			pos += c.Delete
+		}
+	}
+	return string(result), nil
+}
+
+// TransformText 变换基于同一文档的两个并发操作。
+// 返回的 aPrime 作用于b之后, bPrime 作用于a之后, 两者结果相同。
+func TransformText(a, b TextOp) (aPrime, bPrime TextOp, err error) {
+	if a.BaseLen() != b.BaseLen() {
+		return nil, nil, fmt.Errorf("%w: base lengths %d and %d", ErrTextOpIncompatible, a.BaseLen(), b.BaseLen())
+	}
+
+	ca, cb := newTextCursor(a), newTextCursor(b)
+	for !ca.done() || !cb.done() {
+		// 插入不消耗原文, 先于同一位置的其他分量处理; 两边同时插入时a在前
+		if ca.isInsert() {
+			text := ca.take(ca.len())
+			aPrime = aPrime.Insert(text.insert)
+			bPrime = bPrime.Retain(text.n)
+			continue
+		}
+		if cb.isInsert() {
+			text := cb.take(cb.len())
+			aPrime = aPrime.Retain(text.n)
+			bPrime = bPrime.Insert(text.insert)
+			continue
+		}
+		if ca.done() || cb.done() {
+			return nil, nil, ErrTextOpIncompatible
+		}
+
+		n := min(ca.len(), cb.len())
+		pa, pb := ca.take(n), cb.take(n)
+		switch {
+		case pa.retain && pb.retain:
+			aPrime = aPrime.Retain(n)
+			bPrime = bPrime.Retain(n)
+		case pa.retain: // b删除
+			bPrime = bPrime.Delete(n)
+		case pb.retain: // a删除
+			aPrime = aPrime.Delete(n)
+		default:
+			// 两边删除同一段, 变换后都不必再删
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+// ComposeText 合并先后应用的两个操作, 结果等价于先应用a再应用b
+func ComposeText(a, b TextOp) (TextOp, error) {
+	if a.TargetLen() != b.BaseLen() {
+		return nil, fmt.Errorf("%w: target length %d, base length %d", ErrTextOpIncompatible, a.TargetLen(), b.BaseLen())
+	}
+
+	var composed TextOp
+	ca, cb := newTextCursor(a), newTextCursor(b)
+	for !ca.done() || !cb.done() {
+		// a删除的字符b看不到, b插入的字符a没有
+		if ca.isDelete() {
+			composed = composed.Delete(ca.take(ca.len()).n)
+			continue
+		}
+		if cb.isInsert() {
+			composed = composed.Insert(cb.take(cb.len()).insert)
+			continue
+		}
+		if ca.done() || cb.done() {
+			return nil, ErrTextOpIncompatible
+		}
+
+		n := min(ca.len(), cb.len())
+		pa, pb := ca.take(n), cb.take(n)
+		switch {
+		case pa.retain && pb.retain:
+			composed = composed.Retain(n)
+		case pa.retain: // b删除a保留的字符
+			composed = composed.Delete(n)
+		case pb.retain: // b保留a插入的字符
+			composed = composed.Insert(pa.insert)
+		default:
+			// b删除a插入的字符, 相互抵消
+		}
+	}
+	return composed, nil
+}
+
+// textPart 操作分量的一部分
+type textPart struct {
+	retain bool
+	insert string
+	n      int
+}
+
+// textCursor 逐段读取操作的分量, 每次可只取当前分量的一部分
+type textCursor struct {
+	op     TextOp
+	i      int
+	offset int    // 当前分量已读取的字符数
+	runes  []rune // 当前插入分量的字符
+}
+
+func newTextCursor(op TextOp) *textCursor {
+	c := &textCursor{op: op}
+	c.load()
+	return c
+}
+
+// load 准备读取第i个分量
+func (c *textCursor) load() {
+	c.offset = 0
+	c.runes = nil
+	if c.i < len(c.op) && c.op[c.i].Insert != "" {
+		c.runes = []rune(c.op[c.i].Insert)
+	}
+}
+
+func (c *textCursor) done() bool {
+	return c.i >= len(c.op)
+}
+
+func (c *textCursor) isInsert() bool {
+	return !c.done() && c.op[c.i].Insert != ""
+}
+
+func (c *textCursor) isDelete() bool {
+	return !c.done() && c.op[c.i].Delete > 0
+}
+
+// len 返回当前分量剩余的字符数
+func (c *textCursor) len() int {
+	comp := c.op[c.i]
+	switch {
+	case comp.Retain > 0:
+		return comp.Retain - c.offset
+	case comp.Delete > 0:
+		return comp.Delete - c.offset
+	default:
+		return len(c.runes) - c.offset
+	}
+}
+
+// take 读取当前分量的n个字符, 读完时前进到下一个分量
+func (c *textCursor) take(n int) textPart {
+	comp := c.op[c.i]
+	part := textPart{retain: comp.Retain > 0, n: n}
+	if comp.Insert != "" {
+		part.insert = string(c.runes[c.offset : c.offset+n])
+	}
+
+	c.offset += n
+	if c.len() == 0 {
+		c.i++
+		c.load()
+	}
+	return part
+}
@@ -0,0 +1,429 @@
+package statesync
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	guuid "github.com/Lzww0608/GUUID"
+)
+
+// randomTextOp 生成作用于长度为n的文档的随机文本操作
+func randomTextOp(r *rand.Rand, n int) TextOp {
+	letters := []rune("abcxyz 协作文档")
+	insert := func(op TextOp) TextOp {
+		text := make([]rune, 1+r.Intn(4))
+		for i := range text {
+			text[i] = letters[r.Intn(len(letters))]
+		}
+		return op.Insert(string(text))
+	}
+
+	var op TextOp
+	for pos := 0; pos < n; {
+		k := 1 + r.Intn(n-pos)
+		switch r.Intn(4) {
+		case 0:
+			op = insert(op)
+		case 1:
+			op = op.Delete(k)
+			pos += k
+		default:
+			op = op.Retain(k)
+			pos += k
+		}
+	}
+	if n == 0 || r.Intn(4) == 0 {
+		op = insert(op)
+	}
+	return op
+}
+
+func TestTextOp_Apply(t *testing.T) {
+	op := TextOp{}.Retain(6).Delete(5).Insert("协作").Retain(1)
+	got, err := op.Apply("hello world!")
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got != "hello 协作!" {
+		t.Errorf("Expected 'hello 协作!', got '%s'", got)
+	}
+
+	// 插入总是排在相邻的删除之前
+	if op[1].Insert != "协作" || op[2].Delete != 5 {
+		t.Errorf("Expected insert before delete, got %+v", op)
+	}
+
+	if _, err := op.Apply("hello"); err == nil {
+		t.Error("Expected base length mismatch")
+	}
+}
+
+func TestParseTextOp(t *testing.T) {
+	op, err := ParseTextOp([]byte(`[{"retain":2},{"retain":3},{"delete":1},{"insert":"x"}]`))
+	if err != nil {
+		t.Fatalf("ParseTextOp failed: %v", err)
+	}
+	want := TextOp{{Retain: 5}, {Insert: "x"}, {Delete: 1}}
+	if len(op) != len(want) {
+		t.Fatalf("Expected %+v, got %+v", want, op)
+	}
+	for i := range want {
+		if op[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want, op)
+		}
+	}
+
+	data, err := op.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `[{"retain":5},{"insert":"x"},{"delete":1}]` {
+		t.Errorf("Unexpected encoding %s", data)
+	}
+
+	for _, invalid := range []string{`{}`, `[{"retain":-1}]`, `[{"retain":1,"delete":1}]`, `[{}]`} {
+		if _, err := ParseTextOp([]byte(invalid)); err == nil {
+			t.Errorf("Expected %s to be rejected", invalid)
+		}
+	}
+}
+
+func TestTransformText(t *testing.T) {
+	// 同一位置的并发插入, a在前
+	a := TextOp{}.Retain(2).Insert("A").Retain(1)
+	b := TextOp{}.Retain(2).Insert("B").Retain(1)
+	aPrime, bPrime, err := TransformText(a, b)
+	if err != nil {
+		t.Fatalf("TransformText failed: %v", err)
+	}
+	afterA, _ := a.Apply("xyz")
+	afterB, _ := b.Apply("xyz")
+	left, _ := bPrime.Apply(afterA)
+	right, _ := aPrime.Apply(afterB)
+	if left != "xyABz" || right != left {
+		t.Errorf("Expected both orders to give 'xyABz', got '%s' and '%s'", left, right)
+	}
+
+	// 随机操作两种顺序的结果相同
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		doc := string([]rune("协作编辑 hello world")[:r.Intn(16)])
+		n := len([]rune(doc))
+		a, b := randomTextOp(r, n), randomTextOp(r, n)
+
+		aPrime, bPrime, err := TransformText(a, b)
+		if err != nil {
+			t.Fatalf("TransformText failed: %v", err)
+		}
+		afterA, _ := a.Apply(doc)
+		afterB, _ := b.Apply(doc)
+		left, err := bPrime.Apply(afterA)
+		if err != nil {
+			t.Fatalf("Apply b' failed: %v (a=%+v b=%+v)", err, a, b)
+		}
+		right, err := aPrime.Apply(afterB)
+		if err != nil {
+			t.Fatalf("Apply a' failed: %v (a=%+v b=%+v)", err, a, b)
+		}
+		if left != right {
+			t.Fatalf("Diverged on %q: '%s' != '%s' (a=%+v b=%+v)", doc, left, right, a, b)
+		}
+	}
+}
+
+func TestComposeText(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		doc := string([]rune("协作编辑 hello world")[:r.Intn(16)])
+		a := randomTextOp(r, len([]rune(doc)))
+		afterA, _ := a.Apply(doc)
+		b := randomTextOp(r, len([]rune(afterA)))
+
+		composed, err := ComposeText(a, b)
+		if err != nil {
+			t.Fatalf("ComposeText failed: %v", err)
+		}
+		want, _ := b.Apply(afterA)
+		got, err := composed.Apply(doc)
+		if err != nil || got != want {
+			t.Fatalf("Expected '%s', got '%s' (%v)", want, got, err)
+		}
+	}
+
+	if _, err := ComposeText(TextOp{}.Retain(3), TextOp{}.Retain(2)); err == nil {
+		t.Error("Expected incompatible lengths to be rejected")
+	}
+}
+
+// textClient 模拟编辑文本文档的客户端: 同一时刻最多一个操作等待服务端确认,
+// 其间的本地编辑合并到缓冲区, 收到他人的操作时与两者做变换
+type textClient struct {
+	doc     string
+	version uint64 // 本地文档所基于的服务端版本
+
+	// 已发送、等待确认的操作。变换后可能成为空操作, 因此另用 waiting 标记
+	waiting       bool
+	outstandingID guuid.UUID
+	outstanding   TextOp
+	buffer        TextOp // 尚未发送的本地编辑
+
+	inbox []*Operation // 服务端按应用顺序发来的操作
+}
+
+// edit 在本地做一次编辑, 返回需要发送的操作
+func (c *textClient) edit(r *rand.Rand, docID guuid.UUID, user string) *Operation {
+	op := randomTextOp(r, len([]rune(c.doc)))
+	c.doc, _ = op.Apply(c.doc)
+	switch {
+	case !c.waiting:
+		return c.send(op, docID, user)
+	case c.buffer == nil:
+		c.buffer = op
+	default:
+		c.buffer, _ = ComposeText(c.buffer, op)
+	}
+	return nil
+}
+
+func (c *textClient) send(op TextOp, docID guuid.UUID, user string) *Operation {
+	data, _ := op.Marshal()
+	c.waiting = true
+	c.outstandingID, _ = guuid.NewV7()
+	c.outstanding = op
+	return &Operation{ID: c.outstandingID, DocID: docID, UserID: user, Type: OperationTypeText, Data: data, PrevVersion: c.version}
+}
+
+// receive 处理服务端的下一条操作, 返回需要发送的缓冲操作
+func (c *textClient) receive(t *testing.T, docID guuid.UUID, user string) *Operation {
+	applied := c.inbox[0]
+	c.inbox = c.inbox[1:]
+	c.version = applied.Version
+
+	// 自己操作的确认
+	if c.waiting && applied.ID == c.outstandingID {
+		c.waiting = false
+		if c.buffer != nil {
+			buffer := c.buffer
+			c.buffer = nil
+			return c.send(buffer, docID, user)
+		}
+		return nil
+	}
+
+	// 他人的操作: 与服务端一样以已应用的操作为a
+	remote, err := ParseTextOp(applied.Data)
+	if err != nil {
+		t.Fatalf("Failed to parse applied operation: %v", err)
+	}
+	if c.waiting {
+		remote, c.outstanding, err = TransformText(remote, c.outstanding)
+		if err != nil {
+			t.Fatalf("Failed to transform against outstanding operation: %v", err)
+		}
+	}
+	if c.buffer != nil {
+		remote, c.buffer, err = TransformText(remote, c.buffer)
+		if err != nil {
+			t.Fatalf("Failed to transform against buffer: %v", err)
+		}
+	}
+	c.doc, err = remote.Apply(c.doc)
+	if err != nil {
+		t.Fatalf("Failed to apply remote operation: %v", err)
+	}
+	return nil
+}
+
+func TestManager_TextConvergence(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		manager := createTestManager(t)
+		ctx := context.Background()
+
+		const initial = "Hello, 协作!"
+		doc, err := manager.CreateDocument(ctx, "Notes", DocumentTypeText, "user0", []byte(initial))
+		if err != nil {
+			t.Fatalf("CreateDocument failed: %v", err)
+		}
+
+		users := []string{"alice", "bob", "carol"}
+		clients := make([]*textClient, len(users))
+		for i := range clients {
+			clients[i] = &textClient{doc: initial, version: doc.Version}
+		}
+		var sent []*Operation // 发往服务端、尚未处理的操作
+
+		submit := func(op *Operation) {
+			if op != nil {
+				sent = append(sent, op)
+			}
+		}
+		// 服务端处理一个操作, 并按应用顺序发给所有客户端
+		process := func(i int) {
+			op := *sent[i]
+			sent = append(sent[:i], sent[i+1:]...)
+			if err := manager.ApplyOperation(ctx, &op); err != nil {
+				t.Fatalf("seed %d: ApplyOperation failed: %v", seed, err)
+			}
+			for _, c := range clients {
+				c.inbox = append(c.inbox, &op)
+			}
+		}
+
+		for step := 0; step < 300; step++ {
+			i := r.Intn(len(clients))
+			switch r.Intn(3) {
+			case 0:
+				submit(clients[i].edit(r, doc.ID, users[i]))
+			case 1:
+				if len(sent) > 0 {
+					process(r.Intn(len(sent)))
+				}
+			default:
+				if len(clients[i].inbox) > 0 {
+					submit(clients[i].receive(t, doc.ID, users[i]))
+				}
+			}
+		}
+
+		// 处理完所有在途消息
+		for busy := true; busy; {
+			busy = false
+			for len(sent) > 0 {
+				process(0)
+				busy = true
+			}
+			for i, c := range clients {
+				for len(c.inbox) > 0 {
+					submit(c.receive(t, doc.ID, users[i]))
+					busy = true
+				}
+			}
+		}
+
+		final, _ := manager.GetDocument(ctx, doc.ID)
+		for i, c := range clients {
+			if c.doc != string(final.Content) {
+				t.Fatalf("seed %d: %s diverged: '%s' != '%s'", seed, users[i], c.doc, final.Content)
+			}
+			if c.version != final.Version {
+				t.Errorf("seed %d: %s at version %d, document at %d", seed, users[i], c.version, final.Version)
+			}
+		}
+		if n, _ := manager.GetStore().CountConflicts(ctx, &doc.ID); n != 0 {
+			t.Errorf("seed %d: Expected no conflicts, got %d", seed, n)
+		}
+
+		manager.Close()
+	}
+}
+
+func TestManager_TextOperationBase(t *testing.T) {
+	manager := createTestManager(t)
+	defer manager.Close()
+
+	ctx := context.Background()
+	doc, _ := manager.CreateDocument(ctx, "Notes", DocumentTypeText, "user1", []byte("abc"))
+
+	apply := func(opType OperationType, data string, prevVersion uint64) (*Operation, error) {
+		opID, _ := guuid.NewV7()
+		op := &Operation{ID: opID, DocID: doc.ID, UserID: "user1", Type: opType, Data: []byte(data), PrevVersion: prevVersion}
+		return op, manager.ApplyOperation(ctx, op)
+	}
+
+	// PrevVersion 为0时直接作用于当前版本
+	if _, err := apply(OperationTypeText, `[{"retain":3},{"insert":"d"}]`, 0); err != nil {
+		t.Fatalf("ApplyOperation failed: %v", err)
+	}
+
+	// 非文本操作整体替换内容, 之后基于旧版本的文本操作跳过它
+	if _, err := apply(OperationTypeUpdate, "wxyz", 2); err != nil {
+		t.Fatalf("ApplyOperation failed: %v", err)
+	}
+	op, err := apply(OperationTypeText, `[{"retain":3},{"insert":"!"}]`, 1)
+	if err != nil {
+		t.Fatalf("ApplyOperation failed: %v", err)
+	}
+	if string(op.Data) != `[{"retain":4},{"insert":"!"}]` || op.PrevVersion != 3 {
+		t.Errorf("Expected operation transformed onto version 3, got %s at %d", op.Data, op.PrevVersion)
+	}
+
+	updated, _ := manager.GetDocument(ctx, doc.ID)
+	if string(updated.Content) != "wxyz!" || updated.Version != 4 {
+		t.Errorf("Expected 'wxyz!' at version 4, got '%s' at %d", updated.Content, updated.Version)
+	}
+
+	// 与当前内容长度不符的操作被拒绝
+	if _, err := apply(OperationTypeText, `[{"retain":2},{"insert":"?"}]`, 0); err == nil {
+		t.Error("Expected operation not matching the document length to be rejected")
+	}
+}
+
+func TestManager_TextConcurrentInstances(t *testing.T) {
+	// 两个实例共享同一存储, 模拟多个网关后的服务
+	store := NewMemoryStore()
+	managers := make([]*Manager, 2)
+	for i := range managers {
+		manager, err := NewManager(&ManagerConfig{Store: store})
+		if err != nil {
+			t.Fatalf("NewManager failed: %v", err)
+		}
+		defer manager.Close()
+		managers[i] = manager
+	}
+
+	ctx := context.Background()
+	doc, _ := managers[0].CreateDocument(ctx, "Notes", DocumentTypeText, "user0", []byte("0123456789"))
+
+	// 每个客户端都基于初始版本在开头插入, 全部并发提交
+	const clients, edits = 4, 10
+	errs := make(chan error, clients*edits)
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			manager := managers[c%len(managers)]
+			for e := 0; e < edits; e++ {
+				data, _ := TextOp{}.Insert(string(rune('a' + c))).Retain(10).Marshal()
+				opID, _ := guuid.NewV7()
+				errs <- manager.ApplyOperation(ctx, &Operation{ID: opID, DocID: doc.ID, UserID: fmt.Sprint("user", c),
+					Type: OperationTypeText, Data: data, PrevVersion: doc.Version})
+			}
+		}(c)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("ApplyOperation failed: %v", err)
+		}
+	}
+
+	// 操作记录按版本连续, 依次重放得到文档内容
+	final, _ := store.GetDocument(ctx, doc.ID)
+	if final.Version != doc.Version+clients*edits {
+		t.Fatalf("Expected version %d, got %d", doc.Version+clients*edits, final.Version)
+	}
+	ops, _ := store.GetOperationsByVersion(ctx, doc.ID, doc.Version+1, final.Version)
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Version < ops[j].Version })
+	content := string(doc.Content)
+	for i, op := range ops {
+		if op.Version != doc.Version+1+uint64(i) || op.PrevVersion != op.Version-1 {
+			t.Fatalf("Expected operation %d at version %d on %d, got %d on %d",
+				i, doc.Version+1+uint64(i), doc.Version+uint64(i), op.Version, op.PrevVersion)
+		}
+		textOp, _ := ParseTextOp(op.Data)
+		var err error
+		if content, err = textOp.Apply(content); err != nil {
+			t.Fatalf("Replaying version %d failed: %v", op.Version, err)
+		}
+	}
+	if content != string(final.Content) || len([]rune(content)) != 10+clients*edits {
+		t.Errorf("Expected replayed content to match '%s', got '%s'", final.Content, content)
+	}
+}
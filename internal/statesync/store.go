@@ -63,6 +63,11 @@ type Store interface {
 	// GetPendingOperations 获取待处理的操作
 	GetPendingOperations(ctx context.Context, docID guuid.UUID) ([]*Operation, error)
 
+	// CommitOperation 提交已合并的操作 (原子操作)
+	// 文档仍为 oldVersion 时更新为 op.Version 和 content 并保存操作, 否则返回 ErrVersionMismatch;
+	// 版本与操作记录一起提交, 读到新版本的实例也一定能读到对应的操作
+	CommitOperation(ctx context.Context, op *Operation, oldVersion uint64, content []byte) error
+
 	// ==================== 冲突管理 ====================
 
 	// CreateConflict 创建冲突记录
@@ -283,6 +283,33 @@ func (s *MemoryStore) CreateOperation(ctx context.Context, op *Operation) error
 	return nil
 }
 
+func (s *MemoryStore) CommitOperation(ctx context.Context, op *Operation, oldVersion uint64, content []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, exists := s.documents[op.DocID]
+	if !exists {
+		return ErrDocumentNotFound
+	}
+
+	// 版本检查 (乐观锁)
+	if doc.Version != oldVersion {
+		return ErrVersionMismatch
+	}
+
+	doc.Version = op.Version
+	doc.Content = content
+	doc.UpdatedAt = time.Now()
+	doc.UpdatedBy = op.UserID
+
+	opCopy := *op
+	s.operations[op.ID] = &opCopy
+	s.opsByDoc[op.DocID] = append(s.opsByDoc[op.DocID], op.ID)
+	s.opsByUser[op.UserID] = append(s.opsByUser[op.UserID], op.ID)
+
+	return nil
+}
+
 func (s *MemoryStore) GetOperation(ctx context.Context, opID guuid.UUID) (*Operation, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
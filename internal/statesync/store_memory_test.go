@@ -115,6 +115,60 @@ func TestMemoryStore_UpdateDocumentVersion(t *testing.T) {
 	}
 }
 
+func TestMemoryStore_CommitOperation(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	docID, _ := guuid.NewV7()
+	_ = store.CreateDocument(ctx, &Document{
+		ID:        docID,
+		Name:      "Test Doc",
+		Type:      DocumentTypeText,
+		State:     DocumentStateActive,
+		Version:   1,
+		Content:   []byte("abc"),
+		CreatedBy: "user1",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+
+	opID, _ := guuid.NewV7()
+	op := &Operation{
+		ID:          opID,
+		DocID:       docID,
+		UserID:      "user1",
+		Type:        OperationTypeText,
+		Data:        []byte(`[{"retain":3},{"insert":"d"}]`),
+		Version:     2,
+		PrevVersion: 1,
+		Status:      OperationStatusApplied,
+	}
+	if err := store.CommitOperation(ctx, op, 1, []byte("abcd")); err != nil {
+		t.Fatalf("CommitOperation failed: %v", err)
+	}
+
+	// 版本、内容和操作记录一起提交
+	updated, _ := store.GetDocument(ctx, docID)
+	if updated.Version != 2 || string(updated.Content) != "abcd" {
+		t.Errorf("Expected 'abcd' at version 2, got '%s' at %d", updated.Content, updated.Version)
+	}
+	ops, _ := store.GetOperationsByVersion(ctx, docID, 2, 2)
+	if len(ops) != 1 || ops[0].ID != opID {
+		t.Errorf("Expected the operation recorded at version 2, got %d operations", len(ops))
+	}
+
+	// 版本冲突时既不更新文档也不保存操作
+	otherID, _ := guuid.NewV7()
+	other := *op
+	other.ID = otherID
+	if err := store.CommitOperation(ctx, &other, 1, []byte("xyz")); err != ErrVersionMismatch {
+		t.Fatalf("Expected ErrVersionMismatch, got %v", err)
+	}
+	if _, err := store.GetOperation(ctx, otherID); err != ErrOperationNotFound {
+		t.Errorf("Expected rejected operation not to be saved, got %v", err)
+	}
+}
+
 func TestMemoryStore_CreateOperation(t *testing.T) {
 	store := NewMemoryStore()
 	ctx := context.Background()
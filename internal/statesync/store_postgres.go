@@ -466,6 +466,47 @@ func (s *PostgresStore) RemoveActiveUser(ctx context.Context, docID guuid.UUID,
 
 // CreateOperation creates a new operation
 func (s *PostgresStore) CreateOperation(ctx context.Context, op *Operation) error {
+	return insertOperation(ctx, s.db, op)
+}
+
+// CommitOperation atomically moves the document from oldVersion to
+// op.Version with the new content and records the operation
+func (s *PostgresStore) CommitOperation(ctx context.Context, op *Operation, oldVersion uint64, content []byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var success bool
+	err = tx.QueryRowContext(ctx, `SELECT atomic_update_document_version($1, $2, $3, $4, $5)`,
+		op.DocID.String(),
+		oldVersion,
+		op.Version,
+		content,
+		op.UserID,
+	).Scan(&success)
+	if err != nil {
+		return fmt.Errorf("failed to update document version: %w", err)
+	}
+	if !success {
+		return ErrVersionMismatch
+	}
+
+	if err := insertOperation(ctx, tx, op); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertOperation inserts an operation row
+func insertOperation(ctx context.Context, db execer, op *Operation) error {
 	query := `
 		INSERT INTO operations (
 			id, doc_id, user_id, session_id, type, data,
@@ -482,7 +523,7 @@ func (s *PostgresStore) CreateOperation(ctx context.Context, op *Operation) erro
 		return fmt.Errorf("failed to marshal extra metadata: %w", err)
 	}
 
-	_, err = s.db.ExecContext(ctx, query,
+	_, err = db.ExecContext(ctx, query,
 		op.ID.String(),
 		op.DocID.String(),
 		op.UserID,
@@ -866,11 +907,17 @@ func (s *PostgresStore) CreateConflict(ctx context.Context, conflict *Conflict)
 	}
 	defer tx.Rollback()
 
+	fields, resolvedOp, err := encodeConflictDetail(conflict)
+	if err != nil {
+		return err
+	}
+
 	// Insert conflict
 	query := `
 		INSERT INTO conflicts (
-			id, doc_id, resolution, resolved_by, resolved_at, description
-		) VALUES ($1, $2, $3, $4, $5, $6)`
+			id, doc_id, resolution, resolved_by, resolved_at, description,
+			fields, resolved_op
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
 
 	_, err = tx.ExecContext(ctx, query,
 		conflict.ID.String(),
@@ -879,6 +926,8 @@ func (s *PostgresStore) CreateConflict(ctx context.Context, conflict *Conflict)
 		conflict.ResolvedBy,
 		conflict.ResolvedAt,
 		conflict.Description,
+		fields,
+		resolvedOp,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create conflict: %w", err)
@@ -909,12 +958,14 @@ func (s *PostgresStore) CreateConflict(ctx context.Context, conflict *Conflict)
 func (s *PostgresStore) GetConflict(ctx context.Context, conflictID guuid.UUID) (*Conflict, error) {
 	query := `
 		SELECT 
-			id, doc_id, resolution, resolved_by, resolved_at, description
+			id, doc_id, resolution, resolved_by, resolved_at, description,
+			fields, resolved_op
 		FROM conflicts
 		WHERE id = $1`
 
 	var conflict Conflict
 	var resolvedAt sql.NullTime
+	var fields, resolvedOp []byte
 
 	err := s.db.QueryRowContext(ctx, query, conflictID.String()).Scan(
 		&conflict.ID,
@@ -923,6 +974,8 @@ func (s *PostgresStore) GetConflict(ctx context.Context, conflictID guuid.UUID)
 		&conflict.ResolvedBy,
 		&resolvedAt,
 		&conflict.Description,
+		&fields,
+		&resolvedOp,
 	)
 
 	if err == sql.ErrNoRows {
@@ -936,6 +989,10 @@ func (s *PostgresStore) GetConflict(ctx context.Context, conflictID guuid.UUID)
 		conflict.ResolvedAt = resolvedAt.Time
 	}
 
+	if err := decodeConflictDetail(&conflict, fields, resolvedOp); err != nil {
+		return nil, err
+	}
+
 	// Get conflict operations
 	opsQuery := `
 		SELECT o.id, o.doc_id, o.user_id, o.session_id, o.type, o.data,
@@ -994,15 +1051,24 @@ func (s *PostgresStore) UpdateConflict(ctx context.Context, conflict *Conflict)
 			resolution = $2,
 			resolved_by = $3,
 			resolved_at = $4,
-			description = $5
+			description = $5,
+			fields = $6,
+			resolved_op = $7
 		WHERE id = $1`
 
+	fields, resolvedOp, err := encodeConflictDetail(conflict)
+	if err != nil {
+		return err
+	}
+
 	result, err := s.db.ExecContext(ctx, query,
 		conflict.ID.String(),
 		string(conflict.Resolution),
 		conflict.ResolvedBy,
 		conflict.ResolvedAt,
 		conflict.Description,
+		fields,
+		resolvedOp,
 	)
 
 	if err != nil {
@@ -1024,7 +1090,8 @@ func (s *PostgresStore) UpdateConflict(ctx context.Context, conflict *Conflict)
 func (s *PostgresStore) ListConflicts(ctx context.Context, docID guuid.UUID) ([]*Conflict, error) {
 	query := `
 		SELECT 
-			id, doc_id, resolution, resolved_by, resolved_at, description
+			id, doc_id, resolution, resolved_by, resolved_at, description,
+			fields, resolved_op
 		FROM conflicts
 		WHERE doc_id = $1
 		ORDER BY created_at DESC`
@@ -1039,6 +1106,7 @@ func (s *PostgresStore) ListConflicts(ctx context.Context, docID guuid.UUID) ([]
 	for rows.Next() {
 		var conflict Conflict
 		var resolvedAt sql.NullTime
+		var fields, resolvedOp []byte
 
 		err := rows.Scan(
 			&conflict.ID,
@@ -1047,6 +1115,8 @@ func (s *PostgresStore) ListConflicts(ctx context.Context, docID guuid.UUID) ([]
 			&conflict.ResolvedBy,
 			&resolvedAt,
 			&conflict.Description,
+			&fields,
+			&resolvedOp,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan conflict: %w", err)
@@ -1056,6 +1126,10 @@ func (s *PostgresStore) ListConflicts(ctx context.Context, docID guuid.UUID) ([]
 			conflict.ResolvedAt = resolvedAt.Time
 		}
 
+		if err := decodeConflictDetail(&conflict, fields, resolvedOp); err != nil {
+			return nil, err
+		}
+
 		conflicts = append(conflicts, &conflict)
 	}
 
@@ -1066,7 +1140,8 @@ func (s *PostgresStore) ListConflicts(ctx context.Context, docID guuid.UUID) ([]
 func (s *PostgresStore) GetUnresolvedConflicts(ctx context.Context, docID guuid.UUID) ([]*Conflict, error) {
 	query := `
 		SELECT 
-			id, doc_id, resolution, resolved_by, resolved_at, description
+			id, doc_id, resolution, resolved_by, resolved_at, description,
+			fields, resolved_op
 		FROM conflicts
 		WHERE doc_id = $1 AND resolved_at IS NULL
 		ORDER BY created_at ASC`
@@ -1080,6 +1155,7 @@ func (s *PostgresStore) GetUnresolvedConflicts(ctx context.Context, docID guuid.
 	conflicts := []*Conflict{}
 	for rows.Next() {
 		var conflict Conflict
+		var fields, resolvedOp []byte
 
 		err := rows.Scan(
 			&conflict.ID,
@@ -1088,17 +1164,59 @@ func (s *PostgresStore) GetUnresolvedConflicts(ctx context.Context, docID guuid.
 			&conflict.ResolvedBy,
 			&conflict.ResolvedAt,
 			&conflict.Description,
+			&fields,
+			&resolvedOp,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan conflict: %w", err)
 		}
 
+		if err := decodeConflictDetail(&conflict, fields, resolvedOp); err != nil {
+			return nil, err
+		}
+
 		conflicts = append(conflicts, &conflict)
 	}
 
 	return conflicts, nil
 }
 
+// encodeConflictDetail encodes the unmerged fields and the merged operation
+// of a conflict, leaving the columns NULL when they are unset
+func encodeConflictDetail(conflict *Conflict) (fields, resolvedOp interface{}, err error) {
+	if len(conflict.Fields) > 0 {
+		data, err := json.Marshal(conflict.Fields)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal conflict fields: %w", err)
+		}
+		fields = data
+	}
+	if conflict.ResolvedOp != nil {
+		data, err := json.Marshal(conflict.ResolvedOp)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal resolved operation: %w", err)
+		}
+		resolvedOp = data
+	}
+	return fields, resolvedOp, nil
+}
+
+// decodeConflictDetail decodes the columns written by encodeConflictDetail
+func decodeConflictDetail(conflict *Conflict, fields, resolvedOp []byte) error {
+	if len(fields) > 0 {
+		if err := json.Unmarshal(fields, &conflict.Fields); err != nil {
+			return fmt.Errorf("failed to unmarshal conflict fields: %w", err)
+		}
+	}
+	if len(resolvedOp) > 0 {
+		conflict.ResolvedOp = &Operation{}
+		if err := json.Unmarshal(resolvedOp, conflict.ResolvedOp); err != nil {
+			return fmt.Errorf("failed to unmarshal resolved operation: %w", err)
+		}
+	}
+	return nil
+}
+
 // ==================== 锁管理 ====================
 
 // AcquireLock acquires a lock on a document
@@ -110,6 +110,8 @@ func setupTestDB(t *testing.T) *sql.DB {
 			resolved_by VARCHAR(255),
 			resolved_at TIMESTAMP,
 			description TEXT,
+			fields JSONB,
+			resolved_op JSONB,
 			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);
 		
@@ -461,6 +463,207 @@ func TestPostgresStore_AtomicVersionUpdate(t *testing.T) {
 	assert.Equal(t, uint64(2), retrieved.Version)
 }
 
+func TestPostgresStore_CommitOperation(t *testing.T) {
+	if !isPostgresAvailable(t) {
+		t.Skip("PostgreSQL not available, skipping test")
+	}
+
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	store, err := NewPostgresStore(&PostgresStoreConfig{
+		DB:     db,
+		Logger: zaptest.NewLogger(t),
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	docID, _ := guuid.NewV7()
+	doc := &Document{
+		ID:        docID,
+		Name:      "Commit Test",
+		Type:      DocumentTypeText,
+		Version:   1,
+		Content:   []byte("abc"),
+		CreatedBy: "user",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Metadata:  Metadata{},
+	}
+	err = store.CreateDocument(ctx, doc)
+	require.NoError(t, err)
+
+	opID, _ := guuid.NewV7()
+	sessionID, _ := guuid.NewV7()
+	op := &Operation{
+		ID:          opID,
+		DocID:       docID,
+		UserID:      "user",
+		SessionID:   sessionID,
+		Type:        OperationTypeText,
+		Data:        []byte(`[{"retain":3},{"insert":"d"}]`),
+		Timestamp:   time.Now(),
+		Version:     2,
+		PrevVersion: 1,
+		Status:      OperationStatusApplied,
+	}
+
+	// 版本、内容和操作记录在同一事务中提交
+	err = store.CommitOperation(ctx, op, 1, []byte("abcd"))
+	require.NoError(t, err)
+
+	retrieved, err := store.GetDocument(ctx, docID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), retrieved.Version)
+	assert.Equal(t, []byte("abcd"), retrieved.Content)
+
+	ops, err := store.GetOperationsByVersion(ctx, docID, 2, 2)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, opID, ops[0].ID)
+
+	// 版本冲突时回滚, 操作不被保存
+	otherID, _ := guuid.NewV7()
+	other := *op
+	other.ID = otherID
+	err = store.CommitOperation(ctx, &other, 1, []byte("xyz"))
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	_, err = store.GetOperation(ctx, otherID)
+	assert.Error(t, err, "版本冲突的操作不应被保存")
+}
+
+// partialConflict 用合并解决器在两个修改同一字段的操作上产生部分冲突
+func partialConflict(t *testing.T, docID guuid.UUID) *Conflict {
+	ops := make([]*Operation, 2)
+	for i, data := range []string{
+		`{"object": "A1", "props": {"value": 1, "bold": true}}`,
+		`{"object": "A1", "props": {"value": 2}}`,
+	} {
+		opID, _ := guuid.NewV7()
+		sessionID, _ := guuid.NewV7()
+		ops[i] = &Operation{
+			ID:          opID,
+			DocID:       docID,
+			UserID:      "user",
+			SessionID:   sessionID,
+			Type:        OperationTypeUpdate,
+			Data:        []byte(data),
+			Timestamp:   time.Now(),
+			PrevVersion: 1,
+			Status:      OperationStatusPending,
+		}
+	}
+
+	conflictID, _ := guuid.NewV7()
+	conflict := &Conflict{
+		ID:         conflictID,
+		DocID:      docID,
+		Ops:        ops,
+		Resolution: ConflictResolutionManual,
+	}
+	var partial *PartialConflictError
+	err := ResolveConflict(context.Background(), conflict, NewMergeConflictResolver(nil), "user")
+	require.ErrorAs(t, err, &partial)
+	return conflict
+}
+
+func TestConflictDetailEncoding(t *testing.T) {
+	docID, _ := guuid.NewV7()
+	conflict := partialConflict(t, docID)
+
+	fields, resolvedOp, err := encodeConflictDetail(conflict)
+	require.NoError(t, err)
+
+	var decoded Conflict
+	err = decodeConflictDetail(&decoded, fields.([]byte), resolvedOp.([]byte))
+	require.NoError(t, err)
+	assert.Equal(t, conflict.Fields, decoded.Fields)
+	require.NotNil(t, decoded.ResolvedOp)
+	assert.Equal(t, conflict.ResolvedOp.ID, decoded.ResolvedOp.ID)
+	assert.Equal(t, conflict.ResolvedOp.Data, decoded.ResolvedOp.Data)
+
+	// 未设置时写入NULL
+	fields, resolvedOp, err = encodeConflictDetail(&Conflict{})
+	require.NoError(t, err)
+	assert.Nil(t, fields)
+	assert.Nil(t, resolvedOp)
+}
+
+func TestPostgresStore_PartialConflict(t *testing.T) {
+	if !isPostgresAvailable(t) {
+		t.Skip("PostgreSQL not available, skipping test")
+	}
+
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	store, err := NewPostgresStore(&PostgresStoreConfig{
+		DB:     db,
+		Logger: zaptest.NewLogger(t),
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	docID, _ := guuid.NewV7()
+	doc := &Document{
+		ID:        docID,
+		Name:      "Conflict Test",
+		Type:      DocumentTypeSheet,
+		Version:   1,
+		Content:   []byte("{}"),
+		CreatedBy: "user",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Metadata:  Metadata{},
+	}
+	err = store.CreateDocument(ctx, doc)
+	require.NoError(t, err)
+
+	conflict := partialConflict(t, docID)
+	for _, op := range conflict.Ops {
+		err = store.CreateOperation(ctx, op)
+		require.NoError(t, err)
+	}
+
+	// 创建时即带有字段明细
+	err = store.CreateConflict(ctx, conflict)
+	require.NoError(t, err)
+
+	retrieved, err := store.GetConflict(ctx, conflict.ID)
+	require.NoError(t, err)
+	assert.Equal(t, conflict.Fields, retrieved.Fields)
+	require.NotNil(t, retrieved.ResolvedOp)
+	assert.Equal(t, conflict.ResolvedOp.ID, retrieved.ResolvedOp.ID)
+	assert.JSONEq(t, `[{"object":"A1","props":{"bold":true}}]`, string(retrieved.ResolvedOp.Data))
+	assert.Len(t, retrieved.Ops, 2)
+
+	// 人工解决后更新字段明细和合并结果
+	resolvedID, _ := guuid.NewV7()
+	conflict.Fields = nil
+	conflict.ResolvedOp = &Operation{
+		ID:     resolvedID,
+		DocID:  docID,
+		Type:   OperationTypeUpdate,
+		Data:   []byte(`[{"object":"A1","props":{"bold":true,"value":2}}]`),
+		Status: OperationStatusApplied,
+	}
+	conflict.ResolvedBy = "reviewer"
+	conflict.ResolvedAt = time.Now()
+	err = store.UpdateConflict(ctx, conflict)
+	require.NoError(t, err)
+
+	conflicts, err := store.ListConflicts(ctx, docID)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	assert.Empty(t, conflicts[0].Fields)
+	require.NotNil(t, conflicts[0].ResolvedOp)
+	assert.Equal(t, resolvedID, conflicts[0].ResolvedOp.ID)
+	assert.Equal(t, OperationStatusApplied, conflicts[0].ResolvedOp.Status)
+}
+
 func TestPostgresStore_Lock(t *testing.T) {
 	if !isPostgresAvailable(t) {
 		t.Skip("PostgreSQL not available, skipping test")
@@ -68,6 +68,11 @@ case $ACTION in
         echo "✅ Schema 创建成功"
         echo ""
         
+        # 冲突字段明细
+        echo "   应用 002_conflict_fields..."
+        PGPASSWORD=$DB_PASSWORD psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f deployments/postgres/migrations/002_conflict_fields.up.sql
+        echo ""
+        
         # 验证表
         echo "2️⃣  验证表结构..."
         TABLE_COUNT=$(PGPASSWORD=$DB_PASSWORD psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -t -c "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema='public' AND table_type='BASE TABLE';")
@@ -90,6 +95,7 @@ case $ACTION in
             exit 0
         fi
         
+        PGPASSWORD=$DB_PASSWORD psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f deployments/postgres/migrations/002_conflict_fields.down.sql
         PGPASSWORD=$DB_PASSWORD psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f deployments/postgres/migrations/001_initial_schema.down.sql
         echo "✅ 回滚完成"
         ;;
@@ -106,10 +112,12 @@ case $ACTION in
         fi
         
         # Down
+        PGPASSWORD=$DB_PASSWORD psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f deployments/postgres/migrations/002_conflict_fields.down.sql 2>/dev/null || true
         PGPASSWORD=$DB_PASSWORD psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f deployments/postgres/migrations/001_initial_schema.down.sql 2>/dev/null || true
         
         # Up
         PGPASSWORD=$DB_PASSWORD psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f deployments/postgres/migrations/001_initial_schema.up.sql
+        PGPASSWORD=$DB_PASSWORD psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f deployments/postgres/migrations/002_conflict_fields.up.sql
         
         echo "✅ 重置完成"
         ;;